@@ -0,0 +1,10 @@
+-- ============================================================
+-- Снапшоты живого мониторинга (агенты / звонки / очереди)
+-- Переживают рестарт API: восстанавливаются при старте
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS monitor_snapshots (
+    id       TEXT        PRIMARY KEY,          -- имя инстанса / ключ снапшота
+    data     JSONB       NOT NULL,
+    taken_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
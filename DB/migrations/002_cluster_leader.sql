@@ -0,0 +1,12 @@
+-- ============================================================
+-- Кластер API: текущий лидер (держатель AMI-подключения)
+-- Лидерство — pg_advisory_lock; таблица нужна фолловерам,
+-- чтобы знать куда пересылать /api/actions/*
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS cluster_leader (
+    id          INT         PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    instance_id TEXT        NOT NULL,
+    url         TEXT        NOT NULL,
+    elected_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,40 @@
+-- ============================================================
+-- Wrap-up (поствызывная обработка) и коды результата звонка
+-- ============================================================
+
+-- Длительность wrap-up по очередям (нет строки = без wrap-up)
+CREATE TABLE IF NOT EXISTS queue_wrapup_settings (
+    tenant_id      INT         NOT NULL,
+    queue          TEXT        NOT NULL,
+    wrapup_seconds INT         NOT NULL CHECK (wrapup_seconds >= 0),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, queue)
+);
+
+-- Каталог кодов результата (per tenant)
+CREATE TABLE IF NOT EXISTS crm_dispositions (
+    id         SERIAL      PRIMARY KEY,
+    tenant_id  INT         NOT NULL,
+    code       TEXT        NOT NULL,
+    name       TEXT        NOT NULL,
+    color      TEXT,
+    sort_order INT         NOT NULL DEFAULT 0,
+    active     BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, code)
+);
+
+-- Результат конкретного звонка (uniqueid = Linkedid звонка)
+CREATE TABLE IF NOT EXISTS call_dispositions (
+    uniqueid       TEXT        PRIMARY KEY,
+    tenant_id      INT         NOT NULL,
+    disposition_id INT         NOT NULL REFERENCES crm_dispositions(id),
+    agent          TEXT        NOT NULL,          -- SIP номер агента
+    user_id        INT         NOT NULL,
+    queue          TEXT,
+    note           TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_call_dispositions_tenant_created
+    ON call_dispositions (tenant_id, created_at);
@@ -0,0 +1,18 @@
+-- ============================================================
+-- Кастомные статусы агентов (каталог per tenant)
+-- ============================================================
+
+-- pauses_queue: TRUE — статус снимает агента с очередей (QueuePause),
+-- FALSE — агент остаётся доступен для звонков очереди
+CREATE TABLE IF NOT EXISTS agent_statuses (
+    id           SERIAL      PRIMARY KEY,
+    tenant_id    INT         NOT NULL,
+    code         TEXT        NOT NULL,
+    name         TEXT        NOT NULL,
+    color        TEXT,
+    pauses_queue BOOLEAN     NOT NULL DEFAULT TRUE,
+    sort_order   INT         NOT NULL DEFAULT 0,
+    active       BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, code)
+);
@@ -0,0 +1,25 @@
+-- ============================================================
+-- Итоговые записи звонков из живого мониторинга (пишет лидер на Hangup)
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS calls (
+    tenant_id    INT         NOT NULL,
+    uniqueid     TEXT        NOT NULL,          -- Linkedid звонка
+    direction    TEXT,                          -- inbound / outbound / internal
+    src          TEXT,
+    dst          TEXT,
+    queue        TEXT,
+    agent        TEXT,                          -- SIP номер ответившего агента
+    bridge_id    TEXT,
+    started_at   TIMESTAMPTZ NOT NULL,
+    answered_at  TIMESTAMPTZ,
+    ended_at     TIMESTAMPTZ NOT NULL,
+    wait_seconds INT         NOT NULL DEFAULT 0,
+    talk_seconds INT         NOT NULL DEFAULT 0,
+    hold_seconds INT         NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, uniqueid)
+);
+
+CREATE INDEX IF NOT EXISTS ix_calls_tenant_started ON calls (tenant_id, started_at);
+CREATE INDEX IF NOT EXISTS ix_calls_tenant_agent   ON calls (tenant_id, agent, started_at);
+CREATE INDEX IF NOT EXISTS ix_calls_tenant_queue   ON calls (tenant_id, queue, started_at);
@@ -0,0 +1,16 @@
+-- ============================================================
+-- Индекс записей разговоров: где и в каком формате лежит файл
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS recordings (
+    uniqueid         TEXT        PRIMARY KEY,
+    tenant_id        INT,
+    backend          TEXT        NOT NULL,      -- fs / http / s3
+    location         TEXT        NOT NULL,      -- ключ внутри хранилища
+    format           TEXT        NOT NULL,      -- wav / mp3 / gsm / ogg
+    size_bytes       BIGINT,
+    duration_seconds INT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_recordings_tenant_created ON recordings (tenant_id, created_at);
@@ -0,0 +1,48 @@
+-- ============================================================
+-- Сроки хранения записей разговоров, legal hold и журнал удаления
+-- ============================================================
+
+-- Политики хранения. Без queue/disposition_id — политика тенанта по умолчанию;
+-- для звонка действует самая узкая подходящая: disposition > queue > тенант.
+CREATE TABLE IF NOT EXISTS recording_retention_policies (
+    id             SERIAL      PRIMARY KEY,
+    tenant_id      INT         NOT NULL,
+    queue          TEXT,
+    disposition_id INT         REFERENCES crm_dispositions(id) ON DELETE CASCADE,
+    retain_days    INT         NOT NULL CHECK (retain_days > 0),
+    active         BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_recording_retention_scope
+    ON recording_retention_policies (tenant_id, COALESCE(queue, ''), COALESCE(disposition_id, 0));
+
+-- Записи, которые нельзя удалять (судебные/претензионные разбирательства)
+CREATE TABLE IF NOT EXISTS recording_legal_holds (
+    uniqueid   TEXT        PRIMARY KEY,
+    tenant_id  INT         NOT NULL,
+    reason     TEXT,
+    created_by INT,                               -- users.id
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_recording_legal_holds_tenant ON recording_legal_holds (tenant_id);
+
+-- Журнал удаления записей по политикам хранения
+CREATE TABLE IF NOT EXISTS recording_purge_log (
+    id          BIGSERIAL   PRIMARY KEY,
+    tenant_id   INT         NOT NULL,
+    uniqueid    TEXT        NOT NULL,
+    policy_id   INT,
+    retain_days INT         NOT NULL,
+    call_date   TIMESTAMPTZ NOT NULL,
+    backend     TEXT,
+    location    TEXT,
+    size_bytes  BIGINT,
+    status      TEXT        NOT NULL,             -- deleted / missing / failed
+    error       TEXT,
+    purged_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_recording_purge_log_tenant ON recording_purge_log (tenant_id, purged_at);
+CREATE INDEX IF NOT EXISTS ix_recording_purge_log_uniqueid ON recording_purge_log (uniqueid);
@@ -0,0 +1,22 @@
+-- ============================================================
+-- Выгрузка записей разговоров в ZIP по фильтру отчёта звонков
+-- ============================================================
+
+-- Задания выполняет лидер по очереди; архив лежит на его диске до expires_at
+CREATE TABLE IF NOT EXISTS recording_exports (
+    id          BIGSERIAL   PRIMARY KEY,
+    tenant_id   INT         NOT NULL,
+    user_id     INT         NOT NULL,
+    filters     JSONB       NOT NULL,             -- CDRFilter: dateFrom, dateTo, src, dst, disposition
+    status      TEXT        NOT NULL DEFAULT 'queued', -- queued / running / done / failed / expired
+    total       INT         NOT NULL DEFAULT 0,   -- звонков с записью по фильтру
+    processed   INT         NOT NULL DEFAULT 0,
+    missing     INT         NOT NULL DEFAULT 0,   -- файла записи нет в хранилище
+    size_bytes  BIGINT,
+    error       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ,
+    expires_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS ix_recording_exports_tenant ON recording_exports (tenant_id, created_at);
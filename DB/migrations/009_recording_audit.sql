@@ -0,0 +1,18 @@
+-- ============================================================
+-- Журнал доступа к записям разговоров: кто, когда и откуда слушал
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS recording_audit (
+    id         BIGSERIAL   PRIMARY KEY,
+    tenant_id  INT,
+    user_id    INT,                               -- users.id (для подписанной ссылки — кто её выпустил)
+    uniqueid   TEXT        NOT NULL,
+    action     TEXT        NOT NULL,              -- stream / link / play
+    format     TEXT,                              -- ?format=mp3|opus, NULL — оригинал
+    ip         TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_recording_audit_tenant_created ON recording_audit (tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS ix_recording_audit_uniqueid       ON recording_audit (uniqueid, created_at);
@@ -0,0 +1,26 @@
+-- ============================================================
+-- Внешние ссылки на записи (спор с клиентом, юристы): срок, лимит
+-- скачиваний, пароль, отзыв. /play проверяет состояние ссылки здесь.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS recording_shares (
+    id             BIGSERIAL   PRIMARY KEY,
+    tenant_id      INT         NOT NULL,
+    uniqueid       TEXT        NOT NULL,
+    note           TEXT,                          -- кому и зачем выдана
+    password_hash  TEXT,                          -- bcrypt, NULL — без пароля
+    max_downloads  INT,                           -- NULL — без ограничения
+    downloads      INT         NOT NULL DEFAULT 0,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    created_by     INT         NOT NULL,          -- users.id
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_access_at TIMESTAMPTZ,
+    revoked_at     TIMESTAMPTZ,
+    revoked_by     INT
+);
+
+CREATE INDEX IF NOT EXISTS ix_recording_shares_tenant   ON recording_shares (tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS ix_recording_shares_uniqueid ON recording_shares (uniqueid);
+
+-- Прослушивания по внешней ссылке попадают в аудит с её id
+ALTER TABLE recording_audit ADD COLUMN IF NOT EXISTS share_id BIGINT;
@@ -0,0 +1,44 @@
+-- ============================================================
+-- Расшифровки записей разговоров: очередь заданий, сегменты и
+-- полнотекстовый поиск
+-- ============================================================
+
+-- Очередь распознавания (по одной строке на звонок). Выполняет лидер.
+CREATE TABLE IF NOT EXISTS transcription_jobs (
+    uniqueid    TEXT        PRIMARY KEY,
+    tenant_id   INT         NOT NULL,
+    status      TEXT        NOT NULL DEFAULT 'queued', -- queued / running / done / failed / skipped
+    attempts    INT         NOT NULL DEFAULT 0,
+    error       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at  TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS ix_transcription_jobs_status ON transcription_jobs (status, created_at);
+
+-- Расшифровка целиком. Конфигурация 'simple' — без стемминга: звонки
+-- на русском, таджикском и английском вперемешку.
+CREATE TABLE IF NOT EXISTS transcripts (
+    uniqueid   TEXT        PRIMARY KEY,
+    tenant_id  INT         NOT NULL,
+    engine     TEXT        NOT NULL,
+    language   TEXT,
+    text       TEXT        NOT NULL,
+    tsv        TSVECTOR    GENERATED ALWAYS AS (to_tsvector('simple', text)) STORED,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_transcripts_tenant ON transcripts (tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS ix_transcripts_tsv    ON transcripts USING GIN (tsv);
+
+-- Сегменты с таймкодами (для подсветки в плеере)
+CREATE TABLE IF NOT EXISTS transcript_segments (
+    uniqueid  TEXT  NOT NULL REFERENCES transcripts(uniqueid) ON DELETE CASCADE,
+    seq       INT   NOT NULL,
+    speaker   TEXT,                               -- NULL — не определён
+    start_sec REAL  NOT NULL,
+    end_sec   REAL  NOT NULL,
+    text      TEXT  NOT NULL,
+    PRIMARY KEY (uniqueid, seq)
+);
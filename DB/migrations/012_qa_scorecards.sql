@@ -0,0 +1,79 @@
+-- ============================================================
+-- Оценка качества звонков (QA): шаблоны анкет, оценки звонков,
+-- ознакомление агента. Отчёты строятся по qa_evaluations/qa_answers.
+-- ============================================================
+
+-- Шаблон анкеты (per tenant). Шаблон с оценками не редактируется по
+-- структуре — только деактивируется и копируется.
+CREATE TABLE IF NOT EXISTS qa_templates (
+    id          SERIAL       PRIMARY KEY,
+    tenant_id   INT          NOT NULL,
+    name        TEXT         NOT NULL,
+    description TEXT,
+    pass_score  NUMERIC(5,2) NOT NULL DEFAULT 80 CHECK (pass_score BETWEEN 0 AND 100),
+    active      BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_by  INT,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS qa_sections (
+    id          SERIAL PRIMARY KEY,
+    template_id INT    NOT NULL REFERENCES qa_templates(id) ON DELETE CASCADE,
+    name        TEXT   NOT NULL,
+    sort_order  INT    NOT NULL DEFAULT 0
+);
+
+-- Вопрос: балл 0..max_score с весом. auto_fail — критичный пункт:
+-- 0 баллов по нему обнуляет всю оценку.
+CREATE TABLE IF NOT EXISTS qa_questions (
+    id          SERIAL       PRIMARY KEY,
+    template_id INT          NOT NULL REFERENCES qa_templates(id) ON DELETE CASCADE,
+    section_id  INT          NOT NULL REFERENCES qa_sections(id) ON DELETE CASCADE,
+    text        TEXT         NOT NULL,
+    hint        TEXT,
+    weight      NUMERIC(6,2) NOT NULL DEFAULT 1 CHECK (weight >= 0),
+    max_score   INT          NOT NULL DEFAULT 1 CHECK (max_score > 0),
+    auto_fail   BOOLEAN      NOT NULL DEFAULT FALSE,
+    allow_na    BOOLEAN      NOT NULL DEFAULT FALSE,
+    sort_order  INT          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS ix_qa_questions_template ON qa_questions (template_id);
+
+-- Оценка звонка. score — итог в процентах (0 при auto_failed).
+-- status: pending (ждёт агента) → acknowledged / disputed
+CREATE TABLE IF NOT EXISTS qa_evaluations (
+    id              BIGSERIAL    PRIMARY KEY,
+    tenant_id       INT          NOT NULL,
+    template_id     INT          NOT NULL REFERENCES qa_templates(id),
+    uniqueid        TEXT         NOT NULL,
+    agent_id        INT          NOT NULL,          -- users.id оцениваемого
+    evaluator_id    INT          NOT NULL,          -- users.id супервизора
+    score           NUMERIC(5,2) NOT NULL,
+    auto_failed     BOOLEAN      NOT NULL DEFAULT FALSE,
+    passed          BOOLEAN      NOT NULL,
+    comment         TEXT,
+    status          TEXT         NOT NULL DEFAULT 'pending',
+    agent_comment   TEXT,
+    acknowledged_at TIMESTAMPTZ,
+    call_date       TIMESTAMPTZ,                    -- из ast_cdr, для отчётов по времени
+    created_at      TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_qa_evaluations_tenant   ON qa_evaluations (tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS ix_qa_evaluations_agent    ON qa_evaluations (agent_id, created_at);
+CREATE INDEX IF NOT EXISTS ix_qa_evaluations_uniqueid ON qa_evaluations (uniqueid);
+
+-- Ответ на вопрос; score NULL — «неприменимо» (allow_na)
+CREATE TABLE IF NOT EXISTS qa_answers (
+    evaluation_id BIGINT NOT NULL REFERENCES qa_evaluations(id) ON DELETE CASCADE,
+    question_id   INT    NOT NULL REFERENCES qa_questions(id),
+    score         INT,
+    comment       TEXT,
+    PRIMARY KEY (evaluation_id, question_id)
+);
+
+CREATE INDEX IF NOT EXISTS ix_qa_answers_question ON qa_answers (question_id);
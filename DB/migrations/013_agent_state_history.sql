@@ -0,0 +1,17 @@
+-- ============================================================
+-- История состояний агентов (пишет лидер на каждый переход).
+-- Интервал состояния — от changed_at до следующей строки агента.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS agent_state_history (
+    id          BIGSERIAL   PRIMARY KEY,
+    tenant_id   INT         NOT NULL,
+    agent       TEXT        NOT NULL,          -- SIP номер агента (users.sipno)
+    status      TEXT        NOT NULL,          -- offline / idle / ringing / in-call / wrapup / paused
+    presence    TEXT,                          -- статус по телефонии
+    manual_code TEXT,                          -- ручной статус (agent_statuses.code / пауза)
+    changed_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_agent_state_history_agent
+    ON agent_state_history (tenant_id, agent, changed_at);
@@ -0,0 +1,47 @@
+-- ============================================================
+-- Рассылка отчётов по расписанию: расписания (cron в поясе тенанта)
+-- и история отправок. Расписания выполняет лидер.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS report_schedules (
+    id          SERIAL      PRIMARY KEY,
+    tenant_id   INT         NOT NULL,
+    name        TEXT        NOT NULL,
+    report      TEXT        NOT NULL,                  -- calls-summary / agents / calls
+    format      TEXT        NOT NULL DEFAULT 'pdf',    -- csv / pdf (calls — только csv)
+    cron        TEXT        NOT NULL,                  -- "мин час день месяц день_недели" или @daily / @weekly / …
+    timezone    TEXT        NOT NULL DEFAULT 'UTC',    -- IANA пояс cron и периода отчёта
+    period      TEXT        NOT NULL DEFAULT 'day',    -- day / week / month: предыдущий полный период
+    recipients  TEXT[]      NOT NULL,
+    active      BOOLEAN     NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ,                           -- NULL — расписание выключено
+    last_run_at TIMESTAMPTZ,
+    created_by  INT         NOT NULL,                  -- от его имени строится отчёт
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS ix_report_schedules_due
+    ON report_schedules (next_run_at) WHERE active;
+
+CREATE TABLE IF NOT EXISTS report_deliveries (
+    id          BIGSERIAL   PRIMARY KEY,
+    tenant_id   INT         NOT NULL,
+    schedule_id INT         REFERENCES report_schedules(id) ON DELETE SET NULL,
+    trigger     TEXT        NOT NULL,                  -- schedule / manual
+    status      TEXT        NOT NULL,                  -- sent / failed
+    recipients  TEXT[]      NOT NULL,
+    period_from TIMESTAMPTZ NOT NULL,
+    period_to   TIMESTAMPTZ NOT NULL,
+    file_name   TEXT,
+    size_bytes  INT,
+    error       TEXT,
+    created_by  INT,                                   -- кто нажал «отправить сейчас»
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ix_report_deliveries_tenant
+    ON report_deliveries (tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS ix_report_deliveries_schedule
+    ON report_deliveries (schedule_id, created_at);
@@ -0,0 +1,6 @@
+-- ============================================================
+-- Путь звонка: ноги ast_cdr одного звонка (IVR, очередь, попытки
+-- агентам, переводы) группируются по linkedid
+-- ============================================================
+
+CREATE INDEX IF NOT EXISTS ix_ast_cdr_linkedid ON ast_cdr (linkedid);
@@ -0,0 +1,38 @@
+-- ============================================================
+-- Владелец строки CDR фиксируется при записи: tenant_id и агент
+-- (users.id) ставит триггер на INSERT. Отчёты фильтруют по tenant_id
+-- вместо поиска users по sipno — звонок остаётся у тенанта, даже если
+-- агента потом удалили или перевели в другую компанию.
+-- Строки, записанные до миграции, проставляет миграция 022
+-- ============================================================
+
+ALTER TABLE ast_cdr ADD COLUMN IF NOT EXISTS tenant_id     INT;
+ALTER TABLE ast_cdr ADD COLUMN IF NOT EXISTS agent_user_id INT;  -- без FK: пользователя могут удалить
+
+-- Владелец по номерам звонка: пользователь на стороне src (исходящий),
+-- иначе на стороне dst. Нет пользователя — обе колонки NULL.
+CREATE OR REPLACE FUNCTION ast_cdr_owner(p_src TEXT, p_dst TEXT, OUT tenant_id INT, OUT user_id INT) AS $$
+    SELECT u.tenant_id, u.id FROM users u
+    WHERE u.tenant_id IS NOT NULL AND u.sipno::text IN (p_src, p_dst)
+    ORDER BY (u.sipno::text = p_src) DESC
+    LIMIT 1
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION ast_cdr_stamp_tenant() RETURNS trigger AS $$
+BEGIN
+    IF NEW.tenant_id IS NULL THEN
+        SELECT o.tenant_id, o.user_id INTO NEW.tenant_id, NEW.agent_user_id
+        FROM ast_cdr_owner(NEW.src, NEW.dst) o;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_ast_cdr_stamp_tenant ON ast_cdr;
+CREATE TRIGGER trg_ast_cdr_stamp_tenant
+    BEFORE INSERT ON ast_cdr
+    FOR EACH ROW EXECUTE FUNCTION ast_cdr_stamp_tenant();
+
+-- На большой ast_cdr лучше создать вручную с CONCURRENTLY до применения миграции
+CREATE INDEX IF NOT EXISTS ix_ast_cdr_tenant_calldate ON ast_cdr (tenant_id, calldate);
+CREATE INDEX IF NOT EXISTS ix_ast_cdr_agent_calldate  ON ast_cdr (agent_user_id, calldate);
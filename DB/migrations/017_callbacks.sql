@@ -0,0 +1,47 @@
+-- ============================================================
+-- Перезвоны: пропущенные и брошенные входящие (таблица calls) собираются
+-- в список по номеру звонящего. Пока по номеру есть открытая заявка, новые
+-- пропущенные добавляются в неё. Отвеченный позже звонок с этим номером
+-- (входящий или исходящий) закрывает заявку автоматически. Список ведёт лидер.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS callbacks (
+    id              BIGSERIAL   PRIMARY KEY,
+    tenant_id       INT         NOT NULL,
+    number          TEXT        NOT NULL,                  -- номер звонящего, только цифры
+    status          TEXT        NOT NULL DEFAULT 'open',   -- open / claimed / resolved / auto_closed
+    reason          TEXT        NOT NULL,                  -- последний пропуск: missed / abandoned
+    queue           TEXT,                                  -- очередь последнего пропуска
+    miss_count      INT         NOT NULL DEFAULT 1,
+    first_missed_at TIMESTAMPTZ NOT NULL,                  -- от него считается SLA
+    last_missed_at  TIMESTAMPTZ NOT NULL,
+    last_call_id    TEXT        NOT NULL,                  -- calls.uniqueid последнего пропуска
+    attempts        INT         NOT NULL DEFAULT 0,        -- перезвоны из списка (originate)
+    last_attempt_at TIMESTAMPTZ,
+    claimed_by      INT,
+    claimed_at      TIMESTAMPTZ,
+    resolved_by     INT,                                   -- NULL при auto_closed
+    resolved_at     TIMESTAMPTZ,
+    resolved_call   TEXT,                                  -- calls.uniqueid отвеченного звонка (auto_closed)
+    note            TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Одна открытая заявка на номер (с 023 — на callbacks.match_key)
+CREATE UNIQUE INDEX IF NOT EXISTS ux_callbacks_active_number
+    ON callbacks (tenant_id, number) WHERE status IN ('open', 'claimed');
+CREATE INDEX IF NOT EXISTS ix_callbacks_tenant_status
+    ON callbacks (tenant_id, status, first_missed_at);
+
+-- Пропущенные звонки заявки; заодно отметка «звонок уже учтён»
+CREATE TABLE IF NOT EXISTS callback_calls (
+    tenant_id   INT    NOT NULL,
+    uniqueid    TEXT   NOT NULL,                           -- calls.uniqueid
+    callback_id BIGINT NOT NULL REFERENCES callbacks(id) ON DELETE CASCADE,
+    PRIMARY KEY (tenant_id, uniqueid)
+);
+
+CREATE INDEX IF NOT EXISTS ix_callback_calls_callback ON callback_calls (callback_id);
+
+-- Сканирование завершённых звонков лидером
+CREATE INDEX IF NOT EXISTS ix_calls_ended ON calls (ended_at);
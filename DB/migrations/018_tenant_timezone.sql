@@ -0,0 +1,7 @@
+-- ============================================================
+-- Часовой пояс компании: в нём группируются отчёты, читаются даты
+-- фильтров без смещения (dateFrom=2025-03-01) и форматируются даты
+-- выгрузок. Данные по-прежнему хранятся в UTC.
+-- ============================================================
+
+ALTER TABLE crm_tenants ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';  -- IANA: Asia/Dushanbe
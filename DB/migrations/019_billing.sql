@@ -0,0 +1,53 @@
+-- ============================================================
+-- Биллинг компаний по тарифу: за календарный месяц (в поясе компании)
+-- начисляются абонентская плата тарифа, операторы сверх max_operators
+-- и исходящие минуты из ast_cdr. Счета с позициями формирует лидер
+-- после закрытия месяца; оплату отмечает суперадмин.
+-- ============================================================
+
+-- Цены тарифа сверх абонентской платы
+ALTER TABLE crm_tarrifs ADD COLUMN IF NOT EXISTS extra_operator_fee    NUMERIC(12,2) NOT NULL DEFAULT 0;  -- за оператора сверх max_operators в месяц
+ALTER TABLE crm_tarrifs ADD COLUMN IF NOT EXISTS outbound_minute_price NUMERIC(12,4) NOT NULL DEFAULT 0;  -- за начатую минуту исходящего
+
+-- Число операторов компании по дням: лидер обновляет раз в час,
+-- в счёт идёт максимум за месяц
+CREATE TABLE IF NOT EXISTS billing_operator_counts (
+    tenant_id INT  NOT NULL,
+    day       DATE NOT NULL,                               -- в поясе компании
+    operators INT  NOT NULL,
+    PRIMARY KEY (tenant_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id          BIGSERIAL     PRIMARY KEY,
+    tenant_id   INT           NOT NULL,
+    number      TEXT          NOT NULL UNIQUE,             -- 202609-0012: месяц и тенант
+    period      DATE          NOT NULL,                    -- первое число месяца
+    tenant_name TEXT          NOT NULL,                    -- реквизиты на момент формирования
+    tax_id      TEXT,
+    tariff_id   INT,
+    tariff_name TEXT,
+    timezone    TEXT          NOT NULL,                    -- пояс, в котором считался месяц
+    currency    TEXT          NOT NULL,
+    total       NUMERIC(12,2) NOT NULL,
+    status      TEXT          NOT NULL DEFAULT 'unpaid',   -- unpaid / paid
+    paid_at     TIMESTAMPTZ,
+    paid_by     INT,
+    note        TEXT,
+    created_at  TIMESTAMPTZ   NOT NULL DEFAULT NOW(),      -- последнее формирование
+    UNIQUE (tenant_id, period)
+);
+
+CREATE INDEX IF NOT EXISTS ix_invoices_period ON invoices (period DESC, tenant_id);
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+    id          BIGSERIAL     PRIMARY KEY,
+    invoice_id  BIGINT        NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+    position    INT           NOT NULL,
+    kind        TEXT          NOT NULL,                    -- tariff / operators / outbound
+    description TEXT          NOT NULL,
+    quantity    NUMERIC(12,2) NOT NULL,
+    unit_price  NUMERIC(12,4) NOT NULL,
+    amount      NUMERIC(12,2) NOT NULL,
+    UNIQUE (invoice_id, position)
+);
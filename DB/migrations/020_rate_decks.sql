@@ -0,0 +1,64 @@
+-- ============================================================
+-- Тарификация исходящих по направлениям: у тарифа — сетка цен по
+-- префиксам номера (самый длинный совпавший префикс). Отвеченный
+-- исходящий звонок оценивается при записи в ast_cdr тем же триггером,
+-- что ставит владельца (016): тенант → его тариф → префикс dst.
+-- Цена фиксируется в строке: новая сетка меняет только новые звонки,
+-- старые пересчитываются явно (POST /api/tariffs/{id}/rates/rerate).
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS rate_deck (
+    tariff_id        INT           NOT NULL REFERENCES crm_tarrifs(id) ON DELETE CASCADE,
+    prefix           TEXT          NOT NULL,                -- только цифры: 99290, 7, 1212
+    destination      TEXT          NOT NULL DEFAULT '',     -- Таджикистан моб. (Tcell)
+    price_per_minute NUMERIC(12,4) NOT NULL,
+    increment        INT           NOT NULL DEFAULT 60,     -- шаг тарификации, с: 60 — поминутно, 1 — посекундно
+    connection_fee   NUMERIC(12,4) NOT NULL DEFAULT 0,      -- за отвеченный звонок
+    updated_at       TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tariff_id, prefix),
+    CHECK (prefix ~ '^[0-9]+$' AND increment > 0)
+);
+
+ALTER TABLE ast_cdr ADD COLUMN IF NOT EXISTS rate_prefix   TEXT;           -- совпавший префикс сетки
+ALTER TABLE ast_cdr ADD COLUMN IF NOT EXISTS rated_seconds INT;            -- billsec, округлённый вверх до шага
+ALTER TABLE ast_cdr ADD COLUMN IF NOT EXISTS cost          NUMERIC(12,4);  -- NULL — не исходящий или префикса нет в сетке
+
+-- Оценка звонка по сетке тарифа тенанта. Исходящий — с номера пользователя
+-- тенанта на номер, не принадлежащий тенанту (как направление в отчётах).
+-- Нет совпадения — все поля NULL.
+CREATE OR REPLACE FUNCTION ast_cdr_rating(p_tenant_id INT, p_src TEXT, p_dst TEXT, p_billsec INT,
+                                          OUT prefix TEXT, OUT seconds INT, OUT cost NUMERIC) AS $$
+    SELECT r.prefix,
+           (CEIL(p_billsec::numeric / r.increment) * r.increment)::int,
+           ROUND(r.connection_fee
+                 + CEIL(p_billsec::numeric / r.increment) * r.increment / 60.0 * r.price_per_minute, 4)
+    FROM crm_tenants t
+    JOIN rate_deck r ON r.tariff_id = t.tariff_id
+    WHERE t.tenant_id = p_tenant_id
+      AND p_billsec > 0
+      AND EXISTS (SELECT 1 FROM users u WHERE u.sipno::text = p_src AND u.tenant_id = p_tenant_id)
+      AND NOT EXISTS (SELECT 1 FROM users u WHERE u.sipno::text = p_dst AND u.tenant_id = p_tenant_id)
+      -- Все префиксы номера: точное совпадение по ключу вместо LIKE по всей сетке
+      AND r.prefix IN (
+          SELECT left(n.d, i)
+          FROM (SELECT regexp_replace(p_dst, '\D', '', 'g') AS d) n, generate_series(1, length(n.d)) i
+      )
+    ORDER BY length(r.prefix) DESC
+    LIMIT 1
+$$ LANGUAGE sql STABLE;
+
+-- Триггер владельца из 016 дополнен оценкой: она нужна уже с tenant_id
+CREATE OR REPLACE FUNCTION ast_cdr_stamp_tenant() RETURNS trigger AS $$
+BEGIN
+    IF NEW.tenant_id IS NULL THEN
+        SELECT o.tenant_id, o.user_id INTO NEW.tenant_id, NEW.agent_user_id
+        FROM ast_cdr_owner(NEW.src, NEW.dst) o;
+    END IF;
+    IF NEW.tenant_id IS NOT NULL AND NEW.cost IS NULL
+       AND NEW.disposition = 'ANSWERED' AND NEW.lastapp IS DISTINCT FROM 'Hangup' THEN
+        SELECT r.prefix, r.seconds, r.cost INTO NEW.rate_prefix, NEW.rated_seconds, NEW.cost
+        FROM ast_cdr_rating(NEW.tenant_id, NEW.src, NEW.dst, NEW.billsec) r;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
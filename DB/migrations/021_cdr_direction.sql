@@ -0,0 +1,39 @@
+-- ============================================================
+-- Направление звонка фиксируется при записи вместе с владельцем (016):
+-- отчёты и биллинг отбирают исходящие по ast_cdr.direction, а не
+-- поиском users по sipno на каждую строку.
+-- Строки, записанные до миграции, проставляет миграция 022
+-- ============================================================
+
+ALTER TABLE ast_cdr ADD COLUMN IF NOT EXISTS direction TEXT;  -- outbound / inbound / internal, NULL — без владельца
+
+-- Направление для тенанта владельца: по тому, чьи номера src и dst
+-- (как direction в отчётах и ast_cdr_rating)
+CREATE OR REPLACE FUNCTION ast_cdr_direction(p_tenant_id INT, p_src TEXT, p_dst TEXT) RETURNS TEXT AS $$
+    SELECT CASE
+               WHEN s AND d THEN 'internal'
+               WHEN s       THEN 'outbound'
+               WHEN d       THEN 'inbound'
+           END
+    FROM (SELECT EXISTS (SELECT 1 FROM users u WHERE u.sipno::text = p_src AND u.tenant_id = p_tenant_id) AS s,
+                 EXISTS (SELECT 1 FROM users u WHERE u.sipno::text = p_dst AND u.tenant_id = p_tenant_id) AS d) x
+$$ LANGUAGE sql STABLE;
+
+-- Триггер владельца из 016/020 дополнен направлением
+CREATE OR REPLACE FUNCTION ast_cdr_stamp_tenant() RETURNS trigger AS $$
+BEGIN
+    IF NEW.tenant_id IS NULL THEN
+        SELECT o.tenant_id, o.user_id INTO NEW.tenant_id, NEW.agent_user_id
+        FROM ast_cdr_owner(NEW.src, NEW.dst) o;
+    END IF;
+    IF NEW.tenant_id IS NOT NULL AND NEW.direction IS NULL THEN
+        NEW.direction := ast_cdr_direction(NEW.tenant_id, NEW.src, NEW.dst);
+    END IF;
+    IF NEW.tenant_id IS NOT NULL AND NEW.cost IS NULL AND NEW.direction = 'outbound'
+       AND NEW.disposition = 'ANSWERED' AND NEW.lastapp IS DISTINCT FROM 'Hangup' THEN
+        SELECT r.prefix, r.seconds, r.cost INTO NEW.rate_prefix, NEW.rated_seconds, NEW.cost
+        FROM ast_cdr_rating(NEW.tenant_id, NEW.src, NEW.dst, NEW.billsec) r;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
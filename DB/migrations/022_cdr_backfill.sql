@@ -0,0 +1,64 @@
+-- ============================================================
+-- Владелец и направление строк ast_cdr, записанных до триггера (016, 021).
+-- Без этого отчёты, записи и биллинг (фильтр по ast_cdr.tenant_id)
+-- не видят историю звонков тенанта.
+--
+-- Тенант берётся в первую очередь из calls (пишется при завершении звонка,
+-- тенант на момент звонка), иначе — по текущим номерам users (ast_cdr_owner).
+-- Агент — пользователь этого тенанта с номером src/dst, направление —
+-- по текущим номерам тенанта, иначе направление звонка из calls.
+--
+-- Что восстановить нельзя:
+--   * звонки без записи в calls, чьи номера уже не принадлежат ни одному
+--     пользователю (агент удалён, номер освобождён) — остаются без tenant_id
+--     и не видны в отчётах;
+--   * звонки без записи в calls по номеру, который перешёл в другой тенант, —
+--     достаются текущему владельцу номера;
+--   * agent_user_id — текущий владелец номера в тенанте: после переназначения
+--     номера звонок засчитывается новому агенту, удалённый агент — NULL;
+--   * direction по ногам звонка, чьи номера уже не принадлежат тенанту, —
+--     направление всего звонка из calls или NULL.
+--
+-- Повторный проход по оставшимся строкам (например, после восстановления
+-- пользователя): go run ./cmd/cdr-backfill
+-- ============================================================
+
+CREATE OR REPLACE FUNCTION ast_cdr_backfill(p_after BIGINT, p_limit INT,
+    OUT last_id BIGINT, OUT scanned INT, OUT stamped INT) AS $$
+    WITH b AS (
+        SELECT id, src, dst, linkedid, tenant_id, agent_user_id, direction FROM ast_cdr
+        WHERE (tenant_id IS NULL OR direction IS NULL) AND id > p_after
+        ORDER BY id LIMIT p_limit
+    ),
+    owned AS (
+        SELECT b.id, b.src, b.dst, b.tenant_id AS stamped_tenant, b.agent_user_id, b.direction,
+               COALESCE(b.tenant_id, h.tenant_id, o.tenant_id) AS tenant_id,
+               CASE WHEN h.tenant_id = COALESCE(b.tenant_id, h.tenant_id) THEN h.direction END AS call_direction
+        FROM b
+        -- Звонок мог попасть в calls нескольких тенантов — тогда calls не помогает
+        LEFT JOIN LATERAL (
+            SELECT MIN(k.tenant_id) AS tenant_id, MIN(k.direction) AS direction FROM calls k
+            WHERE k.uniqueid = b.linkedid
+            HAVING COUNT(*) = 1
+        ) h ON TRUE
+        LEFT JOIN LATERAL ast_cdr_owner(b.src, b.dst) o ON b.tenant_id IS NULL AND h.tenant_id IS NULL
+    ),
+    upd AS (
+        UPDATE ast_cdr c SET
+            tenant_id     = w.tenant_id,
+            agent_user_id = CASE WHEN w.stamped_tenant IS NOT NULL THEN w.agent_user_id ELSE (
+                                SELECT u.id FROM users u
+                                WHERE u.tenant_id = w.tenant_id AND u.sipno::text IN (w.src, w.dst)
+                                ORDER BY (u.sipno::text = w.src) DESC
+                                LIMIT 1) END,
+            direction     = COALESCE(w.direction, ast_cdr_direction(w.tenant_id, w.src, w.dst), w.call_direction)
+        FROM owned w
+        WHERE c.id = w.id AND w.tenant_id IS NOT NULL
+        RETURNING 1
+    )
+    SELECT (SELECT MAX(id) FROM b), (SELECT COUNT(*)::int FROM b), (SELECT COUNT(*)::int FROM upd)
+$$ LANGUAGE sql;
+
+-- Вся история одним проходом. На большой ast_cdr миграция долгая
+-- (строки обновляются в одной транзакции) — применять в окно обслуживания.
+SELECT ast_cdr_backfill(0, NULL);
@@ -0,0 +1,43 @@
+-- ============================================================
+-- Перезвоны: один номер звонящего — одна открытая заявка, в каком бы
+-- формате он ни пришёл (992901234567 и 901234567). Заявки и автозакрытие
+-- сравнивают номер по последним 9 цифрам (callbackMatchDigits в Go).
+-- ============================================================
+
+ALTER TABLE callbacks ADD COLUMN IF NOT EXISTS match_key TEXT
+    GENERATED ALWAYS AS (right(number, 9)) STORED;
+
+-- Открытые заявки одного номера в разных форматах сливаются в самую раннюю
+CREATE TEMP TABLE callback_dups AS
+SELECT id, keep_id FROM (
+    SELECT id, first_value(id) OVER (PARTITION BY tenant_id, match_key ORDER BY first_missed_at, id) AS keep_id
+    FROM callbacks
+    WHERE status IN ('open', 'claimed')
+) x
+WHERE id <> keep_id;
+
+UPDATE callbacks k SET
+    miss_count      = k.miss_count + s.miss_count,
+    attempts        = k.attempts + s.attempts,
+    last_missed_at  = GREATEST(k.last_missed_at, s.last_missed_at),
+    last_call_id    = CASE WHEN s.last_missed_at > k.last_missed_at THEN s.last_call_id ELSE k.last_call_id END
+FROM (
+    SELECT DISTINCT ON (d.keep_id) d.keep_id,
+           SUM(c.miss_count) OVER w AS miss_count, SUM(c.attempts) OVER w AS attempts,
+           c.last_missed_at, c.last_call_id
+    FROM callback_dups d JOIN callbacks c ON c.id = d.id
+    WINDOW w AS (PARTITION BY d.keep_id)
+    ORDER BY d.keep_id, c.last_missed_at DESC
+) s
+WHERE k.id = s.keep_id;
+
+UPDATE callback_calls cc SET callback_id = d.keep_id
+FROM callback_dups d
+WHERE cc.callback_id = d.id;
+
+DELETE FROM callbacks WHERE id IN (SELECT id FROM callback_dups);
+DROP TABLE callback_dups;
+
+DROP INDEX IF EXISTS ux_callbacks_active_number;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_callbacks_active_match_key
+    ON callbacks (tenant_id, match_key) WHERE status IN ('open', 'claimed');
@@ -0,0 +1,49 @@
+-- ============================================================
+-- Оценка звонка по сетке (020) решает «исходящий» по направлению,
+-- зафиксированному в строке (021), а не поиском users по sipno: живая
+-- оценка в триггере и пересчёт (RerateCalls) дают одинаковый результат,
+-- даже если номер с тех пор переназначен.
+-- ============================================================
+
+DROP FUNCTION IF EXISTS ast_cdr_rating(INT, TEXT, TEXT, INT);
+
+-- Оценка звонка по сетке тарифа тенанта; не исходящий или нет совпадения —
+-- все поля NULL
+CREATE OR REPLACE FUNCTION ast_cdr_rating(p_tenant_id INT, p_direction TEXT, p_dst TEXT, p_billsec INT,
+                                          OUT prefix TEXT, OUT seconds INT, OUT cost NUMERIC) AS $$
+    SELECT r.prefix,
+           (CEIL(p_billsec::numeric / r.increment) * r.increment)::int,
+           ROUND(r.connection_fee
+                 + CEIL(p_billsec::numeric / r.increment) * r.increment / 60.0 * r.price_per_minute, 4)
+    FROM crm_tenants t
+    JOIN rate_deck r ON r.tariff_id = t.tariff_id
+    WHERE t.tenant_id = p_tenant_id
+      AND p_billsec > 0
+      AND p_direction = 'outbound'
+      -- Все префиксы номера: точное совпадение по ключу вместо LIKE по всей сетке
+      AND r.prefix IN (
+          SELECT left(n.d, i)
+          FROM (SELECT regexp_replace(p_dst, '\D', '', 'g') AS d) n, generate_series(1, length(n.d)) i
+      )
+    ORDER BY length(r.prefix) DESC
+    LIMIT 1
+$$ LANGUAGE sql STABLE;
+
+-- Триггер владельца из 021 — с новой сигнатурой оценки
+CREATE OR REPLACE FUNCTION ast_cdr_stamp_tenant() RETURNS trigger AS $$
+BEGIN
+    IF NEW.tenant_id IS NULL THEN
+        SELECT o.tenant_id, o.user_id INTO NEW.tenant_id, NEW.agent_user_id
+        FROM ast_cdr_owner(NEW.src, NEW.dst) o;
+    END IF;
+    IF NEW.tenant_id IS NOT NULL AND NEW.direction IS NULL THEN
+        NEW.direction := ast_cdr_direction(NEW.tenant_id, NEW.src, NEW.dst);
+    END IF;
+    IF NEW.tenant_id IS NOT NULL AND NEW.cost IS NULL AND NEW.direction = 'outbound'
+       AND NEW.disposition = 'ANSWERED' AND NEW.lastapp IS DISTINCT FROM 'Hangup' THEN
+        SELECT r.prefix, r.seconds, r.cost INTO NEW.rate_prefix, NEW.rated_seconds, NEW.cost
+        FROM ast_cdr_rating(NEW.tenant_id, NEW.direction, NEW.dst, NEW.billsec) r;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
@@ -1,27 +1,40 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata" // пояса отчётов (?tz) не зависят от zoneinfo на сервере
 
 	"github.com/gorilla/websocket"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"github.com/jackc/pgx/v5/pgxpool"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"software.sslmate.com/src/go-pkcs12"
 
 	"callcentrix/internal/ami"
 	"callcentrix/internal/auth"
+	"callcentrix/internal/cluster"
 	"callcentrix/internal/config"
 	"callcentrix/internal/db"
 	"callcentrix/internal/handlers"
+	"callcentrix/internal/mailer"
+	"callcentrix/internal/metrics"
 	"callcentrix/internal/monitor"
+	"callcentrix/internal/pdf"
+	"callcentrix/internal/recordings"
 	"callcentrix/internal/sip"
+	"callcentrix/internal/transcription"
 	"callcentrix/internal/ws"
 
 	_ "callcentrix/docs"
@@ -62,8 +75,35 @@ func main() {
 	agentStore     := monitor.NewStore()
 	callStore      := monitor.NewCallStore()
 	queueStore     := monitor.NewQueueStore()
+	presenceStore  := monitor.NewPresenceStore()
 	tenantResolver := monitor.NewTenantResolver(pool)
 
+	metrics.RegisterPool(pool)
+	monitor.RegisterMetrics(agentStore, callStore)
+
+	// Контекст жизни процесса: отменяется по SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// =========================
+	// MONITOR SNAPSHOTS
+	// =========================
+	var persister *monitor.Persister
+	if backend := snapshotBackend(cfg, pool); backend != nil {
+		persister = &monitor.Persister{
+			Agents:   agentStore,
+			Calls:    callStore,
+			Queues:   queueStore,
+			Presence: presenceStore,
+			Backend:  backend,
+			Interval: time.Duration(cfg.Monitor.SnapshotInterval) * time.Second,
+			MaxAge:   time.Duration(cfg.Monitor.SnapshotMaxAge) * time.Minute,
+		}
+	}
+	if cfg.Cluster.Enabled && cfg.Monitor.Snapshot != "postgres" {
+		log.Fatal("CLUSTER_ENABLED requires MONITOR_SNAPSHOT=postgres")
+	}
+
 	// =========================
 	// AMI
 	// =========================
@@ -71,6 +111,7 @@ func main() {
 		Agents:   agentStore,
 		Calls:    callStore,
 		Queues:   queueStore,
+		Presence: presenceStore,
 		Resolver: tenantResolver,
 	}
 
@@ -83,7 +124,207 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	go amiService.Start()
+
+	// Wrap-up после звонков очереди (длительность — queue_wrapup_settings)
+	wrapupManager := &ami.WrapupManager{
+		DB:     pool,
+		AMI:    amiService,
+		Agents: agentStore,
+	}
+	amiHandler.Wrapup = wrapupManager
+
+	// Итоговые записи звонков (таблица calls) — пишет только лидер
+	callLog := monitor.NewCallLog(pool)
+
+	// История состояний агентов (пауза, wrap-up для отчётов) — тоже лидер
+	stateLog := monitor.NewStateLog(pool)
+
+	// =========================
+	// ПЕРЕЗВОНЫ
+	// =========================
+	// Бейдж для WS считает каждый инстанс; список из таблицы calls ведёт лидер
+	callbackBadge := monitor.NewCallbackBadge(pool,
+		time.Duration(cfg.Callbacks.SLAMinutes)*time.Minute,
+		time.Duration(cfg.Callbacks.WarnMinutes)*time.Minute)
+	go callbackBadge.Run(ctx)
+
+	callbackHandler := &handlers.CallbackHandler{
+		DB:      pool,
+		AMI:     amiService,
+		Badge:   callbackBadge,
+		Context: cfg.Callbacks.Context,
+		SLA:     callbackBadge.SLA,
+		Warn:    callbackBadge.Warn,
+	}
+
+	// =========================
+	// RECORDINGS
+	// =========================
+	// Новые записи ищем в RECORDING_STORE; HTTP-прокси к Asterisk остаётся
+	// доступным для строк индекса, созданных до переезда хранилища
+	recordingIndex := recordings.NewIndex(pool, recordingStore(cfg),
+		&recordings.HTTPStore{BaseURL: cfg.Asterisk.RecordingURL})
+
+	var transcoder *recordings.Transcoder
+	if cfg.Recordings.FFmpeg != "" {
+		transcoder = &recordings.Transcoder{
+			Index:    recordingIndex,
+			FFmpeg:   cfg.Recordings.FFmpeg,
+			CacheDir: cfg.Recordings.CacheDir,
+			TTL:      time.Duration(cfg.Recordings.CacheTTLHours) * time.Hour,
+		}
+		go transcoder.Run(ctx)
+	}
+
+	// Удаление записей по срокам хранения — только лидер
+	purger := &recordings.Purger{
+		Index:      recordingIndex,
+		Transcoder: transcoder,
+		Interval:   time.Duration(cfg.Recordings.RetentionIntervalHours) * time.Hour,
+	}
+
+	// ZIP-выгрузки записей: задания из БД выполняет лидер
+	recordingExportHandler := &handlers.RecordingExportHandler{
+		DB:         pool,
+		Recordings: recordingIndex,
+		Dir:        cfg.Recordings.ExportDir,
+		SignSecret: cfg.JWT.Secret,
+	}
+
+	// Расшифровка записей: ffmpeg декодирует, движок распознаёт — только лидер
+	var transcriptionWorker *transcription.Worker
+	if engine := transcriber(cfg); engine != nil {
+		if transcoder == nil {
+			log.Fatal("TRANSCRIBE_ENGINE requires RECORDING_FFMPEG")
+		}
+		transcriptionWorker = &transcription.Worker{
+			DB:          pool,
+			Recordings:  recordingIndex,
+			Decoder:     transcoder,
+			Transcriber: engine,
+			TempDir:     cfg.Transcription.TempDir,
+			MinSeconds:  cfg.Transcription.MinSeconds,
+		}
+	}
+
+	// =========================
+	// РАССЫЛКА ОТЧЁТОВ
+	// =========================
+	// Отчёт строит тот же CDRHandler, что отдаёт его в API; расписания выполняет лидер
+	cdrHandler := &handlers.CDRHandler{
+		DB: pool,
+	}
+
+	reportScheduleHandler := &handlers.ReportScheduleHandler{
+		DB:      pool,
+		CDR:     cdrHandler,
+		Mailer:  reportMailer(cfg),
+		PDFFont: reportFont(cfg),
+	}
+
+	// =========================
+	// БИЛЛИНГ
+	// =========================
+	// Замеры операторов и счета за прошедший месяц — лидер
+	billingHandler := &handlers.BillingHandler{
+		DB:       pool,
+		PDFFont:  reportScheduleHandler.PDFFont,
+		Currency: cfg.Billing.Currency,
+	}
+
+	// =========================
+	// LIVE STATE: лидер держит AMI, фолловеры — реплики сторов
+	// =========================
+	var liveWG sync.WaitGroup
+
+	// startLeader восстанавливает сторы ДО подключения к AMI — события Asterisk
+	// лягут поверх снапшота, а CoreShowChannels/QueueStatus его сверят
+	startLeader := func(ctx context.Context, publisher *cluster.Publisher) {
+		if persister != nil {
+			if err := persister.Restore(ctx); err != nil {
+				log.Printf("❌ Monitor snapshot restore: %v", err)
+			}
+			if publisher != nil {
+				publisher.Attach(agentStore, callStore, queueStore, presenceStore)
+				persister.SeqFunc = publisher.Seq
+				persister.OnSaved = publisher.Snapshot
+				liveWG.Add(1)
+				go func() {
+					defer liveWG.Done()
+					publisher.Run(ctx)
+				}()
+				// Сразу отдаём репликам восстановленное состояние
+				if err := persister.Save(ctx); err != nil {
+					log.Printf("❌ Monitor snapshot save: %v", err)
+				}
+			}
+			liveWG.Add(1)
+			go func() {
+				defer liveWG.Done()
+				persister.Run(ctx)
+			}()
+		}
+		callLog.Attach(callStore)
+		liveWG.Add(1)
+		go func() {
+			defer liveWG.Done()
+			callLog.Run(ctx)
+		}()
+		stateLog.Attach(agentStore)
+		liveWG.Add(1)
+		go func() {
+			defer liveWG.Done()
+			stateLog.Run(ctx)
+		}()
+		if purger.Interval > 0 {
+			go purger.Run(ctx)
+		}
+		go recordingExportHandler.Run(ctx)
+		if transcriptionWorker != nil {
+			go transcriptionWorker.Run(ctx)
+		}
+		if reportScheduleHandler.Mailer != nil {
+			go reportScheduleHandler.Run(ctx)
+		}
+		go callbackHandler.Run(ctx)
+		go billingHandler.Run(ctx)
+		go amiService.Start()
+		go wrapupManager.Run(ctx)
+	}
+
+	var elector *cluster.Elector
+	if !cfg.Cluster.Enabled {
+		startLeader(ctx, nil)
+	} else {
+		bus := &cluster.PGBus{DB: pool, DSN: cfg.DB.DSN}
+		elector = &cluster.Elector{
+			DB:         pool,
+			DSN:        cfg.DB.DSN,
+			InstanceID: cfg.Cluster.InstanceID,
+			URL:        cfg.Cluster.AdvertiseURL,
+		}
+
+		replicaCtx, stopReplica := context.WithCancel(ctx)
+		replica := &cluster.Replica{
+			Agents:   agentStore,
+			Calls:    callStore,
+			Queues:   queueStore,
+			Presence: presenceStore,
+			Backend:  persister.Backend,
+			Origin:   cfg.Cluster.InstanceID,
+		}
+		go replica.Run(replicaCtx, bus)
+
+		go elector.Run(ctx, func(ctx context.Context) {
+			// Становимся лидером: реплика больше не нужна, состояние — из снапшота
+			stopReplica()
+			agentStore.Reset()
+			callStore.Reset()
+			presenceStore.Reset()
+			queueStore.Reset()
+			startLeader(ctx, cluster.NewPublisher(bus, cfg.Cluster.InstanceID))
+		})
+	}
 
 	// =========================
 	// HANDLERS
@@ -93,6 +334,15 @@ func main() {
 		AMI:    amiService,
 		Calls:  callStore,
 		Agents: agentStore,
+		Wrapup: wrapupManager,
+	}
+
+	dispositionsHandler := &handlers.DispositionsHandler{
+		DB: pool,
+	}
+
+	agentStatusesHandler := &handlers.AgentStatusesHandler{
+		DB: pool,
 	}
 
 	agentsInfoHandler := &handlers.AgentsInfoHandler{
@@ -108,14 +358,26 @@ func main() {
 		DB: pool,
 	}
 
-	cdrHandler := &handlers.CDRHandler{
+	transcriptHandler := &handlers.TranscriptHandler{
+		DB: pool,
+	}
+
+	qaHandler := &handlers.QAHandler{
 		DB: pool,
 	}
 
+	retentionHandler := &handlers.RetentionHandler{
+		DB:     pool,
+		Purger: purger,
+	}
+
 	recordingHandler := &handlers.RecordingHandler{
-		DB:              pool,
-		AsteriskBaseURL: cfg.Asterisk.RecordingURL,
-		SignSecret:      cfg.JWT.Secret,
+		DB:         pool,
+		Recordings: recordingIndex,
+		Transcoder: transcoder,
+		SignSecret: cfg.JWT.Secret,
+		PublicBase: cfg.HTTP.PublicBase,
+		Proxies:    cfg.HTTP.TrustedProxies,
 	}
 
 	staffHandler := &handlers.StaffHandler{
@@ -124,10 +386,24 @@ func main() {
 		PublicBase: cfg.HTTP.PublicBase,
 	}
 
+	directoryHandler := &handlers.DirectoryHandler{
+		DB:         pool,
+		Presence:   presenceStore,
+		PublicBase: cfg.HTTP.PublicBase,
+	}
+
 	companiesHandler := &handlers.CompaniesHandler{
 		DB: pool,
 	}
 
+	timeZoneHandler := &handlers.TimeZoneHandler{
+		DB: pool,
+	}
+
+	rateDeckHandler := &handlers.RateDeckHandler{
+		DB: pool,
+	}
+
 	// =========================
 	// ROUTER
 	// =========================
@@ -151,12 +427,18 @@ func main() {
 		MaxAge:           300,
 	}))
 
+	r.Use(metrics.HTTPMiddleware)
+
 	// =========================
 	// PUBLIC ROUTES
 	// =========================
 	r.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.Write([]byte("ok"))
 	})
+	// Без токена метрики на публичном порту не отдаём — только METRICS_ADDR
+	if cfg.Metrics.Token != "" {
+		r.Get("/metrics", metrics.Handler(cfg.Metrics.Token))
+	}
 
 	authHandler := &auth.Handler{
 		DB:     pool,
@@ -172,6 +454,8 @@ func main() {
 		agentStore,
 		callStore,
 		queueStore,
+		presenceStore,
+		callbackBadge,
 		cfg,
 	))
 
@@ -191,17 +475,108 @@ func main() {
 		// ── Агенты ─────────────────────────────────────
 		r.Get("/api/agents/info", agentsInfoHandler.GetAgentsInfo)
 
+		// ── Справочник / BLF ───────────────────────────
+		r.Get("/api/directory", directoryHandler.GetDirectory)
+
 		// ── Действия ───────────────────────────────────
-		r.Post("/api/actions/pause",  actionsHandler.TogglePause)
-		r.Post("/api/actions/hangup", actionsHandler.Hangup)
-		r.Get("/api/actions/my-call", actionsHandler.GetMyActiveCall)
+		// В кластере действия выполняет лидер (у него AMI) — фолловер проксирует
+		r.Group(func(r chi.Router) {
+			if elector != nil {
+				r.Use(elector.ForwardToLeader)
+			}
+			r.Post("/api/actions/pause",  actionsHandler.TogglePause)
+			r.Post("/api/actions/hangup", actionsHandler.Hangup)
+			r.Get("/api/actions/my-call", actionsHandler.GetMyActiveCall)
+			r.Post("/api/actions/wrapup", actionsHandler.SubmitDisposition)
+			r.Post("/api/actions/status", actionsHandler.SetMyStatus)
+		})
+
+		// ── Перезвоны ──────────────────────────────────
+		r.Get("/api/callbacks",               callbackHandler.GetCallbacks)
+		r.Get("/api/callbacks/{id}",          callbackHandler.GetCallback)
+		r.Post("/api/callbacks/{id}/claim",   callbackHandler.ClaimCallback)
+		r.Delete("/api/callbacks/{id}/claim", callbackHandler.ReleaseCallback)
+		r.Post("/api/callbacks/{id}/resolve", callbackHandler.ResolveCallback)
+		// Originate — через AMI лидера
+		r.Group(func(r chi.Router) {
+			if elector != nil {
+				r.Use(elector.ForwardToLeader)
+			}
+			r.Post("/api/callbacks/{id}/call", callbackHandler.CallCallback)
+		})
+
+		// ── Статусы агентов ────────────────────────────
+		r.Get("/api/agent-statuses",         agentStatusesHandler.GetAgentStatuses)
+		r.Post("/api/agent-statuses",        agentStatusesHandler.CreateAgentStatus)
+		r.Put("/api/agent-statuses/{id}",    agentStatusesHandler.UpdateAgentStatus)
+		r.Delete("/api/agent-statuses/{id}", agentStatusesHandler.DeleteAgentStatus)
+
+		// ── Wrap-up и коды результата ──────────────────
+		r.Get("/api/dispositions",         dispositionsHandler.GetDispositions)
+		r.Post("/api/dispositions",        dispositionsHandler.CreateDisposition)
+		r.Put("/api/dispositions/{id}",    dispositionsHandler.UpdateDisposition)
+		r.Delete("/api/dispositions/{id}", dispositionsHandler.DeleteDisposition)
+		r.Get("/api/queues/wrapup",          dispositionsHandler.GetWrapupSettings)
+		r.Put("/api/queues/{queue}/wrapup",  dispositionsHandler.SetWrapupSetting)
 
 		// ── Отчёты ─────────────────────────────────────
-		r.Get("/api/reports/calls", cdrHandler.GetCDR)
+		r.Get("/api/reports/calls",                     cdrHandler.GetCDR)
+		r.Get("/api/reports/calls/export",              cdrHandler.ExportCDR)
+		r.Get("/api/reports/calls/series",              cdrHandler.GetCDRSeries)
+		r.Get("/api/reports/calls/legs",                cdrHandler.GetCDRLegs)
+		r.Get("/api/reports/calls/journeys/{linkedid}", cdrHandler.GetCallJourney)
+		r.Get("/api/reports/agents",                    cdrHandler.GetAgentReport)
+		r.Get("/api/reports/agents/{userId}/calls",     cdrHandler.GetAgentCalls)
+		r.Get("/api/reports/dispositions",              dispositionsHandler.GetDispositionReport)
+		r.Get("/api/reports/schedules",                 reportScheduleHandler.GetReportSchedules)
+		r.Post("/api/reports/schedules",                reportScheduleHandler.CreateReportSchedule)
+		r.Put("/api/reports/schedules/{id}",            reportScheduleHandler.UpdateReportSchedule)
+		r.Delete("/api/reports/schedules/{id}",         reportScheduleHandler.DeleteReportSchedule)
+		r.Post("/api/reports/schedules/{id}/send",      reportScheduleHandler.SendReportNow)
+		r.Get("/api/reports/deliveries",                reportScheduleHandler.GetReportDeliveries)
 
 		// ── Записи звонков ─────────────────────────────
-		r.Get("/api/recordings/{uniqueid}",      recordingHandler.Stream)
-		r.Get("/api/recordings/{uniqueid}/link", recordingHandler.GetSignedLink)
+		r.Get("/api/recordings/{uniqueid}",           recordingHandler.Stream)
+		r.Get("/api/recordings/{uniqueid}/link",      recordingHandler.GetSignedLink)
+		r.Get("/api/recordings/{uniqueid}/peaks",     recordingHandler.GetPeaks)
+		r.Get("/api/recordings/{uniqueid}/listeners", recordingHandler.GetRecordingListeners)
+		r.Get("/api/recordings/audit",                recordingHandler.GetRecordingAudit)
+		r.Post("/api/recordings/{uniqueid}/shares",   recordingHandler.CreateShare)
+		r.Get("/api/recordings/shares",               recordingHandler.GetShares)
+		r.Delete("/api/recordings/shares/{id}",       recordingHandler.RevokeShare)
+		r.Get("/api/recordings/{uniqueid}/transcript",  transcriptHandler.GetTranscript)
+		r.Post("/api/recordings/{uniqueid}/transcript", transcriptHandler.RequestTranscript)
+		r.Get("/api/transcripts/search",                transcriptHandler.SearchTranscripts)
+		r.Post("/api/recordings/exports",             recordingExportHandler.CreateExport)
+		r.Get("/api/recordings/exports",              recordingExportHandler.GetExports)
+		r.Get("/api/recordings/exports/{id}",         recordingExportHandler.GetExport)
+
+		// ── Сроки хранения записей ─────────────────────
+		r.Get("/api/recordings/retention/policies",         retentionHandler.GetRetentionPolicies)
+		r.Post("/api/recordings/retention/policies",        retentionHandler.CreateRetentionPolicy)
+		r.Put("/api/recordings/retention/policies/{id}",    retentionHandler.UpdateRetentionPolicy)
+		r.Delete("/api/recordings/retention/policies/{id}", retentionHandler.DeleteRetentionPolicy)
+		r.Get("/api/recordings/retention/dry-run",          retentionHandler.GetRetentionDryRun)
+		r.Get("/api/recordings/retention/log",              retentionHandler.GetPurgeLog)
+		r.Get("/api/recordings/holds",                      retentionHandler.GetLegalHolds)
+		r.Put("/api/recordings/{uniqueid}/hold",            retentionHandler.SetLegalHold)
+		r.Delete("/api/recordings/{uniqueid}/hold",         retentionHandler.DeleteLegalHold)
+
+		// ── Оценка качества (QA) ───────────────────────
+		r.Get("/api/qa/templates",                    qaHandler.GetQATemplates)
+		r.Post("/api/qa/templates",                   qaHandler.CreateQATemplate)
+		r.Get("/api/qa/templates/{id}",               qaHandler.GetQATemplate)
+		r.Put("/api/qa/templates/{id}",               qaHandler.UpdateQATemplate)
+		r.Delete("/api/qa/templates/{id}",            qaHandler.DeleteQATemplate)
+		r.Get("/api/qa/evaluations",                  qaHandler.GetQAEvaluations)
+		r.Post("/api/qa/evaluations",                 qaHandler.CreateQAEvaluation)
+		r.Get("/api/qa/evaluations/{id}",             qaHandler.GetQAEvaluation)
+		r.Put("/api/qa/evaluations/{id}",             qaHandler.UpdateQAEvaluation)
+		r.Delete("/api/qa/evaluations/{id}",          qaHandler.DeleteQAEvaluation)
+		r.Post("/api/qa/evaluations/{id}/acknowledge", qaHandler.AcknowledgeQAEvaluation)
+		r.Get("/api/reports/qa/agents",               qaHandler.GetQAAgentReport)
+		r.Get("/api/reports/qa/questions",            qaHandler.GetQAQuestionReport)
+		r.Get("/api/reports/qa/trend",                qaHandler.GetQATrendReport)
 
 		// ── Сотрудники ─────────────────────────────────
 		r.Get("/api/staff",                staffHandler.GetStaff)
@@ -212,6 +587,7 @@ func main() {
 
 		// ── Компании ───────────────────────────────────
 		r.Get("/api/tariffs",                      companiesHandler.GetTariffs)
+		r.Put("/api/tariffs/{id}",                 companiesHandler.UpdateTariff)
 		r.Get("/api/users/pending",                companiesHandler.GetPendingUsers)
 		r.Patch("/api/users/{id}/activate",        companiesHandler.ActivateUser)
 		r.Delete("/api/users/{id}/reject",         companiesHandler.RejectUser)
@@ -224,6 +600,24 @@ func main() {
 		r.Put("/api/companies/{tenantId}",         companiesHandler.UpdateCompany)
 		r.Patch("/api/companies/{tenantId}/status", companiesHandler.ToggleStatus)
 
+		// ── Биллинг ────────────────────────────────────
+		r.Get("/api/tariffs/{id}/rates",             rateDeckHandler.GetRates)
+		r.Post("/api/tariffs/{id}/rates/import",     rateDeckHandler.ImportRates)
+		r.Get("/api/tariffs/{id}/rates/export",      rateDeckHandler.ExportRates)
+		r.Get("/api/tariffs/{id}/rates/lookup",      rateDeckHandler.LookupRate)
+		r.Post("/api/tariffs/{id}/rates/rerate",     rateDeckHandler.RerateCalls)
+		r.Delete("/api/tariffs/{id}/rates/{prefix}", rateDeckHandler.DeleteRate)
+		r.Get("/api/billing/invoices",               billingHandler.GetInvoices)
+		r.Post("/api/billing/invoices/generate",     billingHandler.GenerateInvoices)
+		r.Get("/api/billing/invoices/{id}",          billingHandler.GetInvoice)
+		r.Get("/api/billing/invoices/{id}/pdf",      billingHandler.GetInvoicePDF)
+		r.Patch("/api/billing/invoices/{id}/status", billingHandler.SetInvoiceStatus)
+		r.Get("/api/billing/usage",                  billingHandler.GetBillingUsage)
+
+		// ── Настройки компании ─────────────────────────
+		r.Get("/api/settings/timezone", timeZoneHandler.GetTimeZone)
+		r.Put("/api/settings/timezone", timeZoneHandler.SetTimeZone)
+
 		// ── CRM: Тикеты ────────────────────────────────
 		r.Get("/api/crm/tickets",                    crmHandler.GetTickets)
 		r.Post("/api/crm/tickets",                   crmHandler.CreateTicket)
@@ -263,6 +657,15 @@ func main() {
 	// STATIC: записи (HMAC подпись)
 	// =========================
 	r.Get("/api/recordings/{uniqueid}/play", recordingHandler.PlaySigned)
+	r.Post("/api/recordings/{uniqueid}/play", recordingHandler.PlaySigned) // пароль внешней ссылки формой
+
+	// Архив выгрузки лежит на диске лидера
+	r.Group(func(r chi.Router) {
+		if elector != nil {
+			r.Use(elector.ForwardToLeader)
+		}
+		r.Get("/api/recordings/exports/{id}/download", recordingExportHandler.DownloadExport)
+	})
 
 	r.Handle("/uploads/*", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
 
@@ -290,18 +693,133 @@ func main() {
 	// =========================
 	// ЗАПУСК СЕРВЕРА
 	// =========================
-	if cfg.HTTP.TLSCert != "" {
-		log.Printf("🔒 HTTPS server started on %s\n", cfg.HTTP.Addr)
-		tlsCfg, err := loadTLS(cfg.HTTP.TLSCert, cfg.HTTP.TLSPass)
-		if err != nil {
-			log.Fatalf("TLS error: %v", err)
+	server := &http.Server{Addr: cfg.HTTP.Addr, Handler: r}
+
+	go func() {
+		var err error
+		if cfg.HTTP.TLSCert != "" {
+			log.Printf("🔒 HTTPS server started on %s\n", cfg.HTTP.Addr)
+			tlsCfg, tlsErr := loadTLS(cfg.HTTP.TLSCert, cfg.HTTP.TLSPass)
+			if tlsErr != nil {
+				log.Fatalf("TLS error: %v", tlsErr)
+			}
+			server.TLSConfig = tlsCfg
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("🚀 HTTP server started on %s\n", cfg.HTTP.Addr)
+			err = server.ListenAndServe()
 		}
-		server := &http.Server{Addr: cfg.HTTP.Addr, Handler: r, TLSConfig: tlsCfg}
-		log.Fatal(server.ListenAndServeTLS("", ""))
-	} else {
-		log.Printf("🚀 HTTP server started on %s\n", cfg.HTTP.Addr)
-		log.Fatal(http.ListenAndServe(cfg.HTTP.Addr, r))
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// Метрики для Prometheus — на внутреннем адресе, без авторизации
+	var metricsServer *http.Server
+	if cfg.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(""))
+		metricsServer = &http.Server{Addr: cfg.Metrics.Addr, Handler: mux}
+		go func() {
+			log.Printf("📈 Metrics server started on %s\n", cfg.Metrics.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("❌ Metrics server: %v", err)
+			}
+		}()
+	}
+
+	// =========================
+	// ОСТАНОВКА
+	// =========================
+	<-ctx.Done()
+	log.Println("🛑 Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("❌ HTTP shutdown: %v", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
+	}
+
+	// Ждём финальный снапшот мониторинга
+	liveWG.Wait()
+}
+
+// snapshotBackend выбирает хранилище снапшотов мониторинга по конфигу (nil = выключено)
+func snapshotBackend(cfg *config.Config, pool *pgxpool.Pool) monitor.SnapshotBackend {
+	switch cfg.Monitor.Snapshot {
+	case "postgres":
+		return &monitor.PGSnapshotBackend{DB: pool, Key: "default"}
+	case "file":
+		return &monitor.FileSnapshotBackend{Path: cfg.Monitor.SnapshotFile}
+	default:
+		return nil
+	}
+}
+
+func recordingStore(cfg *config.Config) recordings.Store {
+	switch cfg.Recordings.Store {
+	case "fs":
+		return &recordings.FSStore{Root: cfg.Recordings.FSPath}
+	case "s3":
+		return &recordings.S3Store{
+			Endpoint:  cfg.Recordings.S3Endpoint,
+			Region:    cfg.Recordings.S3Region,
+			Bucket:    cfg.Recordings.S3Bucket,
+			Prefix:    cfg.Recordings.S3Prefix,
+			AccessKey: cfg.Recordings.S3AccessKey,
+			SecretKey: cfg.Recordings.S3SecretKey,
+			PathStyle: cfg.Recordings.S3PathStyle,
+		}
+	default:
+		return &recordings.HTTPStore{BaseURL: cfg.Asterisk.RecordingURL}
+	}
+}
+
+// transcriber выбирает движок распознавания речи (nil = выключено)
+func transcriber(cfg *config.Config) transcription.Transcriber {
+	switch cfg.Transcription.Engine {
+	case "whisper":
+		return &transcription.WhisperCLI{
+			Binary:   cfg.Transcription.WhisperBinary,
+			Model:    cfg.Transcription.WhisperModel,
+			Language: cfg.Transcription.Language,
+			Threads:  cfg.Transcription.Threads,
+			Diarize:  cfg.Transcription.Diarize,
+		}
+	default:
+		return nil
+	}
+}
+
+// reportMailer — SMTP для рассылки отчётов (nil = выключено)
+func reportMailer(cfg *config.Config) mailer.Sender {
+	if cfg.SMTP.Host == "" {
+		return nil
+	}
+	return &mailer.Mailer{
+		Host:     cfg.SMTP.Host,
+		Port:     cfg.SMTP.Port,
+		Username: cfg.SMTP.Username,
+		Password: cfg.SMTP.Password,
+		From:     cfg.SMTP.From,
+		TLS:      cfg.SMTP.TLS,
+	}
+}
+
+// reportFont — шрифт PDF-отчётов; без него PDF только латиницей
+func reportFont(cfg *config.Config) *pdf.Font {
+	if cfg.Reports.PDFFont == "" {
+		return nil
+	}
+	font, err := pdf.LoadFont(cfg.Reports.PDFFont)
+	if err != nil {
+		log.Printf("⚠️ Report PDF font: %v — PDF without Cyrillic", err)
+		return nil
 	}
+	return font
 }
 
 func sipWSProxy(target string) http.HandlerFunc {
@@ -0,0 +1,65 @@
+// cdr-backfill — повторный проход ast_cdr_backfill (миграция 022) по строкам
+// ast_cdr без tenant_id или direction: например, после восстановления удалённого
+// пользователя. Сам бэкфилл истории делает миграция 022. Идёт пачками по id,
+// повторный запуск безопасен.
+//
+//	go run ./cmd/cdr-backfill -batch 5000
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"callcentrix/internal/config"
+	"callcentrix/internal/db"
+)
+
+func main() {
+	batch := flag.Int("batch", 5000, "строк ast_cdr за одно обновление")
+	pause := flag.Duration("pause", 100*time.Millisecond, "пауза между пачками (нагрузка на БД)")
+	flag.Parse()
+
+	cfg := config.Load()
+	pool, err := db.New(cfg.DB.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var lastID int64
+	scanned, stamped := 0, 0
+	start := time.Now()
+	for ctx.Err() == nil {
+		// Строки без владельца (внешние номера, удалённые пользователи) остаются
+		// NULL — курсор по id не даёт просматривать их повторно
+		var maxID *int64
+		var n, updated int
+		err := pool.QueryRow(ctx, `SELECT last_id, scanned, stamped FROM ast_cdr_backfill($1, $2)`,
+			lastID, *batch,
+		).Scan(&maxID, &n, &updated)
+		if err != nil {
+			log.Fatalf("❌ CDR backfill after id %d: %v", lastID, err)
+		}
+		if maxID == nil {
+			break
+		}
+		lastID = *maxID
+		scanned += n
+		stamped += updated
+		log.Printf("📝 CDR backfill: id ≤ %d, scanned %d, stamped %d", lastID, scanned, stamped)
+		time.Sleep(*pause)
+	}
+	if ctx.Err() != nil {
+		log.Printf("🛑 CDR backfill interrupted at id %d — rerun to continue", lastID)
+		return
+	}
+	log.Printf("✅ CDR backfill done: scanned %d, stamped %d (%s)", scanned, stamped, time.Since(start).Round(time.Second))
+}
@@ -16,6 +16,7 @@ type ActionsHandler struct {
 	AMI    *Service
 	Calls  *monitor.CallStore
 	Agents *monitor.Store
+	Wrapup *WrapupManager
 }
 
 // =========================
@@ -186,11 +187,7 @@ func (h *ActionsHandler) Hangup(w http.ResponseWriter, r *http.Request) {
 	for _, a := range agentsToReset {
 		if a.CallID == callID {
 			log.Printf("🔄 Resetting agent: %s (was: %s, callID: %s)", a.Name, a.Status, a.CallID)
-			h.Agents.UpdateAgent(tenantID, monitor.AgentState{
-				Name:   a.Name,
-				Status: "idle",
-				CallID: "",
-			})
+			h.Agents.ClearCall(tenantID, a.Name, callID)
 		}
 	}
 	
@@ -216,6 +213,20 @@ func (h *ActionsHandler) GetMyActiveCall(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 
 	agent, ok := h.Agents.GetAgents(user.TenantID)[sipUsername]
+
+	// Wrap-up: звонок завершён, агент должен выбрать результат
+	if ok && agent.Status == "wrapup" {
+		json.NewEncoder(w).Encode(map[string]any{
+			"active": false,
+			"wrapup": map[string]any{
+				"callId": agent.WrapupCallID,
+				"queue":  agent.WrapupQueue,
+				"until":  agent.WrapupUntil,
+			},
+		})
+		return
+	}
+
 	if !ok || (agent.Status != "in-call" && agent.Status != "ringing") {
 		w.Write([]byte(`{"active":false}`))
 		return
@@ -237,4 +248,183 @@ func (h *ActionsHandler) GetMyActiveCall(w http.ResponseWriter, r *http.Request)
 		"callId":   agent.CallID,
 		"status":   agent.Status,
 	})
-}
\ No newline at end of file
+}
+
+// =========================
+// WRAP-UP: РЕЗУЛЬТАТ ЗВОНКА
+// =========================
+
+type SubmitDispositionRequest struct {
+	CallID        string `json:"callId"` // пусто = звонок текущего wrap-up
+	DispositionID int    `json:"dispositionId"`
+	Note          string `json:"note"`
+}
+
+// SubmitDisposition godoc
+// @Summary      Результат звонка (disposition) от агента
+// @Description  Сохраняет код результата по звонку и выводит агента из wrap-up. Изменить результат может агент, который его поставил, или admin; агент звонка при этом не меняется
+// @Tags         Actions
+// @Security     BearerAuth
+// @Accept       json
+// @Param        body body SubmitDispositionRequest true "Disposition"
+// @Success      204
+// @Failure      404 {string} string "call not found"
+// @Failure      409 {string} string "disposition already set by another agent"
+// @Router       /api/actions/wrapup [post]
+func (h *ActionsHandler) SubmitDisposition(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+
+	var req SubmitDispositionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DispositionID == 0 {
+		http.Error(w, "dispositionId is required", http.StatusBadRequest)
+		return
+	}
+
+	// Username в JWT — это SIP номер агента
+	agent := h.Agents.GetAgents(user.TenantID)[user.Username]
+	queue := ""
+	if req.CallID == "" || req.CallID == agent.WrapupCallID {
+		req.CallID = agent.WrapupCallID
+		queue = agent.WrapupQueue
+	}
+	if req.CallID == "" {
+		http.Error(w, "callId is required", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	h.DB.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM crm_dispositions WHERE id=$1 AND tenant_id=$2 AND active)`,
+		req.DispositionID, user.TenantID,
+	).Scan(&exists)
+	if !exists {
+		http.Error(w, "disposition not found", http.StatusNotFound)
+		return
+	}
+
+	// Звонок должен принадлежать тенанту агента: иначе можно занять чужой uniqueid
+	// в call_dispositions (ключ — только uniqueid)
+	var owned bool
+	h.DB.QueryRow(r.Context(), `
+		SELECT EXISTS(SELECT 1 FROM ast_cdr WHERE uniqueid=$1 AND tenant_id=$2)
+		    OR EXISTS(SELECT 1 FROM ast_cdr WHERE linkedid=$1 AND tenant_id=$2)
+		    OR EXISTS(SELECT 1 FROM calls WHERE uniqueid=$1 AND tenant_id=$2)`,
+		req.CallID, user.TenantID,
+	).Scan(&owned)
+	if !owned {
+		http.Error(w, "call not found", http.StatusNotFound)
+		return
+	}
+
+	// Повторная отправка меняет только код и заметку: агент звонка (user_id — по нему
+	// QA находит оцениваемого) остаётся прежним. Чужой результат правит только admin.
+	tag, err := h.DB.Exec(r.Context(), `
+		INSERT INTO call_dispositions (uniqueid, tenant_id, disposition_id, agent, user_id, queue, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (uniqueid) DO UPDATE SET
+			disposition_id = EXCLUDED.disposition_id,
+			note           = EXCLUDED.note,
+			created_at     = NOW()
+		WHERE call_dispositions.tenant_id = EXCLUDED.tenant_id
+		  AND (call_dispositions.user_id = EXCLUDED.user_id OR $8)`,
+		req.CallID, user.TenantID, req.DispositionID, user.Username, user.UserID,
+		nullIfEmpty(queue), nullIfEmpty(req.Note), user.UserType == 1,
+	)
+	if err != nil {
+		log.Printf("❌ SubmitDisposition: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "disposition already set by another agent", http.StatusConflict)
+		return
+	}
+
+	if h.Wrapup != nil {
+		h.Wrapup.Finish(user.TenantID, user.Username, req.CallID, "submitted")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// =========================
+// РУЧНОЙ СТАТУС АГЕНТА
+// =========================
+
+type SetStatusRequest struct {
+	StatusID *int `json:"statusId"` // null — снять ручной статус (агент доступен)
+}
+
+// SetMyStatus godoc
+// @Summary      Ручной статус текущего агента
+// @Description  Статус из каталога тенанта (/api/agent-statuses). Статус с паузой снимает агента с очередей (QueuePause),
+// @Description  без паузы — возвращает в очереди. Звонки перекрывают ручной статус, после звонка агент возвращается в него.
+// @Tags         Actions
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body body SetStatusRequest true "Статус"
+// @Success      200 {object} monitor.AgentState
+// @Failure      404 {string} string "status not found"
+// @Router       /api/actions/status [post]
+func (h *ActionsHandler) SetMyStatus(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+
+	var req SetStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	var manual *monitor.ManualStatus
+	if req.StatusID != nil {
+		var st monitor.ManualStatus
+		var color *string
+		err := h.DB.QueryRow(r.Context(),
+			`SELECT id, code, name, color, pauses_queue FROM agent_statuses
+			 WHERE id=$1 AND tenant_id=$2 AND active`,
+			*req.StatusID, user.TenantID,
+		).Scan(&st.ID, &st.Code, &st.Name, &color, &st.Paused)
+		if err != nil {
+			http.Error(w, "status not found", http.StatusNotFound)
+			return
+		}
+		if color != nil {
+			st.Color = *color
+		}
+		manual = &st
+	}
+
+	// Username в JWT — это SIP номер агента. Сначала стор: эхо QueueMemberPause
+	// увидит уже выставленный статус и не перетрёт его.
+	agent := h.Agents.SetManual(user.TenantID, user.Username, manual)
+
+	fields := map[string]string{
+		"Interface": "PJSIP/" + user.Username,
+		"Paused":    "false",
+	}
+	if manual != nil && manual.Paused {
+		fields["Paused"] = "true"
+		fields["Reason"] = manual.Code
+	}
+	// Во время wrap-up агент и так на паузе — снимет её WrapupManager
+	if fields["Paused"] == "true" || agent.PresenceStatus() != "wrapup" {
+		if err := h.AMI.SendAction("QueuePause", fields); err != nil {
+			log.Printf("❌ AMI QueuePause error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	log.Printf("🚦 Agent status: tenant=%d agent=%s status=%s paused=%s",
+		user.TenantID, user.Username, agent.Status, fields["Paused"])
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agent)
+}
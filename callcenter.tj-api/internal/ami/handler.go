@@ -14,7 +14,9 @@ type Handler struct {
 	Agents         *monitor.Store
 	Calls          *monitor.CallStore
 	Queues         *monitor.QueueStore
+	Presence       *monitor.PresenceStore // BLF всех extension тенанта
 	Resolver       *monitor.TenantResolver
+	Wrapup         *WrapupManager // nil — wrap-up выключен
 	ipCache        map[string]string
 	ipMu           sync.RWMutex
 	activeChannels map[string]bool // Трекер активных каналов
@@ -48,6 +50,17 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 		return
 	}
 
+	// 🔕 PresenceStateChange (CustomPresence:<ext>) — DND; тенант по extension
+	if ev["Event"] == "PresenceStateChange" {
+		ext := extractPresentity(ev["Presentity"])
+		if ext != "" && h.Presence != nil {
+			if tenantID := h.Resolver.ResolveByExtension(ext); tenantID != 0 {
+				h.Presence.SetDND(tenantID, ext, strings.EqualFold(ev["Status"], "dnd"))
+			}
+		}
+		return
+	}
+
 	tenantID := h.Resolver.Resolve(ev)
 	if tenantID == 0 {
 		return
@@ -89,9 +102,33 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 			To:        queue,
 			Channel:   ev["Channel"],
 			StartedAt: time.Now(),
+			Direction: h.direction(callerID, false),
+			Queue:     queue,
 		})
 		log.Printf("📞 Caller %s joined queue %s (uniqueID: %s)", callerID, queue, uniqueID)
 
+	// Ответ на QueueStatus: абонент уже ждёт в очереди (например, после рестарта API)
+	case "QueueEntry":
+		queue := ev["Queue"]
+		uniqueID := ev["Uniqueid"]
+
+		h.Queues.Update(tenantID, queue, func(q *monitor.QueueStats) {
+			q.Waiting++
+		})
+
+		// Для восстановленного из снапшота звонка StartedAt сохранится,
+		// для нового — отсчитываем от времени ожидания в очереди
+		h.Calls.UpdateCall(tenantID, monitor.Call{
+			ID:        uniqueID,
+			From:      ev["CallerIDNum"],
+			To:        queue,
+			Channel:   ev["Channel"],
+			StartedAt: time.Now().Add(-time.Duration(atoi(ev["Wait"])) * time.Second),
+			Direction: h.direction(ev["CallerIDNum"], false),
+			Queue:     queue,
+		})
+		log.Printf("📋 QueueEntry: caller %s waiting in %s for %ss (uniqueID: %s)", ev["CallerIDNum"], queue, ev["Wait"], uniqueID)
+
 	case "QueueCallerLeave":
 		queue := ev["Queue"]
 		uniqueID := ev["Uniqueid"]
@@ -117,10 +154,29 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 			return
 		}
 
+		// Пауза на время wrap-up — наша собственная, статус остаётся "wrapup"
+		current := h.Agents.GetAgents(tenantID)[agent]
+		if current.PresenceStatus() == "wrapup" {
+			return
+		}
+
+		// Пауза — ручной слой статуса: звонки её перекрывают, но не снимают.
+		// Кастомный статус из каталога уже выставлен через /api/actions/status —
+		// эхо его паузы/снятия паузы не трогаем.
 		if ev["Paused"] == "1" {
-			h.setAgentState(tenantID, agent, "paused", "")
+			if current.Manual != nil && current.Manual.Paused {
+				return
+			}
+			h.Agents.SetManual(tenantID, agent, &monitor.ManualStatus{
+				Code:   "paused",
+				Name:   ev["PausedReason"],
+				Paused: true,
+			})
 		} else {
-			h.setAgentState(tenantID, agent, "idle", "")
+			if current.Manual != nil && !current.Manual.Paused {
+				return
+			}
+			h.Agents.SetManual(tenantID, agent, nil)
 		}
 
 	case "DialBegin", "Newstate":
@@ -164,6 +220,15 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 			log.Printf("✅ Preserving original To (queue): %s", existingCall.To)
 		}
 
+		// Звонят агенту: направление по второй стороне (у звонка из очереди уже задано)
+		if !exists {
+			other := ev["ConnectedLineNum"]
+			if other == agent {
+				other = ev["CallerIDNum"]
+			}
+			updatedCall.Direction = h.direction(other, false)
+		}
+
 		h.Calls.UpdateCall(tenantID, updatedCall)
 		h.setAgentState(tenantID, agent, "ringing", callID)
 
@@ -203,14 +268,43 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 			log.Printf("✅ BridgeEnter: Preserving original To (queue): %s", existingCall.To)
 		}
 
-		h.Calls.UpdateCall(tenantID, call)
-		log.Printf("💾 Call saved to tenantID=%d, callID=%s, channel=%s, to=%s", tenantID, callID, call.Channel, call.To)
-
 		otherExt := ev["ConnectedLineNum"]
 		if otherExt == agent {
 			otherExt = ev["CallerIDNum"]
 		}
-		
+
+		// Канал, с которого начался звонок (его Uniqueid = Linkedid), — звонящий;
+		// ответивший агент — на другой стороне бриджа
+		originating := ev["Uniqueid"] == callID
+
+		if !exists {
+			call.Direction = h.direction(otherExt, originating)
+		}
+
+		if h.Resolver.ResolveByExtension(agent) != 0 {
+			// Ответ — первый вход внутреннего номера в бридж; ожидание считаем от начала
+			// звонка в сторе (звонок, впервые увиденный здесь, начинается сейчас)
+			if !exists || existingCall.AnsweredAt == nil {
+				now := time.Now()
+				started := now
+				if exists {
+					started = existingCall.StartedAt
+				}
+				call.StartedAt = started
+				call.AnsweredAt = &now
+				call.WaitSeconds = int(now.Sub(started).Seconds())
+			}
+			// Агент звонка — ответившая сторона; инициатор — только если звонит наружу
+			answerer := !originating || h.Resolver.ResolveByExtension(otherExt) == 0
+			if answerer && (!exists || existingCall.Agent == "") {
+				call.Agent = agent
+			}
+		}
+		call.BridgeID = ev["BridgeUniqueid"]
+
+		h.Calls.UpdateCall(tenantID, call)
+		log.Printf("💾 Call saved to tenantID=%d, callID=%s, channel=%s, to=%s", tenantID, callID, call.Channel, call.To)
+
 		if otherTenantID := h.Resolver.ResolveByExtension(otherExt); otherTenantID != 0 && otherTenantID != tenantID {
 			log.Printf("🔄 Duplicating call to tenantID=%d (other participant)", otherTenantID)
 			h.Calls.UpdateCall(otherTenantID, call)
@@ -218,6 +312,29 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 
 		h.setAgentState(tenantID, agent, "in-call", callID)
 
+	case "Hold", "Unhold":
+		callID := ev["Linkedid"]
+		if callID == "" {
+			return
+		}
+
+		held := ev["Event"] == "Hold"
+		h.Calls.Update(tenantID, callID, func(c *monitor.Call) {
+			now := time.Now()
+			if held && !c.OnHold {
+				c.OnHold = true
+				c.HeldAt = &now
+			}
+			if !held && c.OnHold {
+				if c.HeldAt != nil {
+					c.HoldSeconds += int(now.Sub(*c.HeldAt).Seconds())
+				}
+				c.OnHold = false
+				c.HeldAt = nil
+			}
+		})
+		log.Printf("⏸️ %s: callID=%s, channel=%s", ev["Event"], callID, ev["Channel"])
+
 	case "Hangup":
 		callID := ev["Linkedid"]
 		channel := ev["Channel"]
@@ -233,6 +350,8 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 		
 		if !exists {
 			log.Printf("⚠️ Call not found in CallStore for Hangup: callID=%s, tenantID=%d", callID, tenantID)
+			// Звонок уже удалён — агенты, оставшиеся на нём, зависли бы до CoreShowChannels
+			h.cleanupAgentsWithCall(tenantID, callID)
 			return
 		}
 
@@ -259,12 +378,7 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 				if agentName != "" {
 					agents2 := h.Agents.GetAgents(tenantID)
 					if a, ok := agents2[agentName]; ok {
-						h.Agents.UpdateAgent(tenantID, monitor.AgentState{
-							Name:      a.Name,
-							Status:    "idle",
-							CallID:    "",
-							IPAddress: a.IPAddress,
-						})
+						h.Agents.ClearCall(tenantID, a.Name, a.CallID)
 					}
 				}
 				return
@@ -289,12 +403,7 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 			log.Printf("🗑️ Agent channel finished, removing call and resetting agent: callID=%s, agent=%s", 
 				callID, handlingAgent.Name)
 			
-			h.Agents.UpdateAgent(tenantID, monitor.AgentState{
-				Name:      handlingAgent.Name,
-				Status:    "idle",
-				CallID:    "",
-				IPAddress: handlingAgent.IPAddress,
-			})
+			h.afterCall(tenantID, *handlingAgent, call)
 			
 			h.Calls.RemoveCall(tenantID, callID)
 			
@@ -325,13 +434,8 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 		} else {
 			log.Printf("🗑️ All channels finished, removing call: callID=%s", callID)
 			
-			// Сбрасываем агента
-			h.Agents.UpdateAgent(tenantID, monitor.AgentState{
-				Name:      handlingAgent.Name,
-				Status:    "idle",
-				CallID:    "",
-				IPAddress: handlingAgent.IPAddress,
-			})
+			// Сбрасываем агента (или отправляем в wrap-up)
+			h.afterCall(tenantID, *handlingAgent, call)
 			
 			h.Calls.RemoveCall(tenantID, callID)
 			
@@ -352,7 +456,10 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 
 		ipAddress := extractIPFromAddress(ev["Address"])
 
-		if ev["PeerStatus"] == "Reachable" {
+		if ev["PeerStatus"] == "Reachable" && old.PresenceStatus() == "offline" {
+			// Регистрация — явный выход из offline, приоритет presence его не пропустит
+			h.Agents.SetAgent(tenantID, monitor.AgentState{Name: agent, Status: "idle", IPAddress: ipAddress})
+		} else if ev["PeerStatus"] == "Reachable" {
 			h.setAgentStateWithIP(tenantID, agent, "idle", "", ipAddress)
 		} else {
 			h.setAgentStateWithIP(tenantID, agent, "offline", "", ipAddress)
@@ -364,6 +471,11 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 			return
 		}
 
+		// Presence — для любого extension тенанта, не только агентов очередей
+		if h.Presence != nil {
+			h.Presence.SetDeviceState(tenantID, agent, ev["State"])
+		}
+
 		old := h.Agents.GetAgents(tenantID)[agent]
 		if old.Status == "ringing" || old.Status == "in-call" {
 			return
@@ -414,12 +526,7 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 					if !callExists {
 						log.Printf("🧹 Agent %s has non-existent call %s, resetting to idle", 
 							a.Name, a.CallID)
-						h.Agents.UpdateAgent(checkTenantID, monitor.AgentState{
-							Name:      a.Name,
-							Status:    "idle",
-							CallID:    "",
-							IPAddress: a.IPAddress,
-						})
+						h.Agents.ClearCall(checkTenantID, a.Name, a.CallID)
 					}
 				}
 			}
@@ -446,26 +553,42 @@ func (h *Handler) HandleEvent(ev map[string]string) {
 					// Сбрасываем всех агентов с этим звонком
 					h.cleanupAgentsWithCall(checkTenantID, callID)
 					
-					// Удаляем звонок
-					h.Calls.RemoveCall(checkTenantID, callID)
+					// Удаляем звонок: его конец не наблюдали, в журнал calls не пишем
+					h.Calls.DropCall(checkTenantID, callID)
 				}
 			}
 		}
 	}
 }
 
+// afterCall возвращает агента после завершённого звонка:
+// в wrap-up, если он настроен для очереди звонка, иначе в idle
+func (h *Handler) afterCall(tenantID int, agent monitor.AgentState, call monitor.Call) {
+	if h.Wrapup != nil && h.Wrapup.Start(tenantID, agent, call.ID, call.Queue) {
+		return
+	}
+	h.Agents.ClearCall(tenantID, agent.Name, agent.CallID)
+}
+
+// direction — направление звонка по второй стороне: other — её номер,
+// agentIsCaller — звонок инициировал агент
+func (h *Handler) direction(other string, agentIsCaller bool) string {
+	if h.Resolver.ResolveByExtension(other) != 0 {
+		return monitor.DirectionInternal
+	}
+	if agentIsCaller {
+		return monitor.DirectionOutbound
+	}
+	return monitor.DirectionInbound
+}
+
 // cleanupAgentsWithCall сбрасывает всех агентов у которых есть данный callId
 func (h *Handler) cleanupAgentsWithCall(tenantID int, callID string) {
 	agents := h.Agents.GetAgents(tenantID)
 	for _, a := range agents {
 		if a.CallID == callID {
 			log.Printf("🧹 Cleanup: Resetting agent %s (had stale call %s)", a.Name, callID)
-			h.Agents.UpdateAgent(tenantID, monitor.AgentState{
-				Name:      a.Name,
-				Status:    "idle",
-				CallID:    "",
-				IPAddress: a.IPAddress,
-			})
+			h.Agents.ClearCall(tenantID, a.Name, callID)
 		}
 	}
 }
@@ -485,6 +608,10 @@ func (h *Handler) setAgentState(tenantID int, agent, status, callID string) {
 }
 
 func (h *Handler) setAgentStateWithIP(tenantID int, agent, status, callID, ipAddress string) {
+	// Звонок или offline прерывают wrap-up: снимаем паузу в очереди
+	if h.Wrapup != nil && (status == "ringing" || status == "in-call" || status == "offline") {
+		h.Wrapup.Preempt(tenantID, agent, status)
+	}
 	h.Agents.UpdateAgent(tenantID, monitor.AgentState{
 		Name:      agent,
 		Status:    status,
@@ -497,7 +624,7 @@ func (h *Handler) updateAgentIP(agentName, ipAddress string) {
 	for tenantID := 110001; tenantID < 999999; tenantID++ {
 		agents := h.Agents.GetAgents(tenantID)
 		if agent, exists := agents[agentName]; exists {
-			h.setAgentStateWithIP(tenantID, agentName, agent.Status, agent.CallID, ipAddress)
+			h.setAgentStateWithIP(tenantID, agentName, agent.PresenceStatus(), agent.CallID, ipAddress)
 			log.Printf("✅ Updated IP for tenant=%d agent=%s: %s", tenantID, agentName, ipAddress)
 		}
 	}
@@ -514,6 +641,14 @@ func extractAgent(ch string) string {
 	return strings.Split(p[1], "-")[0]
 }
 
+// extractPresentity: "CustomPresence:1001" → "1001"
+func extractPresentity(presentity string) string {
+	if i := strings.LastIndex(presentity, ":"); i >= 0 {
+		return presentity[i+1:]
+	}
+	return ""
+}
+
 func extractAgentFromDevice(device string) string {
 	if strings.HasPrefix(device, "PJSIP/") {
 		return strings.TrimPrefix(device, "PJSIP/")
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"callcentrix/internal/metrics"
 )
 
 type Service struct {
@@ -38,6 +40,7 @@ func (s *Service) Start() {
 	conn, err := net.Dial("tcp", s.addr)
 	if err != nil {
 		log.Println("AMI connect error:", err)
+		metrics.AMIConnected.WithLabelValues().Set(0)
 		return
 	}
 	s.conn = conn
@@ -53,6 +56,7 @@ func (s *Service) Start() {
 	)
 
 	log.Println("✅ AMI connected")
+	metrics.AMIConnected.WithLabelValues().Set(1)
 
 	// =========================
 	// INITIAL SNAPSHOTS
@@ -63,6 +67,9 @@ func (s *Service) Start() {
 		log.Println("📡 AMI: requesting DeviceStateList")
 		_ = s.SendAction("DeviceStateList", nil)
 
+		log.Println("📡 AMI: requesting PresenceStateList")
+		_ = s.SendAction("PresenceStateList", nil)
+
 		log.Println("📡 AMI: requesting QueueStatus")
 		_ = s.SendAction("QueueStatus", nil)
 		
@@ -101,6 +108,7 @@ func (s *Service) Start() {
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			log.Println("AMI read error:", err)
+			metrics.AMIConnected.WithLabelValues().Set(0)
 			return
 		}
 
@@ -120,6 +128,7 @@ func (s *Service) Start() {
 				   strings.Contains(eventType, "Peer") {
 					log.Printf("🔍 AMI EVENT [%s]: %+v", eventType, event)
 				}
+				metrics.AMIEvents.WithLabelValues(eventType).Inc()
 				s.onEvent(event)
 			}
 			event = map[string]string{}
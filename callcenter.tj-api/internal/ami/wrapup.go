@@ -0,0 +1,192 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"callcentrix/internal/monitor"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Длительность wrap-up читается на пути AMI-событий (Hangup): кэш и таймаут,
+// чтобы медленная БД не держала обработку событий. Изменённая настройка
+// применяется не позже чем через wrapupCacheTTL.
+const (
+	wrapupCacheTTL     = time.Minute
+	wrapupQueryTimeout = 2 * time.Second
+)
+
+// WrapupManager ведёт поствызывную обработку (after-call work).
+// Состояние wrap-up хранится в самом AgentState (WrapupCallID/WrapupUntil),
+// поэтому переживает рестарт через снапшот и реплицируется как обычный статус.
+type WrapupManager struct {
+	DB     *pgxpool.Pool
+	AMI    *Service
+	Agents *monitor.Store
+
+	mu       sync.Mutex
+	settings map[wrapupKey]wrapupSetting
+}
+
+type wrapupKey struct {
+	tenantID int
+	queue    string
+}
+
+type wrapupSetting struct {
+	seconds int
+	until   time.Time
+}
+
+// Seconds — длительность wrap-up для очереди (0 = без wrap-up)
+func (m *WrapupManager) Seconds(ctx context.Context, tenantID int, queue string) int {
+	if queue == "" {
+		return 0
+	}
+	key := wrapupKey{tenantID, queue}
+	m.mu.Lock()
+	cached, ok := m.settings[key]
+	m.mu.Unlock()
+	if ok && time.Now().Before(cached.until) {
+		return cached.seconds
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wrapupQueryTimeout)
+	defer cancel()
+	var seconds int
+	err := m.DB.QueryRow(ctx,
+		`SELECT wrapup_seconds FROM queue_wrapup_settings WHERE tenant_id = $1 AND queue = $2`,
+		tenantID, queue,
+	).Scan(&seconds)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		seconds = 0
+	case err != nil:
+		// БД недоступна — старое значение (или без wrap-up), в кэш не пишем
+		log.Printf("⚠️ Wrap-up setting %s (tenant=%d): %v", queue, tenantID, err)
+		return cached.seconds
+	}
+
+	m.mu.Lock()
+	if m.settings == nil {
+		m.settings = make(map[wrapupKey]wrapupSetting)
+	}
+	m.settings[key] = wrapupSetting{seconds: seconds, until: time.Now().Add(wrapupCacheTTL)}
+	m.mu.Unlock()
+	return seconds
+}
+
+// Start переводит агента в wrap-up после звонка. false — для очереди wrap-up не настроен,
+// вызывающий сам возвращает агента в idle.
+func (m *WrapupManager) Start(tenantID int, agent monitor.AgentState, callID, queue string) bool {
+	seconds := m.Seconds(context.Background(), tenantID, queue)
+	if seconds <= 0 {
+		return false
+	}
+
+	until := time.Now().Add(time.Duration(seconds) * time.Second)
+	m.Agents.UpdateAgent(tenantID, monitor.AgentState{
+		Name:         agent.Name,
+		Status:       "wrapup",
+		IPAddress:    agent.IPAddress,
+		WrapupCallID: callID,
+		WrapupQueue:  queue,
+		WrapupUntil:  &until,
+	})
+
+	// Пауза в очереди, чтобы на время wrap-up не прилетали новые звонки
+	if err := m.pause(agent.Name, queue, true); err != nil {
+		log.Printf("❌ Wrap-up pause %s: %v", agent.Name, err)
+	}
+
+	log.Printf("📝 Wrap-up started: tenant=%d agent=%s call=%s queue=%s for %ds",
+		tenantID, agent.Name, callID, queue, seconds)
+	return true
+}
+
+// Finish завершает wrap-up агента (результат отправлен или истёк таймаут).
+// callID != "" — завершаем только если агент в wrap-up именно по этому звонку.
+func (m *WrapupManager) Finish(tenantID int, name, callID, reason string) bool {
+	agent, ok := m.Agents.GetAgents(tenantID)[name]
+	if !ok || agent.Status != "wrapup" {
+		return false
+	}
+	if callID != "" && agent.WrapupCallID != callID {
+		return false
+	}
+
+	m.unpause(agent)
+
+	m.Agents.SetAgent(tenantID, monitor.AgentState{
+		Name:      agent.Name,
+		Status:    "idle",
+		IPAddress: agent.IPAddress,
+	})
+
+	log.Printf("✅ Wrap-up finished (%s): tenant=%d agent=%s call=%s", reason, tenantID, name, agent.WrapupCallID)
+	return true
+}
+
+// Preempt снимает wrap-up, который прерывает новое состояние (звонок или offline):
+// агент возвращается в очереди, а таймер wrap-up отменяется — вызывающий следом
+// записывает состояние без WrapupUntil, и Run его больше не увидит.
+func (m *WrapupManager) Preempt(tenantID int, name, status string) {
+	agent, ok := m.Agents.GetAgents(tenantID)[name]
+	if !ok || agent.PresenceStatus() != "wrapup" {
+		return
+	}
+	m.unpause(agent)
+	log.Printf("📝 Wrap-up preempted (%s): tenant=%d agent=%s call=%s", status, tenantID, name, agent.WrapupCallID)
+}
+
+// Run раз в секунду завершает просроченные wrap-up (в т.ч. восстановленные из снапшота)
+func (m *WrapupManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for tenantID, agents := range m.Agents.Export() {
+				for name, a := range agents {
+					if a.Status == "wrapup" && (a.WrapupUntil == nil || now.After(*a.WrapupUntil)) {
+						m.Finish(tenantID, name, "", "timeout")
+					}
+				}
+			}
+		}
+	}
+}
+
+// unpause возвращает агента в очередь после wrap-up.
+// Агент, выставивший статус с паузой во время wrap-up, остаётся на паузе.
+func (m *WrapupManager) unpause(agent monitor.AgentState) {
+	if agent.Manual != nil && agent.Manual.Paused {
+		return
+	}
+	if err := m.pause(agent.Name, agent.WrapupQueue, false); err != nil {
+		log.Printf("❌ Wrap-up unpause %s: %v", agent.Name, err)
+	}
+}
+
+func (m *WrapupManager) pause(agent, queue string, paused bool) error {
+	fields := map[string]string{
+		"Interface": "PJSIP/" + agent,
+		"Paused":    "false",
+	}
+	if paused {
+		fields["Paused"] = "true"
+		fields["Reason"] = "wrapup"
+	}
+	if queue != "" {
+		fields["Queue"] = queue
+	}
+	return m.AMI.SendAction("QueuePause", fields)
+}
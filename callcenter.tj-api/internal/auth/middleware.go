@@ -52,3 +52,9 @@ func Middleware(secret string) func(http.Handler) http.Handler {
 func FromContext(ctx context.Context) AuthContext {
 	return ctx.Value(userKey).(AuthContext)
 }
+
+// WithUser кладёт пользователя в контекст — для внутренних вызовов хендлеров
+// без HTTP-запроса (рассылка отчётов по расписанию)
+func WithUser(ctx context.Context, user AuthContext) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"callcentrix/internal/monitor"
+)
+
+// =========================
+// MESSAGES
+// =========================
+
+const (
+	KindAgent    = "agent"
+	KindCall     = "call"
+	KindQueue    = "queue"
+	KindPresence = "presence"
+	KindSnapshot = "snapshot" // лидер сохранил снапшот — реплике пора пересинхронизироваться
+)
+
+// Message — одно изменение живого состояния, публикуемое лидером
+type Message struct {
+	Origin   string              `json:"origin"` // instance id отправителя
+	Seq      uint64              `json:"seq"`
+	Kind     string              `json:"kind"`
+	TenantID int                 `json:"tenantId,omitempty"`
+	Agent    *monitor.AgentState `json:"agent,omitempty"`
+	CallID   string              `json:"callId,omitempty"`
+	Call     *monitor.Call       `json:"call,omitempty"` // nil при KindCall = звонок удалён
+	Queue    *monitor.QueueStats `json:"queue,omitempty"`
+	Presence *monitor.Presence   `json:"presence,omitempty"`
+}
+
+// Bus — транспорт изменений между инстансами.
+// Реализация по умолчанию — Postgres LISTEN/NOTIFY, но подойдёт любая pub/sub шина
+// с сохранением порядка сообщений от одного отправителя.
+type Bus interface {
+	Publish(ctx context.Context, msg Message) error
+	// Subscribe блокируется до отмены ctx, вызывая fn на каждое сообщение
+	Subscribe(ctx context.Context, fn func(Message)) error
+}
+
+// =========================
+// POSTGRES LISTEN/NOTIFY
+// =========================
+
+const pgChannel = "monitor_events"
+
+type PGBus struct {
+	DB  *pgxpool.Pool
+	DSN string // для выделенного LISTEN-подключения (вне пула)
+}
+
+func (b *PGBus) Publish(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = b.DB.Exec(ctx, `SELECT pg_notify($1, $2)`, pgChannel, string(payload))
+	return err
+}
+
+func (b *PGBus) Subscribe(ctx context.Context, fn func(Message)) error {
+	for {
+		err := b.listen(ctx, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("❌ Cluster bus: LISTEN lost: %v (reconnecting)", err)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (b *PGBus) listen(ctx context.Context, fn func(Message)) error {
+	conn, err := pgx.Connect(ctx, b.DSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgChannel); err != nil {
+		return err
+	}
+	log.Println("📡 Cluster bus: listening on", pgChannel)
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			log.Printf("⚠️ Cluster bus: bad payload: %v", err)
+			continue
+		}
+		fn(msg)
+	}
+}
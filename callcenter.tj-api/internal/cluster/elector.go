@@ -0,0 +1,167 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockKey — ключ pg_advisory_lock для лидерства (любая константа, общая для всех инстансов)
+const lockKey int64 = 0x43434158 // "CCAX"
+
+// forwardedHeader помечает запрос, уже пересланный лидеру (защита от петли)
+const forwardedHeader = "X-Cluster-Forwarded"
+
+// pingTimeout — проверка подключения с локом. На полуоткрытом TCP Ping без
+// дедлайна висит вечно, а сервер уже отпустил лок и выбрал второго лидера.
+const pingTimeout = 3 * time.Second
+
+// Elector выбирает лидера через Postgres advisory lock.
+// Лок держится на выделенном подключении: пока оно живо — инстанс лидер.
+type Elector struct {
+	DB         *pgxpool.Pool
+	DSN        string
+	InstanceID string
+	URL        string // внутренний адрес этого инстанса для пересылки actions
+
+	leader atomic.Bool
+}
+
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run пытается стать лидером и вызывает onElected один раз после победы.
+// Потеря лидерства завершает процесс: AMI-подключение и сторы лидера
+// нельзя безопасно "передать" на лету, супервизор перезапустит инстанс фолловером.
+func (e *Elector) Run(ctx context.Context, onElected func(ctx context.Context)) {
+	for {
+		conn, err := pgx.Connect(ctx, e.DSN)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("❌ Cluster elector connect: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		if e.campaign(ctx, conn) {
+			e.lead(ctx, conn, onElected)
+			return
+		}
+		conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// campaign ждёт лок; false — подключение потеряно или ctx отменён
+func (e *Elector) campaign(ctx context.Context, conn *pgx.Conn) bool {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		var ok bool
+		if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey).Scan(&ok); err != nil {
+			log.Printf("❌ Cluster elector: %v", err)
+			return false
+		}
+		if ok {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) lead(ctx context.Context, conn *pgx.Conn, onElected func(ctx context.Context)) {
+	defer conn.Close(context.Background())
+
+	_, err := e.DB.Exec(ctx, `
+		INSERT INTO cluster_leader (id, instance_id, url, elected_at)
+		VALUES (1, $1, $2, NOW())
+		ON CONFLICT (id) DO UPDATE SET
+			instance_id = EXCLUDED.instance_id,
+			url         = EXCLUDED.url,
+			elected_at  = NOW()`,
+		e.InstanceID, e.URL,
+	)
+	if err != nil {
+		log.Printf("❌ Cluster elector: register leader: %v", err)
+	}
+
+	e.leader.Store(true)
+	log.Printf("👑 Cluster: instance %s is the leader", e.InstanceID)
+	onElected(ctx)
+
+	// Следим за подключением с локом
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+			err := conn.Ping(pingCtx)
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				log.Fatalf("❌ Cluster: lost leader lock connection: %v", err)
+			}
+		}
+	}
+}
+
+// LeaderURL — адрес текущего лидера из cluster_leader
+func (e *Elector) LeaderURL(ctx context.Context) (string, error) {
+	var u string
+	err := e.DB.QueryRow(ctx, `SELECT url FROM cluster_leader WHERE id = 1`).Scan(&u)
+	return u, err
+}
+
+// ForwardToLeader — middleware: на фолловере проксирует запрос лидеру как есть
+// (включая Authorization), на лидере отдаёт его следующему обработчику.
+func (e *Elector) ForwardToLeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e.IsLeader() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get(forwardedHeader) != "" {
+			http.Error(w, "leader not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		leaderURL, err := e.LeaderURL(r.Context())
+		if err != nil {
+			http.Error(w, "leader not available", http.StatusServiceUnavailable)
+			return
+		}
+		target, err := url.Parse(leaderURL)
+		if err != nil {
+			http.Error(w, "leader not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err error) {
+			log.Printf("❌ Cluster forward to %s: %v", leaderURL, err)
+			http.Error(w, "leader not available", http.StatusBadGateway)
+		}
+		r.Header.Set(forwardedHeader, e.InstanceID)
+		proxy.ServeHTTP(w, r)
+	})
+}
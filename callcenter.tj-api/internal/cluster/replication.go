@@ -0,0 +1,220 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"callcentrix/internal/monitor"
+)
+
+// =========================
+// PUBLISHER (лидер)
+// =========================
+
+// Publisher рассылает изменения сторов лидера в шину.
+// Observer-ы сторов вызываются под их локами, поэтому здесь только неблокирующая очередь.
+type Publisher struct {
+	bus    Bus
+	origin string
+	seq    atomic.Uint64
+	queue  chan Message
+}
+
+func NewPublisher(bus Bus, origin string) *Publisher {
+	return &Publisher{
+		bus:    bus,
+		origin: origin,
+		queue:  make(chan Message, 4096),
+	}
+}
+
+// Attach подписывает публикатор на изменения всех сторов
+func (p *Publisher) Attach(agents *monitor.Store, calls *monitor.CallStore, queues *monitor.QueueStore, presence *monitor.PresenceStore) {
+	agents.Observe(func(tenantID int, agent monitor.AgentState) {
+		p.enqueue(Message{Kind: KindAgent, TenantID: tenantID, Agent: &agent})
+	})
+	calls.Observe(func(tenantID int, callID string, call *monitor.Call) {
+		msg := Message{Kind: KindCall, TenantID: tenantID, CallID: callID}
+		if call != nil {
+			c := *call
+			c.Channels = append([]string(nil), call.Channels...)
+			msg.Call = &c
+		}
+		p.enqueue(msg)
+	})
+	queues.Observe(func(tenantID int, q monitor.QueueStats) {
+		p.enqueue(Message{Kind: KindQueue, TenantID: tenantID, Queue: &q})
+	})
+	presence.Observe(func(tenantID int, pr monitor.Presence) {
+		p.enqueue(Message{Kind: KindPresence, TenantID: tenantID, Presence: &pr})
+	})
+}
+
+// Seq — номер последнего поставленного в очередь изменения
+func (p *Publisher) Seq() uint64 {
+	return p.seq.Load()
+}
+
+// Snapshot сообщает репликам, что лидер сохранил снапшот с номером snap.Seq
+func (p *Publisher) Snapshot(snap *monitor.Snapshot) {
+	select {
+	case p.queue <- Message{Origin: p.origin, Seq: snap.Seq, Kind: KindSnapshot}:
+	default:
+		log.Println("⚠️ Cluster publisher: queue full, snapshot notice dropped")
+	}
+}
+
+func (p *Publisher) enqueue(msg Message) {
+	msg.Origin = p.origin
+	msg.Seq = p.seq.Add(1)
+	select {
+	case p.queue <- msg:
+	default:
+		// Реплики догонят состояние на следующем снапшоте
+		log.Printf("⚠️ Cluster publisher: queue full, dropped %s seq=%d", msg.Kind, msg.Seq)
+	}
+}
+
+// Run публикует сообщения строго по порядку одним отправителем
+func (p *Publisher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-p.queue:
+			if err := p.bus.Publish(ctx, msg); err != nil {
+				log.Printf("❌ Cluster publish %s seq=%d: %v", msg.Kind, msg.Seq, err)
+			}
+		}
+	}
+}
+
+// =========================
+// REPLICA (фолловер)
+// =========================
+
+// maxPending — сколько изменений держим между снапшотами для доигрывания
+const maxPending = 10000
+
+// Replica поддерживает копию сторов лидера: снапшот из Backend + поток изменений из шины.
+type Replica struct {
+	Agents   *monitor.Store
+	Calls    *monitor.CallStore
+	Queues   *monitor.QueueStore
+	Presence *monitor.PresenceStore
+	Backend  monitor.SnapshotBackend
+	Origin   string // свой instance id — свои сообщения игнорируем
+
+	mu      sync.Mutex
+	pending []Message // изменения с момента последней синхронизации
+}
+
+// Run синхронизируется со снапшотом и применяет изменения до отмены ctx
+func (r *Replica) Run(ctx context.Context, bus Bus) {
+	if err := r.resync(ctx, "", 0); err != nil {
+		log.Printf("❌ Replica initial sync: %v", err)
+	}
+	if err := bus.Subscribe(ctx, r.handle(ctx)); err != nil && ctx.Err() == nil {
+		log.Printf("❌ Replica subscribe: %v", err)
+	}
+}
+
+func (r *Replica) handle(ctx context.Context) func(Message) {
+	return func(msg Message) {
+		if msg.Origin == r.Origin {
+			return
+		}
+
+		if msg.Kind == KindSnapshot {
+			if err := r.resync(ctx, msg.Origin, msg.Seq); err != nil {
+				log.Printf("❌ Replica resync: %v", err)
+			}
+			return
+		}
+
+		r.mu.Lock()
+		if len(r.pending) >= maxPending {
+			r.pending = r.pending[1:]
+		}
+		r.pending = append(r.pending, msg)
+		r.mu.Unlock()
+
+		r.apply(msg)
+	}
+}
+
+// resync заменяет состояние снапшотом лидера и доигрывает изменения новее снапшота
+func (r *Replica) resync(ctx context.Context, origin string, seq uint64) error {
+	snap, err := r.Backend.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if snap == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Agents.Reset()
+	r.Calls.Reset()
+	r.Queues.Reset()
+	r.Presence.Reset()
+	for tenantID, agents := range snap.Agents {
+		for _, a := range agents {
+			r.Agents.Apply(tenantID, a)
+		}
+	}
+	for tenantID, calls := range snap.Calls {
+		for id, c := range calls {
+			c := c
+			r.Calls.Apply(tenantID, id, &c)
+		}
+	}
+	for tenantID, queues := range snap.Queues {
+		for _, q := range queues {
+			r.Queues.Apply(tenantID, q)
+		}
+	}
+	for tenantID, entries := range snap.Presence {
+		for _, pr := range entries {
+			r.Presence.Apply(tenantID, pr)
+		}
+	}
+
+	// Доигрываем изменения того же лидера, вышедшие после снапшота
+	if seq < snap.Seq {
+		seq = snap.Seq
+	}
+	kept := r.pending[:0]
+	for _, msg := range r.pending {
+		if origin != "" && msg.Origin == origin && msg.Seq > seq {
+			r.apply(msg)
+			kept = append(kept, msg)
+		}
+	}
+	r.pending = kept
+
+	return nil
+}
+
+func (r *Replica) apply(msg Message) {
+	switch msg.Kind {
+	case KindAgent:
+		if msg.Agent != nil {
+			r.Agents.Apply(msg.TenantID, *msg.Agent)
+		}
+	case KindCall:
+		r.Calls.Apply(msg.TenantID, msg.CallID, msg.Call)
+	case KindQueue:
+		if msg.Queue != nil {
+			r.Queues.Apply(msg.TenantID, *msg.Queue)
+		}
+	case KindPresence:
+		if msg.Presence != nil {
+			r.Presence.Apply(msg.TenantID, *msg.Presence)
+		}
+	}
+}
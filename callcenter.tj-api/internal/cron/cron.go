@@ -0,0 +1,149 @@
+// Package cron — разбор 5-польных cron-выражений (минута час день месяц день_недели)
+// и расчёт следующего запуска в заданном поясе.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule — разобранное выражение: биты разрешённых значений каждого поля
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Стандартная семантика cron: если ограничены и день месяца, и день недели,
+	// подходит любой из них
+	domStar, dowStar bool
+}
+
+type field struct {
+	min, max int
+}
+
+var (
+	minutes  = field{0, 59}
+	hours    = field{0, 23}
+	days     = field{1, 31}
+	months   = field{1, 12}
+	weekdays = field{0, 7} // 0 и 7 — воскресенье
+)
+
+var macros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 1", // неделя с понедельника
+	"@monthly": "0 0 1 * *",
+}
+
+// Parse разбирает выражение: числа, *, диапазоны a-b, шаг /n, списки через запятую
+// и макросы @hourly / @daily / @weekly / @monthly
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[expr]; ok {
+		expr = m
+	}
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return nil, errors.New("cron: expected 5 fields: minute hour day month weekday")
+	}
+	s := &Schedule{domStar: f[2] == "*", dowStar: f[4] == "*"}
+	var err error
+	if s.minute, err = parseField(f[0], minutes); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(f[1], hours); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(f[2], days); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(f[3], months); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(f[4], weekdays); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+		rng := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("cron: bad step in %q", part)
+			}
+			step = n
+			rng = part[:i]
+		}
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("cron: bad value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("cron: bad range %q", part)
+				}
+			} else if step > 1 {
+				hi = f.max // "5/15" — с 5 до конца диапазона
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("cron: %q out of range %d-%d", part, f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next — первый момент строго после t, подходящий под расписание, в поясе t.
+// Переход на летнее время: несуществующее локальное время time.Date сдвигает вперёд,
+// поэтому запуски в выпавший час в этот день пропускаются.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
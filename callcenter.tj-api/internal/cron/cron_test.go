@@ -0,0 +1,119 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"@yearly",
+	}
+	for _, expr := range tests {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): expected error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	dushanbe, err := time.LoadLocation("Asia/Dushanbe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04:05", s, dushanbe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	// 2026-10-19 — понедельник
+	tests := []struct {
+		expr string
+		from string
+		want string // "" — запуска нет
+	}{
+		{"0 9 * * *", "2026-10-19 08:59:00", "2026-10-19 09:00:00"},
+		{"0 9 * * *", "2026-10-19 09:00:00", "2026-10-20 09:00:00"}, // строго после
+		{"0 9 * * *", "2026-10-19 09:00:30", "2026-10-20 09:00:00"},
+		{"*/15 * * * *", "2026-10-19 10:07:30", "2026-10-19 10:15:00"},
+		{"5/20 * * * *", "2026-10-19 10:26:00", "2026-10-19 10:45:00"},
+		{"0 8,13,18 * * *", "2026-10-19 13:00:00", "2026-10-19 18:00:00"},
+		{"0 9 * * 1-5", "2026-10-23 10:00:00", "2026-10-26 09:00:00"}, // пятница → понедельник
+		{"0 12 * * 0", "2026-10-19 00:00:00", "2026-10-25 12:00:00"},
+		{"0 12 * * 7", "2026-10-19 00:00:00", "2026-10-25 12:00:00"}, // 7 — тоже воскресенье
+		{"@hourly", "2026-10-19 10:07:00", "2026-10-19 11:00:00"},
+		{"@daily", "2026-10-19 10:07:00", "2026-10-20 00:00:00"},
+		{"@weekly", "2026-10-19 00:00:00", "2026-10-26 00:00:00"},
+		{"@monthly", "2026-10-19 10:07:00", "2026-11-01 00:00:00"},
+		{"0 0 31 * *", "2026-11-01 00:00:00", "2026-12-31 00:00:00"}, // в ноябре 31-го нет
+		{"0 0 13 * 5", "2026-10-19 00:00:00", "2026-10-23 00:00:00"}, // день месяца ИЛИ день недели
+		{"0 0 13 * *", "2026-10-19 00:00:00", "2026-11-13 00:00:00"},
+		{"0 0 29 2 *", "2026-10-19 00:00:00", "2028-02-29 00:00:00"},
+		{"0 0 30 2 *", "2026-10-19 00:00:00", ""},
+		{"59 23 31 12 *", "2026-12-31 23:58:00", "2026-12-31 23:59:00"},
+		{"0 0 1 1 *", "2026-12-31 23:59:00", "2027-01-01 00:00:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		got := s.Next(at(tt.from))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("Next(%q, %s) = %s, want none", tt.expr, tt.from, got)
+			}
+			continue
+		}
+		if want := at(tt.want); !got.Equal(want) {
+			t.Errorf("Next(%q, %s) = %s, want %s", tt.expr, tt.from, got.Format(time.DateTime), tt.want)
+		}
+		if got.Location() != dushanbe {
+			t.Errorf("Next(%q) location = %s, want %s", tt.expr, got.Location(), dushanbe)
+		}
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Через переход на летнее время (28.03.2027) — те же 09:00 по местному времени
+	got := s.Next(time.Date(2027, 3, 27, 10, 0, 0, 0, berlin))
+	if want := time.Date(2027, 3, 28, 9, 0, 0, 0, berlin); !got.Equal(want) {
+		t.Fatalf("Next across DST = %s, want %s", got, want)
+	}
+	if got.Sub(time.Date(2027, 3, 27, 9, 0, 0, 0, berlin)) != 23*time.Hour {
+		t.Errorf("day of DST switch should be 23h long")
+	}
+
+	// 02:30 28.03.2027 не существует — запуск в этот день пропускается
+	s, _ = Parse("30 2 * * *")
+	got = s.Next(time.Date(2027, 3, 27, 3, 0, 0, 0, berlin))
+	if want := time.Date(2027, 3, 29, 2, 30, 0, 0, berlin); !got.Equal(want) {
+		t.Fatalf("Next over missing local time = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"callcentrix/internal/auth"
+)
+
+// =========================
+// MODELS
+// =========================
+
+// AgentReportRow — показатели агента за период.
+// Звонки — из ast_cdr по users.sipno: входящие (dst = sipno) и исходящие (src = sipno).
+type AgentReportRow struct {
+	UserID    int    `json:"userId"`
+	Name      string `json:"name"`
+	Extension string `json:"extension"`
+
+	Offered          int     `json:"offered"` // входящие на агента
+	Answered         int     `json:"answered"`
+	Missed           int     `json:"missed"` // не отвечены / нет ответа / занято
+	Outbound         int     `json:"outbound"`
+	OutboundAnswered int     `json:"outboundAnswered"`
+	AHT              float64 `json:"aht"`            // средний разговор по отвеченным входящим и исходящим, с
+	TalkSeconds      int     `json:"talkSeconds"`    // сумма billsec отвеченных
+	AvgRingSeconds   float64 `json:"avgRingSeconds"` // duration − billsec по отвеченным входящим
+
+	PauseSeconds  int `json:"pauseSeconds"` // из agent_state_history
+	WrapupSeconds int `json:"wrapupSeconds"`
+
+	TicketsCreated int `json:"ticketsCreated"` // crm_tickets.created_by
+	TicketsClosed  int `json:"ticketsClosed"`  // assigned_to, закрыт (is_closed) и обновлён в периоде
+}
+
+type AgentReportResponse struct {
+	ReportZone
+	DateFrom time.Time        `json:"dateFrom"`
+	DateTo   time.Time        `json:"dateTo"`
+	Agents   []AgentReportRow `json:"agents"`
+}
+
+// ============================================================
+// REPORT
+// ============================================================
+
+// GetAgentReport godoc
+// @Summary      Показатели агентов за период
+// @Description  Звонки (ast_cdr по sipno), время паузы и wrap-up (история состояний), тикеты CRM. Без dateFrom — последние 30 дней, без dateTo — до текущего момента.
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        dateFrom  query  string  false  "RFC3339 или дата в поясе компании"
+// @Param        dateTo    query  string  false  "RFC3339 или дата в поясе компании (включительно)"
+// @Param        tz        query  string  false  "IANA пояс, по умолчанию — пояс компании"
+// @Param        agentId   query  int     false  "Только этот агент (users.id)"
+// @Success      200  {object}  AgentReportResponse
+// @Router       /api/reports/agents [get]
+func (h *CDRHandler) GetAgentReport(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	q := r.URL.Query()
+
+	loc, err := reportLocation(r.Context(), h.DB, user.TenantID, q)
+	if err != nil {
+		http.Error(w, "invalid tz", http.StatusBadRequest)
+		return
+	}
+	resp := AgentReportResponse{
+		ReportZone: reportZone(loc),
+		DateTo:     time.Now().In(loc).Truncate(time.Second),
+		Agents:     make([]AgentReportRow, 0),
+	}
+	if t, ok := parseReportTime(q.Get("dateTo"), loc, true); ok {
+		resp.DateTo = t.In(loc)
+	}
+	if t, ok := parseReportTime(q.Get("dateFrom"), loc, false); ok {
+		resp.DateFrom = t.In(loc)
+	} else {
+		resp.DateFrom = resp.DateTo.AddDate(0, 0, -30)
+	}
+	if !resp.DateFrom.Before(resp.DateTo) {
+		http.Error(w, "dateFrom must be before dateTo", http.StatusBadRequest)
+		return
+	}
+
+	filter := CDRFilter{DateFrom: resp.DateFrom.Format(time.RFC3339Nano), DateTo: resp.DateTo.Format(time.RFC3339Nano)}
+	where, args := filter.where(user.TenantID)
+	from := "$" + strconv.Itoa(len(args)+1)
+	to := "$" + strconv.Itoa(len(args)+2)
+	args = append(args, resp.DateFrom, resp.DateTo)
+
+	agentFilter := ""
+	if v, err := strconv.Atoi(q.Get("agentId")); err == nil {
+		args = append(args, v)
+		agentFilter = " AND u.id = $" + strconv.Itoa(len(args))
+	}
+
+	// st — интервалы состояний в периоде: переходы внутри него плюс последнее
+	// состояние до его начала; конец интервала — следующий переход агента
+	rows, err := h.DB.Query(r.Context(), `
+		WITH c AS (
+			SELECT c.src, c.dst, c.disposition, c.billsec, c.duration
+			FROM ast_cdr c
+			`+where+`
+		),
+		inb AS (
+			SELECT dst AS ext,
+			       COUNT(*) AS offered,
+			       COUNT(*) FILTER (WHERE disposition = 'ANSWERED') AS answered,
+			       COALESCE(SUM(billsec) FILTER (WHERE disposition = 'ANSWERED'), 0) AS talk,
+			       AVG(duration - billsec) FILTER (WHERE disposition = 'ANSWERED') AS ring
+			FROM c GROUP BY dst
+		),
+		outb AS (
+			SELECT src AS ext,
+			       COUNT(*) AS calls,
+			       COUNT(*) FILTER (WHERE disposition = 'ANSWERED') AS answered,
+			       COALESCE(SUM(billsec) FILTER (WHERE disposition = 'ANSWERED'), 0) AS talk
+			FROM c GROUP BY src
+		),
+		st AS (
+			SELECT agent, status, changed_at,
+			       LEAD(changed_at, 1, LEAST(NOW(), `+to+`)) OVER (PARTITION BY agent ORDER BY changed_at) AS next_at
+			FROM (
+				SELECT agent, status, changed_at FROM agent_state_history
+				WHERE tenant_id = $1 AND changed_at >= `+from+` AND changed_at < `+to+`
+				UNION ALL
+				(SELECT DISTINCT ON (agent) agent, status, changed_at FROM agent_state_history
+				 WHERE tenant_id = $1 AND changed_at < `+from+`
+				 ORDER BY agent, changed_at DESC)
+			) x
+		),
+		states AS (
+			SELECT agent,
+			       SUM(EXTRACT(EPOCH FROM LEAST(next_at, `+to+`) - GREATEST(changed_at, `+from+`)))
+			           FILTER (WHERE status = 'paused') AS paused,
+			       SUM(EXTRACT(EPOCH FROM LEAST(next_at, `+to+`) - GREATEST(changed_at, `+from+`)))
+			           FILTER (WHERE status = 'wrapup') AS wrapup
+			FROM st
+			WHERE next_at > `+from+`
+			GROUP BY agent
+		),
+		created AS (
+			SELECT created_by AS user_id, COUNT(*) AS n FROM crm_tickets
+			WHERE tenant_id = $1 AND created_at >= `+from+` AND created_at < `+to+`
+			GROUP BY created_by
+		),
+		closed AS (
+			SELECT t.assigned_to AS user_id, COUNT(*) AS n FROM crm_tickets t
+			JOIN crm_statuses s ON s.id = t.status_id
+			WHERE t.tenant_id = $1 AND s.is_closed AND t.updated_at >= `+from+` AND t.updated_at < `+to+`
+			GROUP BY t.assigned_to
+		)
+		SELECT u.id, `+userNameSQL+`, u.sipno::text,
+		       COALESCE(i.offered, 0), COALESCE(i.answered, 0),
+		       COALESCE(o.calls, 0), COALESCE(o.answered, 0),
+		       COALESCE(i.talk, 0) + COALESCE(o.talk, 0),
+		       COALESCE(i.ring, 0),
+		       COALESCE(s.paused, 0)::int, COALESCE(s.wrapup, 0)::int,
+		       COALESCE(tc.n, 0), COALESCE(tx.n, 0)
+		FROM users u
+		LEFT JOIN inb i     ON i.ext = u.sipno::text
+		LEFT JOIN outb o    ON o.ext = u.sipno::text
+		LEFT JOIN states s  ON s.agent = u.sipno::text
+		LEFT JOIN created tc ON tc.user_id = u.id
+		LEFT JOIN closed tx  ON tx.user_id = u.id
+		WHERE u.tenant_id = $1 AND u.sipno IS NOT NULL`+agentFilter+`
+		ORDER BY 2`,
+		args...)
+	if err != nil {
+		log.Printf("❌ GetAgentReport: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row AgentReportRow
+		if err := rows.Scan(&row.UserID, &row.Name, &row.Extension,
+			&row.Offered, &row.Answered, &row.Outbound, &row.OutboundAnswered,
+			&row.TalkSeconds, &row.AvgRingSeconds, &row.PauseSeconds, &row.WrapupSeconds,
+			&row.TicketsCreated, &row.TicketsClosed); err != nil {
+			log.Printf("❌ GetAgentReport scan: %v", err)
+			continue
+		}
+		row.Missed = row.Offered - row.Answered
+		if handled := row.Answered + row.OutboundAnswered; handled > 0 {
+			row.AHT = float64(row.TalkSeconds) / float64(handled)
+		}
+		resp.Agents = append(resp.Agents, row)
+	}
+	jsonResp(w, resp)
+}
+
+// GetAgentCalls godoc
+// @Summary      Звонки агента (drill-down отчёта по агентам)
+// @Description  Отчёт звонков с участием агента (src или dst = sipno): те же фильтры, пагинация и ссылки на записи, что у /api/reports/calls
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        userId    path   int     true   "Агент (users.id)"
+// @Param        dateFrom  query  string  false  "RFC3339"
+// @Param        dateTo    query  string  false  "RFC3339"
+// @Param        page      query  int     false  "Страница"
+// @Param        perPage   query  int     false  "до 200"
+// @Success      200  {object}  CDRResponse
+// @Router       /api/reports/agents/{userId}/calls [get]
+func (h *CDRHandler) GetAgentCalls(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	userID, err := chiID(r, "userId")
+	if err != nil {
+		http.Error(w, "invalid userId", http.StatusBadRequest)
+		return
+	}
+	var ext *string
+	err = h.DB.QueryRow(r.Context(),
+		`SELECT sipno::text FROM users WHERE id=$1 AND tenant_id=$2`,
+		userID, user.TenantID,
+	).Scan(&ext)
+	if err != nil || ext == nil {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	q.Set("agent", *ext)
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = q.Encode()
+	h.GetCDR(w, r2)
+}
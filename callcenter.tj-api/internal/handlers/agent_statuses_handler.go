@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"callcentrix/internal/auth"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AgentStatusesHandler — каталог ручных статусов агентов тенанта ("Совещание", "Обучение"...)
+type AgentStatusesHandler struct {
+	DB *pgxpool.Pool
+}
+
+// =========================
+// MODELS
+// =========================
+
+type AgentStatusRequest struct {
+	Code        string  `json:"code"`
+	Name        string  `json:"name"`
+	Color       *string `json:"color"`
+	PausesQueue *bool   `json:"pausesQueue"` // по умолчанию true
+	SortOrder   int     `json:"sortOrder"`
+	Active      *bool   `json:"active"`
+}
+
+type AgentStatusResponse struct {
+	ID          int       `json:"id"`
+	TenantID    int       `json:"tenantId"`
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Color       *string   `json:"color"`
+	PausesQueue bool      `json:"pausesQueue"`
+	SortOrder   int       `json:"sortOrder"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+const agentStatusColumns = `id, tenant_id, code, name, color, pauses_queue, sort_order, active, created_at`
+
+func scanAgentStatus(row interface{ Scan(...any) error }, s *AgentStatusResponse) error {
+	return row.Scan(&s.ID, &s.TenantID, &s.Code, &s.Name, &s.Color, &s.PausesQueue, &s.SortOrder, &s.Active, &s.CreatedAt)
+}
+
+// ============================================================
+// CATALOG
+// ============================================================
+
+// GetAgentStatuses godoc
+// @Summary      Каталог статусов агентов
+// @Tags         AgentStatuses
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  AgentStatusResponse
+// @Router       /api/agent-statuses [get]
+func (h *AgentStatusesHandler) GetAgentStatuses(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+agentStatusColumns+` FROM agent_statuses WHERE tenant_id=$1 ORDER BY sort_order, name`,
+		user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]AgentStatusResponse, 0)
+	for rows.Next() {
+		var s AgentStatusResponse
+		scanAgentStatus(rows, &s)
+		result = append(result, s)
+	}
+	jsonResp(w, result)
+}
+
+// CreateAgentStatus godoc
+// @Summary      Создать статус агента
+// @Tags         AgentStatuses
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  AgentStatusRequest  true  "Статус"
+// @Success      201  {object}  AgentStatusResponse
+// @Failure      409  {string}  string  "status with this code already exists"
+// @Router       /api/agent-statuses [post]
+func (h *AgentStatusesHandler) CreateAgentStatus(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	var req AgentStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.Name == "" {
+		http.Error(w, "code and name are required", http.StatusBadRequest)
+		return
+	}
+	pauses, active := true, true
+	if req.PausesQueue != nil {
+		pauses = *req.PausesQueue
+	}
+	if req.Active != nil {
+		active = *req.Active
+	}
+	var s AgentStatusResponse
+	err := scanAgentStatus(h.DB.QueryRow(r.Context(),
+		`INSERT INTO agent_statuses (tenant_id, code, name, color, pauses_queue, sort_order, active)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)
+		 RETURNING `+agentStatusColumns,
+		user.TenantID, req.Code, req.Name, req.Color, pauses, req.SortOrder, active), &s)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "status with this code already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("✅ Agent status created: id=%d tenant=%d code=%s", s.ID, s.TenantID, s.Code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// UpdateAgentStatus godoc
+// @Summary      Обновить статус агента
+// @Description  Агенты, уже находящиеся в статусе, получат изменения при следующей его установке
+// @Tags         AgentStatuses
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                 true  "ID"
+// @Param        body  body  AgentStatusRequest  true  "Статус"
+// @Success      200  {object}  AgentStatusResponse
+// @Router       /api/agent-statuses/{id} [put]
+func (h *AgentStatusesHandler) UpdateAgentStatus(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req AgentStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.Name == "" {
+		http.Error(w, "code and name are required", http.StatusBadRequest)
+		return
+	}
+	var s AgentStatusResponse
+	err = scanAgentStatus(h.DB.QueryRow(r.Context(),
+		`UPDATE agent_statuses SET code=$1, name=$2, color=$3, pauses_queue=COALESCE($4, pauses_queue),
+		        sort_order=$5, active=COALESCE($6, active)
+		 WHERE id=$7 AND tenant_id=$8
+		 RETURNING `+agentStatusColumns,
+		req.Code, req.Name, req.Color, req.PausesQueue, req.SortOrder, req.Active, id, user.TenantID), &s)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "status with this code already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	jsonResp(w, s)
+}
+
+// DeleteAgentStatus godoc
+// @Summary      Удалить статус агента
+// @Tags         AgentStatuses
+// @Security     BearerAuth
+// @Param        id  path  int  true  "ID"
+// @Success      204  "No Content"
+// @Router       /api/agent-statuses/{id} [delete]
+func (h *AgentStatusesHandler) DeleteAgentStatus(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM agent_statuses WHERE id=$1 AND tenant_id=$2`, id, user.TenantID)
+	if err != nil || tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,843 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"callcentrix/internal/auth"
+	"callcentrix/internal/pdf"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BillingHandler — счета компаний по тарифу за календарный месяц (в поясе
+// компании): абонентская плата, операторы сверх max_operators (пик за месяц
+// по дневным замерам) и исходящие из ast_cdr — по сетке цен тарифа, а вне её
+// по минутной цене. Замеры операторов и счета за закрытый месяц делает Run на
+// лидере; суперадмин смотрит счета, выгружает их в PDF, пересчитывает
+// неоплаченные и отмечает оплату.
+type BillingHandler struct {
+	DB       *pgxpool.Pool
+	PDFFont  *pdf.Font // nil — встроенный Helvetica без кириллицы
+	Currency string    // валюта счетов: TJS
+}
+
+var (
+	errBillingNoCompany = errors.New("company not found")
+	errBillingNoTariff  = errors.New("company has no tariff")
+)
+
+// =========================
+// MODELS
+// =========================
+
+type InvoiceLine struct {
+	Position    int     `json:"position"`
+	Kind        string  `json:"kind"` // tariff / operators / outbound
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+	Amount      float64 `json:"amount"`
+}
+
+type Invoice struct {
+	ID         int64         `json:"id"`
+	TenantID   int           `json:"tenantId"`
+	Number     string        `json:"number"`
+	Period     string        `json:"period"` // 2026-09
+	TenantName string        `json:"tenantName"`
+	TaxID      *string       `json:"taxId"`
+	TariffID   *int          `json:"tariffId"`
+	TariffName *string       `json:"tariffName"`
+	TimeZone   string        `json:"timeZone"` // пояс компании, в котором считался месяц
+	Currency   string        `json:"currency"`
+	Total      float64       `json:"total"`
+	Status     string        `json:"status"` // unpaid / paid
+	PaidAt     *time.Time    `json:"paidAt"`
+	PaidBy     *int          `json:"paidBy"`
+	Note       *string       `json:"note"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	Lines      []InvoiceLine `json:"lines,omitempty"`
+}
+
+type InvoiceListResponse struct {
+	Invoices    []Invoice `json:"invoices"`
+	Total       int       `json:"total"`
+	UnpaidSum   float64   `json:"unpaidSum"` // неоплачено по фильтру
+	UnpaidCount int       `json:"unpaidCount"`
+	Page        int       `json:"page"`
+	PerPage     int       `json:"perPage"`
+}
+
+type GenerateInvoicesRequest struct {
+	Period   string `json:"period"`   // 2026-09; пусто — прошлый месяц
+	TenantID int    `json:"tenantId"` // 0 — все активные компании с тарифом
+}
+
+// InvoiceSkip — компания, по которой счёт не сформирован
+type InvoiceSkip struct {
+	TenantID int    `json:"tenantId"`
+	Reason   string `json:"reason"` // no tariff / invoice is paid / …
+}
+
+type GenerateInvoicesResponse struct {
+	Invoices []Invoice     `json:"invoices"`
+	Skipped  []InvoiceSkip `json:"skipped"`
+}
+
+type SetInvoiceStatusRequest struct {
+	Status string `json:"status"` // paid / unpaid
+	Note   string `json:"note"`
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// GetInvoices godoc
+// @Summary      Счета компаний
+// @Description  Только суперадмин. Новые периоды сверху.
+// @Tags         Billing
+// @Security     BearerAuth
+// @Produce      json
+// @Param        tenantId  query  int     false  "Компания"
+// @Param        status    query  string  false  "unpaid / paid"
+// @Param        period    query  string  false  "Месяц: 2026-09"
+// @Param        page      query  int     false  "Страница"
+// @Param        perPage   query  int     false  "до 200"
+// @Success      200  {object}  InvoiceListResponse
+// @Router       /api/billing/invoices [get]
+func (h *BillingHandler) GetInvoices(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 0 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(q.Get("perPage"))
+	if perPage < 1 || perPage > 200 {
+		perPage = 50
+	}
+
+	where := " WHERE TRUE"
+	args := []any{}
+	if v := q.Get("tenantId"); v != "" {
+		tenantID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid tenantId", http.StatusBadRequest)
+			return
+		}
+		args = append(args, tenantID)
+		where += " AND i.tenant_id = $" + strconv.Itoa(len(args))
+	}
+	switch status := q.Get("status"); status {
+	case "":
+	case "unpaid", "paid":
+		args = append(args, status)
+		where += " AND i.status = $" + strconv.Itoa(len(args))
+	default:
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("period"); v != "" {
+		period, err := time.Parse("2006-01", v)
+		if err != nil {
+			http.Error(w, "invalid period", http.StatusBadRequest)
+			return
+		}
+		args = append(args, period)
+		where += " AND i.period = $" + strconv.Itoa(len(args))
+	}
+
+	resp := InvoiceListResponse{Invoices: make([]Invoice, 0), Page: page, PerPage: perPage}
+	if err := h.DB.QueryRow(r.Context(), `
+		SELECT COUNT(*),
+		       COALESCE(SUM(i.total) FILTER (WHERE i.status = 'unpaid'), 0),
+		       COUNT(*) FILTER (WHERE i.status = 'unpaid')
+		FROM invoices i`+where, args...,
+	).Scan(&resp.Total, &resp.UnpaidSum, &resp.UnpaidCount); err != nil {
+		log.Printf("❌ GetInvoices count: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	idx := len(args) + 1
+	rows, err := h.DB.Query(r.Context(), invoiceSelect+where+`
+		ORDER BY i.period DESC, i.tenant_name, i.id
+		LIMIT $`+strconv.Itoa(idx)+` OFFSET $`+strconv.Itoa(idx+1),
+		append(args, perPage, (page-1)*perPage)...)
+	if err != nil {
+		log.Printf("❌ GetInvoices: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			log.Printf("❌ GetInvoices scan: %v", err)
+			continue
+		}
+		resp.Invoices = append(resp.Invoices, inv)
+	}
+	jsonResp(w, resp)
+}
+
+// GetInvoice godoc
+// @Summary      Счёт с позициями
+// @Tags         Billing
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID счёта"
+// @Success      200  {object}  Invoice
+// @Router       /api/billing/invoices/{id} [get]
+func (h *BillingHandler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.invoiceFromPath(w, r)
+	if !ok {
+		return
+	}
+	jsonResp(w, inv)
+}
+
+// GetInvoicePDF godoc
+// @Summary      Счёт в PDF
+// @Tags         Billing
+// @Security     BearerAuth
+// @Produce      application/pdf
+// @Param        id  path  int  true  "ID счёта"
+// @Success      200  {file}  file
+// @Router       /api/billing/invoices/{id}/pdf [get]
+func (h *BillingHandler) GetInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.invoiceFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := invoiceDocument(&inv).Write(&buf, h.PDFFont); err != nil {
+		log.Printf("❌ Invoice %d PDF: %v", inv.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="invoice_`+inv.Number+`.pdf"`)
+	w.Write(buf.Bytes())
+}
+
+// SetInvoiceStatus godoc
+// @Summary      Отметить оплату счёта
+// @Description  paid — оплачен (время и автор фиксируются), unpaid — снять отметку. Оплаченный счёт не пересчитывается.
+// @Tags         Billing
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                      true  "ID счёта"
+// @Param        body  body  SetInvoiceStatusRequest  true  "Статус"
+// @Success      200  {object}  Invoice
+// @Router       /api/billing/invoices/{id}/status [patch]
+func (h *BillingHandler) SetInvoiceStatus(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 0 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req SetInvoiceStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.Status != "paid" && req.Status != "unpaid" {
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `
+		UPDATE invoices SET
+			status  = $2,
+			paid_at = CASE WHEN $2 = 'paid' THEN COALESCE(paid_at, NOW()) END,
+			paid_by = CASE WHEN $2 = 'paid' THEN COALESCE(paid_by, $3) END,
+			note    = COALESCE($4, note)
+		WHERE id = $1`,
+		id, req.Status, user.UserID, nullStr(req.Note))
+	if err != nil {
+		log.Printf("❌ SetInvoiceStatus: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("📝 Invoice %d: %s (user %d)", id, req.Status, user.UserID)
+
+	inv, err := h.load(r.Context(), int64(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, inv)
+}
+
+// GenerateInvoices godoc
+// @Summary      Сформировать счета за месяц
+// @Description  Считает начисления и сохраняет счёт; неоплаченный счёт за тот же месяц пересчитывается, оплаченный остаётся как есть. Без tenantId — все активные компании с тарифом.
+// @Tags         Billing
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  GenerateInvoicesRequest  true  "Месяц и компания"
+// @Success      200  {object}  GenerateInvoicesResponse
+// @Router       /api/billing/invoices/generate [post]
+func (h *BillingHandler) GenerateInvoices(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 0 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req GenerateInvoicesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	var year int
+	var month time.Month
+	if req.Period == "" {
+		// Прошлый месяц по UTC; у каждой компании границы месяца — в её поясе
+		now := time.Now().UTC()
+		prev := now.AddDate(0, 0, -now.Day())
+		year, month = prev.Year(), prev.Month()
+	} else {
+		p, err := time.Parse("2006-01", req.Period)
+		if err != nil {
+			http.Error(w, "invalid period", http.StatusBadRequest)
+			return
+		}
+		year, month = p.Year(), p.Month()
+	}
+
+	tenants := []int{req.TenantID}
+	if req.TenantID == 0 {
+		var err error
+		if tenants, err = h.billableTenants(r.Context()); err != nil {
+			log.Printf("❌ GenerateInvoices: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := GenerateInvoicesResponse{Invoices: make([]Invoice, 0), Skipped: make([]InvoiceSkip, 0)}
+	for _, tenantID := range tenants {
+		inv, err := h.compute(r.Context(), tenantID, year, month)
+		if errors.Is(err, errBillingNoCompany) && req.TenantID != 0 {
+			http.Error(w, "company not found", http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			var saved bool
+			if saved, err = h.save(r.Context(), inv, true); err == nil && !saved {
+				err = errors.New("invoice is paid")
+			}
+		}
+		if err != nil {
+			resp.Skipped = append(resp.Skipped, InvoiceSkip{TenantID: tenantID, Reason: err.Error()})
+			continue
+		}
+		resp.Invoices = append(resp.Invoices, *inv)
+	}
+
+	log.Printf("📝 Invoices %04d-%02d by user %d: %d generated, %d skipped",
+		year, month, user.UserID, len(resp.Invoices), len(resp.Skipped))
+	jsonResp(w, resp)
+}
+
+// GetBillingUsage godoc
+// @Summary      Начисления компании за месяц без сохранения счёта
+// @Description  По умолчанию — текущий месяц (начислено на сейчас).
+// @Tags         Billing
+// @Security     BearerAuth
+// @Produce      json
+// @Param        tenantId  query  int     true   "Компания"
+// @Param        period    query  string  false  "Месяц: 2026-09"
+// @Success      200  {object}  Invoice
+// @Router       /api/billing/usage [get]
+func (h *BillingHandler) GetBillingUsage(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 0 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+
+	tenantID, err := strconv.Atoi(q.Get("tenantId"))
+	if err != nil {
+		http.Error(w, "invalid tenantId", http.StatusBadRequest)
+		return
+	}
+	now := time.Now().In(tenantLocation(r.Context(), h.DB, tenantID))
+	year, month := now.Year(), now.Month()
+	if v := q.Get("period"); v != "" {
+		p, err := time.Parse("2006-01", v)
+		if err != nil {
+			http.Error(w, "invalid period", http.StatusBadRequest)
+			return
+		}
+		year, month = p.Year(), p.Month()
+	}
+
+	inv, err := h.compute(r.Context(), tenantID, year, month)
+	switch {
+	case errors.Is(err, errBillingNoCompany):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errBillingNoTariff):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("❌ GetBillingUsage: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, inv)
+}
+
+// ============================================================
+// WORKER (лидер)
+// ============================================================
+
+// Run раз в час замеряет число операторов компаний и формирует счета за
+// прошедший месяц тем, у кого их ещё нет. Пересчитать счёт — GenerateInvoices.
+func (h *BillingHandler) Run(ctx context.Context) {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for {
+		h.countOperators(ctx)
+		h.closeMonth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// countOperators запоминает максимум операторов компании за день (в её поясе)
+func (h *BillingHandler) countOperators(ctx context.Context) {
+	tenants, err := h.billableTenants(ctx)
+	if err != nil {
+		log.Printf("❌ Billing operators: %v", err)
+		return
+	}
+	for _, tenantID := range tenants {
+		day := time.Now().In(tenantLocation(ctx, h.DB, tenantID)).Format("2006-01-02")
+		if _, err := h.DB.Exec(ctx, `
+			INSERT INTO billing_operator_counts (tenant_id, day, operators)
+			SELECT $1, $2::date, COUNT(*) FROM users WHERE tenant_id = $1 AND status = 'enable'
+			ON CONFLICT (tenant_id, day) DO UPDATE
+				SET operators = GREATEST(billing_operator_counts.operators, EXCLUDED.operators)`,
+			tenantID, day); err != nil {
+			log.Printf("❌ Billing operators tenant %d: %v", tenantID, err)
+		}
+	}
+}
+
+// closeMonth формирует счета за прошлый месяц (в поясе компании), если их нет
+func (h *BillingHandler) closeMonth(ctx context.Context) {
+	tenants, err := h.billableTenants(ctx)
+	if err != nil {
+		log.Printf("❌ Billing: %v", err)
+		return
+	}
+	for _, tenantID := range tenants {
+		now := time.Now().In(tenantLocation(ctx, h.DB, tenantID))
+		prev := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+
+		var exists bool
+		if err := h.DB.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM invoices WHERE tenant_id = $1 AND period = $2)`,
+			tenantID, prev,
+		).Scan(&exists); err != nil || exists {
+			continue
+		}
+
+		inv, err := h.compute(ctx, tenantID, prev.Year(), prev.Month())
+		if err == nil {
+			_, err = h.save(ctx, inv, false)
+		}
+		if err != nil {
+			log.Printf("❌ Invoice tenant %d %s: %v", tenantID, prev.Format("2006-01"), err)
+			continue
+		}
+		log.Printf("📝 Invoice %s: tenant %d, %.2f %s", inv.Number, tenantID, inv.Total, inv.Currency)
+	}
+}
+
+// ============================================================
+// CHARGES
+// ============================================================
+
+// compute считает начисления компании за месяц; счёт не сохраняется (ID = 0)
+func (h *BillingHandler) compute(ctx context.Context, tenantID, year int, month time.Month) (*Invoice, error) {
+	inv := &Invoice{TenantID: tenantID, Currency: h.Currency, Status: "unpaid", CreatedAt: time.Now()}
+
+	var u billingUsage
+	err := h.DB.QueryRow(ctx, `
+		SELECT t.name, t.tax_id, t.tariff_id, tr.name,
+		       tr.max_operators, tr.monthly_fee, tr.extra_operator_fee, tr.outbound_minute_price
+		FROM crm_tenants t
+		LEFT JOIN crm_tarrifs tr ON tr.id = t.tariff_id
+		WHERE t.tenant_id = $1`, tenantID,
+	).Scan(&inv.TenantName, &inv.TaxID, &inv.TariffID, &inv.TariffName, &u.maxOps, &u.fee, &u.extraFee, &u.minutePrice)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errBillingNoCompany
+	}
+	if err != nil {
+		return nil, err
+	}
+	if inv.TariffName == nil {
+		return nil, errBillingNoTariff
+	}
+
+	// Границы месяца — в поясе компании
+	loc := tenantLocation(ctx, h.DB, tenantID)
+	from := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 1, 0)
+	inv.Period = from.Format("2006-01")
+	inv.Number = fmt.Sprintf("%s-%04d", from.Format("200601"), tenantID)
+	inv.TimeZone = loc.String()
+
+	// Пик операторов по дневным замерам. Замеров за месяц нет: идущий месяц —
+	// сколько операторов сейчас, прошедший — 0 (сегодняшний штат к прошлому
+	// месяцу отношения не имеет, сверх тарифа не начисляем)
+	var operators *int
+	if err := h.DB.QueryRow(ctx, `
+		SELECT MAX(operators) FROM billing_operator_counts
+		WHERE tenant_id = $1 AND day >= $2::date AND day < $3::date`,
+		tenantID, from.Format("2006-01-02"), to.Format("2006-01-02"),
+	).Scan(&operators); err != nil {
+		return nil, err
+	}
+	switch now := time.Now(); {
+	case operators != nil:
+		u.operators = *operators
+	case !now.Before(from) && now.Before(to):
+		if err := h.DB.QueryRow(ctx,
+			`SELECT COUNT(*) FROM users WHERE tenant_id = $1 AND status = 'enable'`, tenantID,
+		).Scan(&u.operators); err != nil {
+			return nil, err
+		}
+	default:
+		log.Printf("⚠️ Billing tenant %d %s: no operator samples, operators not charged", tenantID, inv.Period)
+	}
+
+	// Исходящие: отвеченные звонки с номера пользователя компании на внешний
+	// номер (как направление в /api/reports/calls/series). Оценённые по сетке
+	// тарифа (ast_cdr.cost) — строкой на направление, остальные — по минутной
+	// цене тарифа, минуты — начатые
+	outbound := `
+		FROM ast_cdr c
+		WHERE c.lastapp != 'Hangup'
+		  AND c.tenant_id = $1
+		  AND c.calldate AT TIME ZONE 'UTC' >= $2
+		  AND c.calldate AT TIME ZONE 'UTC' <  $3
+		  AND c.disposition = 'ANSWERED' AND c.billsec > 0`
+	rows, err := h.DB.Query(ctx, `
+		SELECT c.rate_prefix,
+		       COALESCE((SELECT destination FROM rate_deck WHERE tariff_id = $4 AND prefix = c.rate_prefix), ''),
+		       COUNT(*), SUM(c.rated_seconds), SUM(c.cost)`+outbound+` AND c.cost IS NOT NULL
+		GROUP BY c.rate_prefix
+		ORDER BY SUM(c.cost) DESC, c.rate_prefix`,
+		tenantID, from.UTC(), to.UTC(), *inv.TariffID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d ratedDirection
+		if err := rows.Scan(&d.prefix, &d.name, &d.calls, &d.seconds, &d.cost); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		u.rated = append(u.rated, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := h.DB.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(CEIL(c.billsec / 60.0)), 0)`+outbound+`
+		  AND c.cost IS NULL AND c.direction = 'outbound'`,
+		tenantID, from.UTC(), to.UTC(),
+	).Scan(&u.calls, &u.minutes); err != nil {
+		return nil, err
+	}
+
+	inv.charge(&u)
+	return inv, nil
+}
+
+// billingUsage — тариф и потребление компании за месяц, из которых
+// складываются позиции счёта
+type billingUsage struct {
+	maxOps                     *int
+	fee, extraFee, minutePrice *float64
+	operators                  int // пик операторов за месяц
+	rated                      []ratedDirection
+	calls                      int     // исходящие вне сетки тарифа
+	minutes                    float64 // их начатые минуты
+}
+
+// ratedDirection — исходящие, оценённые по сетке тарифа, по префиксу
+type ratedDirection struct {
+	prefix, name   string
+	calls, seconds int
+	cost           float64
+}
+
+// charge добавляет в счёт позиции: абонентская плата, операторы сверх тарифа,
+// исходящие по направлениям сетки и вне её
+func (inv *Invoice) charge(u *billingUsage) {
+	inv.addLine("tariff", "Абонентская плата, тариф «"+*inv.TariffName+"»", 1, deref(u.fee))
+	if u.maxOps != nil && u.operators > *u.maxOps {
+		inv.addLine("operators",
+			fmt.Sprintf("Операторы сверх тарифа (пик %d, включено %d)", u.operators, *u.maxOps),
+			float64(u.operators-*u.maxOps), deref(u.extraFee))
+	}
+	for _, d := range u.rated {
+		// Цена за минуту — средняя по направлению: в сумме и плата за соединение
+		qty := money(float64(d.seconds) / 60)
+		unit := 0.0
+		if qty > 0 {
+			unit = math.Round(d.cost/qty*10000) / 10000
+		}
+		name := "+" + d.prefix
+		if d.name != "" {
+			name = d.name + " (+" + d.prefix + ")"
+		}
+		inv.addAmount("outbound", fmt.Sprintf("Исходящие: %s, звонков %d, минут", name, d.calls), qty, unit, d.cost)
+	}
+	if u.minutes > 0 {
+		desc := fmt.Sprintf("Исходящие звонки: %d, минут", u.calls)
+		if len(u.rated) > 0 {
+			desc = fmt.Sprintf("Исходящие вне сетки тарифа: %d, минут", u.calls)
+		}
+		inv.addLine("outbound", desc, u.minutes, deref(u.minutePrice))
+	}
+}
+
+func (inv *Invoice) addLine(kind, description string, quantity, unitPrice float64) {
+	inv.addAmount(kind, description, quantity, unitPrice, quantity*unitPrice)
+}
+
+// addAmount — позиция с готовой суммой (звонки, оценённые по сетке)
+func (inv *Invoice) addAmount(kind, description string, quantity, unitPrice, amount float64) {
+	line := InvoiceLine{
+		Position:    len(inv.Lines) + 1,
+		Kind:        kind,
+		Description: description,
+		Quantity:    quantity,
+		UnitPrice:   unitPrice,
+		Amount:      money(amount),
+	}
+	inv.Lines = append(inv.Lines, line)
+	inv.Total = money(inv.Total + line.Amount)
+}
+
+// save сохраняет счёт с позициями. Счёт за этот месяц уже есть: overwrite —
+// пересчитать, если не оплачен; иначе не трогать. false — счёт не сохранён.
+func (h *BillingHandler) save(ctx context.Context, inv *Invoice, overwrite bool) (bool, error) {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	period, _ := time.Parse("2006-01", inv.Period)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO invoices (tenant_id, number, period, tenant_name, tax_id, tariff_id, tariff_name,
+		                      timezone, currency, total)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (tenant_id, period) DO UPDATE SET
+			tenant_name = EXCLUDED.tenant_name, tax_id = EXCLUDED.tax_id,
+			tariff_id = EXCLUDED.tariff_id, tariff_name = EXCLUDED.tariff_name,
+			timezone = EXCLUDED.timezone, currency = EXCLUDED.currency,
+			total = EXCLUDED.total, created_at = NOW()
+		WHERE invoices.status = 'unpaid' AND $11
+		RETURNING id, created_at`,
+		inv.TenantID, inv.Number, period, inv.TenantName, inv.TaxID, inv.TariffID, inv.TariffName,
+		inv.TimeZone, inv.Currency, inv.Total, overwrite,
+	).Scan(&inv.ID, &inv.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM invoice_lines WHERE invoice_id = $1`, inv.ID); err != nil {
+		return false, err
+	}
+	for _, l := range inv.Lines {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO invoice_lines (invoice_id, position, kind, description, quantity, unit_price, amount)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			inv.ID, l.Position, l.Kind, l.Description, l.Quantity, l.UnitPrice, l.Amount); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit(ctx)
+}
+
+// =========================
+// HELPERS
+// =========================
+
+const invoiceSelect = `
+	SELECT i.id, i.tenant_id, i.number, i.period, i.tenant_name, i.tax_id, i.tariff_id, i.tariff_name,
+	       i.timezone, i.currency, i.total, i.status, i.paid_at, i.paid_by, i.note, i.created_at
+	FROM invoices i`
+
+func scanInvoice(row interface{ Scan(...any) error }) (Invoice, error) {
+	var inv Invoice
+	var period time.Time
+	err := row.Scan(&inv.ID, &inv.TenantID, &inv.Number, &period, &inv.TenantName, &inv.TaxID,
+		&inv.TariffID, &inv.TariffName, &inv.TimeZone, &inv.Currency, &inv.Total, &inv.Status,
+		&inv.PaidAt, &inv.PaidBy, &inv.Note, &inv.CreatedAt)
+	inv.Period = period.Format("2006-01")
+	return inv, err
+}
+
+// load — счёт с позициями
+func (h *BillingHandler) load(ctx context.Context, id int64) (Invoice, error) {
+	inv, err := scanInvoice(h.DB.QueryRow(ctx, invoiceSelect+` WHERE i.id = $1`, id))
+	if err != nil {
+		return inv, err
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT position, kind, description, quantity, unit_price, amount
+		FROM invoice_lines WHERE invoice_id = $1 ORDER BY position`, id)
+	if err != nil {
+		return inv, err
+	}
+	defer rows.Close()
+	inv.Lines = make([]InvoiceLine, 0)
+	for rows.Next() {
+		var l InvoiceLine
+		if err := rows.Scan(&l.Position, &l.Kind, &l.Description, &l.Quantity, &l.UnitPrice, &l.Amount); err != nil {
+			return inv, err
+		}
+		inv.Lines = append(inv.Lines, l)
+	}
+	return inv, rows.Err()
+}
+
+// invoiceFromPath — счёт из {id} для суперадмина; false — ответ уже отправлен
+func (h *BillingHandler) invoiceFromPath(w http.ResponseWriter, r *http.Request) (Invoice, bool) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 0 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return Invoice{}, false
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return Invoice{}, false
+	}
+
+	inv, err := h.load(r.Context(), int64(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return Invoice{}, false
+	}
+	if err != nil {
+		log.Printf("❌ Invoice %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return Invoice{}, false
+	}
+	return inv, true
+}
+
+// billableTenants — активные компании с тарифом
+func (h *BillingHandler) billableTenants(ctx context.Context) ([]int, error) {
+	rows, err := h.DB.Query(ctx,
+		`SELECT tenant_id FROM crm_tenants WHERE status AND tariff_id IS NOT NULL ORDER BY tenant_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// invoiceDocument — счёт для PDF: позиции и итог одной таблицей
+func invoiceDocument(inv *Invoice) *pdf.Document {
+	period, _ := time.Parse("2006-01", inv.Period)
+	subtitle := inv.TenantName
+	if inv.TaxID != nil && *inv.TaxID != "" {
+		subtitle += ", ИНН " + *inv.TaxID
+	}
+	subtitle += " · " + periodLabel(period, period.AddDate(0, 1, 0)) + " (" + inv.TimeZone + ")"
+	if inv.Status == "paid" && inv.PaidAt != nil {
+		subtitle += " · оплачен " + inv.PaidAt.Format("02.01.2006")
+	} else {
+		subtitle += " · не оплачен"
+	}
+
+	lines := pdf.Section{Header: []string{"№", "Услуга", "Кол-во", "Цена, " + inv.Currency, "Сумма, " + inv.Currency}}
+	for _, l := range inv.Lines {
+		lines.Rows = append(lines.Rows, []string{
+			strconv.Itoa(l.Position),
+			l.Description,
+			strconv.FormatFloat(l.Quantity, 'f', -1, 64),
+			strconv.FormatFloat(l.UnitPrice, 'f', -1, 64),
+			strconv.FormatFloat(l.Amount, 'f', 2, 64),
+		})
+	}
+	lines.Rows = append(lines.Rows, []string{"", "Итого", "", "", strconv.FormatFloat(inv.Total, 'f', 2, 64)})
+
+	return &pdf.Document{
+		Title:    "Счёт № " + inv.Number,
+		Subtitle: subtitle,
+		Sections: []pdf.Section{lines},
+	}
+}
+
+// money — округление до копеек (дирамов)
+func money(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func deref(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestInvoiceCharge(t *testing.T) {
+	intp := func(v int) *int { return &v }
+	price := func(v float64) *float64 { return &v }
+	tariff := "Стандарт"
+
+	tests := []struct {
+		name  string
+		usage billingUsage
+		lines []InvoiceLine
+		total float64
+	}{
+		{
+			name:  "fee only, operators within tariff",
+			usage: billingUsage{maxOps: intp(10), fee: price(500), extraFee: price(50), operators: 10},
+			lines: []InvoiceLine{
+				{1, "tariff", "Абонентская плата, тариф «Стандарт»", 1, 500, 500},
+			},
+			total: 500,
+		},
+		{
+			name:  "extra operators over the peak",
+			usage: billingUsage{maxOps: intp(10), fee: price(500), extraFee: price(49.99), operators: 13},
+			lines: []InvoiceLine{
+				{1, "tariff", "Абонентская плата, тариф «Стандарт»", 1, 500, 500},
+				{2, "operators", "Операторы сверх тарифа (пик 13, включено 10)", 3, 49.99, 149.97},
+			},
+			total: 649.97,
+		},
+		{
+			name:  "no operator samples for a past month",
+			usage: billingUsage{maxOps: intp(10), fee: price(500), extraFee: price(50), operators: 0},
+			lines: []InvoiceLine{
+				{1, "tariff", "Абонентская плата, тариф «Стандарт»", 1, 500, 500},
+			},
+			total: 500,
+		},
+		{
+			name:  "unlimited operators, no fee",
+			usage: billingUsage{operators: 40},
+			lines: []InvoiceLine{
+				{1, "tariff", "Абонентская плата, тариф «Стандарт»", 1, 0, 0},
+			},
+		},
+		{
+			name: "rated directions and unrated minutes",
+			usage: billingUsage{
+				fee: price(100), minutePrice: price(0.35),
+				rated: []ratedDirection{
+					{prefix: "7", name: "Россия", calls: 3, seconds: 130, cost: 1.234},
+					{prefix: "99290", calls: 1, seconds: 0, cost: 0.1},
+				},
+				calls: 2, minutes: 3,
+			},
+			lines: []InvoiceLine{
+				{1, "tariff", "Абонентская плата, тариф «Стандарт»", 1, 100, 100},
+				{2, "outbound", "Исходящие: Россия (+7), звонков 3, минут", 2.17, 0.5687, 1.23},
+				{3, "outbound", "Исходящие: +99290, звонков 1, минут", 0, 0, 0.1},
+				{4, "outbound", "Исходящие вне сетки тарифа: 2, минут", 3, 0.35, 1.05},
+			},
+			total: 102.38,
+		},
+		{
+			name:  "unrated minutes only",
+			usage: billingUsage{fee: price(100), minutePrice: price(0.3333), calls: 4, minutes: 7},
+			lines: []InvoiceLine{
+				{1, "tariff", "Абонентская плата, тариф «Стандарт»", 1, 100, 100},
+				{2, "outbound", "Исходящие звонки: 4, минут", 7, 0.3333, 2.33},
+			},
+			total: 102.33,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &Invoice{TariffName: &tariff}
+			inv.charge(&tt.usage)
+			if !reflect.DeepEqual(inv.Lines, tt.lines) {
+				t.Errorf("lines:\n got %+v\nwant %+v", inv.Lines, tt.lines)
+			}
+			if inv.Total != tt.total {
+				t.Errorf("total = %v, want %v", inv.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestInvoiceAddAmount(t *testing.T) {
+	inv := &Invoice{}
+	// Сумма позиции округляется до дирамов, итог — сумма округлённых позиций
+	inv.addAmount("outbound", "a", 1, 0.3333, 0.3333)
+	inv.addAmount("outbound", "b", 1, 0.3333, 0.3333)
+	inv.addLine("operators", "c", 3, 0.1)
+	inv.addLine("tariff", "d", 1, 0.005)
+
+	want := []float64{0.33, 0.33, 0.3, 0.01}
+	for i, l := range inv.Lines {
+		if l.Position != i+1 || l.Amount != want[i] {
+			t.Errorf("line %d: position %d amount %v, want %d %v", i, l.Position, l.Amount, i+1, want[i])
+		}
+	}
+	if inv.Total != 0.97 {
+		t.Errorf("total = %v, want 0.97", inv.Total)
+	}
+}
+
+// TestInvoiceSaveGuard проверяет на живой базе, что оплаченный счёт не
+// пересчитывается. Таблицы — временные, в сессии теста: DB_TEST_DSN
+// может указывать на любую базу PostgreSQL.
+func TestInvoiceSaveGuard(t *testing.T) {
+	dsn := os.Getenv("DB_TEST_DSN")
+	if dsn == "" {
+		t.Skip("DB_TEST_DSN is not set")
+	}
+	ctx := context.Background()
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxConns = 1 // временные таблицы видны только своему соединению
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(ctx, `
+		CREATE TEMP TABLE invoices (
+			id          BIGSERIAL     PRIMARY KEY,
+			tenant_id   INT           NOT NULL,
+			number      TEXT          NOT NULL UNIQUE,
+			period      DATE          NOT NULL,
+			tenant_name TEXT          NOT NULL,
+			tax_id      TEXT,
+			tariff_id   INT,
+			tariff_name TEXT,
+			timezone    TEXT          NOT NULL,
+			currency    TEXT          NOT NULL,
+			total       NUMERIC(12,2) NOT NULL,
+			status      TEXT          NOT NULL DEFAULT 'unpaid',
+			paid_at     TIMESTAMPTZ,
+			paid_by     INT,
+			note        TEXT,
+			created_at  TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+			UNIQUE (tenant_id, period)
+		);
+		CREATE TEMP TABLE invoice_lines (
+			id          BIGSERIAL     PRIMARY KEY,
+			invoice_id  BIGINT        NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+			position    INT           NOT NULL,
+			kind        TEXT          NOT NULL,
+			description TEXT          NOT NULL,
+			quantity    NUMERIC(12,2) NOT NULL,
+			unit_price  NUMERIC(12,4) NOT NULL,
+			amount      NUMERIC(12,2) NOT NULL,
+			UNIQUE (invoice_id, position)
+		)`); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &BillingHandler{DB: db}
+	tariff := "Стандарт"
+	invoice := func(fee float64) *Invoice {
+		inv := &Invoice{TenantID: 12, Number: "202609-0012", Period: "2026-09", TenantName: "ООО Тест",
+			TariffName: &tariff, TimeZone: "Asia/Dushanbe", Currency: "TJS"}
+		inv.charge(&billingUsage{fee: &fee})
+		return inv
+	}
+	save := func(inv *Invoice, overwrite, want bool) {
+		t.Helper()
+		saved, err := h.save(ctx, inv, overwrite)
+		if err != nil || saved != want {
+			t.Fatalf("save(total %v, overwrite %v) = %v, %v; want %v", inv.Total, overwrite, saved, err, want)
+		}
+	}
+	stored := func(want float64) {
+		t.Helper()
+		inv, err := h.load(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inv.Total != want || len(inv.Lines) != 1 || inv.Lines[0].Amount != want {
+			t.Errorf("stored total %v lines %+v, want %v", inv.Total, inv.Lines, want)
+		}
+	}
+
+	save(invoice(100), false, true)
+	stored(100)
+	save(invoice(150), false, false) // закрытие месяца не трогает сформированный счёт
+	stored(100)
+	save(invoice(200), true, true) // неоплаченный пересчитывается
+	stored(200)
+
+	if _, err := db.Exec(ctx, `UPDATE invoices SET status = 'paid', paid_at = NOW() WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	save(invoice(300), true, false) // оплаченный — нет
+	stored(200)
+}
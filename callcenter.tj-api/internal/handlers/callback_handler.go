@@ -0,0 +1,696 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"callcentrix/internal/auth"
+	"callcentrix/internal/monitor"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CallbackHandler — список перезвонов по пропущенным и брошенным входящим.
+// Заявки собирает Run на лидере из таблицы calls (одна открытая заявка на номер),
+// он же закрывает их, когда номер дозвонился или до него дозвонились. Агент берёт
+// заявку, перезванивает через Originate со своего телефона и закрывает её.
+type CallbackHandler struct {
+	DB      *pgxpool.Pool
+	AMI     Originator // AMI лидера; перезвон — через ForwardToLeader
+	Badge   *monitor.CallbackBadge
+	Context string        // dialplan-контекст, в котором набирается номер клиента
+	SLA     time.Duration // от первого пропуска до нарушения SLA
+	Warn    time.Duration // от первого пропуска до предупреждения
+}
+
+// Originator — отправка AMI action (ami.Service)
+type Originator interface {
+	SendAction(action string, fields map[string]string) error
+}
+
+// Номера сравниваются по последним цифрам: входящий приходит с кодом страны
+// (992901234567), а агент набирает национальный номер (901234567).
+// Те же цифры — callbacks.match_key (миграция 023): одна открытая заявка на ключ.
+const callbackMatchDigits = 9
+
+// Пропущенные звонки старше не попадают в список (первый запуск, простой лидера)
+const callbackLookback = 24 * time.Hour
+
+// =========================
+// MODELS
+// =========================
+
+type CallbackUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Callback struct {
+	ID            int64         `json:"id"`
+	Number        string        `json:"number"`
+	Status        string        `json:"status"` // open / claimed / resolved / auto_closed
+	Reason        string        `json:"reason"` // missed — не ответили, abandoned — сбросил в очереди
+	Queue         *string       `json:"queue"`
+	MissCount     int           `json:"missCount"`
+	FirstMissedAt time.Time     `json:"firstMissedAt"`
+	LastMissedAt  time.Time     `json:"lastMissedAt"`
+	LastCallID    string        `json:"lastCallId"`
+	Attempts      int           `json:"attempts"`
+	LastAttemptAt *time.Time    `json:"lastAttemptAt"`
+	ClaimedBy     *CallbackUser `json:"claimedBy"`
+	ClaimedAt     *time.Time    `json:"claimedAt"`
+	ResolvedBy    *CallbackUser `json:"resolvedBy"` // null при auto_closed
+	ResolvedAt    *time.Time    `json:"resolvedAt"`
+	ResolvedCall  *string       `json:"resolvedCall"` // звонок, закрывший заявку автоматически
+	Note          *string       `json:"note"`
+
+	// SLA: возраст открытой заявки от первого пропуска; у закрытой — время до закрытия
+	AgeSeconds int       `json:"ageSeconds"`
+	SLADueAt   time.Time `json:"slaDueAt"`
+	SLA        string    `json:"sla"` // ok / warning / breached
+}
+
+// CallbackCall — пропущенный звонок заявки
+type CallbackCall struct {
+	Uniqueid    string    `json:"uniqueid"`
+	StartedAt   time.Time `json:"startedAt"`
+	EndedAt     time.Time `json:"endedAt"`
+	Queue       *string   `json:"queue"`
+	Dst         string    `json:"dst"`
+	WaitSeconds int       `json:"waitSeconds"`
+}
+
+type CallbackDetail struct {
+	Callback
+	Calls []CallbackCall `json:"calls"`
+}
+
+type CallbackListResponse struct {
+	Callbacks []Callback             `json:"callbacks"`
+	Counts    monitor.CallbackCounts `json:"counts"` // как в WS-бейдже
+	Total     int                    `json:"total"`
+	Page      int                    `json:"page"`
+	PerPage   int                    `json:"perPage"`
+}
+
+type ResolveCallbackRequest struct {
+	Note string `json:"note"`
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// GetCallbacks godoc
+// @Summary      Список перезвонов
+// @Description  Пропущенные и брошенные входящие, по одной заявке на номер. Открытые — от самых старых (SLA), закрытые — от последних.
+// @Tags         Callbacks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        status   query  string  false  "active (open+claimed, по умолчанию) / open / claimed / resolved / auto_closed / closed / all"
+// @Param        mine     query  bool    false  "только взятые мной"
+// @Param        sla      query  string  false  "warning / breached"
+// @Param        number   query  string  false  "Номер (подстрока)"
+// @Param        page     query  int     false  "Страница"
+// @Param        perPage  query  int     false  "до 200"
+// @Success      200  {object}  CallbackListResponse
+// @Router       /api/callbacks [get]
+func (h *CallbackHandler) GetCallbacks(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(q.Get("perPage"))
+	if perPage < 1 || perPage > 200 {
+		perPage = 50
+	}
+
+	where := " WHERE cb.tenant_id = $1"
+	args := []any{user.TenantID}
+	order := " ORDER BY cb.first_missed_at, cb.id"
+	switch status := q.Get("status"); status {
+	case "", "active":
+		where += " AND cb.status IN ('open', 'claimed')"
+	case "open", "claimed", "resolved", "auto_closed":
+		where += " AND cb.status = $" + strconv.Itoa(len(args)+1)
+		args = append(args, status)
+	case "closed":
+		where += " AND cb.status IN ('resolved', 'auto_closed')"
+	case "all":
+	default:
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	if s := q.Get("status"); s == "resolved" || s == "auto_closed" || s == "closed" {
+		order = " ORDER BY cb.resolved_at DESC, cb.id DESC"
+	}
+	if q.Get("mine") == "true" || q.Get("mine") == "1" {
+		where += " AND cb.claimed_by = $" + strconv.Itoa(len(args)+1)
+		args = append(args, user.UserID)
+	}
+	switch q.Get("sla") {
+	case "":
+	case "warning":
+		where += " AND cb.status IN ('open', 'claimed')" +
+			" AND cb.first_missed_at <= NOW() - make_interval(secs => $" + strconv.Itoa(len(args)+1) + ")" +
+			" AND cb.first_missed_at >  NOW() - make_interval(secs => $" + strconv.Itoa(len(args)+2) + ")"
+		args = append(args, h.Warn.Seconds(), h.SLA.Seconds())
+	case "breached":
+		where += " AND cb.status IN ('open', 'claimed')" +
+			" AND cb.first_missed_at <= NOW() - make_interval(secs => $" + strconv.Itoa(len(args)+1) + ")"
+		args = append(args, h.SLA.Seconds())
+	default:
+		http.Error(w, "invalid sla", http.StatusBadRequest)
+		return
+	}
+	if number := q.Get("number"); number != "" {
+		where += " AND cb.number LIKE $" + strconv.Itoa(len(args)+1)
+		args = append(args, "%"+callbackNumber(number)+"%")
+	}
+
+	resp := CallbackListResponse{
+		Callbacks: make([]Callback, 0),
+		Counts:    h.Badge.Get(user.TenantID),
+		Page:      page,
+		PerPage:   perPage,
+	}
+	if err := h.DB.QueryRow(r.Context(), `SELECT COUNT(*) FROM callbacks cb`+where, args...).Scan(&resp.Total); err != nil {
+		log.Printf("❌ GetCallbacks count: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	idx := len(args) + 1
+	rows, err := h.DB.Query(r.Context(), callbackSelect+where+order+`
+		LIMIT $`+strconv.Itoa(idx)+` OFFSET $`+strconv.Itoa(idx+1),
+		append(args, perPage, (page-1)*perPage)...)
+	if err != nil {
+		log.Printf("❌ GetCallbacks: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		cb, err := h.scanCallback(rows)
+		if err != nil {
+			log.Printf("❌ GetCallbacks scan: %v", err)
+			continue
+		}
+		resp.Callbacks = append(resp.Callbacks, cb)
+	}
+	jsonResp(w, resp)
+}
+
+// GetCallback godoc
+// @Summary      Заявка на перезвон с пропущенными звонками
+// @Tags         Callbacks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID заявки"
+// @Success      200  {object}  CallbackDetail
+// @Router       /api/callbacks/{id} [get]
+func (h *CallbackHandler) GetCallback(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	cb, err := h.load(r.Context(), user.TenantID, int64(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ GetCallback: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	detail := CallbackDetail{Callback: cb, Calls: make([]CallbackCall, 0)}
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT c.uniqueid, c.started_at, c.ended_at, c.queue, COALESCE(c.dst, ''), c.wait_seconds
+		FROM callback_calls cc
+		JOIN calls c ON c.tenant_id = cc.tenant_id AND c.uniqueid = cc.uniqueid
+		WHERE cc.callback_id = $1 AND cc.tenant_id = $2
+		ORDER BY c.started_at`,
+		cb.ID, user.TenantID)
+	if err != nil {
+		log.Printf("❌ GetCallback calls: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c CallbackCall
+		if err := rows.Scan(&c.Uniqueid, &c.StartedAt, &c.EndedAt, &c.Queue, &c.Dst, &c.WaitSeconds); err != nil {
+			log.Printf("❌ GetCallback calls scan: %v", err)
+			continue
+		}
+		detail.Calls = append(detail.Calls, c)
+	}
+	jsonResp(w, detail)
+}
+
+// ClaimCallback godoc
+// @Summary      Взять заявку на перезвон
+// @Description  Заявку, взятую другим агентом, взять нельзя (409) — сначала её должен отпустить он или админ.
+// @Tags         Callbacks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID заявки"
+// @Success      200  {object}  Callback
+// @Failure      409  {string}  string  "already claimed / closed"
+// @Router       /api/callbacks/{id}/claim [post]
+func (h *CallbackHandler) ClaimCallback(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `
+		UPDATE callbacks SET status = 'claimed', claimed_by = $3, claimed_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+		  AND (status = 'open' OR (status = 'claimed' AND claimed_by = $3))`,
+		id, user.TenantID, user.UserID)
+	if err != nil {
+		log.Printf("❌ ClaimCallback: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		h.conflict(w, r, int64(id))
+		return
+	}
+	h.respond(w, r, int64(id))
+}
+
+// ReleaseCallback godoc
+// @Summary      Отпустить заявку на перезвон
+// @Description  Возвращает заявку в общий список. Чужую заявку может отпустить только админ.
+// @Tags         Callbacks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID заявки"
+// @Success      200  {object}  Callback
+// @Router       /api/callbacks/{id}/claim [delete]
+func (h *CallbackHandler) ReleaseCallback(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `
+		UPDATE callbacks SET status = 'open', claimed_by = NULL, claimed_at = NULL
+		WHERE id = $1 AND tenant_id = $2 AND status = 'claimed'
+		  AND (claimed_by = $3 OR $4)`,
+		id, user.TenantID, user.UserID, user.UserType == 1)
+	if err != nil {
+		log.Printf("❌ ReleaseCallback: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		h.conflict(w, r, int64(id))
+		return
+	}
+	h.respond(w, r, int64(id))
+}
+
+// CallCallback godoc
+// @Summary      Перезвонить по заявке
+// @Description  Originate: сначала звонит телефон агента, после ответа набирается номер клиента. Свободная заявка
+// @Description  берётся агентом. Отвеченный звонок закроет заявку автоматически; не дозвонился — заявка остаётся за агентом.
+// @Tags         Callbacks
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID заявки"
+// @Success      200  {object}  Callback
+// @Failure      409  {string}  string  "already claimed / closed"
+// @Router       /api/callbacks/{id}/call [post]
+func (h *CallbackHandler) CallCallback(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var number string
+	err = h.DB.QueryRow(r.Context(), `
+		UPDATE callbacks SET status = 'claimed',
+			claimed_by = $3, claimed_at = COALESCE(claimed_at, NOW()),
+			attempts = attempts + 1, last_attempt_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+		  AND (status = 'open' OR (status = 'claimed' AND claimed_by = $3))
+		RETURNING number`,
+		id, user.TenantID, user.UserID).Scan(&number)
+	if errors.Is(err, pgx.ErrNoRows) {
+		h.conflict(w, r, int64(id))
+		return
+	}
+	if err != nil {
+		log.Printf("❌ CallCallback: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Username в JWT — это SIP номер агента
+	err = h.AMI.SendAction("Originate", map[string]string{
+		"Channel":  "PJSIP/" + user.Username,
+		"Context":  h.Context,
+		"Exten":    number,
+		"Priority": "1",
+		"CallerID": "Перезвон <" + number + ">",
+		"Timeout":  "30000",
+		"Async":    "true",
+		"Variable": "CALLBACK_ID=" + strconv.Itoa(id),
+	})
+	if err != nil {
+		log.Printf("❌ AMI Originate error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("📞 Callback %d: tenant=%d agent=%s → %s", id, user.TenantID, user.Username, number)
+	h.respond(w, r, int64(id))
+}
+
+// ResolveCallback godoc
+// @Summary      Закрыть заявку на перезвон
+// @Description  Свободную или свою заявку закрывает агент, чужую — только админ.
+// @Tags         Callbacks
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                     true   "ID заявки"
+// @Param        body  body  ResolveCallbackRequest  false  "Комментарий"
+// @Success      200  {object}  Callback
+// @Router       /api/callbacks/{id}/resolve [post]
+func (h *CallbackHandler) ResolveCallback(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req ResolveCallbackRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `
+		UPDATE callbacks SET status = 'resolved', resolved_by = $3, resolved_at = NOW(), note = $5
+		WHERE id = $1 AND tenant_id = $2
+		  AND (status = 'open' OR (status = 'claimed' AND (claimed_by = $3 OR $4)))`,
+		id, user.TenantID, user.UserID, user.UserType == 1, nullStr(req.Note))
+	if err != nil {
+		log.Printf("❌ ResolveCallback: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		h.conflict(w, r, int64(id))
+		return
+	}
+	h.respond(w, r, int64(id))
+}
+
+// ============================================================
+// WORKER
+// ============================================================
+
+// Run собирает заявки из завершённых звонков и закрывает дозвонившиеся до отмены ctx
+func (h *CallbackHandler) Run(ctx context.Context) {
+	t := time.NewTicker(15 * time.Second)
+	defer t.Stop()
+	for {
+		changed := h.collect(ctx)
+		if h.autoClose(ctx) {
+			changed = true
+		}
+		if changed {
+			h.Badge.Refresh(ctx, 0)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// collect добавляет неотвеченные входящие в заявки их номеров; true — что-то добавлено
+func (h *CallbackHandler) collect(ctx context.Context) bool {
+	// Анонимные номера (без цифр) перезвонить нельзя — их не берём
+	rows, err := h.DB.Query(ctx, `
+		SELECT c.tenant_id, c.uniqueid, regexp_replace(c.src, '\D', '', 'g'), c.queue, c.started_at
+		FROM calls c
+		WHERE c.ended_at > NOW() - make_interval(secs => $1)
+		  AND c.direction = 'inbound' AND c.answered_at IS NULL
+		  AND regexp_replace(c.src, '\D', '', 'g') != ''
+		  AND NOT EXISTS (SELECT 1 FROM callback_calls cc
+		                  WHERE cc.tenant_id = c.tenant_id AND cc.uniqueid = c.uniqueid)
+		ORDER BY c.started_at
+		LIMIT 500`,
+		callbackLookback.Seconds())
+	if err != nil {
+		log.Printf("❌ Callbacks collect: %v", err)
+		return false
+	}
+	type missed struct {
+		tenantID  int
+		uniqueid  string
+		number    string
+		queue     *string
+		startedAt time.Time
+	}
+	var calls []missed
+	for rows.Next() {
+		var m missed
+		if err := rows.Scan(&m.tenantID, &m.uniqueid, &m.number, &m.queue, &m.startedAt); err != nil {
+			log.Printf("❌ Callbacks collect scan: %v", err)
+			continue
+		}
+		calls = append(calls, m)
+	}
+	rows.Close()
+
+	for _, m := range calls {
+		// Очередь была — звонящий не дождался агента, иначе звонок просто не взяли
+		reason := "missed"
+		if m.queue != nil {
+			reason = "abandoned"
+		}
+		if err := h.addMissed(ctx, m.tenantID, m.uniqueid, m.number, reason, m.queue, m.startedAt); err != nil {
+			log.Printf("❌ Callbacks collect %s (tenant=%d): %v", m.uniqueid, m.tenantID, err)
+			continue
+		}
+		log.Printf("📝 Callback: tenant=%d number=%s %s (call %s)", m.tenantID, m.number, reason, m.uniqueid)
+	}
+	return len(calls) > 0
+}
+
+// addMissed — пропуск в открытую заявку номера (или новая заявка) и отметка звонка
+func (h *CallbackHandler) addMissed(ctx context.Context, tenantID int, uniqueid, number, reason string, queue *string, at time.Time) error {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO callbacks (tenant_id, number, reason, queue, first_missed_at, last_missed_at, last_call_id)
+		VALUES ($1, $2, $3, $4, $5, $5, $6)
+		ON CONFLICT (tenant_id, match_key) WHERE status IN ('open', 'claimed') DO UPDATE SET
+			miss_count      = callbacks.miss_count + 1,
+			reason          = EXCLUDED.reason,
+			queue           = COALESCE(EXCLUDED.queue, callbacks.queue),
+			first_missed_at = LEAST(callbacks.first_missed_at, EXCLUDED.first_missed_at),
+			last_missed_at  = GREATEST(callbacks.last_missed_at, EXCLUDED.last_missed_at),
+			last_call_id    = CASE WHEN EXCLUDED.last_missed_at >= callbacks.last_missed_at
+			                       THEN EXCLUDED.last_call_id ELSE callbacks.last_call_id END
+		RETURNING id`,
+		tenantID, number, reason, queue, at, uniqueid,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO callback_calls (tenant_id, uniqueid, callback_id) VALUES ($1, $2, $3)`,
+		tenantID, uniqueid, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// autoClose закрывает заявки, по номеру которых после последнего пропуска был
+// отвеченный звонок: входящий от клиента или исходящий к нему (в том числе
+// перезвон из списка). true — что-то закрыто.
+func (h *CallbackHandler) autoClose(ctx context.Context) bool {
+	rows, err := h.DB.Query(ctx, `
+		WITH done AS (
+			SELECT cb.id, a.uniqueid
+			FROM callbacks cb
+			CROSS JOIN LATERAL (
+				SELECT c.uniqueid FROM calls c
+				WHERE c.tenant_id = cb.tenant_id
+				  AND c.started_at > cb.last_missed_at
+				  AND c.answered_at IS NOT NULL
+				  AND ((c.direction = 'inbound'  AND right(regexp_replace(c.src, '\D', '', 'g'), $1) = cb.match_key)
+				    OR (c.direction = 'outbound' AND right(regexp_replace(c.dst, '\D', '', 'g'), $1) = cb.match_key))
+				ORDER BY c.started_at
+				LIMIT 1
+			) a
+			WHERE cb.status IN ('open', 'claimed')
+		)
+		UPDATE callbacks cb SET status = 'auto_closed', resolved_at = NOW(), resolved_call = done.uniqueid
+		FROM done
+		WHERE cb.id = done.id
+		RETURNING cb.tenant_id, cb.id, cb.number, done.uniqueid`,
+		callbackMatchDigits)
+	if err != nil {
+		log.Printf("❌ Callbacks auto-close: %v", err)
+		return false
+	}
+	defer rows.Close()
+
+	closed := false
+	for rows.Next() {
+		var tenantID int
+		var id int64
+		var number, uniqueid string
+		if err := rows.Scan(&tenantID, &id, &number, &uniqueid); err != nil {
+			continue
+		}
+		closed = true
+		log.Printf("✅ Callback %d auto-closed: tenant=%d number=%s answered call %s", id, tenantID, number, uniqueid)
+	}
+	return closed
+}
+
+// =========================
+// HELPERS
+// =========================
+
+const callbackSelect = `
+		SELECT cb.id, cb.number, cb.status, cb.reason, cb.queue, cb.miss_count,
+		       cb.first_missed_at, cb.last_missed_at, cb.last_call_id,
+		       cb.attempts, cb.last_attempt_at,
+		       cb.claimed_by, (SELECT ` + userNameSQL + ` FROM users u WHERE u.id = cb.claimed_by),
+		       cb.claimed_at,
+		       cb.resolved_by, (SELECT ` + userNameSQL + ` FROM users u WHERE u.id = cb.resolved_by),
+		       cb.resolved_at, cb.resolved_call, cb.note
+		FROM callbacks cb`
+
+func (h *CallbackHandler) scanCallback(row interface{ Scan(...any) error }) (Callback, error) {
+	var cb Callback
+	var claimedID, resolvedID *int
+	var claimedName, resolvedName *string
+	err := row.Scan(
+		&cb.ID, &cb.Number, &cb.Status, &cb.Reason, &cb.Queue, &cb.MissCount,
+		&cb.FirstMissedAt, &cb.LastMissedAt, &cb.LastCallID,
+		&cb.Attempts, &cb.LastAttemptAt,
+		&claimedID, &claimedName, &cb.ClaimedAt,
+		&resolvedID, &resolvedName,
+		&cb.ResolvedAt, &cb.ResolvedCall, &cb.Note,
+	)
+	if err != nil {
+		return cb, err
+	}
+	cb.ClaimedBy = callbackUser(claimedID, claimedName)
+	cb.ResolvedBy = callbackUser(resolvedID, resolvedName)
+
+	// Закрытая заявка стареть перестаёт: SLA — выполнен ли он к закрытию
+	end := time.Now()
+	if cb.ResolvedAt != nil {
+		end = *cb.ResolvedAt
+	}
+	age := end.Sub(cb.FirstMissedAt)
+	cb.AgeSeconds = int(age.Seconds())
+	cb.SLADueAt = cb.FirstMissedAt.Add(h.SLA)
+	switch {
+	case age >= h.SLA:
+		cb.SLA = "breached"
+	case age >= h.Warn && cb.ResolvedAt == nil:
+		cb.SLA = "warning"
+	default:
+		cb.SLA = "ok"
+	}
+	return cb, nil
+}
+
+func (h *CallbackHandler) load(ctx context.Context, tenantID int, id int64) (Callback, error) {
+	return h.scanCallback(h.DB.QueryRow(ctx, callbackSelect+` WHERE cb.id = $1 AND cb.tenant_id = $2`, id, tenantID))
+}
+
+// respond отдаёт заявку после изменения и сразу обновляет бейдж тенанта
+func (h *CallbackHandler) respond(w http.ResponseWriter, r *http.Request, id int64) {
+	user := auth.FromContext(r.Context())
+	h.Badge.Refresh(r.Context(), user.TenantID)
+
+	cb, err := h.load(r.Context(), user.TenantID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, cb)
+}
+
+// conflict объясняет, почему заявку не удалось изменить: нет такой, закрыта или взята другим
+func (h *CallbackHandler) conflict(w http.ResponseWriter, r *http.Request, id int64) {
+	user := auth.FromContext(r.Context())
+	cb, err := h.load(r.Context(), user.TenantID, id)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case cb.Status == "resolved" || cb.Status == "auto_closed":
+		http.Error(w, "callback is closed", http.StatusConflict)
+	case cb.Status == "open":
+		http.Error(w, "callback is not claimed", http.StatusConflict)
+	default:
+		http.Error(w, "callback is claimed by another agent", http.StatusConflict)
+	}
+}
+
+func callbackUser(id *int, name *string) *CallbackUser {
+	if id == nil {
+		return nil
+	}
+	u := &CallbackUser{ID: *id}
+	if name != nil {
+		u.Name = *name
+	}
+	return u
+}
+
+// callbackNumber — номер без разделителей и «+», как он хранится в заявке
+func callbackNumber(s string) string {
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits = append(digits, s[i])
+		}
+	}
+	return string(digits)
+}
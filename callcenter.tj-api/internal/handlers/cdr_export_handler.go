@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"callcentrix/internal/auth"
+	"callcentrix/internal/xlsx"
+)
+
+// cdrColumn — колонка выгрузки отчёта звонков (строка — звонок целиком)
+type cdrColumn struct {
+	Key    string
+	Header string
+	Value  func(j *CallJourney) any // string, int, time.Time, *string, *float64
+}
+
+// cdrColumns — все колонки в порядке по умолчанию (без cdrDefaultExcluded)
+var cdrColumns = []cdrColumn{
+	{"callDate", "Дата и время", func(j *CallJourney) any { return j.StartedAt }}, // в поясе выгрузки, в заголовке — смещение
+	{"direction", "Направление", func(j *CallJourney) any { return j.Direction }},
+	{"src", "Откуда", func(j *CallJourney) any { return j.Src }},
+	{"dst", "Куда", func(j *CallJourney) any { return j.Dst }},
+	{"clid", "Caller ID", func(j *CallJourney) any { return j.Clid }},
+	{"queue", "Очередь", func(j *CallJourney) any { return j.Queue }},
+	{"outcome", "Итог", func(j *CallJourney) any { return j.Outcome }},
+	{"agentName", "Агент", cdrJourneyAgent},
+	{"transferredTo", "Переведён", func(j *CallJourney) any { return journeyAgentNames(j.TransferredTo) }},
+	{"agentsTried", "Не ответили", func(j *CallJourney) any { return journeyAgentNames(j.AgentsTried) }},
+	{"waitSeconds", "Ожидание, с", func(j *CallJourney) any { return j.WaitSeconds }},
+	{"talkSeconds", "Разговор, с", func(j *CallJourney) any { return j.TalkSeconds }},
+	{"duration", "Длительность, с", func(j *CallJourney) any { return j.Duration }},
+	{"cost", "Стоимость", func(j *CallJourney) any { return j.Cost }},
+	{"resultCode", "Код результата", func(j *CallJourney) any { return j.ResultCode }},
+	{"resultName", "Результат", func(j *CallJourney) any { return j.ResultName }},
+	{"recordingUrl", "Запись", cdrRecordingLink},
+	{"linkedid", "Linkedid", func(j *CallJourney) any { return j.LinkedID }},
+	{"legs", "Ног", func(j *CallJourney) any { return len(j.Legs) }},
+	{"transcript", "Расшифровка", cdrTranscript},
+}
+
+// cdrDefaultExcluded — колонки, которые выгружаются только явно через columns
+var cdrDefaultExcluded = map[string]bool{"transcript": true}
+
+// cdrJourneyAgent — кто ответил (входящий) или кто звонил (исходящий)
+func cdrJourneyAgent(j *CallJourney) any {
+	switch {
+	case j.AnsweredBy != nil:
+		return j.AnsweredBy.Name
+	case j.Agent != nil:
+		return j.Agent.Name
+	}
+	return nil
+}
+
+// cdrRecordingLink — ссылки на записи ног через API (аудит прослушиваний, хранилище
+// записей), а не прямой URL Asterisk; несколько — через пробел
+func cdrRecordingLink(j *CallJourney) any {
+	var links []string
+	for _, l := range j.Legs {
+		if l.RecordingURL != nil {
+			links = append(links, *l.RecordingURL)
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	return strings.Join(links, " ")
+}
+
+// cdrTranscript — расшифровки ног звонка подряд
+func cdrTranscript(j *CallJourney) any {
+	var texts []string
+	for _, l := range j.Legs {
+		if l.transcript != nil && *l.transcript != "" {
+			texts = append(texts, *l.transcript)
+		}
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func journeyAgentNames(agents []JourneyAgent) any {
+	if len(agents) == 0 {
+		return nil
+	}
+	names := make([]string, len(agents))
+	for i, a := range agents {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// cdrRowWriter — CSV или XLSX
+type cdrRowWriter interface {
+	WriteRow(cells ...any) error
+	Close() error
+}
+
+// ExportCDR godoc
+// @Summary      Выгрузка отчёта звонков в CSV / XLSX
+// @Description  Строка — звонок целиком, как в /api/reports/calls; те же фильтры, без пагинации: ноги идут потоком из БД и собираются в звонки на лету. columns — ключи колонок через запятую (callDate,direction,src,dst,clid,queue,outcome,agentName,transferredTo,agentsTried,waitSeconds,talkSeconds,duration,cost,resultCode,resultName,recordingUrl,linkedid,legs,transcript); по умолчанию — все, кроме transcript.
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      text/csv
+// @Produce      application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param        format       query  string  false  "csv (по умолчанию) / xlsx"
+// @Param        columns      query  string  false  "Колонки через запятую"
+// @Param        tz           query  string  false  "IANA пояс дат, по умолчанию — пояс компании"
+// @Param        dateFrom     query  string  false  "RFC3339 или дата в поясе выгрузки"
+// @Param        dateTo       query  string  false  "RFC3339 или дата в поясе выгрузки (включительно)"
+// @Param        src          query  string  false  "Откуда (подстрока)"
+// @Param        dst          query  string  false  "Куда (подстрока)"
+// @Param        disposition  query  string  false  "ANSWERED / NO ANSWER / BUSY / FAILED"
+// @Param        transcript   query  string  false  "Поиск по расшифровке"
+// @Param        agent        query  string  false  "SIP номер агента"
+// @Success      200  {file}  file
+// @Failure      400  {string}  string  "unknown column"
+// @Router       /api/reports/calls/export [get]
+func (h *CDRHandler) ExportCDR(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		http.Error(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+	columns, err := selectCDRColumns(q.Get("columns"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := reportLocation(r.Context(), h.DB, user.TenantID, q)
+	if err != nil {
+		http.Error(w, "invalid tz", http.StatusBadRequest)
+		return
+	}
+	filter := cdrFilterFromQuery(q)
+	filter.TimeZone = loc.String()
+	where, args := filter.where(user.TenantID)
+	// Ноги подходящих звонков подряд: звонок за звонком по времени начала
+	rows, err := h.DB.Query(r.Context(), `
+		WITH m AS (
+			SELECT COALESCE(NULLIF(c.linkedid, ''), c.uniqueid) AS lid, MIN(c.calldate) AS started
+			FROM ast_cdr c `+where+`
+			GROUP BY 1
+		)`+journeyLegSelect+`
+		JOIN m ON (c.linkedid = m.lid OR c.uniqueid = m.lid)
+		      AND COALESCE(NULLIF(c.linkedid, ''), c.uniqueid) = m.lid
+		WHERE `+journeyLegScope+`
+		ORDER BY m.started, m.lid, c.calldate, c.id`, args...)
+	if err != nil {
+		log.Printf("❌ ExportCDR: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// После первой строки статус уже отправлен — ошибки дальше только в лог,
+	// клиент получит оборванный файл
+	name := "calls_" + time.Now().In(loc).Format("20060102_150405") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	var out cdrRowWriter
+	if format == "xlsx" {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		out, err = xlsx.NewWriter(w, "Звонки")
+		if err != nil {
+			log.Printf("❌ ExportCDR xlsx: %v", err)
+			return
+		}
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		out = newCSVRows(w)
+	}
+
+	header := make([]any, len(columns))
+	for i, c := range columns {
+		header[i] = c.Header
+		if c.Key == "callDate" {
+			header[i] = c.Header + " (UTC" + utcOffset(time.Now().In(loc)) + ")"
+		}
+	}
+	if err := out.WriteRow(header...); err != nil {
+		log.Printf("❌ ExportCDR write: %v", err)
+		return
+	}
+
+	count := 0
+	cells := make([]any, len(columns))
+	write := func(id string, legs []CallJourneyLeg) error {
+		j := buildJourney(id, legs).in(loc)
+		for i, c := range columns {
+			cells[i] = c.Value(&j)
+		}
+		if err := out.WriteRow(cells...); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+	var id string
+	var legs []CallJourneyLeg
+	for rows.Next() {
+		legID, l, err := scanJourneyLeg(rows)
+		if err != nil {
+			log.Printf("❌ ExportCDR scan: %v", err)
+			continue
+		}
+		if legID != id && len(legs) > 0 {
+			if err := write(id, legs); err != nil {
+				log.Printf("❌ ExportCDR write after %d rows: %v", count, err)
+				out.Close()
+				return
+			}
+			legs = nil
+		}
+		id = legID
+		legs = append(legs, l)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("❌ ExportCDR rows after %d rows: %v", count, err)
+	} else if len(legs) > 0 {
+		if err := write(id, legs); err != nil {
+			log.Printf("❌ ExportCDR write after %d rows: %v", count, err)
+			out.Close()
+			return
+		}
+	}
+	if err := out.Close(); err != nil {
+		log.Printf("❌ ExportCDR close: %v", err)
+		return
+	}
+	log.Printf("📤 CDR export: %d rows, %s, tenant=%d user=%d", count, format, user.TenantID, user.UserID)
+}
+
+// selectCDRColumns разбирает columns=a,b,c; пусто — все, кроме transcript
+func selectCDRColumns(param string) ([]cdrColumn, error) {
+	if param == "" {
+		result := make([]cdrColumn, 0, len(cdrColumns))
+		for _, c := range cdrColumns {
+			if !cdrDefaultExcluded[c.Key] {
+				result = append(result, c)
+			}
+		}
+		return result, nil
+	}
+	var result []cdrColumn
+	for _, key := range strings.Split(param, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		found := false
+		for _, c := range cdrColumns {
+			if c.Key == key {
+				result = append(result, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("unknown column: " + key)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("unknown column: " + param)
+	}
+	return result, nil
+}
+
+// =========================
+// CSV
+// =========================
+
+// csvRows — CSV для Excel: UTF-8 с BOM (иначе кириллица ломается), дата — текстом.
+// Сбрасывается каждые csvFlushRows строк, чтобы файл шёл клиенту по мере чтения.
+type csvRows struct {
+	w    *csv.Writer
+	rows int
+}
+
+const csvFlushRows = 500
+
+func newCSVRows(w io.Writer) *csvRows {
+	io.WriteString(w, "\uFEFF")
+	return &csvRows{w: csv.NewWriter(w)}
+}
+
+func (c *csvRows) WriteRow(cells ...any) error {
+	record := make([]string, len(cells))
+	for i, v := range cells {
+		record[i] = csvCell(v)
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+	c.rows++
+	if c.rows%csvFlushRows == 0 {
+		c.w.Flush()
+		return c.w.Error()
+	}
+	return nil
+}
+
+func (c *csvRows) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func csvCell(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case *string:
+		if v == nil {
+			return ""
+		}
+		return *v
+	case int:
+		return strconv.Itoa(v)
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05") // в поясе значения
+
+	}
+	return ""
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -32,29 +33,158 @@ type CDRRecord struct {
 	Clid         string    `json:"clid"`
 	AgentName    *string   `json:"agentName"`
 	RecordingURL *string   `json:"recordingUrl"`
+	ResultCode   *string   `json:"resultCode"` // код результата из wrap-up (call_dispositions)
+	ResultName   *string   `json:"resultName"`
+
+	TranscriptStatus *string `json:"transcriptStatus"` // queued / running / done / failed / skipped
+	Transcript       *string `json:"transcript"`
+
+	// Цена исходящего по сетке тарифа (rate_deck); null — не исходящий, не отвечен или префикса нет в сетке
+	Cost         *float64 `json:"cost"`
+	RatePrefix   *string  `json:"ratePrefix"`
+	RatedSeconds *int     `json:"ratedSeconds"` // billsec, округлённый до шага тарификации
 }
 
+// CDRStats — итоги отчёта: в /api/reports/calls по звонкам (answered — ответил агент,
+// длительность — разговор звонка), в /api/reports/calls/legs — по ногам (billsec)
 type CDRStats struct {
 	Total    int     `json:"total"`
 	Answered int     `json:"answered"`
 	Missed   int     `json:"missed"`
 	AvgDur   float64 `json:"avgDuration"`
 	TotalDur int     `json:"totalDuration"`
+
+	// Стоимость исходящих по сетке тарифа
+	Cost            float64 `json:"cost"`
+	RatedCalls      int     `json:"ratedCalls"`
+	RatedSeconds    int     `json:"ratedSeconds"`
+	UnratedOutbound int     `json:"unratedOutbound"` // отвеченные исходящие без цены: префикса нет в сетке
 }
 
+// CDRResponse — отчёт звонков: строка — звонок целиком (CallJourney)
 type CDRResponse struct {
-	Records []CDRRecord `json:"records"`
-	Stats   CDRStats    `json:"stats"`
-	Total   int         `json:"total"`
-	Page    int         `json:"page"`
-	PerPage int         `json:"perPage"`
+	ReportZone               // даты звонков — в поясе тенанта (или ?tz)
+	Journeys   []CallJourney `json:"journeys"`
+	Stats      CDRStats      `json:"stats"`
+	Total      int           `json:"total"`
+	Page       int           `json:"page"`
+	PerPage    int           `json:"perPage"`
+}
+
+// CDRLegsResponse — ноги звонков (строки ast_cdr) для разбора и сверки с Asterisk
+type CDRLegsResponse struct {
+	ReportZone             // даты записей — в поясе тенанта (или ?tz)
+	Records    []CDRRecord `json:"records"`
+	Stats      CDRStats    `json:"stats"`
+	Total      int         `json:"total"`
+	Page       int         `json:"page"`
+	PerPage    int         `json:"perPage"`
+}
+
+// CDRFilter — фильтры отчёта звонков (query-параметры GetCDR).
+// Используется и экспортом записей — выборка должна совпадать с отчётом.
+type CDRFilter struct {
+	DateFrom    string `json:"dateFrom,omitempty"` // RFC3339; без смещения или дата — в поясе TimeZone
+	DateTo      string `json:"dateTo,omitempty"`   // RFC3339; дата — включительно, до конца дня
+	TimeZone    string `json:"timeZone,omitempty"` // IANA пояс тенанта (reportLocation), пусто — UTC
+	Src         string `json:"src,omitempty"`
+	Dst         string `json:"dst,omitempty"`
+	Disposition string `json:"disposition,omitempty"`
+	Transcript  string `json:"transcript,omitempty"` // полнотекстовый поиск по расшифровке
+	Agent       string `json:"agent,omitempty"`      // SIP номер агента — ноги с его участием (src, dst, dstchannel)
+}
+
+func cdrFilterFromQuery(q url.Values) CDRFilter {
+	return CDRFilter{
+		DateFrom:    q.Get("dateFrom"),
+		DateTo:      q.Get("dateTo"),
+		TimeZone:    q.Get("tz"),
+		Src:         q.Get("src"),
+		Dst:         q.Get("dst"),
+		Disposition: q.Get("disposition"),
+		Transcript:  q.Get("transcript"),
+		Agent:       q.Get("agent"),
+	}
+}
+
+// where строит WHERE по ast_cdr c; $1 — tenant_id, остальные параметры — в args
+func (f CDRFilter) where(tenantID int) (string, []any) {
+	// Тенант строки проставлен при записи (триггер ast_cdr_stamp_tenant)
+	// Убираем дублирующие строки с lastapp=Hangup
+	where := `
+		WHERE c.lastapp != 'Hangup'
+		AND c.tenant_id = $1`
+
+	args := []any{tenantID}
+	idx := 2
+
+	loc := f.location()
+	if t, ok := parseReportTime(f.DateFrom, loc, false); ok {
+		where += " AND c.calldate AT TIME ZONE 'UTC' >= $" + strconv.Itoa(idx)
+		args = append(args, t.UTC())
+		idx++
+	}
+	if t, ok := parseReportTime(f.DateTo, loc, true); ok {
+		where += " AND c.calldate AT TIME ZONE 'UTC' <= $" + strconv.Itoa(idx)
+		args = append(args, t.UTC())
+		idx++
+	}
+	if f.Src != "" {
+		where += " AND c.src ILIKE $" + strconv.Itoa(idx)
+		args = append(args, "%"+f.Src+"%")
+		idx++
+	}
+	if f.Dst != "" {
+		where += " AND c.dst ILIKE $" + strconv.Itoa(idx)
+		args = append(args, "%"+f.Dst+"%")
+		idx++
+	}
+	if f.Disposition != "" {
+		where += " AND c.disposition = $" + strconv.Itoa(idx)
+		args = append(args, f.Disposition)
+		idx++
+	}
+	if f.Transcript != "" {
+		where += ` AND EXISTS (SELECT 1 FROM transcripts tr
+			WHERE tr.uniqueid = c.uniqueid AND tr.tsv @@ websearch_to_tsquery('simple', $` + strconv.Itoa(idx) + `))`
+		args = append(args, f.Transcript)
+		idx++
+	}
+	if f.Agent != "" {
+		// Нога очереди: dst — номер очереди, агент — пир dstchannel
+		where += " AND $" + strconv.Itoa(idx) + " IN (c.src, c.dst, substring(c.dstchannel from '^[^/]+/([^-;@/]+)'))"
+		args = append(args, f.Agent)
+	}
+	return where, args
+}
+
+// location — пояс дат фильтра; неизвестный пояс — UTC
+func (f CDRFilter) location() *time.Location {
+	loc, err := loadTimeZone(f.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 // GetCDR godoc
-// @Summary      Отчёт звонков из ast_cdr
+// @Summary      Отчёт звонков: один звонок — одна строка
+// @Description  Ноги ast_cdr группируются по linkedid: путь звонка (IVR, очередь, попытки агентам, ответ, переводы) с таймингом каждой ноги и итогом; звонок попадает в отчёт, если под фильтр подходит хотя бы одна его нога. Итоги — по звонкам. Отдельные ноги — /api/reports/calls/legs.
+// @Description  dateFrom/dateTo — RFC3339 или дата/время без смещения в поясе компании (?tz — другой IANA-пояс); даты звонков — в том же поясе.
 // @Tags         Reports
 // @Security     BearerAuth
 // @Produce      json
+// @Param        tz           query  string  false  "IANA пояс, по умолчанию — пояс компании"
+// @Param        dateFrom     query  string  false  "RFC3339 или дата в поясе отчёта"
+// @Param        dateTo       query  string  false  "RFC3339 или дата в поясе отчёта (включительно)"
+// @Param        src          query  string  false  "Откуда (подстрока)"
+// @Param        dst          query  string  false  "Куда (подстрока)"
+// @Param        disposition  query  string  false  "ANSWERED / NO ANSWER / BUSY / FAILED"
+// @Param        transcript   query  string  false  "Поиск по расшифровке"
+// @Param        agent        query  string  false  "SIP номер агента"
+// @Param        page         query  int     false  "Страница"
+// @Param        perPage      query  int     false  "до 200"
+// @Success      200  {object}  CDRResponse
 // @Router       /api/reports/calls [get]
 func (h *CDRHandler) GetCDR(w http.ResponseWriter, r *http.Request) {
 	user := auth.FromContext(r.Context())
@@ -68,94 +198,192 @@ func (h *CDRHandler) GetCDR(w http.ResponseWriter, r *http.Request) {
 	if perPage < 1 || perPage > 200 {
 		perPage = 50
 	}
-	offset := (page - 1) * perPage
+	loc, err := reportLocation(r.Context(), h.DB, user.TenantID, q)
+	if err != nil {
+		http.Error(w, "invalid tz", http.StatusBadRequest)
+		return
+	}
+	resp := CDRResponse{ReportZone: reportZone(loc), Journeys: make([]CallJourney, 0), Page: page, PerPage: perPage}
 
-	// Фильтруем по tenant_id через JOIN users по sipno
-	// Убираем дублирующие строки с lastapp=Hangup
-	where := `
-		WHERE c.lastapp != 'Hangup'
-		AND (
-			EXISTS (SELECT 1 FROM users WHERE sipno::text = c.src AND tenant_id = $1)
-			OR
-			EXISTS (SELECT 1 FROM users WHERE sipno::text = c.dst AND tenant_id = $1)
-		)`
+	filter := cdrFilterFromQuery(q)
+	filter.TimeZone = loc.String()
+	where, args := filter.where(user.TenantID)
+	idx := len(args) + 1
 
-	args := []any{user.TenantID}
-	idx := 2
+	// Статистика по звонкам
+	stats := &resp.Stats
+	err = h.DB.QueryRow(r.Context(), journeyStatsSQL(where), args...).Scan(
+		&stats.Total, &stats.Answered, &stats.Missed, &stats.AvgDur, &stats.TotalDur,
+		&stats.Cost, &stats.RatedCalls, &stats.RatedSeconds, &stats.UnratedOutbound)
+	if err != nil {
+		log.Printf("❌ GetCDR stats: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Total = stats.Total
 
-	if v := q.Get("dateFrom"); v != "" {
-		if t, err := time.Parse(time.RFC3339, v); err == nil {
-			where += " AND c.calldate AT TIME ZONE 'UTC' >= $" + strconv.Itoa(idx)
-			args = append(args, t.UTC())
-			idx++
+	// Звонки страницы
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT COALESCE(NULLIF(c.linkedid, ''), c.uniqueid) AS lid
+		FROM ast_cdr c `+where+`
+		GROUP BY 1
+		ORDER BY MIN(c.calldate) DESC, 1
+		LIMIT $`+strconv.Itoa(idx)+` OFFSET $`+strconv.Itoa(idx+1),
+		append(args, perPage, (page-1)*perPage)...)
+	if err != nil {
+		log.Printf("❌ GetCDR journeys: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("❌ GetCDR scan: %v", err)
+			continue
 		}
+		ids = append(ids, id)
 	}
-	if v := q.Get("dateTo"); v != "" {
-		if t, err := time.Parse(time.RFC3339, v); err == nil {
-			where += " AND c.calldate AT TIME ZONE 'UTC' <= $" + strconv.Itoa(idx)
-			args = append(args, t.UTC())
-			idx++
+	rows.Close()
+
+	if len(ids) > 0 {
+		legs, err := h.journeyLegs(r.Context(), user.TenantID, ids)
+		if err != nil {
+			log.Printf("❌ GetCDR legs: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, id := range ids {
+			if l := legs[id]; len(l) > 0 {
+				resp.Journeys = append(resp.Journeys, buildJourney(id, l).in(loc))
+			}
 		}
 	}
-	if v := q.Get("src"); v != "" {
-		where += " AND c.src ILIKE $" + strconv.Itoa(idx)
-		args = append(args, "%"+v+"%")
-		idx++
+	jsonResp(w, resp)
+}
+
+// journeyStatsSQL — итоги отчёта по звонкам, подходящим под where (CDRFilter.where).
+// Повторяет buildJourney: направление — по первой ноге, ответ — отвеченная нога
+// с агентом (исходящий — любая отвеченная), разговор — интервалы ответа ног
+// без наложений. Стоимость — сумма по ногам; ratedCalls и unratedOutbound — звонки.
+func journeyStatsSQL(where string) string {
+	return `
+		WITH m AS (
+			SELECT COALESCE(NULLIF(c.linkedid, ''), c.uniqueid) AS lid
+			FROM ast_cdr c ` + where + `
+			GROUP BY 1
+		),
+		l AS (
+			SELECT m.lid, c.id, c.calldate, c.disposition, c.billsec, c.cost, c.rated_seconds, c.direction,
+			       c.calldate + make_interval(secs => c.duration) AS leg_end,
+			       c.calldate + make_interval(secs => c.duration - c.billsec) AS talk_start,
+			       EXISTS (SELECT 1 FROM users u WHERE u.tenant_id = $1 AND ` + journeyCallerMatch + `) AS by_caller,
+			       EXISTS (SELECT 1 FROM users u WHERE u.tenant_id = $1 AND ` + journeyAgentMatch + `) AS by_agent
+			FROM m
+			JOIN ast_cdr c ON (c.linkedid = m.lid OR c.uniqueid = m.lid)
+			              AND COALESCE(NULLIF(c.linkedid, ''), c.uniqueid) = m.lid
+			WHERE ` + journeyLegScope + `
+		),
+		a AS (
+			SELECT l.*,
+			       l.disposition = 'ANSWERED' AND l.billsec > 0
+			       AND (l.by_agent OR first_value(l.by_caller AND NOT l.by_agent) OVER w) AS answered
+			FROM l
+			WINDOW w AS (PARTITION BY l.lid ORDER BY l.calldate, l.id)
+		),
+		t AS (
+			SELECT a.*,
+			       MAX(a.leg_end) FILTER (WHERE a.answered) OVER (PARTITION BY a.lid ORDER BY a.calldate, a.id
+			           ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS prev_end
+			FROM a
+		),
+		j AS (
+			SELECT lid, bool_or(answered) AS answered,
+			       COALESCE(SUM(GREATEST(0, EXTRACT(EPOCH FROM
+			           leg_end - GREATEST(talk_start, COALESCE(prev_end, talk_start)))::int)) FILTER (WHERE answered), 0) AS talk,
+			       SUM(cost) AS cost,
+			       SUM(rated_seconds) FILTER (WHERE cost IS NOT NULL) AS rated_seconds,
+			       COUNT(*) FILTER (WHERE cost IS NULL AND disposition = 'ANSWERED' AND billsec > 0
+			           AND direction = 'outbound') AS unrated
+			FROM t
+			GROUP BY lid
+		)
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE answered),
+		       COUNT(*) FILTER (WHERE NOT answered),
+		       COALESCE(AVG(talk) FILTER (WHERE answered), 0),
+		       COALESCE(SUM(talk), 0),
+		       COALESCE(SUM(cost), 0),
+		       COUNT(cost),
+		       COALESCE(SUM(rated_seconds), 0),
+		       COUNT(*) FILTER (WHERE unrated > 0)
+		FROM j`
+}
+
+// GetCDRLegs godoc
+// @Summary      Ноги звонков из ast_cdr
+// @Description  Строка — нога звонка (строка ast_cdr), итоги — по ногам. Для разбора звонка и сверки с Asterisk; основной отчёт — /api/reports/calls.
+// @Description  Фильтры — как у /api/reports/calls; даты записей — в поясе компании (?tz — другой IANA-пояс).
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  CDRLegsResponse
+// @Router       /api/reports/calls/legs [get]
+func (h *CDRHandler) GetCDRLegs(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
 	}
-	if v := q.Get("dst"); v != "" {
-		where += " AND c.dst ILIKE $" + strconv.Itoa(idx)
-		args = append(args, "%"+v+"%")
-		idx++
+	perPage, _ := strconv.Atoi(q.Get("perPage"))
+	if perPage < 1 || perPage > 200 {
+		perPage = 50
 	}
-	if v := q.Get("disposition"); v != "" {
-		where += " AND c.disposition = $" + strconv.Itoa(idx)
-		args = append(args, v)
-		idx++
+	offset := (page - 1) * perPage
+
+	loc, err := reportLocation(r.Context(), h.DB, user.TenantID, q)
+	if err != nil {
+		http.Error(w, "invalid tz", http.StatusBadRequest)
+		return
 	}
+	filter := cdrFilterFromQuery(q)
+	filter.TimeZone = loc.String()
+	where, args := filter.where(user.TenantID)
+	idx := len(args) + 1
 
 	// Статистика
 	var stats CDRStats
-	err := h.DB.QueryRow(r.Context(), `
+	err = h.DB.QueryRow(r.Context(), `
 		SELECT
 			COUNT(*),
 			COUNT(*) FILTER (WHERE disposition = 'ANSWERED'),
 			COUNT(*) FILTER (WHERE disposition != 'ANSWERED'),
 			COALESCE(AVG(billsec) FILTER (WHERE disposition = 'ANSWERED'), 0),
-			COALESCE(SUM(billsec) FILTER (WHERE disposition = 'ANSWERED'), 0)
+			COALESCE(SUM(billsec) FILTER (WHERE disposition = 'ANSWERED'), 0),
+			COALESCE(SUM(c.cost), 0),
+			COUNT(c.cost),
+			COALESCE(SUM(c.rated_seconds) FILTER (WHERE c.cost IS NOT NULL), 0),
+			COUNT(*) FILTER (WHERE c.cost IS NULL AND disposition = 'ANSWERED' AND c.billsec > 0
+				AND c.direction = 'outbound')
 		FROM ast_cdr c `+where, args...,
-	).Scan(&stats.Total, &stats.Answered, &stats.Missed, &stats.AvgDur, &stats.TotalDur)
+	).Scan(&stats.Total, &stats.Answered, &stats.Missed, &stats.AvgDur, &stats.TotalDur,
+		&stats.Cost, &stats.RatedCalls, &stats.RatedSeconds, &stats.UnratedOutbound)
 	if err != nil {
-		log.Printf("❌ GetCDR stats: %v", err)
+		log.Printf("❌ GetCDRLegs stats: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Записи
-	rows, err := h.DB.Query(r.Context(), `
-		SELECT
-			c.id,
-			COALESCE(c.uniqueid, ''),
-			COALESCE(c.src, ''),
-			COALESCE(c.dst, ''),
-			COALESCE(c.channel, ''),
-			COALESCE(c.dstchannel, ''),
-			COALESCE(c.lastapp, ''),
-			c.calldate,
-			c.duration,
-			c.billsec,
-			COALESCE(c.disposition, ''),
-			COALESCE(c.clid, ''),
-			(SELECT COALESCE(NULLIF(TRIM(COALESCE(first_name,'') || ' ' || COALESCE(last_name,'')), ''), username)
-			 FROM users WHERE sipno::text = c.src AND tenant_id = $1 LIMIT 1),
-			NULLIF(TRIM(c.userfield), '')
-		FROM ast_cdr c
-		`+where+`
+	rows, err := h.DB.Query(r.Context(), cdrRecordSelect+where+`
 		ORDER BY c.calldate DESC
 		LIMIT $`+strconv.Itoa(idx)+` OFFSET $`+strconv.Itoa(idx+1),
 		append(args, perPage, offset)...,
 	)
 	if err != nil {
-		log.Printf("❌ GetCDR records: %v", err)
+		log.Printf("❌ GetCDRLegs records: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -163,34 +391,81 @@ func (h *CDRHandler) GetCDR(w http.ResponseWriter, r *http.Request) {
 
 	records := make([]CDRRecord, 0)
 	for rows.Next() {
-		var rec CDRRecord
-		var userfield *string
-		if err := rows.Scan(
-			&rec.ID, &rec.Uniqueid,
-			&rec.Src, &rec.Dst,
-			&rec.Channel, &rec.DstChannel, &rec.LastApp,
-			&rec.CallDate, &rec.Duration, &rec.Billsec,
-			&rec.Disposition, &rec.Clid,
-			&rec.AgentName,
-			&userfield,
-		); err != nil {
-			log.Printf("❌ GetCDR scan: %v", err)
+		rec, err := h.scanRecord(rows)
+		if err != nil {
+			log.Printf("❌ GetCDRLegs scan: %v", err)
 			continue
 		}
-		// Если userfield содержит имя файла записи
-		if userfield != nil && *userfield != "" {
-			url := h.RecordingURL + "/" + *userfield
-			rec.RecordingURL = &url
-		}
+		rec.CallDate = rec.CallDate.In(loc)
 		records = append(records, rec)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(CDRResponse{
-		Records: records,
-		Stats:   stats,
-		Total:   stats.Total,
-		Page:    page,
-		PerPage: perPage,
+	json.NewEncoder(w).Encode(CDRLegsResponse{
+		ReportZone: reportZone(loc),
+		Records:    records,
+		Stats:      stats,
+		Total:      stats.Total,
+		Page:       page,
+		PerPage:    perPage,
 	})
-}
\ No newline at end of file
+}
+
+// cdrRecordSelect — ноги звонков (GetCDRLegs); дальше — WHERE из CDRFilter.where
+const cdrRecordSelect = `
+		SELECT
+			c.id,
+			COALESCE(c.uniqueid, ''),
+			COALESCE(c.src, ''),
+			COALESCE(c.dst, ''),
+			COALESCE(c.channel, ''),
+			COALESCE(c.dstchannel, ''),
+			COALESCE(c.lastapp, ''),
+			c.calldate,
+			c.duration,
+			c.billsec,
+			COALESCE(c.disposition, ''),
+			COALESCE(c.clid, ''),
+			(SELECT `+userNameSQL+` FROM users u WHERE u.id = c.agent_user_id),
+			NULLIF(TRIM(c.userfield), ''),
+			d.code,
+			d.name,
+			tj.status,
+			tr.text,
+			c.cost,
+			c.rate_prefix,
+			c.rated_seconds
+		FROM ast_cdr c
+		LEFT JOIN call_dispositions cd ON cd.uniqueid = c.uniqueid AND cd.tenant_id = $1
+		LEFT JOIN crm_dispositions d   ON d.id = cd.disposition_id
+		LEFT JOIN transcription_jobs tj ON tj.uniqueid = c.uniqueid AND tj.tenant_id = $1
+		LEFT JOIN transcripts tr        ON tr.uniqueid = c.uniqueid AND tr.tenant_id = $1
+		`
+
+// scanRecord читает строку cdrRecordSelect
+func (h *CDRHandler) scanRecord(row interface{ Scan(...any) error }) (CDRRecord, error) {
+	var rec CDRRecord
+	var userfield *string
+	err := row.Scan(
+		&rec.ID, &rec.Uniqueid,
+		&rec.Src, &rec.Dst,
+		&rec.Channel, &rec.DstChannel, &rec.LastApp,
+		&rec.CallDate, &rec.Duration, &rec.Billsec,
+		&rec.Disposition, &rec.Clid,
+		&rec.AgentName,
+		&userfield,
+		&rec.ResultCode,
+		&rec.ResultName,
+		&rec.TranscriptStatus,
+		&rec.Transcript,
+		&rec.Cost,
+		&rec.RatePrefix,
+		&rec.RatedSeconds,
+	)
+	// Если userfield содержит имя файла записи
+	if userfield != nil && *userfield != "" {
+		url := h.RecordingURL + "/" + *userfield
+		rec.RecordingURL = &url
+	}
+	return rec, err
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"callcentrix/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// =========================
+// MODELS
+// =========================
+
+// CallJourney — звонок целиком: все ноги ast_cdr с одним linkedid
+// (IVR → очередь → попытки агентам → ответил → перевод) и итог звонка
+type CallJourney struct {
+	LinkedID  string    `json:"linkedid"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	Direction string    `json:"direction"` // inbound / outbound / internal
+	Src       string    `json:"src"`       // кто звонил (первая нога)
+	Dst       string    `json:"dst"`       // куда звонили
+	Clid      string    `json:"clid"`
+	Queue     *string   `json:"queue"`
+
+	// answered — ответил агент (исходящий — ответил абонент), transferred — после ответа
+	// переведён другому агенту, abandoned — входящий сброшен в IVR или очереди,
+	// voicemail, no-answer, busy, failed
+	Outcome       string           `json:"outcome"`
+	Agent         *JourneyAgent    `json:"agent"`      // исходящий: кто звонил
+	AnsweredBy    *JourneyAgent    `json:"answeredBy"` // входящий: кто ответил первым
+	TransferredTo []JourneyAgent   `json:"transferredTo"`
+	AgentsTried   []JourneyAgent   `json:"agentsTried"` // звонили, но не ответили
+	WaitSeconds   int              `json:"waitSeconds"` // от начала до ответа (или до конца, если ответа нет)
+	TalkSeconds   int              `json:"talkSeconds"` // разговор без наложений ног
+	Duration      int              `json:"duration"`
+	ResultCode    *string          `json:"resultCode"` // wrap-up
+	ResultName    *string          `json:"resultName"`
+	Cost          *float64         `json:"cost"` // сумма цен ног по сетке тарифа; null — тарифицированных ног нет
+	Legs          []CallJourneyLeg `json:"legs"`
+}
+
+type JourneyAgent struct {
+	UserID    int    `json:"userId"`
+	Name      string `json:"name"`
+	Extension string `json:"extension"`
+}
+
+// CallJourneyLeg — строка ast_cdr в пути звонка
+type CallJourneyLeg struct {
+	ID           int           `json:"id"`
+	Uniqueid     string        `json:"uniqueid"`
+	Step         string        `json:"step"` // ivr / queue / agent / transfer / voicemail / dial
+	Src          string        `json:"src"`
+	Dst          string        `json:"dst"`
+	Channel      string        `json:"channel"`
+	DstChannel   string        `json:"dstChannel"`
+	LastApp      string        `json:"lastApp"`
+	LastData     string        `json:"lastData"`
+	Agent        *JourneyAgent `json:"agent"` // агент на стороне dst / dstchannel
+	StartedAt    time.Time     `json:"startedAt"`
+	Offset       int           `json:"offset"` // секунд от начала звонка
+	RingSeconds  int           `json:"ringSeconds"`
+	Billsec      int           `json:"billsec"`
+	Disposition  string        `json:"disposition"`
+	Cost         *float64      `json:"cost"`
+	RecordingURL *string       `json:"recordingUrl"`
+
+	caller     *JourneyAgent // агент на стороне src
+	tenantID   *int
+	duration   int
+	clid       string
+	resultCode *string
+	resultName *string
+	transcript *string
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// GetCallJourney godoc
+// @Summary      Путь одного звонка
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        linkedid  path  string  true  "linkedid звонка"
+// @Success      200  {object}  CallJourney
+// @Router       /api/reports/calls/journeys/{linkedid} [get]
+func (h *CDRHandler) GetCallJourney(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id := chi.URLParam(r, "linkedid")
+
+	legs, err := h.journeyLegs(r.Context(), user.TenantID, []string{id})
+	if err != nil {
+		log.Printf("❌ GetCallJourney: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Звонок тенанта — если хотя бы одна нога записана за ним
+	own := false
+	for _, l := range legs[id] {
+		if l.tenantID != nil && *l.tenantID == user.TenantID {
+			own = true
+			break
+		}
+	}
+	if !own {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	loc, err := reportLocation(r.Context(), h.DB, user.TenantID, r.URL.Query())
+	if err != nil {
+		http.Error(w, "invalid tz", http.StatusBadRequest)
+		return
+	}
+	jsonResp(w, buildJourney(id, legs[id]).in(loc))
+}
+
+// =========================
+// HELPERS
+// =========================
+
+// journeyLegSelect — ноги звонков по linkedid (у старых CDR без linkedid — по uniqueid),
+// первая колонка — ключ звонка; дальше — условия, journeyLegScope и порядок ног.
+// Агент ноги — пользователь тенанта по dst или по пиру dstchannel (PJSIP/101-0000002a):
+// у ноги очереди dst — номер очереди, а ответивший агент виден только в dstchannel.
+const journeyLegSelect = `
+		SELECT COALESCE(NULLIF(c.linkedid, ''), c.uniqueid),
+		       c.id, c.tenant_id, COALESCE(c.uniqueid, ''),
+		       COALESCE(c.src, ''), COALESCE(c.dst, ''),
+		       COALESCE(c.channel, ''), COALESCE(c.dstchannel, ''),
+		       COALESCE(c.lastapp, ''), COALESCE(c.lastdata, ''),
+		       c.calldate, c.duration, c.billsec, COALESCE(c.disposition, ''),
+		       COALESCE(c.clid, ''), c.cost,
+		       NULLIF(TRIM(c.userfield), '') IS NOT NULL,
+		       su.id, su.name, su.ext,
+		       au.id, au.name, au.ext,
+		       d.code, d.name, tr.text
+		FROM ast_cdr c
+		LEFT JOIN LATERAL (
+			SELECT u.id, ` + userNameSQL + ` AS name, u.sipno::text AS ext FROM users u
+			WHERE u.tenant_id = $1 AND ` + journeyCallerMatch + ` LIMIT 1
+		) su ON TRUE
+		LEFT JOIN LATERAL (
+			SELECT u.id, ` + userNameSQL + ` AS name, u.sipno::text AS ext FROM users u
+			WHERE u.tenant_id = $1 AND ` + journeyAgentMatch + `
+			LIMIT 1
+		) au ON TRUE
+		LEFT JOIN call_dispositions cd ON cd.uniqueid = c.uniqueid AND cd.tenant_id = $1
+		LEFT JOIN crm_dispositions d   ON d.id = cd.disposition_id
+		LEFT JOIN transcripts tr       ON tr.uniqueid = c.uniqueid AND tr.tenant_id = $1`
+
+// Пользователь тенанта u на сторонах ноги c: звонивший и агент. Те же условия —
+// в статистике отчёта (journeyStatsSQL), чтобы итоги совпадали со строками.
+const (
+	journeyCallerMatch = `u.sipno::text = c.src`
+	journeyAgentMatch  = `u.sipno::text IN (c.dst, substring(c.dstchannel from '^[^/]+/([^-;@/]+)'))`
+)
+
+// journeyLegScope — ноги тенанта и ноги без владельца (IVR, очередь, внешний номер);
+// ноги чужого тенанта не показываем
+const journeyLegScope = `(c.tenant_id = $1 OR c.tenant_id IS NULL) AND c.lastapp != 'Hangup'`
+
+// journeyLegs — ноги звонков ids, сгруппированные по звонку
+func (h *CDRHandler) journeyLegs(ctx context.Context, tenantID int, ids []string) (map[string][]CallJourneyLeg, error) {
+	rows, err := h.DB.Query(ctx, journeyLegSelect+`
+		WHERE (c.linkedid = ANY($2) OR c.uniqueid = ANY($2))
+		  AND `+journeyLegScope+`
+		ORDER BY c.calldate, c.id`,
+		tenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string][]CallJourneyLeg)
+	for rows.Next() {
+		id, l, err := scanJourneyLeg(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[id] = append(result[id], l)
+	}
+	return result, rows.Err()
+}
+
+// scanJourneyLeg читает строку journeyLegSelect: ключ звонка и ногу
+func scanJourneyLeg(row interface{ Scan(...any) error }) (string, CallJourneyLeg, error) {
+	var id string
+	var l CallJourneyLeg
+	var recorded bool
+	var srcID, agentID *int
+	var srcName, srcExt, agentName, agentExt *string
+	if err := row.Scan(&id, &l.ID, &l.tenantID, &l.Uniqueid, &l.Src, &l.Dst, &l.Channel, &l.DstChannel,
+		&l.LastApp, &l.LastData, &l.StartedAt, &l.duration, &l.Billsec, &l.Disposition, &l.clid, &l.Cost,
+		&recorded, &srcID, &srcName, &srcExt, &agentID, &agentName, &agentExt,
+		&l.resultCode, &l.resultName, &l.transcript); err != nil {
+		return "", l, err
+	}
+	l.RingSeconds = l.duration - l.Billsec
+	if srcID != nil {
+		l.caller = &JourneyAgent{UserID: *srcID, Name: *srcName, Extension: *srcExt}
+	}
+	if agentID != nil {
+		l.Agent = &JourneyAgent{UserID: *agentID, Name: *agentName, Extension: *agentExt}
+	}
+	if recorded {
+		path := recordingPath(l.Uniqueid)
+		l.RecordingURL = &path
+	}
+	return id, l, nil
+}
+
+// buildJourney собирает путь и итог звонка из его ног (по времени начала).
+// Разговор считается по интервалам ответа ног без наложений: нога очереди и
+// нога агента в Asterisk часто покрывают один и тот же разговор.
+func buildJourney(id string, legs []CallJourneyLeg) CallJourney {
+	first := legs[0]
+	j := CallJourney{
+		LinkedID:      id,
+		StartedAt:     first.StartedAt,
+		EndedAt:       first.StartedAt,
+		Direction:     "inbound",
+		Src:           first.Src,
+		Dst:           first.Dst,
+		Clid:          first.clid,
+		TransferredTo: make([]JourneyAgent, 0),
+		AgentsTried:   make([]JourneyAgent, 0),
+		Legs:          legs,
+	}
+	if first.caller != nil {
+		j.Direction = "outbound"
+		j.Agent = first.caller
+		if first.Agent != nil {
+			j.Direction = "internal"
+		}
+	}
+
+	var answeredAt, talkEnd time.Time
+	hasQueue, hasIVR, hasVoicemail := false, false, false
+	seen := make(map[int]bool) // агенты в answeredBy / transferredTo / agentsTried
+
+	for i := range legs {
+		l := &legs[i]
+		l.Offset = int(l.StartedAt.Sub(j.StartedAt).Seconds())
+		end := l.StartedAt.Add(time.Duration(l.duration) * time.Second)
+		if end.After(j.EndedAt) {
+			j.EndedAt = end
+		}
+		if j.ResultCode == nil && l.resultCode != nil {
+			j.ResultCode, j.ResultName = l.resultCode, l.resultName
+		}
+		if l.Cost != nil {
+			cost := *l.Cost
+			if j.Cost != nil {
+				cost += *j.Cost
+			}
+			j.Cost = &cost
+		}
+
+		l.Step = journeyStep(l.LastApp)
+		switch l.Step {
+		case "queue":
+			hasQueue = true
+			if j.Queue == nil {
+				queue, _, _ := strings.Cut(l.LastData, ",")
+				j.Queue = &queue
+			}
+		case "ivr":
+			hasIVR = true
+		case "voicemail":
+			hasVoicemail = true
+		case "dial":
+			if l.Agent != nil && j.Direction != "outbound" {
+				l.Step = "agent"
+			}
+		}
+
+		// Ответ: на входящем — агентом, на исходящем — любой отвеченной ногой
+		answered := l.Disposition == "ANSWERED" && l.Billsec > 0
+		if j.Direction != "outbound" {
+			answered = answered && l.Agent != nil
+		}
+		if answered {
+			start := end.Add(-time.Duration(l.Billsec) * time.Second)
+			if answeredAt.IsZero() || start.Before(answeredAt) {
+				answeredAt = start
+			}
+			if start.Before(talkEnd) {
+				start = talkEnd
+			}
+			if end.After(start) {
+				j.TalkSeconds += int(end.Sub(start).Seconds())
+				talkEnd = end
+			}
+		}
+		if j.Direction == "outbound" || l.Agent == nil {
+			continue
+		}
+		switch {
+		case answered && j.AnsweredBy == nil:
+			j.AnsweredBy = l.Agent
+			seen[l.Agent.UserID] = true
+		case answered && l.Agent.UserID != j.AnsweredBy.UserID:
+			l.Step = "transfer"
+			if !seen[l.Agent.UserID] {
+				j.TransferredTo = append(j.TransferredTo, *l.Agent)
+				seen[l.Agent.UserID] = true
+			}
+		}
+	}
+	// Не ответившие агенты — только те, кто так и не взял трубку
+	for _, l := range legs {
+		if l.Agent != nil && j.Direction != "outbound" && !seen[l.Agent.UserID] {
+			j.AgentsTried = append(j.AgentsTried, *l.Agent)
+			seen[l.Agent.UserID] = true
+		}
+	}
+
+	j.Duration = int(j.EndedAt.Sub(j.StartedAt).Seconds())
+	if answeredAt.IsZero() {
+		j.WaitSeconds = j.Duration
+	} else {
+		j.WaitSeconds = int(answeredAt.Sub(j.StartedAt).Seconds())
+	}
+
+	last := legs[len(legs)-1].Disposition
+	switch {
+	case len(j.TransferredTo) > 0:
+		j.Outcome = "transferred"
+	case !answeredAt.IsZero():
+		j.Outcome = "answered"
+	case j.Direction == "outbound":
+		j.Outcome = journeyDisposition(last)
+	case hasVoicemail:
+		j.Outcome = "voicemail"
+	case hasQueue || hasIVR || last == "ANSWERED":
+		// Канал ответил Asterisk (IVR, очередь), но агента звонящий не дождался
+		j.Outcome = "abandoned"
+	default:
+		j.Outcome = journeyDisposition(last)
+	}
+	return j
+}
+
+// in переводит время звонка и его ног в пояс отчёта
+func (j CallJourney) in(loc *time.Location) CallJourney {
+	j.StartedAt = j.StartedAt.In(loc)
+	j.EndedAt = j.EndedAt.In(loc)
+	for i := range j.Legs {
+		j.Legs[i].StartedAt = j.Legs[i].StartedAt.In(loc)
+	}
+	return j
+}
+
+func journeyDisposition(d string) string {
+	switch d {
+	case "NO ANSWER":
+		return "no-answer"
+	case "BUSY":
+		return "busy"
+	case "ANSWERED":
+		return "answered"
+	}
+	return "failed"
+}
+
+func journeyStep(lastApp string) string {
+	switch strings.ToLower(lastApp) {
+	case "queue":
+		return "queue"
+	case "background", "playback", "read", "waitexten", "ivr":
+		return "ivr"
+	case "voicemail":
+		return "voicemail"
+	}
+	return "dial"
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildJourney(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	agent := func(id int, ext string) *JourneyAgent {
+		return &JourneyAgent{UserID: id, Name: "Agent " + ext, Extension: ext}
+	}
+	a101, a102, a103 := agent(1, "101"), agent(2, "102"), agent(3, "103")
+	cost := func(v float64) *float64 { return &v }
+	code := "sale"
+
+	// leg — нога: начало (секунд от t0), длительность, billsec, disposition, lastapp
+	leg := func(offset, duration, billsec int, disposition, lastApp string) CallJourneyLeg {
+		return CallJourneyLeg{
+			Src: "992901234567", Dst: "700", StartedAt: t0.Add(time.Duration(offset) * time.Second),
+			duration: duration, Billsec: billsec, Disposition: disposition, LastApp: lastApp,
+		}
+	}
+	with := func(l CallJourneyLeg, f func(*CallJourneyLeg)) CallJourneyLeg { f(&l); return l }
+	queue := func(l *CallJourneyLeg) { l.LastData = "support,t,,,300" }
+	by := func(a *JourneyAgent) func(*CallJourneyLeg) { return func(l *CallJourneyLeg) { l.Agent = a } }
+
+	type want struct {
+		direction, outcome string
+		queue              string
+		answeredBy, agent  *JourneyAgent
+		transferred, tried []JourneyAgent
+		wait, talk, dur    int
+		steps              []string
+		cost               *float64
+		resultCode         *string
+	}
+	tests := []struct {
+		name string
+		legs []CallJourneyLeg
+		want want
+	}{
+		{
+			name: "ivr, queue, first agent no answer, second answers",
+			legs: []CallJourneyLeg{
+				leg(0, 10, 10, "ANSWERED", "BackGround"),
+				with(leg(10, 100, 80, "ANSWERED", "Queue"), func(l *CallJourneyLeg) { queue(l); l.Agent = a102 }),
+				with(leg(10, 15, 0, "NO ANSWER", "Dial"), by(a101)),
+			},
+			want: want{
+				direction: "inbound", outcome: "answered", queue: "support",
+				answeredBy: a102, transferred: []JourneyAgent{}, tried: []JourneyAgent{*a101},
+				wait: 30, talk: 80, dur: 110,
+				steps: []string{"ivr", "queue", "agent"},
+			},
+		},
+		{
+			name: "answered then transferred, talk without overlap",
+			legs: []CallJourneyLeg{
+				with(leg(0, 60, 50, "ANSWERED", "Queue"), func(l *CallJourneyLeg) { queue(l); l.Agent = a101 }),
+				with(leg(40, 70, 60, "ANSWERED", "Dial"), by(a103)),
+			},
+			want: want{
+				direction: "inbound", outcome: "transferred", queue: "support",
+				answeredBy: a101, transferred: []JourneyAgent{*a103}, tried: []JourneyAgent{},
+				wait: 10, talk: 100, dur: 110,
+				steps: []string{"queue", "transfer"},
+			},
+		},
+		{
+			name: "queue abandon after agent rang",
+			legs: []CallJourneyLeg{
+				leg(0, 8, 8, "ANSWERED", "Playback"),
+				with(leg(8, 45, 37, "ANSWERED", "Queue"), queue),
+				with(leg(12, 20, 0, "NO ANSWER", "Dial"), by(a101)),
+			},
+			want: want{
+				direction: "inbound", outcome: "abandoned", queue: "support",
+				transferred: []JourneyAgent{}, tried: []JourneyAgent{*a101},
+				wait: 53, talk: 0, dur: 53,
+				steps: []string{"ivr", "queue", "agent"},
+			},
+		},
+		{
+			name: "voicemail",
+			legs: []CallJourneyLeg{
+				with(leg(0, 30, 0, "NO ANSWER", "Dial"), by(a101)),
+				leg(30, 40, 40, "ANSWERED", "VoiceMail"),
+			},
+			want: want{
+				direction: "inbound", outcome: "voicemail",
+				transferred: []JourneyAgent{}, tried: []JourneyAgent{*a101},
+				wait: 70, talk: 0, dur: 70,
+				steps: []string{"agent", "voicemail"},
+			},
+		},
+		{
+			name: "outbound answered, cost summed over legs",
+			legs: []CallJourneyLeg{
+				with(leg(0, 50, 40, "ANSWERED", "Dial"), func(l *CallJourneyLeg) {
+					l.Src, l.Dst, l.caller, l.Cost = "101", "901234567", a101, cost(0.5)
+					l.resultCode = &code
+				}),
+				with(leg(55, 20, 15, "ANSWERED", "Dial"), func(l *CallJourneyLeg) {
+					l.Src, l.Dst, l.caller, l.Cost = "101", "901234567", a101, cost(0.25)
+				}),
+			},
+			want: want{
+				direction: "outbound", outcome: "answered", agent: a101,
+				transferred: []JourneyAgent{}, tried: []JourneyAgent{},
+				wait: 10, talk: 55, dur: 75,
+				steps: []string{"dial", "dial"}, cost: cost(0.75), resultCode: &code,
+			},
+		},
+		{
+			name: "outbound busy",
+			legs: []CallJourneyLeg{
+				with(leg(0, 5, 0, "BUSY", "Dial"), func(l *CallJourneyLeg) { l.caller = a101 }),
+			},
+			want: want{
+				direction: "outbound", outcome: "busy", agent: a101,
+				transferred: []JourneyAgent{}, tried: []JourneyAgent{},
+				wait: 5, talk: 0, dur: 5,
+				steps: []string{"dial"},
+			},
+		},
+		{
+			name: "internal answered",
+			legs: []CallJourneyLeg{
+				with(leg(0, 20, 12, "ANSWERED", "Dial"), func(l *CallJourneyLeg) { l.caller, l.Agent = a101, a102 }),
+			},
+			want: want{
+				direction: "internal", outcome: "answered", agent: a101, answeredBy: a102,
+				transferred: []JourneyAgent{}, tried: []JourneyAgent{},
+				wait: 8, talk: 12, dur: 20,
+				steps: []string{"agent"},
+			},
+		},
+		{
+			name: "inbound no answer without queue",
+			legs: []CallJourneyLeg{
+				with(leg(0, 25, 0, "NO ANSWER", "Dial"), by(a101)),
+			},
+			want: want{
+				direction: "inbound", outcome: "no-answer",
+				transferred: []JourneyAgent{}, tried: []JourneyAgent{*a101},
+				wait: 25, talk: 0, dur: 25,
+				steps: []string{"agent"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := buildJourney("1760864400.1", tt.legs)
+			w := tt.want
+			if j.LinkedID != "1760864400.1" || !j.StartedAt.Equal(t0) {
+				t.Errorf("id/start = %s %s", j.LinkedID, j.StartedAt)
+			}
+			if j.Direction != w.direction || j.Outcome != w.outcome {
+				t.Errorf("direction/outcome = %s/%s, want %s/%s", j.Direction, j.Outcome, w.direction, w.outcome)
+			}
+			queue := ""
+			if j.Queue != nil {
+				queue = *j.Queue
+			}
+			if queue != w.queue {
+				t.Errorf("queue = %q, want %q", queue, w.queue)
+			}
+			if !reflect.DeepEqual(j.AnsweredBy, w.answeredBy) || !reflect.DeepEqual(j.Agent, w.agent) {
+				t.Errorf("answeredBy/agent = %v/%v, want %v/%v", j.AnsweredBy, j.Agent, w.answeredBy, w.agent)
+			}
+			if !reflect.DeepEqual(j.TransferredTo, w.transferred) || !reflect.DeepEqual(j.AgentsTried, w.tried) {
+				t.Errorf("transferredTo/agentsTried = %v/%v, want %v/%v", j.TransferredTo, j.AgentsTried, w.transferred, w.tried)
+			}
+			if j.WaitSeconds != w.wait || j.TalkSeconds != w.talk || j.Duration != w.dur {
+				t.Errorf("wait/talk/duration = %d/%d/%d, want %d/%d/%d",
+					j.WaitSeconds, j.TalkSeconds, j.Duration, w.wait, w.talk, w.dur)
+			}
+			steps := make([]string, len(j.Legs))
+			for i, l := range j.Legs {
+				steps[i] = l.Step
+			}
+			if !reflect.DeepEqual(steps, w.steps) {
+				t.Errorf("steps = %v, want %v", steps, w.steps)
+			}
+			if !reflect.DeepEqual(j.Cost, w.cost) || !reflect.DeepEqual(j.ResultCode, w.resultCode) {
+				t.Errorf("cost/resultCode = %v/%v, want %v/%v", j.Cost, j.ResultCode, w.cost, w.resultCode)
+			}
+		})
+	}
+}
+
+func TestBuildJourneyLegOffsets(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	legs := []CallJourneyLeg{
+		{StartedAt: t0, duration: 10, Billsec: 10, Disposition: "ANSWERED", LastApp: "Read"},
+		{StartedAt: t0.Add(10 * time.Second), duration: 30, Billsec: 0, Disposition: "NO ANSWER", LastApp: "Queue"},
+	}
+	loc, err := time.LoadLocation("Asia/Dushanbe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := buildJourney("x", legs).in(loc)
+	if j.Legs[0].Offset != 0 || j.Legs[1].Offset != 10 {
+		t.Errorf("offsets = %d, %d", j.Legs[0].Offset, j.Legs[1].Offset)
+	}
+	if j.StartedAt.Location() != loc || j.Legs[1].StartedAt.Location() != loc || !j.EndedAt.Equal(t0.Add(40*time.Second)) {
+		t.Errorf("times = %s %s %s", j.StartedAt, j.Legs[1].StartedAt, j.EndedAt)
+	}
+}
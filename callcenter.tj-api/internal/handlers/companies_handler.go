@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"callcentrix/internal/auth"
 
@@ -35,13 +36,16 @@ type Company struct {
 	TariffName             *string `json:"tariffName"`
 	TariffMaxOps           *int    `json:"tariffMaxOperators"`
 	TariffFee              *float64 `json:"tariffFee"`
+	TimeZone               string  `json:"timeZone"` // пояс отчётов компании
 }
 
 type Tariff struct {
-	ID           int     `json:"id"`
-	Name         string  `json:"name"`
-	MaxOperators int     `json:"maxOperators"`
-	MonthlyFee   float64 `json:"monthlyFee"`
+	ID                  int     `json:"id"`
+	Name                string  `json:"name"`
+	MaxOperators        int     `json:"maxOperators"`
+	MonthlyFee          float64 `json:"monthlyFee"`
+	ExtraOperatorFee    float64 `json:"extraOperatorFee"`    // за оператора сверх maxOperators в месяц
+	OutboundMinutePrice float64 `json:"outboundMinutePrice"` // за начатую минуту исходящего
 }
 
 type UnassignedUser struct {
@@ -88,7 +92,8 @@ func (h *CompaniesHandler) GetCompanies(w http.ResponseWriter, r *http.Request)
 			t.representatives_contact, t.website, t.company_contact,
 			t.location, t.max_users, t.status,
 			COUNT(u.id) as user_count,
-			t.tariff_id, tr.name, tr.max_operators, tr.monthly_fee
+			t.tariff_id, tr.name, tr.max_operators, tr.monthly_fee,
+			t.timezone
 		FROM crm_tenants t
 		LEFT JOIN users u ON u.tenant_id = t.tenant_id AND u.status = 'enable'
 		LEFT JOIN crm_tarrifs tr ON tr.id = t.tariff_id
@@ -96,7 +101,8 @@ func (h *CompaniesHandler) GetCompanies(w http.ResponseWriter, r *http.Request)
 			t.business_profile, t.representatives, t.tax_id,
 			t.representatives_contact, t.website, t.company_contact,
 			t.location, t.max_users, t.status,
-			t.tariff_id, tr.name, tr.max_operators, tr.monthly_fee
+			t.tariff_id, tr.name, tr.max_operators, tr.monthly_fee,
+			t.timezone
 		ORDER BY t.name
 	`)
 	if err != nil {
@@ -116,6 +122,7 @@ func (h *CompaniesHandler) GetCompanies(w http.ResponseWriter, r *http.Request)
 			&c.Location, &c.MaxUsers, &c.Status,
 			&c.UserCount,
 			&c.TariffID, &c.TariffName, &c.TariffMaxOps, &c.TariffFee,
+			&c.TimeZone,
 		); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -710,6 +717,7 @@ func (h *CompaniesHandler) UpdateCompany(w http.ResponseWriter, r *http.Request)
 		Location               *string `json:"location"`
 		MaxUsers               int     `json:"maxUsers"`
 		TariffID               *int    `json:"tariffId"`
+		TimeZone               *string `json:"timeZone"` // nil — не менять
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request", http.StatusBadRequest)
@@ -719,6 +727,15 @@ func (h *CompaniesHandler) UpdateCompany(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "name is required", http.StatusBadRequest)
 		return
 	}
+	var loc *time.Location
+	if req.TimeZone != nil {
+		if loc, err = loadTimeZone(*req.TimeZone); err != nil {
+			http.Error(w, "invalid timeZone", http.StatusBadRequest)
+			return
+		}
+		tz := loc.String()
+		req.TimeZone = &tz
+	}
 
 	// Получаем id компании
 	var companyID int
@@ -732,20 +749,24 @@ func (h *CompaniesHandler) UpdateCompany(w http.ResponseWriter, r *http.Request)
 		UPDATE crm_tenants SET
 			name = $1, business_profile = $2, representatives = $3, tax_id = $4,
 			representatives_contact = $5, website = $6, company_contact = $7,
-			location = $8, max_users = $9, tariff_id = $10
+			location = $8, max_users = $9, tariff_id = $10,
+			timezone = COALESCE($12, timezone)
 		WHERE tenant_id = $11
 	`, req.Name, req.BusinessProfile, req.Representatives, req.TaxID,
 		req.RepresentativesContact, req.Website, req.CompanyContact,
-		req.Location, req.MaxUsers, req.TariffID, tenantID)
+		req.Location, req.MaxUsers, req.TariffID, tenantID, req.TimeZone)
 	if err != nil {
 		log.Printf("❌ UpdateCompany: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if loc != nil {
+		tenantZones.set(tenantID, loc)
+	}
 
 	// Логируем
 	changes, _ := json.Marshal(map[string]interface{}{
-		"name": req.Name, "tariff_id": req.TariffID, "max_users": req.MaxUsers,
+		"name": req.Name, "tariff_id": req.TariffID, "max_users": req.MaxUsers, "timezone": req.TimeZone,
 	})
 	h.DB.Exec(r.Context(), `
 		INSERT INTO crm_log_company (company_id, tenant_id, action, changed_by, changes, created_at)
@@ -823,7 +844,8 @@ func (h *CompaniesHandler) GetTariffs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := h.DB.Query(r.Context(), `
-		SELECT id, name, max_operators, monthly_fee FROM crm_tarrifs ORDER BY monthly_fee
+		SELECT id, name, max_operators, monthly_fee, extra_operator_fee, outbound_minute_price
+		FROM crm_tarrifs ORDER BY monthly_fee
 	`)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -834,7 +856,7 @@ func (h *CompaniesHandler) GetTariffs(w http.ResponseWriter, r *http.Request) {
 	list := make([]Tariff, 0)
 	for rows.Next() {
 		var t Tariff
-		if err := rows.Scan(&t.ID, &t.Name, &t.MaxOperators, &t.MonthlyFee); err != nil {
+		if err := rows.Scan(&t.ID, &t.Name, &t.MaxOperators, &t.MonthlyFee, &t.ExtraOperatorFee, &t.OutboundMinutePrice); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -843,4 +865,52 @@ func (h *CompaniesHandler) GetTariffs(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(list)
-}
\ No newline at end of file
+}
+
+// =========================
+// UPDATE TARIFF
+// =========================
+func (h *CompaniesHandler) UpdateTariff(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 0 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var t Tariff
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if t.Name == "" || t.MaxOperators < 0 || t.MonthlyFee < 0 || t.ExtraOperatorFee < 0 || t.OutboundMinutePrice < 0 {
+		http.Error(w, "invalid tariff", http.StatusBadRequest)
+		return
+	}
+
+	// Цены меняют только будущие счета: сформированные хранят суммы позиций
+	tag, err := h.DB.Exec(r.Context(), `
+		UPDATE crm_tarrifs SET
+			name = $1, max_operators = $2, monthly_fee = $3,
+			extra_operator_fee = $4, outbound_minute_price = $5
+		WHERE id = $6
+	`, t.Name, t.MaxOperators, t.MonthlyFee, t.ExtraOperatorFee, t.OutboundMinutePrice, id)
+	if err != nil {
+		log.Printf("❌ UpdateTariff: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "tariff not found", http.StatusNotFound)
+		return
+	}
+	t.ID = id
+
+	log.Printf("✅ Tariff %d updated by user %d", id, user.UserID)
+	jsonResp(w, t)
+}
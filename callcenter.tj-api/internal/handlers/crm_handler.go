@@ -167,14 +167,16 @@ func (h *CRMHandler) GetTickets(w http.ResponseWriter, r *http.Request) {
 		args = append(args, "%"+search+"%", search)
 		idx += 2
 	}
-	if dateFrom != "" {
+	// Даты (2006-01-02) — дни в поясе компании, а не сервера БД
+	loc := tenantLocation(r.Context(), h.DB, user.TenantID)
+	if t, ok := parseReportTime(dateFrom, loc, false); ok {
 		where += " AND t.created_at >= $" + strconv.Itoa(idx)
-		args = append(args, dateFrom)
+		args = append(args, t)
 		idx++
 	}
-	if dateTo != "" {
-		where += " AND t.created_at < ($" + strconv.Itoa(idx) + "::date + interval '1 day')"
-		args = append(args, dateTo)
+	if t, ok := parseReportTime(dateTo, loc, true); ok {
+		where += " AND t.created_at <= $" + strconv.Itoa(idx)
+		args = append(args, t)
 		idx++
 	}
 	if assignedTo != "" {
@@ -231,15 +233,20 @@ func (h *CRMHandler) GetTickets(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		t.CreatedAt = t.CreatedAt.In(loc)
+		t.UpdatedAt = t.UpdatedAt.In(loc)
 		tickets = append(tickets, t)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	zone := reportZone(loc)
 	json.NewEncoder(w).Encode(map[string]any{
-		"tickets": tickets,
-		"total":   total,
-		"limit":   limit,
-		"offset":  offset,
+		"tickets":   tickets,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+		"timeZone":  zone.TimeZone,
+		"utcOffset": zone.UTCOffset,
 	})
 }
 
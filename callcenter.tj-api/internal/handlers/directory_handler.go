@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"callcentrix/internal/auth"
+	"callcentrix/internal/monitor"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DirectoryHandler — справочник компании: все extension тенанта с presence (BLF)
+type DirectoryHandler struct {
+	DB         *pgxpool.Pool
+	Presence   *monitor.PresenceStore
+	PublicBase string
+}
+
+// DirectoryEntry — extension из ast_ps_endpoints + сотрудник (users/user_profiles) + presence
+type DirectoryEntry struct {
+	Extension string  `json:"extension"`
+	UserID    *int    `json:"userId"` // nil — extension без сотрудника (переговорная, факс...)
+	FirstName string  `json:"firstName"`
+	LastName  string  `json:"lastName"`
+	Position  *string `json:"position"`
+	Email     *string `json:"email"`
+	Phone     *string `json:"phone"`
+	AvatarURL *string `json:"avatarUrl"`
+
+	Presence    string     `json:"presence"` // available / busy / ringing / offline / dnd
+	DeviceState string     `json:"deviceState,omitempty"`
+	UpdatedAt   *time.Time `json:"presenceUpdatedAt,omitempty"`
+}
+
+// GetDirectory godoc
+// @Summary      Справочник компании с presence
+// @Description  Все extension тенанта (в т.ч. не агенты очередей). Изменения presence приходят в /ws/monitor сообщениями type=presence
+// @Tags         Directory
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  DirectoryEntry
+// @Router       /api/directory [get]
+func (h *DirectoryHandler) GetDirectory(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT
+			e.id, u.id,
+			COALESCE(u.first_name, ''), COALESCE(u.last_name, ''),
+			p.position, p.email, p.phone, p.avatar_url
+		FROM ast_ps_endpoints e
+		LEFT JOIN users u ON u.sipno::text = e.id AND u.tenant_id = e.tenant_id
+		LEFT JOIN user_profiles p ON p.user_id = u.id
+		WHERE e.tenant_id = $1
+		ORDER BY e.id`,
+		user.TenantID,
+	)
+	if err != nil {
+		log.Printf("❌ GetDirectory: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	presence := h.Presence.Get(user.TenantID)
+
+	list := make([]DirectoryEntry, 0)
+	for rows.Next() {
+		var e DirectoryEntry
+		if err := rows.Scan(
+			&e.Extension, &e.UserID, &e.FirstName, &e.LastName,
+			&e.Position, &e.Email, &e.Phone, &e.AvatarURL,
+		); err != nil {
+			log.Printf("❌ GetDirectory scan error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if e.AvatarURL != nil && *e.AvatarURL != "" && !strings.HasPrefix(*e.AvatarURL, "http") {
+			full := h.PublicBase + "/" + strings.TrimPrefix(*e.AvatarURL, "/")
+			e.AvatarURL = &full
+		}
+
+		e.Presence = "offline"
+		if p, ok := presence[e.Extension]; ok {
+			e.Presence = p.Status
+			e.DeviceState = p.DeviceState
+			updated := p.UpdatedAt
+			e.UpdatedAt = &updated
+		}
+		list = append(list, e)
+	}
+
+	jsonResp(w, list)
+}
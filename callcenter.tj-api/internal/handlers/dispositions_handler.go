@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"callcentrix/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DispositionsHandler — каталог кодов результата звонка, настройки wrap-up и отчёт
+type DispositionsHandler struct {
+	DB *pgxpool.Pool
+}
+
+// maxWrapupSeconds — предел wrap-up: дольше агент фактически выпадает из очереди
+const maxWrapupSeconds = 3600
+
+// =========================
+// MODELS
+// =========================
+
+type DispositionRequest struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	Color     *string `json:"color"`
+	SortOrder int     `json:"sortOrder"`
+	Active    *bool   `json:"active"`
+}
+
+type DispositionResponse struct {
+	ID        int       `json:"id"`
+	TenantID  int       `json:"tenantId"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Color     *string   `json:"color"`
+	SortOrder int       `json:"sortOrder"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type WrapupSetting struct {
+	Queue         string `json:"queue"`
+	WrapupSeconds int    `json:"wrapupSeconds"`
+}
+
+type DispositionReportRow struct {
+	DispositionID int     `json:"dispositionId"`
+	Code          string  `json:"code"`
+	Name          string  `json:"name"`
+	Color         *string `json:"color"`
+	Agent         *string `json:"agent"` // nil — итог по коду
+	AgentName     *string `json:"agentName"`
+	Count         int     `json:"count"`
+}
+
+// ============================================================
+// CATALOG
+// ============================================================
+
+// GetDispositions godoc
+// @Summary      Список кодов результата звонка
+// @Tags         Dispositions
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  DispositionResponse
+// @Router       /api/dispositions [get]
+func (h *DispositionsHandler) GetDispositions(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT id, tenant_id, code, name, color, sort_order, active, created_at
+		 FROM crm_dispositions WHERE tenant_id=$1 ORDER BY sort_order, name`,
+		user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]DispositionResponse, 0)
+	for rows.Next() {
+		var d DispositionResponse
+		rows.Scan(&d.ID, &d.TenantID, &d.Code, &d.Name, &d.Color, &d.SortOrder, &d.Active, &d.CreatedAt)
+		result = append(result, d)
+	}
+	jsonResp(w, result)
+}
+
+// CreateDisposition godoc
+// @Summary      Создать код результата
+// @Tags         Dispositions
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  DispositionRequest  true  "Код результата"
+// @Success      201  {object}  DispositionResponse
+// @Failure      409  {string}  string  "disposition with this code already exists"
+// @Router       /api/dispositions [post]
+func (h *DispositionsHandler) CreateDisposition(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	var req DispositionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.Name == "" {
+		http.Error(w, "code and name are required", http.StatusBadRequest)
+		return
+	}
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+	var d DispositionResponse
+	err := h.DB.QueryRow(r.Context(),
+		`INSERT INTO crm_dispositions (tenant_id, code, name, color, sort_order, active)
+		 VALUES ($1,$2,$3,$4,$5,$6)
+		 RETURNING id, tenant_id, code, name, color, sort_order, active, created_at`,
+		user.TenantID, req.Code, req.Name, req.Color, req.SortOrder, active).
+		Scan(&d.ID, &d.TenantID, &d.Code, &d.Name, &d.Color, &d.SortOrder, &d.Active, &d.CreatedAt)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "disposition with this code already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("✅ Disposition created: id=%d tenant=%d code=%s", d.ID, d.TenantID, d.Code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(d)
+}
+
+// UpdateDisposition godoc
+// @Summary      Обновить код результата
+// @Tags         Dispositions
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                 true  "ID"
+// @Param        body  body  DispositionRequest  true  "Код результата"
+// @Success      200  {object}  DispositionResponse
+// @Router       /api/dispositions/{id} [put]
+func (h *DispositionsHandler) UpdateDisposition(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req DispositionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.Name == "" {
+		http.Error(w, "code and name are required", http.StatusBadRequest)
+		return
+	}
+	var d DispositionResponse
+	err = h.DB.QueryRow(r.Context(),
+		`UPDATE crm_dispositions SET code=$1, name=$2, color=$3, sort_order=$4, active=COALESCE($5, active)
+		 WHERE id=$6 AND tenant_id=$7
+		 RETURNING id, tenant_id, code, name, color, sort_order, active, created_at`,
+		req.Code, req.Name, req.Color, req.SortOrder, req.Active, id, user.TenantID).
+		Scan(&d.ID, &d.TenantID, &d.Code, &d.Name, &d.Color, &d.SortOrder, &d.Active, &d.CreatedAt)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "disposition with this code already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	jsonResp(w, d)
+}
+
+// DeleteDisposition godoc
+// @Summary      Удалить код результата
+// @Description  Использованный код удалить нельзя — только деактивировать
+// @Tags         Dispositions
+// @Security     BearerAuth
+// @Param        id  path  int  true  "ID"
+// @Success      204  "No Content"
+// @Failure      409  {string}  string  "disposition is in use"
+// @Router       /api/dispositions/{id} [delete]
+func (h *DispositionsHandler) DeleteDisposition(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var inUse bool
+	h.DB.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM call_dispositions WHERE disposition_id=$1)`, id).Scan(&inUse)
+	if inUse {
+		http.Error(w, "disposition is in use", http.StatusConflict)
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM crm_dispositions WHERE id=$1 AND tenant_id=$2`, id, user.TenantID)
+	if err != nil || tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ============================================================
+// WRAP-UP SETTINGS
+// ============================================================
+
+// GetWrapupSettings godoc
+// @Summary      Длительность wrap-up по очередям тенанта
+// @Tags         Dispositions
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  WrapupSetting
+// @Router       /api/queues/wrapup [get]
+func (h *DispositionsHandler) GetWrapupSettings(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT q.name, COALESCE(s.wrapup_seconds, 0)
+		FROM ast_queues q
+		LEFT JOIN queue_wrapup_settings s ON s.tenant_id = q.tenant_id AND s.queue = q.name
+		WHERE q.tenant_id = $1
+		ORDER BY q.name`,
+		user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]WrapupSetting, 0)
+	for rows.Next() {
+		var s WrapupSetting
+		rows.Scan(&s.Queue, &s.WrapupSeconds)
+		result = append(result, s)
+	}
+	jsonResp(w, result)
+}
+
+// SetWrapupSetting godoc
+// @Summary      Задать длительность wrap-up для очереди (0 = выключить, не больше 3600 с)
+// @Tags         Dispositions
+// @Security     BearerAuth
+// @Accept       json
+// @Param        queue  path  string         true  "Имя очереди"
+// @Param        body   body  WrapupSetting  true  "wrapupSeconds"
+// @Success      204  "No Content"
+// @Failure      400  {string}  string  "wrapupSeconds must be 0..3600"
+// @Router       /api/queues/{queue}/wrapup [put]
+func (h *DispositionsHandler) SetWrapupSetting(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	queue := chi.URLParam(r, "queue")
+
+	var req WrapupSetting
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.WrapupSeconds < 0 || req.WrapupSeconds > maxWrapupSeconds {
+		http.Error(w, "wrapupSeconds must be 0.."+strconv.Itoa(maxWrapupSeconds), http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	h.DB.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM ast_queues WHERE name=$1 AND tenant_id=$2)`,
+		queue, user.TenantID,
+	).Scan(&exists)
+	if !exists {
+		http.Error(w, "queue not found", http.StatusNotFound)
+		return
+	}
+
+	_, err := h.DB.Exec(r.Context(), `
+		INSERT INTO queue_wrapup_settings (tenant_id, queue, wrapup_seconds, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (tenant_id, queue) DO UPDATE SET
+			wrapup_seconds = EXCLUDED.wrapup_seconds,
+			updated_at     = NOW()`,
+		user.TenantID, queue, req.WrapupSeconds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ============================================================
+// REPORT
+// ============================================================
+
+// GetDispositionReport godoc
+// @Summary      Отчёт по результатам звонков
+// @Description  Количество звонков по кодам результата, итог и разбивка по агентам. dateFrom/dateTo — RFC3339 или дата в поясе компании (dateTo включительно)
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  DispositionReportRow
+// @Router       /api/reports/dispositions [get]
+func (h *DispositionsHandler) GetDispositionReport(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	q := r.URL.Query()
+
+	where := "WHERE cd.tenant_id = $1"
+	args := []any{user.TenantID}
+	idx := 2
+	loc := tenantLocation(r.Context(), h.DB, user.TenantID)
+	if t, ok := parseReportTime(q.Get("dateFrom"), loc, false); ok {
+		where += " AND cd.created_at >= $" + strconv.Itoa(idx)
+		args = append(args, t)
+		idx++
+	}
+	if t, ok := parseReportTime(q.Get("dateTo"), loc, true); ok {
+		where += " AND cd.created_at <= $" + strconv.Itoa(idx)
+		args = append(args, t)
+		idx++
+	}
+	if v := q.Get("queue"); v != "" {
+		where += " AND cd.queue = $" + strconv.Itoa(idx)
+		args = append(args, v)
+		idx++
+	}
+
+	// GROUPING SETS: строка на код (agent IS NULL) + строки код × агент
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT d.id, d.code, d.name, d.color, cd.agent,
+			MAX(COALESCE(NULLIF(TRIM(COALESCE(u.first_name,'') || ' ' || COALESCE(u.last_name,'')), ''), u.username)),
+			COUNT(*)
+		FROM call_dispositions cd
+		JOIN crm_dispositions d ON d.id = cd.disposition_id
+		LEFT JOIN users u       ON u.id = cd.user_id
+		`+where+`
+		GROUP BY GROUPING SETS ((d.id, d.code, d.name, d.color), (d.id, d.code, d.name, d.color, cd.agent))
+		ORDER BY d.code, cd.agent NULLS FIRST`,
+		args...)
+	if err != nil {
+		log.Printf("❌ GetDispositionReport: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	result := make([]DispositionReportRow, 0)
+	for rows.Next() {
+		var row DispositionReportRow
+		if err := rows.Scan(&row.DispositionID, &row.Code, &row.Name, &row.Color,
+			&row.Agent, &row.AgentName, &row.Count); err != nil {
+			log.Printf("❌ GetDispositionReport scan: %v", err)
+			continue
+		}
+		if row.Agent == nil {
+			row.AgentName = nil
+		}
+		result = append(result, row)
+	}
+	jsonResp(w, result)
+}
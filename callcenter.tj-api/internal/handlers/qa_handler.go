@@ -0,0 +1,1042 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"callcentrix/internal/auth"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// QAHandler — оценка качества звонков: шаблоны анкет, оценки супервизоров,
+// ознакомление агента и отчёты. Шаблоны и оценки ведёт admin тенанта,
+// агент видит и подтверждает только свои оценки.
+type QAHandler struct {
+	DB *pgxpool.Pool
+}
+
+// Статусы оценки
+const (
+	qaPending      = "pending"      // ждёт ознакомления агента
+	qaAcknowledged = "acknowledged" // агент ознакомился
+	qaDisputed     = "disputed"     // агент не согласен (см. agentComment)
+)
+
+// =========================
+// MODELS
+// =========================
+
+type QAQuestion struct {
+	ID       int     `json:"id"`
+	Text     string  `json:"text"`
+	Hint     *string `json:"hint"`
+	Weight   float64 `json:"weight"`
+	MaxScore int     `json:"maxScore"`
+	AutoFail bool    `json:"autoFail"` // 0 баллов по вопросу — оценка 0 целиком
+	AllowNA  bool    `json:"allowNa"`  // можно ответить «неприменимо»
+}
+
+type QASection struct {
+	ID        int          `json:"id"`
+	Name      string       `json:"name"`
+	Questions []QAQuestion `json:"questions"`
+}
+
+type QATemplateRequest struct {
+	Name        string      `json:"name"`
+	Description *string     `json:"description"`
+	PassScore   *float64    `json:"passScore"` // по умолчанию 80
+	Active      *bool       `json:"active"`
+	Sections    []QASection `json:"sections"` // при обновлении nil — структура не меняется
+}
+
+type QATemplateResponse struct {
+	ID          int         `json:"id"`
+	Name        string      `json:"name"`
+	Description *string     `json:"description"`
+	PassScore   float64     `json:"passScore"`
+	Active      bool        `json:"active"`
+	InUse       bool        `json:"inUse"` // есть оценки — структуру менять нельзя
+	CreatedAt   time.Time   `json:"createdAt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+	Sections    []QASection `json:"sections,omitempty"`
+}
+
+type QAAnswer struct {
+	QuestionID int     `json:"questionId"`
+	Score      *int    `json:"score"` // nil — «неприменимо»
+	Comment    *string `json:"comment"`
+}
+
+type QAEvaluationRequest struct {
+	TemplateID int        `json:"templateId"`
+	UniqueID   string     `json:"uniqueid"`
+	AgentID    *int       `json:"agentId"` // nil — агент из результата звонка (wrap-up)
+	Comment    *string    `json:"comment"`
+	Answers    []QAAnswer `json:"answers"`
+}
+
+type QAAcknowledgeRequest struct {
+	Comment *string `json:"comment"`
+	Dispute bool    `json:"dispute"`
+}
+
+type QAAnswerDetail struct {
+	QAAnswer
+	Section  string `json:"section"`
+	Question string `json:"question"`
+	MaxScore int    `json:"maxScore"`
+	AutoFail bool   `json:"autoFail"`
+}
+
+type QAEvaluationResponse struct {
+	ID             int64            `json:"id"`
+	TemplateID     int              `json:"templateId"`
+	TemplateName   string           `json:"templateName"`
+	UniqueID       string           `json:"uniqueid"`
+	RecordingURL   string           `json:"recordingUrl"`
+	CallDate       *time.Time       `json:"callDate"`
+	AgentID        int              `json:"agentId"`
+	AgentName      *string          `json:"agentName"`
+	EvaluatorID    int              `json:"evaluatorId"`
+	EvaluatorName  *string          `json:"evaluatorName"`
+	Score          float64          `json:"score"` // проценты
+	AutoFailed     bool             `json:"autoFailed"`
+	Passed         bool             `json:"passed"`
+	Comment        *string          `json:"comment"`
+	Status         string           `json:"status"` // pending / acknowledged / disputed
+	AgentComment   *string          `json:"agentComment"`
+	AcknowledgedAt *time.Time       `json:"acknowledgedAt"`
+	CreatedAt      time.Time        `json:"createdAt"`
+	UpdatedAt      time.Time        `json:"updatedAt"`
+	Answers        []QAAnswerDetail `json:"answers,omitempty"`
+}
+
+const qaTemplateColumns = `t.id, t.name, t.description, t.pass_score, t.active,
+	EXISTS (SELECT 1 FROM qa_evaluations e WHERE e.template_id = t.id), t.created_at, t.updated_at`
+
+func scanQATemplate(row interface{ Scan(...any) error }, t *QATemplateResponse) error {
+	return row.Scan(&t.ID, &t.Name, &t.Description, &t.PassScore, &t.Active, &t.InUse, &t.CreatedAt, &t.UpdatedAt)
+}
+
+const qaEvaluationColumns = `e.id, e.template_id, t.name, e.uniqueid, e.call_date,
+	e.agent_id, ` + qaAgentNameSQL + `, e.evaluator_id, ` + qaEvaluatorNameSQL + `,
+	e.score, e.auto_failed, e.passed, e.comment, e.status, e.agent_comment, e.acknowledged_at,
+	e.created_at, e.updated_at`
+
+const qaEvaluationFrom = `FROM qa_evaluations e
+	JOIN qa_templates t ON t.id = e.template_id
+	LEFT JOIN users a   ON a.id = e.agent_id
+	LEFT JOIN users ev  ON ev.id = e.evaluator_id`
+
+const (
+	qaAgentNameSQL     = `COALESCE(NULLIF(TRIM(COALESCE(a.first_name,'') || ' ' || COALESCE(a.last_name,'')), ''), a.username)`
+	qaEvaluatorNameSQL = `COALESCE(NULLIF(TRIM(COALESCE(ev.first_name,'') || ' ' || COALESCE(ev.last_name,'')), ''), ev.username)`
+)
+
+func scanQAEvaluation(row interface{ Scan(...any) error }, e *QAEvaluationResponse) error {
+	err := row.Scan(&e.ID, &e.TemplateID, &e.TemplateName, &e.UniqueID, &e.CallDate,
+		&e.AgentID, &e.AgentName, &e.EvaluatorID, &e.EvaluatorName,
+		&e.Score, &e.AutoFailed, &e.Passed, &e.Comment, &e.Status, &e.AgentComment, &e.AcknowledgedAt,
+		&e.CreatedAt, &e.UpdatedAt)
+	e.RecordingURL = recordingPath(e.UniqueID)
+	return err
+}
+
+// recordingPath — воспроизведение записи (RecordingHandler.Stream, с Bearer-токеном)
+func recordingPath(uniqueid string) string {
+	return "/api/recordings/" + url.PathEscape(uniqueid)
+}
+
+// ============================================================
+// TEMPLATES
+// ============================================================
+
+// GetQATemplates godoc
+// @Summary      Шаблоны анкет оценки качества
+// @Tags         QA
+// @Security     BearerAuth
+// @Produce      json
+// @Param        active  query  bool  false  "true — только активные"
+// @Success      200  {array}  QATemplateResponse
+// @Router       /api/qa/templates [get]
+func (h *QAHandler) GetQATemplates(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	where := `WHERE t.tenant_id = $1`
+	if r.URL.Query().Get("active") == "true" {
+		where += ` AND t.active`
+	}
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+qaTemplateColumns+` FROM qa_templates t `+where+` ORDER BY t.active DESC, t.name`,
+		user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]QATemplateResponse, 0)
+	for rows.Next() {
+		var t QATemplateResponse
+		if err := scanQATemplate(rows, &t); err != nil {
+			log.Printf("❌ QA templates scan: %v", err)
+			continue
+		}
+		result = append(result, t)
+	}
+	jsonResp(w, result)
+}
+
+// GetQATemplate godoc
+// @Summary      Шаблон анкеты с разделами и вопросами
+// @Tags         QA
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID"
+// @Success      200  {object}  QATemplateResponse
+// @Router       /api/qa/templates/{id} [get]
+func (h *QAHandler) GetQATemplate(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	t, err := h.loadTemplate(r.Context(), id, user.TenantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, t)
+}
+
+// CreateQATemplate godoc
+// @Summary      Создать шаблон анкеты (только admin)
+// @Description  Разделы с вопросами: weight — вес вопроса, maxScore — максимальный балл, autoFail — критичный пункт (0 баллов обнуляет оценку)
+// @Tags         QA
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  QATemplateRequest  true  "Шаблон"
+// @Success      201  {object}  QATemplateResponse
+// @Failure      409  {string}  string  "template with this name already exists"
+// @Router       /api/qa/templates [post]
+func (h *QAHandler) CreateQATemplate(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	req, err := decodeQATemplate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Sections) == 0 {
+		http.Error(w, "at least one section with questions is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	active := req.Active == nil || *req.Active
+	var id int
+	err = tx.QueryRow(r.Context(), `
+		INSERT INTO qa_templates (tenant_id, name, description, pass_score, active, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		user.TenantID, req.Name, req.Description, *req.PassScore, active, user.UserID,
+	).Scan(&id)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "template with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := insertQASections(r.Context(), tx, id, req.Sections); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := h.loadTemplate(r.Context(), id, user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("✅ QA template created: id=%d tenant=%d name=%s", id, user.TenantID, req.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// UpdateQATemplate godoc
+// @Summary      Обновить шаблон анкеты (только admin)
+// @Description  sections заменяет структуру целиком — только пока по шаблону нет оценок. Иначе меняются name/description/passScore/active; для новой структуры — деактивировать и создать новый шаблон.
+// @Tags         QA
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                true  "ID"
+// @Param        body  body  QATemplateRequest  true  "Шаблон"
+// @Success      200  {object}  QATemplateResponse
+// @Failure      409  {string}  string  "template is in use"
+// @Router       /api/qa/templates/{id} [put]
+func (h *QAHandler) UpdateQATemplate(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	req, err := decodeQATemplate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var inUse bool
+	err = tx.QueryRow(r.Context(), `
+		UPDATE qa_templates t SET name=$1, description=$2, pass_score=$3, active=COALESCE($4, active), updated_at=NOW()
+		WHERE id=$5 AND tenant_id=$6
+		RETURNING EXISTS (SELECT 1 FROM qa_evaluations e WHERE e.template_id = t.id)`,
+		req.Name, req.Description, *req.PassScore, req.Active, id, user.TenantID,
+	).Scan(&inUse)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "template with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Sections != nil {
+		if inUse {
+			http.Error(w, "template is in use", http.StatusConflict)
+			return
+		}
+		if len(req.Sections) == 0 {
+			http.Error(w, "at least one section with questions is required", http.StatusBadRequest)
+			return
+		}
+		// Вопросы удаляются каскадом вместе с разделами
+		if _, err := tx.Exec(r.Context(), `DELETE FROM qa_sections WHERE template_id=$1`, id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := insertQASections(r.Context(), tx, id, req.Sections); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := h.loadTemplate(r.Context(), id, user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, t)
+}
+
+// DeleteQATemplate godoc
+// @Summary      Удалить шаблон анкеты (только admin)
+// @Description  Шаблон с оценками удалить нельзя — только деактивировать
+// @Tags         QA
+// @Security     BearerAuth
+// @Param        id  path  int  true  "ID"
+// @Success      204  "No Content"
+// @Failure      409  {string}  string  "template is in use"
+// @Router       /api/qa/templates/{id} [delete]
+func (h *QAHandler) DeleteQATemplate(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var inUse bool
+	h.DB.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM qa_evaluations WHERE template_id=$1)`, id).Scan(&inUse)
+	if inUse {
+		http.Error(w, "template is in use", http.StatusConflict)
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM qa_templates WHERE id=$1 AND tenant_id=$2`, id, user.TenantID)
+	if err != nil || tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ============================================================
+// EVALUATIONS
+// ============================================================
+
+// GetQAEvaluations godoc
+// @Summary      Оценки звонков
+// @Description  admin видит все оценки тенанта, остальные — только свои
+// @Tags         QA
+// @Security     BearerAuth
+// @Produce      json
+// @Param        agentId     query  int     false  "Агент (users.id)"
+// @Param        templateId  query  int     false  "Шаблон"
+// @Param        uniqueid    query  string  false  "uniqueid звонка"
+// @Param        status      query  string  false  "pending / acknowledged / disputed"
+// @Param        dateFrom    query  string  false  "RFC3339 или дата в поясе компании, по дате звонка"
+// @Param        dateTo      query  string  false  "RFC3339 или дата в поясе компании, по дате звонка"
+// @Param        limit       query  int     false  "по умолчанию 200, максимум 1000"
+// @Success      200  {array}  QAEvaluationResponse
+// @Router       /api/qa/evaluations [get]
+func (h *QAHandler) GetQAEvaluations(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	q := r.URL.Query()
+
+	where, args := qaFilter(q, user.TenantID, tenantLocation(r.Context(), h.DB, user.TenantID))
+	idx := len(args) + 1
+	if user.UserType != 1 {
+		where += " AND e.agent_id = $" + strconv.Itoa(idx)
+		args = append(args, user.UserID)
+		idx++
+	}
+	if v := q.Get("uniqueid"); v != "" {
+		where += " AND e.uniqueid = $" + strconv.Itoa(idx)
+		args = append(args, v)
+		idx++
+	}
+	if v := q.Get("status"); v != "" {
+		where += " AND e.status = $" + strconv.Itoa(idx)
+		args = append(args, v)
+		idx++
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 1000 {
+		limit = 200
+	}
+
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+qaEvaluationColumns+` `+qaEvaluationFrom+` `+where+`
+		 ORDER BY e.created_at DESC, e.id DESC
+		 LIMIT $`+strconv.Itoa(idx),
+		append(args, limit)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]QAEvaluationResponse, 0)
+	for rows.Next() {
+		var e QAEvaluationResponse
+		if err := scanQAEvaluation(rows, &e); err != nil {
+			log.Printf("❌ QA evaluations scan: %v", err)
+			continue
+		}
+		result = append(result, e)
+	}
+	jsonResp(w, result)
+}
+
+// GetQAEvaluation godoc
+// @Summary      Оценка звонка с ответами
+// @Tags         QA
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID"
+// @Success      200  {object}  QAEvaluationResponse
+// @Router       /api/qa/evaluations/{id} [get]
+func (h *QAHandler) GetQAEvaluation(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	e, err := h.loadEvaluation(r.Context(), int64(id), user.TenantID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && user.UserType != 1 && e.AgentID != user.UserID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, e)
+}
+
+// CreateQAEvaluation godoc
+// @Summary      Оценить звонок (только admin)
+// @Description  Ответ нужен на каждый вопрос шаблона: score 0..maxScore или null («неприменимо», если allowNa). Итог — взвешенный процент, 0 при провале критичного пункта.
+// @Tags         QA
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  QAEvaluationRequest  true  "Оценка"
+// @Success      201  {object}  QAEvaluationResponse
+// @Router       /api/qa/evaluations [post]
+func (h *QAHandler) CreateQAEvaluation(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var req QAEvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TemplateID == 0 || req.UniqueID == "" {
+		http.Error(w, "templateId and uniqueid are required", http.StatusBadRequest)
+		return
+	}
+	if !recordingAccess(r.Context(), h.DB, req.UniqueID, user.TenantID) {
+		http.Error(w, "call not found", http.StatusNotFound)
+		return
+	}
+	agentID, err := h.resolveAgent(r.Context(), req.AgentID, req.UniqueID, user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := h.score(r.Context(), req.TemplateID, user.TenantID, req.Answers, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var id int64
+	err = tx.QueryRow(r.Context(), `
+		INSERT INTO qa_evaluations (tenant_id, template_id, uniqueid, agent_id, evaluator_id,
+		                            score, auto_failed, passed, comment, call_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9,
+		        (SELECT MIN(calldate) AT TIME ZONE 'UTC' FROM ast_cdr WHERE uniqueid = $3))
+		RETURNING id`,
+		user.TenantID, req.TemplateID, req.UniqueID, agentID, user.UserID,
+		res.Score, res.AutoFailed, res.Passed, req.Comment,
+	).Scan(&id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := insertQAAnswers(r.Context(), tx, id, req.Answers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e, err := h.loadEvaluation(r.Context(), id, user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("✅ QA evaluation: id=%d call=%s agent=%d score=%.2f by user=%d",
+		id, req.UniqueID, agentID, res.Score, user.UserID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(e)
+}
+
+// UpdateQAEvaluation godoc
+// @Summary      Исправить оценку (только admin)
+// @Description  Заменяет ответы и комментарий; ознакомление агента сбрасывается
+// @Tags         QA
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                  true  "ID"
+// @Param        body  body  QAEvaluationRequest  true  "Оценка (templateId и uniqueid игнорируются)"
+// @Success      200  {object}  QAEvaluationResponse
+// @Router       /api/qa/evaluations/{id} [put]
+func (h *QAHandler) UpdateQAEvaluation(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req QAEvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var templateID int
+	var uniqueid string
+	err = h.DB.QueryRow(r.Context(),
+		`SELECT template_id, uniqueid FROM qa_evaluations WHERE id=$1 AND tenant_id=$2`,
+		id, user.TenantID,
+	).Scan(&templateID, &uniqueid)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	agentID, err := h.resolveAgent(r.Context(), req.AgentID, uniqueid, user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Неактивный шаблон не мешает исправить уже выставленную оценку
+	res, err := h.score(r.Context(), templateID, user.TenantID, req.Answers, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	_, err = tx.Exec(r.Context(), `
+		UPDATE qa_evaluations SET agent_id=$1, evaluator_id=$2, score=$3, auto_failed=$4, passed=$5,
+		       comment=$6, status=$7, agent_comment=NULL, acknowledged_at=NULL, updated_at=NOW()
+		WHERE id=$8`,
+		agentID, user.UserID, res.Score, res.AutoFailed, res.Passed, req.Comment, qaPending, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(r.Context(), `DELETE FROM qa_answers WHERE evaluation_id=$1`, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := insertQAAnswers(r.Context(), tx, int64(id), req.Answers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e, err := h.loadEvaluation(r.Context(), int64(id), user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, e)
+}
+
+// DeleteQAEvaluation godoc
+// @Summary      Удалить оценку (только admin)
+// @Tags         QA
+// @Security     BearerAuth
+// @Param        id  path  int  true  "ID"
+// @Success      204  "No Content"
+// @Router       /api/qa/evaluations/{id} [delete]
+func (h *QAHandler) DeleteQAEvaluation(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM qa_evaluations WHERE id=$1 AND tenant_id=$2`, id, user.TenantID)
+	if err != nil || tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcknowledgeQAEvaluation godoc
+// @Summary      Ознакомиться с оценкой (только оцениваемый агент)
+// @Description  dispute=true — агент не согласен, comment обязателен
+// @Tags         QA
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                   true  "ID"
+// @Param        body  body  QAAcknowledgeRequest  false "Комментарий агента"
+// @Success      200  {object}  QAEvaluationResponse
+// @Failure      409  {string}  string  "evaluation already acknowledged"
+// @Router       /api/qa/evaluations/{id}/acknowledge [post]
+func (h *QAHandler) AcknowledgeQAEvaluation(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req QAAcknowledgeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Dispute && (req.Comment == nil || *req.Comment == "") {
+		http.Error(w, "comment is required to dispute", http.StatusBadRequest)
+		return
+	}
+	status := qaAcknowledged
+	if req.Dispute {
+		status = qaDisputed
+	}
+
+	var current string
+	err = h.DB.QueryRow(r.Context(),
+		`SELECT status FROM qa_evaluations WHERE id=$1 AND tenant_id=$2 AND agent_id=$3`,
+		id, user.TenantID, user.UserID,
+	).Scan(&current)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(), `
+		UPDATE qa_evaluations SET status=$1, agent_comment=$2, acknowledged_at=NOW()
+		WHERE id=$3 AND status=$4`,
+		status, req.Comment, id, qaPending)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "evaluation already acknowledged", http.StatusConflict)
+		return
+	}
+	log.Printf("📝 QA evaluation %d %s by agent=%d", id, status, user.UserID)
+
+	e, err := h.loadEvaluation(r.Context(), int64(id), user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, e)
+}
+
+// =========================
+// HELPERS
+// =========================
+
+func decodeQATemplate(r *http.Request) (QATemplateRequest, error) {
+	var req QATemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		return req, errors.New("name is required")
+	}
+	if req.PassScore == nil {
+		def := 80.0
+		req.PassScore = &def
+	}
+	if *req.PassScore < 0 || *req.PassScore > 100 {
+		return req, errors.New("passScore must be between 0 and 100")
+	}
+	for _, s := range req.Sections {
+		if s.Name == "" || len(s.Questions) == 0 {
+			return req, errors.New("each section needs a name and at least one question")
+		}
+		for _, q := range s.Questions {
+			if q.Text == "" {
+				return req, errors.New("question text is required")
+			}
+			if q.MaxScore < 1 || q.Weight < 0 {
+				return req, fmt.Errorf("question %q: maxScore must be >= 1 and weight >= 0", q.Text)
+			}
+		}
+	}
+	return req, nil
+}
+
+func insertQASections(ctx context.Context, tx pgx.Tx, templateID int, sections []QASection) error {
+	for i, s := range sections {
+		var sectionID int
+		err := tx.QueryRow(ctx,
+			`INSERT INTO qa_sections (template_id, name, sort_order) VALUES ($1, $2, $3) RETURNING id`,
+			templateID, s.Name, i,
+		).Scan(&sectionID)
+		if err != nil {
+			return err
+		}
+		for j, q := range s.Questions {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO qa_questions (template_id, section_id, text, hint, weight, max_score, auto_fail, allow_na, sort_order)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+				templateID, sectionID, q.Text, q.Hint, q.Weight, q.MaxScore, q.AutoFail, q.AllowNA, j)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func insertQAAnswers(ctx context.Context, tx pgx.Tx, evaluationID int64, answers []QAAnswer) error {
+	for _, a := range answers {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO qa_answers (evaluation_id, question_id, score, comment) VALUES ($1, $2, $3, $4)`,
+			evaluationID, a.QuestionID, a.Score, a.Comment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *QAHandler) loadTemplate(ctx context.Context, id, tenantID int) (*QATemplateResponse, error) {
+	var t QATemplateResponse
+	err := scanQATemplate(h.DB.QueryRow(ctx,
+		`SELECT `+qaTemplateColumns+` FROM qa_templates t WHERE t.id=$1 AND t.tenant_id=$2`,
+		id, tenantID), &t)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT s.id, s.name, q.id, q.text, q.hint, q.weight, q.max_score, q.auto_fail, q.allow_na
+		FROM qa_sections s
+		JOIN qa_questions q ON q.section_id = s.id
+		WHERE s.template_id = $1
+		ORDER BY s.sort_order, s.id, q.sort_order, q.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	t.Sections = make([]QASection, 0)
+	for rows.Next() {
+		var sectionID int
+		var sectionName string
+		var q QAQuestion
+		if err := rows.Scan(&sectionID, &sectionName, &q.ID, &q.Text, &q.Hint, &q.Weight,
+			&q.MaxScore, &q.AutoFail, &q.AllowNA); err != nil {
+			return nil, err
+		}
+		if n := len(t.Sections); n == 0 || t.Sections[n-1].ID != sectionID {
+			t.Sections = append(t.Sections, QASection{ID: sectionID, Name: sectionName})
+		}
+		s := &t.Sections[len(t.Sections)-1]
+		s.Questions = append(s.Questions, q)
+	}
+	return &t, rows.Err()
+}
+
+func (h *QAHandler) loadEvaluation(ctx context.Context, id int64, tenantID int) (*QAEvaluationResponse, error) {
+	var e QAEvaluationResponse
+	err := scanQAEvaluation(h.DB.QueryRow(ctx,
+		`SELECT `+qaEvaluationColumns+` `+qaEvaluationFrom+` WHERE e.id=$1 AND e.tenant_id=$2`,
+		id, tenantID), &e)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT a.question_id, a.score, a.comment, s.name, q.text, q.max_score, q.auto_fail
+		FROM qa_answers a
+		JOIN qa_questions q ON q.id = a.question_id
+		JOIN qa_sections s  ON s.id = q.section_id
+		WHERE a.evaluation_id = $1
+		ORDER BY s.sort_order, s.id, q.sort_order, q.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	e.Answers = make([]QAAnswerDetail, 0)
+	for rows.Next() {
+		var a QAAnswerDetail
+		if err := rows.Scan(&a.QuestionID, &a.Score, &a.Comment, &a.Section, &a.Question,
+			&a.MaxScore, &a.AutoFail); err != nil {
+			return nil, err
+		}
+		e.Answers = append(e.Answers, a)
+	}
+	return &e, rows.Err()
+}
+
+// resolveAgent — оцениваемый агент: явно указанный пользователь тенанта или тот,
+// кто поставил результат звонка на wrap-up
+func (h *QAHandler) resolveAgent(ctx context.Context, agentID *int, uniqueid string, tenantID int) (int, error) {
+	if agentID != nil {
+		var exists bool
+		h.DB.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM users WHERE id=$1 AND tenant_id=$2)`,
+			*agentID, tenantID).Scan(&exists)
+		if !exists {
+			return 0, errors.New("agent not found")
+		}
+		return *agentID, nil
+	}
+	var id int
+	err := h.DB.QueryRow(ctx,
+		`SELECT user_id FROM call_dispositions WHERE uniqueid=$1 AND tenant_id=$2`,
+		uniqueid, tenantID).Scan(&id)
+	if err != nil {
+		return 0, errors.New("agentId is required: call has no wrap-up agent")
+	}
+	return id, nil
+}
+
+type qaResult struct {
+	Score      float64
+	AutoFailed bool
+	Passed     bool
+}
+
+// score проверяет ответы по шаблону и считает итог (scoreAnswers)
+func (h *QAHandler) score(ctx context.Context, templateID, tenantID int, answers []QAAnswer, activeOnly bool) (qaResult, error) {
+	var res qaResult
+	var passScore float64
+	var active bool
+	err := h.DB.QueryRow(ctx,
+		`SELECT pass_score, active FROM qa_templates WHERE id=$1 AND tenant_id=$2`,
+		templateID, tenantID).Scan(&passScore, &active)
+	if err != nil {
+		return res, errors.New("template not found")
+	}
+	if activeOnly && !active {
+		return res, errors.New("template is not active")
+	}
+
+	rows, err := h.DB.Query(ctx,
+		`SELECT id, text, weight, max_score, auto_fail, allow_na FROM qa_questions WHERE template_id=$1`,
+		templateID)
+	if err != nil {
+		return res, err
+	}
+	questions := map[int]QAQuestion{}
+	for rows.Next() {
+		var q QAQuestion
+		if err := rows.Scan(&q.ID, &q.Text, &q.Weight, &q.MaxScore, &q.AutoFail, &q.AllowNA); err != nil {
+			rows.Close()
+			return res, err
+		}
+		questions[q.ID] = q
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	return scoreAnswers(questions, passScore, answers)
+}
+
+// scoreAnswers — итог по ответам: Σ(вес × балл/макс) / Σ вес по применимым
+// вопросам, в процентах. 0 по критичному пункту — итог 0.
+func scoreAnswers(questions map[int]QAQuestion, passScore float64, answers []QAAnswer) (qaResult, error) {
+	var res qaResult
+	seen := map[int]bool{}
+	var got, total float64
+	for _, a := range answers {
+		q, ok := questions[a.QuestionID]
+		if !ok {
+			return res, fmt.Errorf("question %d is not in template", a.QuestionID)
+		}
+		if seen[a.QuestionID] {
+			return res, fmt.Errorf("question %d answered twice", a.QuestionID)
+		}
+		seen[a.QuestionID] = true
+		if a.Score == nil {
+			if !q.AllowNA {
+				return res, fmt.Errorf("question %d requires a score", a.QuestionID)
+			}
+			continue
+		}
+		if *a.Score < 0 || *a.Score > q.MaxScore {
+			return res, fmt.Errorf("question %d: score must be between 0 and %d", a.QuestionID, q.MaxScore)
+		}
+		if q.AutoFail && *a.Score == 0 {
+			res.AutoFailed = true
+		}
+		got += q.Weight * float64(*a.Score) / float64(q.MaxScore)
+		total += q.Weight
+	}
+	if len(seen) != len(questions) {
+		return res, errors.New("all template questions must be answered")
+	}
+
+	res.Score = 100
+	if total > 0 {
+		res.Score = math.Round(got/total*10000) / 100
+	}
+	if res.AutoFailed {
+		res.Score = 0
+	}
+	res.Passed = !res.AutoFailed && res.Score >= passScore
+	return res, nil
+}
+
+// qaFilter — общие фильтры оценок для списка и отчётов: tenant ($1), agentId,
+// templateId, dateFrom/dateTo по дате звонка (нет в CDR — по дате оценки);
+// даты без смещения — в поясе loc
+func qaFilter(q url.Values, tenantID int, loc *time.Location) (string, []any) {
+	where := `WHERE e.tenant_id = $1`
+	args := []any{tenantID}
+	if v, err := strconv.Atoi(q.Get("agentId")); err == nil {
+		args = append(args, v)
+		where += " AND e.agent_id = $" + strconv.Itoa(len(args))
+	}
+	if v, err := strconv.Atoi(q.Get("templateId")); err == nil {
+		args = append(args, v)
+		where += " AND e.template_id = $" + strconv.Itoa(len(args))
+	}
+	if t, ok := parseReportTime(q.Get("dateFrom"), loc, false); ok {
+		args = append(args, t)
+		where += " AND COALESCE(e.call_date, e.created_at) >= $" + strconv.Itoa(len(args))
+	}
+	if t, ok := parseReportTime(q.Get("dateTo"), loc, true); ok {
+		args = append(args, t)
+		where += " AND COALESCE(e.call_date, e.created_at) <= $" + strconv.Itoa(len(args))
+	}
+	return where, args
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScoreAnswers(t *testing.T) {
+	questions := map[int]QAQuestion{
+		1: {ID: 1, Text: "Приветствие", Weight: 1, MaxScore: 5},
+		2: {ID: 2, Text: "Решение вопроса", Weight: 3, MaxScore: 10},
+		3: {ID: 3, Text: "Допродажа", Weight: 2, MaxScore: 5, AllowNA: true},
+		4: {ID: 4, Text: "Грубость", Weight: 1, MaxScore: 1, AutoFail: true},
+	}
+	score := func(v int) *int { return &v }
+	answers := func(s1, s2, s3, s4 *int) []QAAnswer {
+		return []QAAnswer{{QuestionID: 1, Score: s1}, {QuestionID: 2, Score: s2}, {QuestionID: 3, Score: s3}, {QuestionID: 4, Score: s4}}
+	}
+
+	tests := []struct {
+		name    string
+		answers []QAAnswer
+		want    qaResult
+		err     string
+	}{
+		{
+			name:    "all max",
+			answers: answers(score(5), score(10), score(5), score(1)),
+			want:    qaResult{Score: 100, Passed: true},
+		},
+		{
+			// (1×4/5 + 3×5/10 + 2×5/5 + 1×1/1) / 7 = 5.3 / 7, ниже проходного
+			name:    "weighted, below pass score",
+			answers: answers(score(4), score(5), score(5), score(1)),
+			want:    qaResult{Score: 75.71},
+		},
+		{
+			// (1×4/5 + 3×10/10 + 1) / 5: неприменимый вопрос не входит ни в баллы, ни в веса
+			name:    "n/a excluded from weights",
+			answers: answers(score(4), score(10), nil, score(1)),
+			want:    qaResult{Score: 96, Passed: true},
+		},
+		{
+			name:    "weighted, above pass score",
+			answers: answers(score(5), score(6), score(5), score(1)),
+			want:    qaResult{Score: 82.86, Passed: true},
+		},
+		{
+			name:    "auto-fail zeroes the score",
+			answers: answers(score(5), score(10), score(5), score(0)),
+			want:    qaResult{Score: 0, AutoFailed: true},
+		},
+		{
+			name:    "zero on a regular question is not auto-fail",
+			answers: answers(score(0), score(10), score(5), score(1)),
+			want:    qaResult{Score: 85.71, Passed: true},
+		},
+		{
+			name:    "n/a not allowed",
+			answers: answers(nil, score(10), score(5), score(1)),
+			err:     "question 1 requires a score",
+		},
+		{
+			name:    "score above max",
+			answers: answers(score(6), score(10), score(5), score(1)),
+			err:     "question 1: score must be between 0 and 5",
+		},
+		{
+			name:    "negative score",
+			answers: answers(score(5), score(-1), score(5), score(1)),
+			err:     "question 2: score must be between 0 and 10",
+		},
+		{
+			name:    "missing question",
+			answers: answers(score(5), score(10), score(5), score(1))[:3],
+			err:     "all template questions must be answered",
+		},
+		{
+			name:    "answered twice",
+			answers: append(answers(score(5), score(10), score(5), score(1)), QAAnswer{QuestionID: 2, Score: score(1)}),
+			err:     "question 2 answered twice",
+		},
+		{
+			name:    "unknown question",
+			answers: append(answers(score(5), score(10), score(5), score(1)), QAAnswer{QuestionID: 9, Score: score(1)}),
+			err:     "question 9 is not in template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := scoreAnswers(questions, 80, tt.answers)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != tt.want {
+				t.Errorf("result = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreAnswersAllNA(t *testing.T) {
+	// Все вопросы неприменимы — 100%, как пустая оценка без штрафов
+	questions := map[int]QAQuestion{1: {ID: 1, Weight: 1, MaxScore: 5, AllowNA: true}}
+	res, err := scoreAnswers(questions, 80, []QAAnswer{{QuestionID: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (qaResult{Score: 100, Passed: true}) {
+		t.Errorf("result = %+v", res)
+	}
+}
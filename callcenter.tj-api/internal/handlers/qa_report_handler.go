@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"callcentrix/internal/auth"
+)
+
+// =========================
+// MODELS
+// =========================
+
+type QAAgentReportRow struct {
+	AgentID     int     `json:"agentId"`
+	AgentName   *string `json:"agentName"`
+	Evaluations int     `json:"evaluations"`
+	AvgScore    float64 `json:"avgScore"`
+	PassRate    float64 `json:"passRate"` // % оценок выше проходного балла
+	AutoFails   int     `json:"autoFails"`
+	Pending     int     `json:"pending"`  // ждут ознакомления
+	Disputed    int     `json:"disputed"` // агент не согласен
+	// Худшая оценка периода — с неё обычно начинают разбор
+	LowestEvaluationID int64   `json:"lowestEvaluationId"`
+	LowestScore        float64 `json:"lowestScore"`
+	LowestUniqueID     string  `json:"lowestUniqueid"`
+	LowestRecordingURL string  `json:"lowestRecordingUrl"`
+}
+
+type QAQuestionReportRow struct {
+	QuestionID int      `json:"questionId"`
+	TemplateID int      `json:"templateId"`
+	Template   string   `json:"template"`
+	Section    string   `json:"section"`
+	Question   string   `json:"question"`
+	Weight     float64  `json:"weight"`
+	AutoFail   bool     `json:"autoFail"`
+	Answered   int      `json:"answered"`
+	NotApplied int      `json:"notApplicable"`
+	AvgPercent *float64 `json:"avgPercent"` // средний балл в % от максимума, nil — только N/A
+	Zeros      int      `json:"zeros"`      // ответов с 0 баллов
+	// Последний звонок с 0 баллов по вопросу
+	LastZeroUniqueID     *string `json:"lastZeroUniqueid"`
+	LastZeroRecordingURL *string `json:"lastZeroRecordingUrl"`
+}
+
+type QATrendRow struct {
+	Period      time.Time `json:"period"` // начало интервала в поясе компании
+	Evaluations int       `json:"evaluations"`
+	AvgScore    float64   `json:"avgScore"`
+	PassRate    float64   `json:"passRate"`
+	AutoFails   int       `json:"autoFails"`
+}
+
+// ============================================================
+// REPORTS
+// ============================================================
+
+// GetQAAgentReport godoc
+// @Summary      Оценка качества: средние баллы по агентам (только admin)
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        templateId  query  int     false  "Шаблон"
+// @Param        agentId     query  int     false  "Агент"
+// @Param        dateFrom    query  string  false  "RFC3339 или дата в поясе компании, по дате звонка"
+// @Param        dateTo      query  string  false  "RFC3339 или дата в поясе компании, по дате звонка"
+// @Success      200  {array}  QAAgentReportRow
+// @Router       /api/reports/qa/agents [get]
+func (h *QAHandler) GetQAAgentReport(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	where, args := qaFilter(r.URL.Query(), user.TenantID, tenantLocation(r.Context(), h.DB, user.TenantID))
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT e.agent_id, MAX(`+qaAgentNameSQL+`), COUNT(*),
+		       AVG(e.score), AVG(e.passed::int) * 100,
+		       COUNT(*) FILTER (WHERE e.auto_failed),
+		       COUNT(*) FILTER (WHERE e.status = 'pending'),
+		       COUNT(*) FILTER (WHERE e.status = 'disputed'),
+		       (ARRAY_AGG(e.id ORDER BY e.score, e.created_at DESC))[1],
+		       MIN(e.score),
+		       (ARRAY_AGG(e.uniqueid ORDER BY e.score, e.created_at DESC))[1]
+		FROM qa_evaluations e
+		LEFT JOIN users a ON a.id = e.agent_id
+		`+where+`
+		GROUP BY e.agent_id
+		ORDER BY AVG(e.score) DESC`,
+		args...)
+	if err != nil {
+		log.Printf("❌ GetQAAgentReport: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]QAAgentReportRow, 0)
+	for rows.Next() {
+		var row QAAgentReportRow
+		if err := rows.Scan(&row.AgentID, &row.AgentName, &row.Evaluations, &row.AvgScore, &row.PassRate,
+			&row.AutoFails, &row.Pending, &row.Disputed,
+			&row.LowestEvaluationID, &row.LowestScore, &row.LowestUniqueID); err != nil {
+			log.Printf("❌ GetQAAgentReport scan: %v", err)
+			continue
+		}
+		row.LowestRecordingURL = recordingPath(row.LowestUniqueID)
+		result = append(result, row)
+	}
+	jsonResp(w, result)
+}
+
+// GetQAQuestionReport godoc
+// @Summary      Оценка качества: результаты по вопросам анкеты (только admin)
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        templateId  query  int     false  "Шаблон"
+// @Param        agentId     query  int     false  "Агент"
+// @Param        dateFrom    query  string  false  "RFC3339 или дата в поясе компании, по дате звонка"
+// @Param        dateTo      query  string  false  "RFC3339 или дата в поясе компании, по дате звонка"
+// @Success      200  {array}  QAQuestionReportRow
+// @Router       /api/reports/qa/questions [get]
+func (h *QAHandler) GetQAQuestionReport(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	where, args := qaFilter(r.URL.Query(), user.TenantID, tenantLocation(r.Context(), h.DB, user.TenantID))
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT q.id, t.id, t.name, s.name, q.text, q.weight, q.auto_fail,
+		       COUNT(a.score), COUNT(*) FILTER (WHERE a.score IS NULL),
+		       AVG(a.score::numeric / q.max_score) * 100,
+		       COUNT(*) FILTER (WHERE a.score = 0),
+		       (ARRAY_AGG(e.uniqueid ORDER BY e.created_at DESC) FILTER (WHERE a.score = 0))[1]
+		FROM qa_answers a
+		JOIN qa_evaluations e ON e.id = a.evaluation_id
+		JOIN qa_questions q   ON q.id = a.question_id
+		JOIN qa_sections s    ON s.id = q.section_id
+		JOIN qa_templates t   ON t.id = q.template_id
+		`+where+`
+		GROUP BY q.id, t.id, t.name, s.id, s.name, s.sort_order
+		ORDER BY t.name, s.sort_order, s.id, q.sort_order, q.id`,
+		args...)
+	if err != nil {
+		log.Printf("❌ GetQAQuestionReport: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]QAQuestionReportRow, 0)
+	for rows.Next() {
+		var row QAQuestionReportRow
+		if err := rows.Scan(&row.QuestionID, &row.TemplateID, &row.Template, &row.Section, &row.Question,
+			&row.Weight, &row.AutoFail, &row.Answered, &row.NotApplied, &row.AvgPercent, &row.Zeros,
+			&row.LastZeroUniqueID); err != nil {
+			log.Printf("❌ GetQAQuestionReport scan: %v", err)
+			continue
+		}
+		if row.LastZeroUniqueID != nil {
+			u := recordingPath(*row.LastZeroUniqueID)
+			row.LastZeroRecordingURL = &u
+		}
+		result = append(result, row)
+	}
+	jsonResp(w, result)
+}
+
+// GetQATrendReport godoc
+// @Summary      Оценка качества: динамика среднего балла (только admin)
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        interval    query  string  false  "day / week / month, по умолчанию week"
+// @Param        templateId  query  int     false  "Шаблон"
+// @Param        agentId     query  int     false  "Агент"
+// @Param        dateFrom    query  string  false  "RFC3339 или дата в поясе компании, по дате звонка"
+// @Param        dateTo      query  string  false  "RFC3339 или дата в поясе компании, по дате звонка"
+// @Success      200  {array}  QATrendRow
+// @Router       /api/reports/qa/trend [get]
+func (h *QAHandler) GetQATrendReport(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	interval := q.Get("interval")
+	switch interval {
+	case "day", "week", "month":
+	case "":
+		interval = "week"
+	default:
+		http.Error(w, "interval must be day, week or month", http.StatusBadRequest)
+		return
+	}
+	loc := tenantLocation(r.Context(), h.DB, user.TenantID)
+	where, args := qaFilter(q, user.TenantID, loc)
+	bucket := `date_trunc($` + strconv.Itoa(len(args)+1) + `, COALESCE(e.call_date, e.created_at) AT TIME ZONE $` + strconv.Itoa(len(args)+2) + `)`
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT `+bucket+`, COUNT(*), AVG(e.score), AVG(e.passed::int) * 100,
+		       COUNT(*) FILTER (WHERE e.auto_failed)
+		FROM qa_evaluations e
+		`+where+`
+		GROUP BY 1
+		ORDER BY 1`,
+		append(args, interval, loc.String())...)
+	if err != nil {
+		log.Printf("❌ GetQATrendReport: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]QATrendRow, 0)
+	for rows.Next() {
+		var row QATrendRow
+		if err := rows.Scan(&row.Period, &row.Evaluations, &row.AvgScore, &row.PassRate, &row.AutoFails); err != nil {
+			log.Printf("❌ GetQATrendReport scan: %v", err)
+			continue
+		}
+		// timestamp без пояса приходит как UTC — это локальное время в loc
+		p := row.Period
+		row.Period = time.Date(p.Year(), p.Month(), p.Day(), 0, 0, 0, 0, loc)
+		result = append(result, row)
+	}
+	jsonResp(w, result)
+}
@@ -0,0 +1,631 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"callcentrix/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RateDeckHandler — сетки цен исходящих по тарифам (rate_deck). Звонок
+// оценивается по самому длинному префиксу номера при записи в ast_cdr
+// (триггер, миграция 020); здесь — просмотр, импорт CSV и пересчёт
+// уже записанных звонков. Только суперадмин.
+type RateDeckHandler struct {
+	DB *pgxpool.Pool
+}
+
+const (
+	maxRateDeckUpload    = 20 << 20
+	maxRateImportErrs    = 50
+	maxRerateDays        = 93
+	defaultRateIncrement = 60
+)
+
+// =========================
+// MODELS
+// =========================
+
+type Rate struct {
+	Prefix         string    `json:"prefix"`
+	Destination    string    `json:"destination"`
+	PricePerMinute float64   `json:"pricePerMinute"`
+	Increment      int       `json:"increment"`     // шаг тарификации, с
+	ConnectionFee  float64   `json:"connectionFee"` // за отвеченный звонок
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type RateListResponse struct {
+	Rates   []Rate `json:"rates"`
+	Total   int    `json:"total"`
+	Page    int    `json:"page"`
+	PerPage int    `json:"perPage"`
+}
+
+type RateImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type RateImportResponse struct {
+	Mode     string            `json:"mode"`     // replace / merge
+	Imported int               `json:"imported"` // строк в сетке из файла
+	Skipped  int               `json:"skipped"`  // строк с ошибками
+	Total    int               `json:"total"`    // префиксов в сетке после импорта
+	Errors   []RateImportError `json:"errors"`   // первые 50
+}
+
+// RateMatch — префикс сетки для номера и цена звонка заданной длины
+type RateMatch struct {
+	Rate
+	Seconds      int     `json:"seconds"`      // длительность примера
+	RatedSeconds int     `json:"ratedSeconds"` // с учётом шага
+	Cost         float64 `json:"cost"`
+}
+
+type RerateRequest struct {
+	DateFrom string `json:"dateFrom"` // RFC3339 или дата (UTC)
+	DateTo   string `json:"dateTo"`   // включительно
+}
+
+type RerateResponse struct {
+	Rated   int `json:"rated"`   // звонков с ценой
+	Unrated int `json:"unrated"` // отвеченных без цены: не исходящие или префикса нет в сетке
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// GetRates godoc
+// @Summary      Сетка цен тарифа
+// @Tags         Billing
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path   int     true   "ID тарифа"
+// @Param        prefix   query  string  false  "Префиксы, начинающиеся с"
+// @Param        search   query  string  false  "Направление (подстрока)"
+// @Param        page     query  int     false  "Страница"
+// @Param        perPage  query  int     false  "до 500"
+// @Success      200  {object}  RateListResponse
+// @Router       /api/tariffs/{id}/rates [get]
+func (h *RateDeckHandler) GetRates(w http.ResponseWriter, r *http.Request) {
+	tariffID, ok := h.tariffFromPath(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(q.Get("perPage"))
+	if perPage < 1 || perPage > 500 {
+		perPage = 100
+	}
+
+	where := " WHERE tariff_id = $1"
+	args := []any{tariffID}
+	if prefix := rateDigits(q.Get("prefix")); prefix != "" {
+		args = append(args, prefix+"%")
+		where += " AND prefix LIKE $" + strconv.Itoa(len(args))
+	}
+	if search := q.Get("search"); search != "" {
+		args = append(args, "%"+search+"%")
+		where += " AND destination ILIKE $" + strconv.Itoa(len(args))
+	}
+
+	resp := RateListResponse{Rates: make([]Rate, 0), Page: page, PerPage: perPage}
+	if err := h.DB.QueryRow(r.Context(), `SELECT COUNT(*) FROM rate_deck`+where, args...).Scan(&resp.Total); err != nil {
+		log.Printf("❌ GetRates count: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	idx := len(args) + 1
+	rows, err := h.DB.Query(r.Context(), rateSelect+where+`
+		ORDER BY prefix
+		LIMIT $`+strconv.Itoa(idx)+` OFFSET $`+strconv.Itoa(idx+1),
+		append(args, perPage, (page-1)*perPage)...)
+	if err != nil {
+		log.Printf("❌ GetRates: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rt Rate
+		if err := scanRate(rows, &rt); err != nil {
+			log.Printf("❌ GetRates scan: %v", err)
+			continue
+		}
+		resp.Rates = append(resp.Rates, rt)
+	}
+	jsonResp(w, resp)
+}
+
+// ImportRates godoc
+// @Summary      Импорт сетки цен из CSV
+// @Description  Колонки: prefix, destination, price_per_minute, increment (с, по умолчанию 60), connection_fee (по умолчанию 0). Разделитель «,» или «;», строка заголовка необязательна, десятичная запятая допускается. Файл — multipart-поле file или тело запроса text/csv. mode=replace (по умолчанию) заменяет сетку целиком, merge — добавляет и обновляет префиксы. Цены уже записанных звонков не меняются — см. rerate.
+// @Tags         Billing
+// @Security     BearerAuth
+// @Accept       multipart/form-data
+// @Accept       text/csv
+// @Produce      json
+// @Param        id    path      int     true   "ID тарифа"
+// @Param        mode  query     string  false  "replace / merge"
+// @Param        file  formData  file    false  "CSV"
+// @Success      200  {object}  RateImportResponse
+// @Failure      400  {object}  RateImportResponse  "в файле нет ни одной корректной строки"
+// @Router       /api/tariffs/{id}/rates/import [post]
+func (h *RateDeckHandler) ImportRates(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	tariffID, ok := h.tariffFromPath(w, r)
+	if !ok {
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "replace"
+	}
+	if mode != "replace" && mode != "merge" {
+		http.Error(w, "invalid mode", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRateDeckUpload)
+	var src io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(maxRateDeckUpload); err != nil {
+			http.Error(w, "file too large (max 20MB)", http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file field required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		src = file
+	}
+
+	rates, resp, err := parseRateDeck(src)
+	if err != nil {
+		http.Error(w, "invalid csv: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp.Mode = mode
+	if len(rates) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	if err := h.importRates(r.Context(), tariffID, mode, rates); err != nil {
+		log.Printf("❌ ImportRates tariff %d: %v", tariffID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Imported = len(rates)
+	h.DB.QueryRow(r.Context(), `SELECT COUNT(*) FROM rate_deck WHERE tariff_id = $1`, tariffID).Scan(&resp.Total)
+
+	log.Printf("📝 Rate deck tariff %d: %s %d prefixes (%d skipped), user %d",
+		tariffID, mode, resp.Imported, resp.Skipped, user.UserID)
+	jsonResp(w, resp)
+}
+
+// ExportRates godoc
+// @Summary      Сетка цен тарифа в CSV
+// @Description  В формате импорта.
+// @Tags         Billing
+// @Security     BearerAuth
+// @Produce      text/csv
+// @Param        id  path  int  true  "ID тарифа"
+// @Success      200  {file}  file
+// @Router       /api/tariffs/{id}/rates/export [get]
+func (h *RateDeckHandler) ExportRates(w http.ResponseWriter, r *http.Request) {
+	tariffID, ok := h.tariffFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(), rateSelect+` WHERE tariff_id = $1 ORDER BY prefix`, tariffID)
+	if err != nil {
+		log.Printf("❌ ExportRates: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="rates_%d.csv"`, tariffID))
+	out := newCSVRows(w)
+	out.WriteRow("prefix", "destination", "price_per_minute", "increment", "connection_fee")
+	for rows.Next() {
+		var rt Rate
+		if err := scanRate(rows, &rt); err != nil {
+			log.Printf("❌ ExportRates scan: %v", err)
+			continue
+		}
+		out.WriteRow(rt.Prefix, rt.Destination,
+			strconv.FormatFloat(rt.PricePerMinute, 'f', -1, 64),
+			rt.Increment,
+			strconv.FormatFloat(rt.ConnectionFee, 'f', -1, 64))
+	}
+	if err := out.Close(); err != nil {
+		log.Printf("❌ ExportRates close: %v", err)
+	}
+}
+
+// LookupRate godoc
+// @Summary      Префикс сетки для номера
+// @Description  Самый длинный совпавший префикс и цена звонка длительностью seconds (по умолчанию 60 с).
+// @Tags         Billing
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path   int     true   "ID тарифа"
+// @Param        number   query  string  true   "Номер"
+// @Param        seconds  query  int     false  "Длительность разговора, с"
+// @Success      200  {object}  RateMatch
+// @Failure      404  {string}  string  "no rate for number"
+// @Router       /api/tariffs/{id}/rates/lookup [get]
+func (h *RateDeckHandler) LookupRate(w http.ResponseWriter, r *http.Request) {
+	tariffID, ok := h.tariffFromPath(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	number := rateDigits(q.Get("number"))
+	if number == "" {
+		http.Error(w, "number is required", http.StatusBadRequest)
+		return
+	}
+	seconds := 60
+	if v := q.Get("seconds"); v != "" {
+		s, err := strconv.Atoi(v)
+		if err != nil || s < 0 {
+			http.Error(w, "invalid seconds", http.StatusBadRequest)
+			return
+		}
+		seconds = s
+	}
+
+	// Тот же поиск префикса, что в ast_cdr_rating: все префиксы номера, самый длинный
+	rows, err := h.DB.Query(r.Context(), rateSelect+`
+		WHERE tariff_id = $1
+		  AND prefix IN (SELECT left($2::text, i) FROM generate_series(1, length($2::text)) i)`,
+		tariffID, number)
+	if err != nil {
+		log.Printf("❌ LookupRate: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var candidates []Rate
+	for rows.Next() {
+		var rt Rate
+		if err := scanRate(rows, &rt); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		candidates = append(candidates, rt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("❌ LookupRate: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rt, ok := matchRate(candidates, number)
+	if !ok {
+		http.Error(w, "no rate for number", http.StatusNotFound)
+		return
+	}
+	m := RateMatch{Rate: rt}
+	m.Seconds = seconds
+	m.RatedSeconds, m.Cost = m.Rate.price(seconds)
+	jsonResp(w, m)
+}
+
+// DeleteRate godoc
+// @Summary      Удалить префикс из сетки
+// @Tags         Billing
+// @Security     BearerAuth
+// @Param        id      path  int     true  "ID тарифа"
+// @Param        prefix  path  string  true  "Префикс"
+// @Success      204
+// @Router       /api/tariffs/{id}/rates/{prefix} [delete]
+func (h *RateDeckHandler) DeleteRate(w http.ResponseWriter, r *http.Request) {
+	tariffID, ok := h.tariffFromPath(w, r)
+	if !ok {
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM rate_deck WHERE tariff_id = $1 AND prefix = $2`, tariffID, chi.URLParam(r, "prefix"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RerateCalls godoc
+// @Summary      Пересчитать цены звонков по текущей сетке
+// @Description  Отвеченные звонки компаний на этом тарифе за период (до 93 дней) оцениваются заново; звонки без совпавшего префикса теряют цену. Исходящий — по зафиксированному ast_cdr.direction, как при записи звонка. Нужен после импорта сетки, если звонки уже записаны, и для звонков до миграции 020.
+// @Tags         Billing
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int            true  "ID тарифа"
+// @Param        body  body  RerateRequest  true  "Период"
+// @Success      200  {object}  RerateResponse
+// @Router       /api/tariffs/{id}/rates/rerate [post]
+func (h *RateDeckHandler) RerateCalls(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	tariffID, ok := h.tariffFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req RerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	from, okFrom := parseReportTime(req.DateFrom, time.UTC, false)
+	to, okTo := parseReportTime(req.DateTo, time.UTC, true)
+	if !okFrom || !okTo || to.Before(from) {
+		http.Error(w, "dateFrom and dateTo are required", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxRerateDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("period is longer than %d days", maxRerateDays), http.StatusBadRequest)
+		return
+	}
+
+	var resp RerateResponse
+	err := h.DB.QueryRow(r.Context(), `
+		WITH upd AS (
+			UPDATE ast_cdr c SET (rate_prefix, rated_seconds, cost) = (
+				SELECT o.prefix, o.seconds, o.cost FROM ast_cdr_rating(c.tenant_id, c.direction, c.dst, c.billsec) o
+			)
+			WHERE c.tenant_id IN (SELECT tenant_id FROM crm_tenants WHERE tariff_id = $1)
+			  AND c.calldate AT TIME ZONE 'UTC' >= $2
+			  AND c.calldate AT TIME ZONE 'UTC' <= $3
+			  AND c.disposition = 'ANSWERED'
+			  AND c.lastapp != 'Hangup'
+			RETURNING c.cost
+		)
+		SELECT COUNT(*) FILTER (WHERE cost IS NOT NULL), COUNT(*) FILTER (WHERE cost IS NULL) FROM upd`,
+		tariffID, from, to,
+	).Scan(&resp.Rated, &resp.Unrated)
+	if err != nil {
+		log.Printf("❌ RerateCalls tariff %d: %v", tariffID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("📝 Rerate tariff %d %s – %s: %d rated, %d unrated (user %d)",
+		tariffID, from.Format(time.RFC3339), to.Format(time.RFC3339), resp.Rated, resp.Unrated, user.UserID)
+	jsonResp(w, resp)
+}
+
+// =========================
+// HELPERS
+// =========================
+
+const rateSelect = `
+	SELECT prefix, destination, price_per_minute, increment, connection_fee, updated_at
+	FROM rate_deck`
+
+func scanRate(row interface{ Scan(...any) error }, rt *Rate) error {
+	return row.Scan(&rt.Prefix, &rt.Destination, &rt.PricePerMinute, &rt.Increment, &rt.ConnectionFee, &rt.UpdatedAt)
+}
+
+// price — оценка разговора, как в ast_cdr_rating: шаг вверх, плата за соединение
+func (rt *Rate) price(billsec int) (int, float64) {
+	if billsec <= 0 {
+		return 0, 0
+	}
+	rated := (billsec + rt.Increment - 1) / rt.Increment * rt.Increment
+	cost := rt.ConnectionFee + float64(rated)/60*rt.PricePerMinute
+	return rated, math.Round(cost*10000) / 10000
+}
+
+// matchRate — префикс сетки с самым длинным совпадением с началом номера
+func matchRate(rates []Rate, number string) (Rate, bool) {
+	var best Rate
+	found := false
+	for _, rt := range rates {
+		if strings.HasPrefix(number, rt.Prefix) && (!found || len(rt.Prefix) > len(best.Prefix)) {
+			best, found = rt, true
+		}
+	}
+	return best, found
+}
+
+// tariffFromPath — {id} существующего тарифа для суперадмина; false — ответ уже отправлен
+func (h *RateDeckHandler) tariffFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 0 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return 0, false
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return 0, false
+	}
+	var exists bool
+	if err := h.DB.QueryRow(r.Context(),
+		`SELECT EXISTS (SELECT 1 FROM crm_tarrifs WHERE id = $1)`, id,
+	).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+	if !exists {
+		http.Error(w, "tariff not found", http.StatusNotFound)
+		return 0, false
+	}
+	return id, true
+}
+
+// importRates записывает сетку одной транзакцией: COPY во временную таблицу,
+// затем replace — вместо старой сетки, merge — поверх неё
+func (h *RateDeckHandler) importRates(ctx context.Context, tariffID int, mode string, rates []Rate) error {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		CREATE TEMP TABLE rate_import (
+			prefix TEXT, destination TEXT, price_per_minute NUMERIC(12,4), increment INT, connection_fee NUMERIC(12,4)
+		) ON COMMIT DROP`); err != nil {
+		return err
+	}
+	rows := make([][]any, len(rates))
+	for i, rt := range rates {
+		rows[i] = []any{rt.Prefix, rt.Destination, rt.PricePerMinute, rt.Increment, rt.ConnectionFee}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"rate_import"},
+		[]string{"prefix", "destination", "price_per_minute", "increment", "connection_fee"},
+		pgx.CopyFromRows(rows)); err != nil {
+		return err
+	}
+
+	if mode == "replace" {
+		if _, err := tx.Exec(ctx, `DELETE FROM rate_deck WHERE tariff_id = $1`, tariffID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO rate_deck (tariff_id, prefix, destination, price_per_minute, increment, connection_fee)
+		SELECT $1, prefix, destination, price_per_minute, increment, connection_fee FROM rate_import
+		ON CONFLICT (tariff_id, prefix) DO UPDATE SET
+			destination      = EXCLUDED.destination,
+			price_per_minute = EXCLUDED.price_per_minute,
+			increment        = EXCLUDED.increment,
+			connection_fee   = EXCLUDED.connection_fee,
+			updated_at       = NOW()`, tariffID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// parseRateDeck читает CSV сетки. Ошибочные строки пропускаются и попадают
+// в resp.Errors; повтор префикса — действует последняя строка.
+func parseRateDeck(src io.Reader) ([]Rate, RateImportResponse, error) {
+	resp := RateImportResponse{Errors: make([]RateImportError, 0)}
+
+	br := bufio.NewReader(src)
+	// Разделитель — по первой строке: Excel в русской локали пишет «;»
+	first, _ := br.Peek(4096)
+	first = bytes.TrimPrefix(first, []byte("\uFEFF"))
+	if i := bytes.IndexByte(first, '\n'); i >= 0 {
+		first = first[:i]
+	}
+	cr := csv.NewReader(br)
+	if bytes.Count(first, []byte(";")) > bytes.Count(first, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	index := make(map[string]int)
+	var rates []Rate
+	fail := func(line int, msg string) {
+		resp.Skipped++
+		if len(resp.Errors) < maxRateImportErrs {
+			resp.Errors = append(resp.Errors, RateImportError{Line: line, Error: msg})
+		}
+	}
+	for n := 1; ; n++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, resp, err
+		}
+		// Номер строки файла для ошибок: пустые строки csv пропускает
+		line, _ := cr.FieldPos(0)
+		if n == 1 && len(rec) > 0 {
+			rec[0] = strings.TrimPrefix(rec[0], "\uFEFF")
+		}
+		if len(rec) == 0 || (len(rec) == 1 && strings.TrimSpace(rec[0]) == "") {
+			continue
+		}
+		// Заголовок: первая строка, где вместо префикса — текст
+		if n == 1 && rateDigits(rec[0]) == "" {
+			continue
+		}
+		if len(rec) < 3 {
+			fail(line, "expected prefix, destination, price_per_minute")
+			continue
+		}
+
+		rt := Rate{Destination: strings.TrimSpace(rec[1]), Increment: defaultRateIncrement}
+		raw := strings.TrimSpace(rec[0])
+		if rt.Prefix = rateDigits(raw); rt.Prefix == "" || len(rt.Prefix) != len(strings.TrimPrefix(raw, "+")) {
+			fail(line, "invalid prefix "+strconv.Quote(raw))
+			continue
+		}
+		if rt.PricePerMinute, err = rateNumber(rec[2]); err != nil || rt.PricePerMinute < 0 {
+			fail(line, "invalid price_per_minute")
+			continue
+		}
+		if len(rec) > 3 && strings.TrimSpace(rec[3]) != "" {
+			if rt.Increment, err = strconv.Atoi(strings.TrimSpace(rec[3])); err != nil || rt.Increment <= 0 {
+				fail(line, "invalid increment")
+				continue
+			}
+		}
+		if len(rec) > 4 && strings.TrimSpace(rec[4]) != "" {
+			if rt.ConnectionFee, err = rateNumber(rec[4]); err != nil || rt.ConnectionFee < 0 {
+				fail(line, "invalid connection_fee")
+				continue
+			}
+		}
+
+		if i, ok := index[rt.Prefix]; ok {
+			rates[i] = rt
+			continue
+		}
+		index[rt.Prefix] = len(rates)
+		rates = append(rates, rt)
+	}
+	return rates, resp, nil
+}
+
+// rateNumber — цена с точкой или десятичной запятой
+func rateNumber(s string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), 64)
+}
+
+// rateDigits — префикс или номер без «+», пробелов и разделителей
+func rateDigits(s string) string {
+	return callbackNumber(s)
+}
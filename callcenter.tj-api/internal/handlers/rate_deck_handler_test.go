@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRateDeck(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		rates   []Rate
+		skipped int
+		errors  []RateImportError
+	}{
+		{
+			name: "comma, header, defaults",
+			csv: "prefix,destination,price_per_minute,increment,connection_fee\n" +
+				"992,Tajikistan,0.5\n" +
+				"+7,Russia,1.25,1,0.1\n",
+			rates: []Rate{
+				{Prefix: "992", Destination: "Tajikistan", PricePerMinute: 0.5, Increment: 60},
+				{Prefix: "7", Destination: "Russia", PricePerMinute: 1.25, Increment: 1, ConnectionFee: 0.1},
+			},
+			errors: []RateImportError{},
+		},
+		{
+			name: "excel: BOM, semicolon, decimal comma, no header",
+			csv: "\uFEFF99290;Таджикистан моб. (Tcell);0,35;30;0,05\r\n" +
+				"7;\"Россия, моб.\";1,2\r\n",
+			rates: []Rate{
+				{Prefix: "99290", Destination: "Таджикистан моб. (Tcell)", PricePerMinute: 0.35, Increment: 30, ConnectionFee: 0.05},
+				{Prefix: "7", Destination: "Россия, моб.", PricePerMinute: 1.2, Increment: 60},
+			},
+			errors: []RateImportError{},
+		},
+		{
+			name: "header with BOM and semicolons",
+			csv:  "\uFEFFПрефикс;Направление;Цена\n1;USA;0,1\n",
+			rates: []Rate{
+				{Prefix: "1", Destination: "USA", PricePerMinute: 0.1, Increment: 60},
+			},
+			errors: []RateImportError{},
+		},
+		{
+			name: "duplicate prefix: last row wins, first position kept",
+			csv:  "7,Russia,1\n992,Tajikistan,0.5\n+7,Russia mobile,2,6\n",
+			rates: []Rate{
+				{Prefix: "7", Destination: "Russia mobile", PricePerMinute: 2, Increment: 6},
+				{Prefix: "992", Destination: "Tajikistan", PricePerMinute: 0.5, Increment: 60},
+			},
+			errors: []RateImportError{},
+		},
+		{
+			name: "bad rows are skipped, blank lines ignored",
+			csv: "prefix,destination,price\n" +
+				"\n" +
+				"992,Tajikistan\n" +
+				"99-2,Dash,1\n" +
+				"abc,Text,1\n" +
+				"993,Neg,-1\n" +
+				"994,Price,free\n" +
+				"995,Step,1,0\n" +
+				"996,Fee,1,60,x\n" +
+				"7,Russia,1\n",
+			rates: []Rate{
+				{Prefix: "7", Destination: "Russia", PricePerMinute: 1, Increment: 60},
+			},
+			skipped: 7,
+			errors: []RateImportError{
+				{Line: 3, Error: "expected prefix, destination, price_per_minute"},
+				{Line: 4, Error: `invalid prefix "99-2"`},
+				{Line: 5, Error: `invalid prefix "abc"`},
+				{Line: 6, Error: "invalid price_per_minute"},
+				{Line: 7, Error: "invalid price_per_minute"},
+				{Line: 8, Error: "invalid increment"},
+				{Line: 9, Error: "invalid connection_fee"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, resp, err := parseRateDeck(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rates, tt.rates) {
+				t.Errorf("rates:\n got %+v\nwant %+v", rates, tt.rates)
+			}
+			if resp.Skipped != tt.skipped || !reflect.DeepEqual(resp.Errors, tt.errors) {
+				t.Errorf("skipped %d errors %+v, want %d %+v", resp.Skipped, resp.Errors, tt.skipped, tt.errors)
+			}
+		})
+	}
+}
+
+func TestParseRateDeckErrorLimit(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < maxRateImportErrs+10; i++ {
+		b.WriteString("x1,Bad,1\n")
+	}
+	_, resp, err := parseRateDeck(strings.NewReader("header,row,here\n" + b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Skipped != maxRateImportErrs+10 || len(resp.Errors) != maxRateImportErrs {
+		t.Errorf("skipped %d, errors %d", resp.Skipped, len(resp.Errors))
+	}
+}
+
+func TestRatePrice(t *testing.T) {
+	tests := []struct {
+		rate    Rate
+		billsec int
+		rated   int
+		cost    float64
+	}{
+		{Rate{PricePerMinute: 0.5, Increment: 60}, 0, 0, 0},
+		{Rate{PricePerMinute: 0.5, Increment: 60, ConnectionFee: 0.1}, -5, 0, 0},
+		{Rate{PricePerMinute: 0.5, Increment: 60}, 1, 60, 0.5},
+		{Rate{PricePerMinute: 0.5, Increment: 60}, 60, 60, 0.5},
+		{Rate{PricePerMinute: 0.5, Increment: 60}, 61, 120, 1},
+		{Rate{PricePerMinute: 0.6, Increment: 1}, 61, 61, 0.61},
+		{Rate{PricePerMinute: 0.35, Increment: 30, ConnectionFee: 0.05}, 31, 60, 0.4},
+		{Rate{PricePerMinute: 0.3333, Increment: 6}, 7, 12, 0.0667},
+	}
+	for _, tt := range tests {
+		rated, cost := tt.rate.price(tt.billsec)
+		if rated != tt.rated || cost != tt.cost {
+			t.Errorf("%+v.price(%d) = %d, %v; want %d, %v", tt.rate, tt.billsec, rated, cost, tt.rated, tt.cost)
+		}
+	}
+}
+
+func TestMatchRate(t *testing.T) {
+	deck := []Rate{
+		{Prefix: "99290"}, {Prefix: "7"}, {Prefix: "992"}, {Prefix: "79"}, {Prefix: "9929"}, {Prefix: "1"},
+	}
+	tests := map[string]string{
+		"992901234567": "99290",
+		"992931234567": "9929",
+		"992371234567": "992",
+		"79161234567":  "79",
+		"74951234567":  "7",
+		"12125551234":  "1",
+		"99":           "",
+		"4420":         "",
+	}
+	for number, want := range tests {
+		rt, ok := matchRate(deck, number)
+		if ok != (want != "") || rt.Prefix != want {
+			t.Errorf("matchRate(%s) = %q, %v; want %q", number, rt.Prefix, ok, want)
+		}
+	}
+}
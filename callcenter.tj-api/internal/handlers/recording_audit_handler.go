@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"callcentrix/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Повторные обращения пользователя к записи в пределах окна — то же прослушивание
+const auditListenWindow = 30 * time.Minute
+
+// Действия в recording_audit
+const (
+	auditStream = "stream" // воспроизведение через /api/recordings/{uniqueid}
+	auditLink   = "link"   // выпуск подписанной ссылки
+	auditPlay   = "play"   // воспроизведение по подписанной ссылке
+
+	auditShareCreate = "share-create" // выдача внешней ссылки
+	auditShareRevoke = "share-revoke"
+	auditSharePlay   = "share-play" // скачивание по внешней ссылке (user — кто её выдал)
+)
+
+// =========================
+// MODELS
+// =========================
+
+type RecordingAuditEntry struct {
+	ID        int64     `json:"id"`
+	UserID    *int      `json:"userId"`
+	UserName  *string   `json:"userName"`
+	UniqueID  string    `json:"uniqueid"`
+	Action    string    `json:"action"` // stream / link / play / share-*
+	ShareID   *int64    `json:"shareId"`
+	Format    *string   `json:"format"`
+	IP        *string   `json:"ip"`
+	UserAgent *string   `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RecordingListener — кто слушал запись (агрегат по пользователю)
+type RecordingListener struct {
+	UserID   *int      `json:"userId"`
+	UserName *string   `json:"userName"`
+	Plays    int       `json:"plays"`
+	Links    int       `json:"links"`
+	FirstAt  time.Time `json:"firstAt"`
+	LastAt   time.Time `json:"lastAt"`
+	LastIP   *string   `json:"lastIp"`
+}
+
+// userNameSQL — отображаемое имя пользователя u (как в отчёте звонков)
+const userNameSQL = `COALESCE(NULLIF(TRIM(COALESCE(u.first_name,'') || ' ' || COALESCE(u.last_name,'')), ''), u.username)`
+
+// ============================================================
+// API
+// ============================================================
+
+// GetRecordingAudit godoc
+// @Summary      Журнал доступа к записям (только admin)
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Produce      json
+// @Param        dateFrom  query  string  false  "RFC3339 или дата в поясе компании"
+// @Param        dateTo    query  string  false  "RFC3339 или дата в поясе компании (включительно)"
+// @Param        userId    query  int     false  "Пользователь"
+// @Param        uniqueid  query  string  false  "uniqueid звонка"
+// @Param        action    query  string  false  "stream / link / play / share-create / share-revoke / share-play"
+// @Param        limit     query  int     false  "по умолчанию 200, максимум 1000"
+// @Success      200  {array}  RecordingAuditEntry
+// @Router       /api/recordings/audit [get]
+func (h *RecordingHandler) GetRecordingAudit(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+
+	where := `WHERE a.tenant_id = $1`
+	args := []any{user.TenantID}
+	idx := 2
+
+	loc := tenantLocation(r.Context(), h.DB, user.TenantID)
+	if t, ok := parseReportTime(q.Get("dateFrom"), loc, false); ok {
+		where += " AND a.created_at >= $" + strconv.Itoa(idx)
+		args = append(args, t)
+		idx++
+	}
+	if t, ok := parseReportTime(q.Get("dateTo"), loc, true); ok {
+		where += " AND a.created_at <= $" + strconv.Itoa(idx)
+		args = append(args, t)
+		idx++
+	}
+	if v, err := strconv.Atoi(q.Get("userId")); err == nil {
+		where += " AND a.user_id = $" + strconv.Itoa(idx)
+		args = append(args, v)
+		idx++
+	}
+	if v := q.Get("uniqueid"); v != "" {
+		where += " AND a.uniqueid = $" + strconv.Itoa(idx)
+		args = append(args, v)
+		idx++
+	}
+	if v := q.Get("action"); v != "" {
+		where += " AND a.action = $" + strconv.Itoa(idx)
+		args = append(args, v)
+		idx++
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 1000 {
+		limit = 200
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT a.id, a.user_id, `+userNameSQL+`, a.uniqueid, a.action, a.share_id, a.format,
+		       a.ip, a.user_agent, a.created_at
+		FROM recording_audit a
+		LEFT JOIN users u ON u.id = a.user_id
+		`+where+`
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $`+strconv.Itoa(idx),
+		append(args, limit)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]RecordingAuditEntry, 0)
+	for rows.Next() {
+		var e RecordingAuditEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.UserName, &e.UniqueID, &e.Action, &e.ShareID, &e.Format,
+			&e.IP, &e.UserAgent, &e.CreatedAt); err != nil {
+			log.Printf("❌ Recording audit scan: %v", err)
+			continue
+		}
+		result = append(result, e)
+	}
+	jsonResp(w, result)
+}
+
+// GetRecordingListeners godoc
+// @Summary      Кто слушал запись (только admin)
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Produce      json
+// @Param        uniqueid  path  string  true  "uniqueid звонка"
+// @Success      200  {array}  RecordingListener
+// @Router       /api/recordings/{uniqueid}/listeners [get]
+func (h *RecordingHandler) GetRecordingListeners(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	uniqueid := chi.URLParam(r, "uniqueid")
+	if !h.checkAccess(r, uniqueid, user.TenantID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT a.user_id, MAX(`+userNameSQL+`),
+		       COUNT(*) FILTER (WHERE a.action IN ('stream', 'play', 'share-play')),
+		       COUNT(*) FILTER (WHERE a.action IN ('link', 'share-create')),
+		       MIN(a.created_at), MAX(a.created_at),
+		       (ARRAY_AGG(a.ip ORDER BY a.created_at DESC))[1]
+		FROM recording_audit a
+		LEFT JOIN users u ON u.id = a.user_id
+		WHERE a.uniqueid = $1 AND a.tenant_id = $2
+		GROUP BY a.user_id
+		ORDER BY MAX(a.created_at) DESC`,
+		uniqueid, user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]RecordingListener, 0)
+	for rows.Next() {
+		var l RecordingListener
+		if err := rows.Scan(&l.UserID, &l.UserName, &l.Plays, &l.Links, &l.FirstAt, &l.LastAt, &l.LastIP); err != nil {
+			log.Printf("❌ Recording listeners scan: %v", err)
+			continue
+		}
+		result = append(result, l)
+	}
+	jsonResp(w, result)
+}
+
+// =========================
+// HELPERS
+// =========================
+
+// audit пишет обращение к записи в recording_audit. tenantID 0 — берётся тенант пользователя
+// (подписанная ссылка), shareID 0 — не внешняя ссылка. Сбой записи аудита не ломает
+// воспроизведение — только лог.
+func (h *RecordingHandler) audit(r *http.Request, action, uniqueid string, userID, tenantID int, shareID int64) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	_, err := h.DB.Exec(ctx, `
+		INSERT INTO recording_audit (tenant_id, user_id, uniqueid, action, share_id, format, ip, user_agent)
+		VALUES (COALESCE(NULLIF($1, 0), (SELECT tenant_id FROM users WHERE id = $2)), $2, $3, $4, NULLIF($5, 0), $6, $7, $8)`,
+		tenantID, userID, uniqueid, action, shareID,
+		nullStr(r.URL.Query().Get("format")), nullStr(h.clientIP(r)), nullStr(r.UserAgent()),
+	)
+	if err != nil {
+		log.Printf("❌ Recording audit %s %s: %v", action, uniqueid, err)
+	}
+}
+
+// auditListen пишет прослушивание, только если этот пользователь не слушал запись
+// последние auditListenWindow: плеер дробит одно прослушивание на Range-запросы
+// с любого смещения, и считать их все (или только bytes=0-) одинаково неверно.
+// true — строка аудита добавлена.
+func (h *RecordingHandler) auditListen(r *http.Request, action, uniqueid string, userID, tenantID int) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	tag, err := h.DB.Exec(ctx, `
+		INSERT INTO recording_audit (tenant_id, user_id, uniqueid, action, format, ip, user_agent)
+		SELECT COALESCE(NULLIF($1, 0), (SELECT tenant_id FROM users WHERE id = $2)), $2, $3, $4, $5, $6, $7
+		WHERE NOT EXISTS (
+			SELECT 1 FROM recording_audit
+			WHERE uniqueid = $3 AND user_id = $2 AND action = $4
+			  AND created_at > NOW() - make_interval(mins => $8)
+		)`,
+		tenantID, userID, uniqueid, action,
+		nullStr(r.URL.Query().Get("format")), nullStr(h.clientIP(r)), nullStr(r.UserAgent()),
+		int(auditListenWindow/time.Minute),
+	)
+	if err != nil {
+		log.Printf("❌ Recording audit %s %s: %v", action, uniqueid, err)
+		return false
+	}
+	return tag.RowsAffected() > 0
+}
+
+// clientIP — адрес клиента. X-Forwarded-For / X-Real-IP учитываются, только если
+// соединение пришло от доверенного прокси (HTTP_TRUSTED_PROXIES): иначе их подделает кто угодно.
+// В цепочке X-Forwarded-For берётся самый правый адрес, не являющийся доверенным прокси.
+func (h *RecordingHandler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !h.trustedProxy(host) {
+		return host
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(hops[i])
+			if !h.trustedProxy(ip) || i == 0 {
+				return ip
+			}
+		}
+	}
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	return host
+}
+
+func (h *RecordingHandler) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range h.Proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
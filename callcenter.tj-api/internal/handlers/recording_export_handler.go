@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"callcentrix/internal/auth"
+	"callcentrix/internal/recordings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RecordingExportHandler — выгрузка записей в ZIP по фильтру отчёта звонков.
+// Задания из recording_exports по одному выполняет Run на лидере; архив лежит на его диске,
+// поэтому скачивание в кластере проксируется лидеру.
+type RecordingExportHandler struct {
+	DB         *pgxpool.Pool
+	Recordings *recordings.Index
+	Dir        string // каталог готовых архивов
+	SignSecret string
+}
+
+const (
+	maxExportRecordings = 5000
+	exportTTL           = 24 * time.Hour // сколько архив хранится после сборки
+	exportLinkTTL       = time.Hour      // срок подписанной ссылки на скачивание
+)
+
+// =========================
+// MODELS
+// =========================
+
+type RecordingExportResponse struct {
+	ID          int64      `json:"id"`
+	Filters     CDRFilter  `json:"filters"`
+	Status      string     `json:"status"` // queued / running / done / failed / expired
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Missing     int        `json:"missing"`
+	Size        *int64     `json:"size"`
+	Error       *string    `json:"error"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	FinishedAt  *time.Time `json:"finishedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	DownloadURL *string    `json:"downloadUrl,omitempty"` // только для done, действует час
+}
+
+const recordingExportColumns = `id, filters, status, total, processed, missing, size_bytes, error, created_at, finished_at, expires_at`
+
+func scanRecordingExport(row interface{ Scan(...any) error }, e *RecordingExportResponse) error {
+	return row.Scan(&e.ID, &e.Filters, &e.Status, &e.Total, &e.Processed, &e.Missing,
+		&e.Size, &e.Error, &e.CreatedAt, &e.FinishedAt, &e.ExpiresAt)
+}
+
+// exportItem — звонок из выборки и его строка в manifest.csv
+type exportItem struct {
+	UniqueID    string
+	CallDate    time.Time
+	Src         string
+	Dst         string
+	Disposition string
+	Duration    int
+	Billsec     int
+	File        string
+	Status      string // ok / missing / error
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// CreateExport godoc
+// @Summary      Выгрузить записи звонков в ZIP
+// @Description  Фильтры — как у /api/reports/calls (в теле или в query). Архив собирается в фоне, прогресс — GET /api/recordings/exports/{id}.
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  CDRFilter  false  "Фильтры отчёта звонков"
+// @Success      202  {object}  RecordingExportResponse
+// @Router       /api/recordings/exports [post]
+func (h *RecordingExportHandler) CreateExport(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+
+	filter := cdrFilterFromQuery(r.URL.Query())
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	// Пояс фиксируется в задании: выгрузка соберётся позже, а даты в манифесте
+	// и именах файлов должны совпасть с отчётом, из которого её заказали
+	if filter.TimeZone == "" {
+		filter.TimeZone = tenantLocation(r.Context(), h.DB, user.TenantID).String()
+	}
+	loc, err := loadTimeZone(filter.TimeZone)
+	if err != nil {
+		http.Error(w, "invalid timeZone", http.StatusBadRequest)
+		return
+	}
+	for _, v := range []string{filter.DateFrom, filter.DateTo} {
+		if _, ok := parseReportTime(v, loc, false); v != "" && !ok {
+			http.Error(w, "dateFrom and dateTo must be RFC3339 or a date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var e RecordingExportResponse
+	err = scanRecordingExport(h.DB.QueryRow(r.Context(),
+		`INSERT INTO recording_exports (tenant_id, user_id, filters)
+		 VALUES ($1, $2, $3)
+		 RETURNING `+recordingExportColumns,
+		user.TenantID, user.UserID, filter), &e)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("📦 Recording export queued: id=%d tenant=%d user=%d", e.ID, user.TenantID, user.UserID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(e)
+}
+
+// GetExports godoc
+// @Summary      Выгрузки записей тенанта
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  RecordingExportResponse
+// @Router       /api/recordings/exports [get]
+func (h *RecordingExportHandler) GetExports(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+recordingExportColumns+` FROM recording_exports
+		 WHERE tenant_id=$1 ORDER BY id DESC LIMIT 50`, user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]RecordingExportResponse, 0)
+	for rows.Next() {
+		var e RecordingExportResponse
+		if err := scanRecordingExport(rows, &e); err != nil {
+			log.Printf("❌ Recording exports scan: %v", err)
+			continue
+		}
+		h.withLink(&e)
+		result = append(result, e)
+	}
+	jsonResp(w, result)
+}
+
+// GetExport godoc
+// @Summary      Статус выгрузки записей
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID выгрузки"
+// @Success      200  {object}  RecordingExportResponse
+// @Router       /api/recordings/exports/{id} [get]
+func (h *RecordingExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var e RecordingExportResponse
+	err = scanRecordingExport(h.DB.QueryRow(r.Context(),
+		`SELECT `+recordingExportColumns+` FROM recording_exports WHERE id=$1 AND tenant_id=$2`,
+		id, user.TenantID), &e)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	h.withLink(&e)
+	jsonResp(w, e)
+}
+
+// =========================
+// GET /api/recordings/exports/{id}/download?expires=...&sig=...
+// Публичный роут — проверяет HMAC подпись (как /play)
+// =========================
+func (h *RecordingExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+	expected := sign(h.SignSecret, "export:"+idStr, expires)
+	if !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(expected)) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	var status string
+	if err := h.DB.QueryRow(r.Context(),
+		`SELECT status FROM recording_exports WHERE id=$1`, id).Scan(&status); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if status != "done" {
+		http.Error(w, "export is "+status, http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(h.path(id))
+	if err != nil {
+		// Архив собирал прежний лидер или его уже удалили
+		http.Error(w, "export file is no longer available", http.StatusGone)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("recordings-%d.zip", id)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	log.Printf("📦 Recording export downloaded: id=%d", id)
+}
+
+// withLink добавляет подписанную ссылку на скачивание готового архива
+func (h *RecordingExportHandler) withLink(e *RecordingExportResponse) {
+	if e.Status != "done" {
+		return
+	}
+	expires := time.Now().Add(exportLinkTTL).Unix()
+	idStr := strconv.FormatInt(e.ID, 10)
+	url := fmt.Sprintf("/api/recordings/exports/%s/download?expires=%d&sig=%s",
+		idStr, expires, sign(h.SignSecret, "export:"+idStr, expires))
+	e.DownloadURL = &url
+}
+
+// ============================================================
+// WORKER
+// ============================================================
+
+// Run выполняет задания по одному и удаляет просроченные архивы. Только на лидере:
+// задания, прерванные сменой лидера или рестартом, возвращаются в очередь.
+func (h *RecordingExportHandler) Run(ctx context.Context) {
+	if _, err := h.DB.Exec(ctx,
+		`UPDATE recording_exports SET status='queued', processed=0, missing=0 WHERE status='running'`); err != nil {
+		log.Printf("❌ Recording exports requeue: %v", err)
+	}
+
+	poll := time.NewTicker(5 * time.Second)
+	defer poll.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			for ctx.Err() == nil && h.runNext(ctx) {
+			}
+		case <-prune.C:
+			h.prune(ctx)
+		}
+	}
+}
+
+// runNext забирает самое старое задание из очереди; false — очередь пуста
+func (h *RecordingExportHandler) runNext(ctx context.Context) bool {
+	var id int64
+	var tenantID int
+	var filter CDRFilter
+	err := h.DB.QueryRow(ctx, `
+		UPDATE recording_exports SET status='running'
+		WHERE id = (
+			SELECT id FROM recording_exports WHERE status='queued'
+			ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, tenant_id, filters`,
+	).Scan(&id, &tenantID, &filter)
+	if err != nil {
+		return false
+	}
+
+	start := time.Now()
+	size, err := h.export(ctx, id, tenantID, filter)
+	if ctx.Err() != nil {
+		return false // лидерство потеряно — задание вернётся в очередь
+	}
+	if err != nil {
+		log.Printf("❌ Recording export %d: %v", id, err)
+		h.DB.Exec(ctx, `UPDATE recording_exports SET status='failed', error=$2, finished_at=NOW() WHERE id=$1`,
+			id, err.Error())
+		return true
+	}
+	h.DB.Exec(ctx, `
+		UPDATE recording_exports SET status='done', size_bytes=$2, finished_at=NOW(), expires_at=$3
+		WHERE id=$1`, id, size, time.Now().Add(exportTTL))
+	log.Printf("📦 Recording export %d done: %d bytes (%s)", id, size, time.Since(start).Round(time.Second))
+	return true
+}
+
+// export собирает архив: recordings/<файлы> + manifest.csv. Возвращает размер архива.
+func (h *RecordingExportHandler) export(ctx context.Context, id int64, tenantID int, filter CDRFilter) (int64, error) {
+	items, err := h.exportItems(ctx, tenantID, filter)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := h.DB.Exec(ctx, `UPDATE recording_exports SET total=$2 WHERE id=$1`, id, len(items)); err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(h.Dir, 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(h.Dir, ".export-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	missing := 0
+	for i := range items {
+		it := &items[i]
+		if err := h.addRecording(ctx, zw, tenantID, it); err != nil {
+			return 0, err
+		}
+		if it.Status != "ok" {
+			missing++
+		}
+		if (i+1)%20 == 0 || i+1 == len(items) {
+			h.DB.Exec(ctx, `UPDATE recording_exports SET processed=$2, missing=$3 WHERE id=$1`, id, i+1, missing)
+		}
+	}
+	if err := writeExportManifest(zw, items); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmp.Name(), h.path(id))
+}
+
+// exportItems — звонки по фильтру отчёта, у которых может быть запись (был разговор)
+func (h *RecordingExportHandler) exportItems(ctx context.Context, tenantID int, filter CDRFilter) ([]exportItem, error) {
+	where, args := filter.where(tenantID)
+	rows, err := h.DB.Query(ctx, `
+		SELECT DISTINCT ON (c.calldate, c.uniqueid)
+			c.uniqueid, c.calldate,
+			COALESCE(c.src, ''), COALESCE(c.dst, ''), COALESCE(c.disposition, ''),
+			c.duration, c.billsec
+		FROM ast_cdr c `+where+` AND c.billsec > 0
+		ORDER BY c.calldate, c.uniqueid
+		LIMIT $`+strconv.Itoa(len(args)+1),
+		append(args, maxExportRecordings+1)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loc := filter.location()
+	var items []exportItem
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var it exportItem
+		if err := rows.Scan(&it.UniqueID, &it.CallDate, &it.Src, &it.Dst, &it.Disposition,
+			&it.Duration, &it.Billsec); err != nil {
+			return nil, err
+		}
+		if seen[it.UniqueID] {
+			continue
+		}
+		seen[it.UniqueID] = true
+		it.CallDate = it.CallDate.In(loc)
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) > maxExportRecordings {
+		return nil, fmt.Errorf("more than %d recordings match the filter, narrow it down", maxExportRecordings)
+	}
+	return items, nil
+}
+
+// addRecording кладёт файл записи в архив. Отсутствующая запись — не ошибка выгрузки,
+// она отмечается в manifest.csv; ошибкой считается только сбой записи самого архива.
+func (h *RecordingExportHandler) addRecording(ctx context.Context, zw *zip.Writer, tenantID int, it *exportItem) error {
+	// Те же правила доступа, что у RecordingHandler
+	if !recordingAccess(ctx, h.DB, it.UniqueID, tenantID) {
+		it.Status = "missing"
+		return nil
+	}
+	rec, obj, err := h.Recordings.Open(ctx, it.UniqueID, tenantID)
+	if errors.Is(err, recordings.ErrNotFound) {
+		it.Status = "missing"
+		return nil
+	}
+	if err != nil {
+		log.Printf("⚠️ Recording export %s: %v", it.UniqueID, err)
+		it.Status = "error"
+		return nil
+	}
+	defer obj.Body.Close()
+
+	it.File = fmt.Sprintf("recordings/%s_%s_%s_%s.%s", it.CallDate.Format("20060102-150405"),
+		safeFileName(it.Src), safeFileName(it.Dst), safeFileName(it.UniqueID), rec.Format)
+	// Аудио почти не сжимается — кладём без компрессии
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: it.File, Method: zip.Store, Modified: it.CallDate})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, obj.Body); err != nil {
+		return fmt.Errorf("%s: %w", it.UniqueID, err)
+	}
+	it.Status = "ok"
+	return nil
+}
+
+func writeExportManifest(zw *zip.Writer, items []exportItem) error {
+	fw, err := zw.Create("manifest.csv")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(fw)
+	cw.Write([]string{"uniqueid", "call_date", "src", "dst", "disposition", "duration", "billsec", "file", "status"})
+	for _, it := range items {
+		cw.Write([]string{
+			it.UniqueID,
+			it.CallDate.Format(time.RFC3339), // со смещением пояса выгрузки
+			it.Src,
+			it.Dst,
+			it.Disposition,
+			strconv.Itoa(it.Duration),
+			strconv.Itoa(it.Billsec),
+			it.File,
+			it.Status,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// prune помечает просроченные выгрузки expired и удаляет их архивы
+func (h *RecordingExportHandler) prune(ctx context.Context) {
+	rows, err := h.DB.Query(ctx, `
+		UPDATE recording_exports SET status='expired'
+		WHERE status='done' AND expires_at < NOW()
+		RETURNING id`)
+	if err != nil {
+		log.Printf("❌ Recording exports prune: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			os.Remove(h.path(id))
+		}
+	}
+}
+
+func (h *RecordingExportHandler) path(id int64) string {
+	return filepath.Join(h.Dir, fmt.Sprintf("%d.zip", id))
+}
+
+// safeFileName оставляет в имени файла архива только безопасные символы
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '+', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+}
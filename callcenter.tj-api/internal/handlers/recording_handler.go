@@ -1,32 +1,40 @@
 package handlers
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
 	"callcentrix/internal/auth"
+	"callcentrix/internal/recordings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type RecordingHandler struct {
-	DB              *pgxpool.Pool
-	AsteriskBaseURL string // http://172.20.40.2:8088/recordings
-	SignSecret      string
+	DB         *pgxpool.Pool
+	Recordings *recordings.Index      // индекс + хранилища (fs / http / s3)
+	Transcoder *recordings.Transcoder // nil — ?format и peaks недоступны
+	SignSecret string
+	PublicBase string         // для внешних ссылок, например "https://cc.example.com"
+	Proxies    []netip.Prefix // доверенные прокси для адреса клиента в аудите
 }
 
 // =========================
-// GET /api/recordings/{uniqueid}
-// Проксирует файл с Asterisk сервера — только для своего тенанта
+// GET /api/recordings/{uniqueid}[?format=mp3|opus]
+// Отдаёт файл из хранилища записей — только для своего тенанта.
+// Поддерживает Range (206) для перемотки в плеере.
 // =========================
 func (h *RecordingHandler) Stream(w http.ResponseWriter, r *http.Request) {
 	user := auth.FromContext(r.Context())
@@ -38,31 +46,10 @@ func (h *RecordingHandler) Stream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ищем файл на Asterisk сервере перебирая расширения
-	for _, ext := range []string{".wav", ".mp3", ".gsm", ".ogg"} {
-		fileURL := h.AsteriskBaseURL + "/" + uniqueid + ext
-		resp, err := http.Get(fileURL)
-		if err != nil || resp.StatusCode != 200 {
-			if resp != nil {
-				resp.Body.Close()
-			}
-			continue
-		}
-		defer resp.Body.Close()
-
-		// Передаём заголовки
-		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
-		w.Header().Set("Content-Length", resp.Header.Get("Content-Length"))
-		w.Header().Set("Accept-Ranges", "bytes")
-		w.Header().Set("Cache-Control", "no-store")
-		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s%s"`, uniqueid, ext))
-
-		log.Printf("🎵 Recording proxied: %s%s → user=%d tenant=%d", uniqueid, ext, user.UserID, user.TenantID)
-		io.Copy(w, resp.Body)
-		return
+	rec, ok := h.serve(w, r, uniqueid, user.TenantID)
+	if ok && h.auditListen(r, auditStream, uniqueid, user.UserID, user.TenantID) {
+		log.Printf("🎵 Recording streamed: %s (%s) → user=%d tenant=%d", rec.FileName(), rec.Backend, user.UserID, user.TenantID)
 	}
-
-	http.Error(w, "recording not found", http.StatusNotFound)
 }
 
 // =========================
@@ -78,17 +65,67 @@ func (h *RecordingHandler) GetSignedLink(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// В подпись входит пользователь — воспроизведение по ссылке попадёт в аудит от его имени
 	expires := time.Now().Add(15 * time.Minute).Unix()
-	sig := sign(h.SignSecret, uniqueid, expires)
+	sig := sign(h.SignSecret, playSubject(uniqueid, user.UserID), expires)
+	h.audit(r, auditLink, uniqueid, user.UserID, user.TenantID, 0)
 
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"url":"/api/recordings/%s/play?expires=%d&sig=%s"}`,
-		uniqueid, expires, sig)
+	fmt.Fprintf(w, `{"url":"/api/recordings/%s/play?expires=%d&u=%d&sig=%s"}`,
+		uniqueid, expires, user.UserID, sig)
 }
 
 // =========================
-// GET /api/recordings/{uniqueid}/play?expires=...&sig=...
-// Публичный роут для <audio src> — проверяет HMAC подпись
+// GET /api/recordings/{uniqueid}/peaks?count=800
+// Waveform для плеера (кэшируется вместе с транскодами)
+// =========================
+func (h *RecordingHandler) GetPeaks(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	uniqueid := chi.URLParam(r, "uniqueid")
+
+	if !h.checkAccess(r, uniqueid, user.TenantID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if h.Transcoder == nil {
+		http.Error(w, "waveform generation is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	count := 800
+	if c, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil {
+		count = c
+	}
+	if count < 10 || count > 4000 {
+		http.Error(w, "count must be between 10 and 4000", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := h.Recordings.Lookup(r.Context(), uniqueid, user.TenantID)
+	if errors.Is(err, recordings.ErrNotFound) {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	peaks, err := h.Transcoder.Peaks(r.Context(), rec, count)
+	if err != nil {
+		log.Printf("❌ Recording peaks %s: %v", uniqueid, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	jsonResp(w, peaks)
+}
+
+// =========================
+// GET /api/recordings/{uniqueid}/play?expires=...&sig=...[&format=mp3|opus]
+// Публичный роут для <audio src> — проверяет HMAC подпись.
+// С ?share=<id> — внешняя ссылка: дополнительно проверяется её состояние в БД,
+// пароль — Basic auth или POST с полем password.
 // =========================
 func (h *RecordingHandler) PlaySigned(w http.ResponseWriter, r *http.Request) {
 	uniqueid := chi.URLParam(r, "uniqueid")
@@ -101,53 +138,125 @@ func (h *RecordingHandler) PlaySigned(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expected := sign(h.SignSecret, uniqueid, expires)
-	if !hmac.Equal([]byte(sig), []byte(expected)) {
-		http.Error(w, "invalid signature", http.StatusForbidden)
+	if share := r.URL.Query().Get("share"); share != "" {
+		h.playShared(w, r, uniqueid, share, expires, sig)
 		return
 	}
 
-	for _, ext := range []string{".wav", ".mp3", ".gsm", ".ogg"} {
-		fileURL := h.AsteriskBaseURL + "/" + uniqueid + ext
-		resp, err := http.Get(fileURL)
-		if err != nil || resp.StatusCode != 200 {
-			if resp != nil {
-				resp.Body.Close()
-			}
-			continue
-		}
-		defer resp.Body.Close()
-
-		ct := resp.Header.Get("Content-Type")
-		if ct == "" {
-			ct = contentTypeByExt(ext)
-		}
-		w.Header().Set("Content-Type", ct)
-		w.Header().Set("Cache-Control", "no-store")
-		io.Copy(w, resp.Body)
+	userID, err := strconv.Atoi(r.URL.Query().Get("u"))
+	if err != nil {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	expected := sign(h.SignSecret, playSubject(uniqueid, userID), expires)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
 		return
 	}
 
-	http.Error(w, "file not found", http.StatusNotFound)
+	if _, ok := h.serve(w, r, uniqueid, 0); ok {
+		h.auditListen(r, auditPlay, uniqueid, userID, 0)
+	}
 }
 
 // =========================
 // HELPERS
 // =========================
 
+// serve находит запись через индекс и отдаёт её с поддержкой Range.
+// ?format=mp3|opus — перекодированная копия из кэша транскодера.
+func (h *RecordingHandler) serve(w http.ResponseWriter, r *http.Request, uniqueid string, tenantID int) (*recordings.Recording, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return h.serveTranscoded(w, r, uniqueid, tenantID, format)
+	}
+
+	rec, reader, err := h.Recordings.Reader(r.Context(), uniqueid, tenantID)
+	if !h.recordingError(w, uniqueid, err) {
+		return nil, false
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", rec.ContentType())
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, rec.FileName()))
+	http.ServeContent(w, r, rec.FileName(), rec.CreatedAt, reader)
+	return rec, true
+}
+
+func (h *RecordingHandler) serveTranscoded(w http.ResponseWriter, r *http.Request, uniqueid string, tenantID int, format string) (*recordings.Recording, bool) {
+	if h.Transcoder == nil {
+		http.Error(w, "transcoding is disabled", http.StatusNotImplemented)
+		return nil, false
+	}
+
+	rec, err := h.Recordings.Lookup(r.Context(), uniqueid, tenantID)
+	if !h.recordingError(w, uniqueid, err) {
+		return nil, false
+	}
+
+	path, contentType, err := h.Transcoder.Transcode(r.Context(), rec, format)
+	if errors.Is(err, recordings.ErrUnsupportedFormat) {
+		http.Error(w, "format must be mp3 or opus", http.StatusBadRequest)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Recording transcode %s: %v", uniqueid, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	name := uniqueid + filepath.Ext(path)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, name))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	return rec, true
+}
+
+// recordingError пишет ответ для ошибки поиска записи; true — ошибки нет
+func (h *RecordingHandler) recordingError(w http.ResponseWriter, uniqueid string, err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, recordings.ErrNotFound) {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return false
+	}
+	log.Printf("❌ Recording %s: %v", uniqueid, err)
+	http.Error(w, err.Error(), http.StatusBadGateway)
+	return false
+}
+
 func (h *RecordingHandler) checkAccess(r *http.Request, uniqueid string, tenantID int) bool {
-	var count int
-	err := h.DB.QueryRow(r.Context(), `
-		SELECT COUNT(*) FROM ast_cdr
-		WHERE uniqueid = $1
-		AND (
-			EXISTS (SELECT 1 FROM users WHERE sipno::text = src AND tenant_id = $2)
-			OR
-			EXISTS (SELECT 1 FROM users WHERE sipno::text = dst AND tenant_id = $2)
-		)`,
+	return recordingAccess(r.Context(), h.DB, uniqueid, tenantID)
+}
+
+// recordingAccess — звонок принадлежит тенанту, если хотя бы одна его строка CDR
+// записана за тенантом (ast_cdr.tenant_id)
+func recordingAccess(ctx context.Context, db *pgxpool.Pool, uniqueid string, tenantID int) bool {
+	var ok bool
+	err := db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM ast_cdr WHERE uniqueid = $1 AND tenant_id = $2)`,
 		uniqueid, tenantID,
-	).Scan(&count)
-	return err == nil && count > 0
+	).Scan(&ok)
+	return err == nil && ok
+}
+
+// playSubject — что подписывает ссылка /play: запись и выпустивший её пользователь
+func playSubject(uniqueid string, userID int) string {
+	return uniqueid + ":" + strconv.Itoa(userID)
 }
 
 func sign(secret, uniqueid string, expires int64) string {
@@ -155,16 +264,3 @@ func sign(secret, uniqueid string, expires int64) string {
 	h.Write([]byte(fmt.Sprintf("%s:%d", uniqueid, expires)))
 	return hex.EncodeToString(h.Sum(nil))
 }
-
-func contentTypeByExt(ext string) string {
-	switch strings.ToLower(ext) {
-	case ".mp3":
-		return "audio/mpeg"
-	case ".ogg":
-		return "audio/ogg"
-	case ".gsm":
-		return "audio/x-gsm"
-	default:
-		return "audio/wav"
-	}
-}
\ No newline at end of file
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"callcentrix/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultShareHours = 72
+	maxShareHours     = 24 * 90
+
+	// Сколько живёт токен докачки одного скачивания (перемотка, пауза в плеере)
+	shareContinuationTTL = 2 * time.Hour
+)
+
+// =========================
+// MODELS
+// =========================
+
+type RecordingShareRequest struct {
+	ExpiresInHours int     `json:"expiresInHours"` // по умолчанию 72, максимум 90 дней
+	MaxDownloads   *int    `json:"maxDownloads"`   // nil — без ограничения
+	Password       string  `json:"password"`       // пусто — без пароля
+	Note           *string `json:"note"`
+}
+
+type RecordingShareResponse struct {
+	ID           int64      `json:"id"`
+	UniqueID     string     `json:"uniqueid"`
+	Note         *string    `json:"note"`
+	HasPassword  bool       `json:"hasPassword"`
+	MaxDownloads *int       `json:"maxDownloads"`
+	Downloads    int        `json:"downloads"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	CreatedBy    int        `json:"createdBy"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastAccessAt *time.Time `json:"lastAccessAt"`
+	RevokedAt    *time.Time `json:"revokedAt"`
+	Active       bool       `json:"active"`
+	URL          string     `json:"url"`
+}
+
+const recordingShareColumns = `id, uniqueid, note, password_hash IS NOT NULL, max_downloads, downloads,
+	expires_at, created_by, created_at, last_access_at, revoked_at`
+
+func (h *RecordingHandler) scanShare(row interface{ Scan(...any) error }, s *RecordingShareResponse) error {
+	err := row.Scan(&s.ID, &s.UniqueID, &s.Note, &s.HasPassword, &s.MaxDownloads, &s.Downloads,
+		&s.ExpiresAt, &s.CreatedBy, &s.CreatedAt, &s.LastAccessAt, &s.RevokedAt)
+	if err != nil {
+		return err
+	}
+	s.Active = s.RevokedAt == nil && time.Now().Before(s.ExpiresAt) &&
+		(s.MaxDownloads == nil || s.Downloads < *s.MaxDownloads)
+	s.URL = h.shareURL(s.UniqueID, s.ID, s.ExpiresAt)
+	return nil
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// CreateShare godoc
+// @Summary      Внешняя ссылка на запись (только admin)
+// @Description  Ссылка для третьих лиц: срок действия, лимит скачиваний, пароль (HTTP Basic, любой логин). Отзывается DELETE /api/recordings/shares/{id}.
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        uniqueid  path  string                 true  "uniqueid звонка"
+// @Param        body      body  RecordingShareRequest  true  "Параметры ссылки"
+// @Success      201  {object}  RecordingShareResponse
+// @Router       /api/recordings/{uniqueid}/shares [post]
+func (h *RecordingHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	uniqueid := chi.URLParam(r, "uniqueid")
+	if !h.checkAccess(r, uniqueid, user.TenantID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	var req RecordingShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultShareHours
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > maxShareHours {
+		http.Error(w, fmt.Sprintf("expiresInHours must be between 1 and %d", maxShareHours), http.StatusBadRequest)
+		return
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 1 {
+		http.Error(w, "maxDownloads must be positive", http.StatusBadRequest)
+		return
+	}
+	var passwordHash *string
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s := string(hash)
+		passwordHash = &s
+	}
+
+	// Секунды отбрасываем: expires в подписи ссылки — Unix-время без дробной части
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour).Truncate(time.Second)
+
+	var s RecordingShareResponse
+	err := h.scanShare(h.DB.QueryRow(r.Context(), `
+		INSERT INTO recording_shares (tenant_id, uniqueid, note, password_hash, max_downloads, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+recordingShareColumns,
+		user.TenantID, uniqueid, req.Note, passwordHash, req.MaxDownloads, expiresAt, user.UserID), &s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, auditShareCreate, uniqueid, user.UserID, user.TenantID, s.ID)
+	log.Printf("🔗 Recording share created: id=%d %s tenant=%d by user=%d until %s",
+		s.ID, uniqueid, user.TenantID, user.UserID, expiresAt.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// GetShares godoc
+// @Summary      Внешние ссылки на записи тенанта (только admin)
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Produce      json
+// @Param        uniqueid  query  string  false  "Только по этой записи"
+// @Param        active    query  bool    false  "Только действующие"
+// @Success      200  {array}  RecordingShareResponse
+// @Router       /api/recordings/shares [get]
+func (h *RecordingHandler) GetShares(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+
+	where := `WHERE tenant_id = $1`
+	args := []any{user.TenantID}
+	if v := q.Get("uniqueid"); v != "" {
+		where += ` AND uniqueid = $2`
+		args = append(args, v)
+	}
+	if q.Get("active") == "true" {
+		where += ` AND revoked_at IS NULL AND expires_at > NOW()
+			AND (max_downloads IS NULL OR downloads < max_downloads)`
+	}
+
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+recordingShareColumns+` FROM recording_shares `+where+` ORDER BY created_at DESC LIMIT 500`,
+		args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]RecordingShareResponse, 0)
+	for rows.Next() {
+		var s RecordingShareResponse
+		if err := h.scanShare(rows, &s); err != nil {
+			log.Printf("❌ Recording shares scan: %v", err)
+			continue
+		}
+		result = append(result, s)
+	}
+	jsonResp(w, result)
+}
+
+// RevokeShare godoc
+// @Summary      Отозвать внешнюю ссылку (только admin)
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Param        id  path  int  true  "ID ссылки"
+// @Success      204  "No Content"
+// @Router       /api/recordings/shares/{id} [delete]
+func (h *RecordingHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var uniqueid string
+	err = h.DB.QueryRow(r.Context(), `
+		UPDATE recording_shares SET revoked_at = NOW(), revoked_by = $3
+		WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL
+		RETURNING uniqueid`,
+		id, user.TenantID, user.UserID).Scan(&uniqueid)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	h.audit(r, auditShareRevoke, uniqueid, user.UserID, user.TenantID, int64(id))
+	log.Printf("🔗 Recording share revoked: id=%d %s by user=%d", id, uniqueid, user.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// =========================
+// PLAYBACK
+// =========================
+
+// playShared — /play по внешней ссылке. HMAC защищает от подделки параметров,
+// а отзыв, срок, лимит скачиваний и пароль проверяются по recording_shares.
+func (h *RecordingHandler) playShared(w http.ResponseWriter, r *http.Request, uniqueid, shareStr string, expires int64, sig string) {
+	shareID, err := strconv.ParseInt(shareStr, 10, 64)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(sign(h.SignSecret, shareSubject(uniqueid, shareID), expires))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	var (
+		tenantID, createdBy int
+		passwordHash        *string
+		expiresAt           time.Time
+		revokedAt           *time.Time
+	)
+	err = h.DB.QueryRow(r.Context(), `
+		SELECT tenant_id, created_by, password_hash, expires_at, revoked_at
+		FROM recording_shares WHERE id = $1 AND uniqueid = $2`,
+		shareID, uniqueid,
+	).Scan(&tenantID, &createdBy, &passwordHash, &expiresAt, &revokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case revokedAt != nil:
+		http.Error(w, "link revoked", http.StatusGone)
+		return
+	case time.Now().After(expiresAt):
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+
+	// Докачка Range уже засчитанного скачивания — по токену, выданному при его начале.
+	// Без токена любой запрос (с Range или без) считается новым скачиванием.
+	if h.shareContinuation(r, uniqueid, shareID) {
+		h.serve(w, r, uniqueid, tenantID)
+		return
+	}
+
+	if passwordHash != nil {
+		// Пароль — только в Basic auth или в теле POST, не в URL (логи прокси, история браузера)
+		_, password, ok := r.BasicAuth()
+		if !ok && r.Method == http.MethodPost {
+			password = r.PostFormValue("password")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(*passwordHash), []byte(password)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Recording", charset="UTF-8"`)
+			http.Error(w, "password required", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `
+		UPDATE recording_shares SET downloads = downloads + 1, last_access_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		AND (max_downloads IS NULL OR downloads < max_downloads)`, shareID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "download limit reached", http.StatusGone)
+		return
+	}
+	h.setShareContinuation(w, uniqueid, shareID, expiresAt)
+
+	if _, ok := h.serve(w, r, uniqueid, tenantID); ok {
+		h.audit(r, auditSharePlay, uniqueid, createdBy, tenantID, shareID)
+		log.Printf("🔗 Recording share played: id=%d %s from %s", shareID, uniqueid, h.clientIP(r))
+	}
+}
+
+// setShareContinuation выдаёт засчитанному скачиванию короткоживущий токен (cookie):
+// с ним Range-запросы плеера докачивают запись без повторного счёта и пароля
+func (h *RecordingHandler) setShareContinuation(w http.ResponseWriter, uniqueid string, shareID int64, shareExpiresAt time.Time) {
+	expires := time.Now().Add(shareContinuationTTL)
+	if shareExpiresAt.Before(expires) {
+		expires = shareExpiresAt
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     shareCookieName(shareID),
+		Value:    fmt.Sprintf("%d.%s", expires.Unix(), sign(h.SignSecret, shareContinuationSubject(uniqueid, shareID), expires.Unix())),
+		Path:     "/api/recordings/" + uniqueid + "/play",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.PublicBase, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// shareContinuation — запрос несёт действующий токен засчитанного скачивания этой ссылки
+func (h *RecordingHandler) shareContinuation(r *http.Request, uniqueid string, shareID int64) bool {
+	c, err := r.Cookie(shareCookieName(shareID))
+	if err != nil {
+		return false
+	}
+	expiresStr, sig, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(sign(h.SignSecret, shareContinuationSubject(uniqueid, shareID), expires)))
+}
+
+func shareCookieName(shareID int64) string {
+	return "rs_" + strconv.FormatInt(shareID, 10)
+}
+
+// shareContinuationSubject — что подписывает токен докачки (не пересекается со ссылками)
+func shareContinuationSubject(uniqueid string, shareID int64) string {
+	return fmt.Sprintf("share-cont:%s:%d", uniqueid, shareID)
+}
+
+// shareURL — абсолютная ссылка для передачи третьим лицам
+func (h *RecordingHandler) shareURL(uniqueid string, shareID int64, expiresAt time.Time) string {
+	expires := expiresAt.Unix()
+	return fmt.Sprintf("%s/api/recordings/%s/play?share=%d&expires=%d&sig=%s",
+		h.PublicBase, uniqueid, shareID, expires, sign(h.SignSecret, shareSubject(uniqueid, shareID), expires))
+}
+
+// shareSubject — что подписывает внешняя ссылка (не пересекается с playSubject)
+func shareSubject(uniqueid string, shareID int64) string {
+	return fmt.Sprintf("share:%s:%d", uniqueid, shareID)
+}
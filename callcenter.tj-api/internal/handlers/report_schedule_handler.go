@@ -0,0 +1,785 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"callcentrix/internal/auth"
+	"callcentrix/internal/cron"
+	"callcentrix/internal/mailer"
+	"callcentrix/internal/pdf"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReportScheduleHandler — рассылка отчётов на почту по расписанию.
+// Отчёт строят те же хендлеры, что отдают его в API (внутренний запрос от имени
+// автора расписания), и он уходит вложением CSV или PDF. Расписания выполняет
+// Run на лидере; «отправить сейчас» работает на любом инстансе.
+type ReportScheduleHandler struct {
+	DB      *pgxpool.Pool
+	CDR     *CDRHandler
+	Mailer  mailer.Sender // nil — SMTP не настроен, рассылка выключена
+	PDFFont *pdf.Font     // nil — встроенный Helvetica без кириллицы
+}
+
+const maxReportRecipients = 20
+
+// =========================
+// MODELS
+// =========================
+
+type ReportScheduleRequest struct {
+	Name       string   `json:"name"`
+	Report     string   `json:"report"`   // calls-summary / agents / calls
+	Format     string   `json:"format"`   // csv / pdf; calls — только csv
+	Cron       string   `json:"cron"`     // "0 8 * * *", "@weekly", …
+	Timezone   string   `json:"timezone"` // IANA, по умолчанию — пояс компании
+	Period     string   `json:"period"`   // day / week / month — предыдущий полный период
+	Recipients []string `json:"recipients"`
+	Active     *bool    `json:"active"`
+}
+
+type ReportSchedule struct {
+	ID         int        `json:"id"`
+	TenantID   int        `json:"-"`
+	Name       string     `json:"name"`
+	Report     string     `json:"report"`
+	Format     string     `json:"format"`
+	Cron       string     `json:"cron"`
+	Timezone   string     `json:"timezone"`
+	Period     string     `json:"period"`
+	Recipients []string   `json:"recipients"`
+	Active     bool       `json:"active"`
+	NextRunAt  *time.Time `json:"nextRunAt"`
+	LastRunAt  *time.Time `json:"lastRunAt"`
+	CreatedBy  int        `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+const reportScheduleColumns = `id, tenant_id, name, report, format, cron, timezone, period, recipients, active,
+	next_run_at, last_run_at, created_by, created_at`
+
+func scanReportSchedule(row interface{ Scan(...any) error }, s *ReportSchedule) error {
+	return row.Scan(&s.ID, &s.TenantID, &s.Name, &s.Report, &s.Format, &s.Cron, &s.Timezone, &s.Period,
+		&s.Recipients, &s.Active, &s.NextRunAt, &s.LastRunAt, &s.CreatedBy, &s.CreatedAt)
+}
+
+type ReportDelivery struct {
+	ID         int64     `json:"id"`
+	ScheduleID *int      `json:"scheduleId"` // NULL — расписание удалено
+	Trigger    string    `json:"trigger"`    // schedule / manual
+	Status     string    `json:"status"`     // sent / failed
+	Recipients []string  `json:"recipients"`
+	PeriodFrom time.Time `json:"periodFrom"`
+	PeriodTo   time.Time `json:"periodTo"`
+	FileName   *string   `json:"fileName"`
+	Size       *int      `json:"size"`
+	Error      *string   `json:"error"`
+	CreatedBy  *int      `json:"createdBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+const reportDeliveryColumns = `id, schedule_id, trigger, status, recipients, period_from, period_to,
+	file_name, size_bytes, error, created_by, created_at`
+
+func scanReportDelivery(row interface{ Scan(...any) error }, d *ReportDelivery) error {
+	return row.Scan(&d.ID, &d.ScheduleID, &d.Trigger, &d.Status, &d.Recipients, &d.PeriodFrom, &d.PeriodTo,
+		&d.FileName, &d.Size, &d.Error, &d.CreatedBy, &d.CreatedAt)
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// GetReportSchedules godoc
+// @Summary      Расписания рассылки отчётов
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  ReportSchedule
+// @Router       /api/reports/schedules [get]
+func (h *ReportScheduleHandler) GetReportSchedules(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+reportScheduleColumns+` FROM report_schedules WHERE tenant_id=$1 ORDER BY name`,
+		user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]ReportSchedule, 0)
+	for rows.Next() {
+		var s ReportSchedule
+		if err := scanReportSchedule(rows, &s); err != nil {
+			log.Printf("❌ Report schedules scan: %v", err)
+			continue
+		}
+		result = append(result, s)
+	}
+	jsonResp(w, result)
+}
+
+// CreateReportSchedule godoc
+// @Summary      Создать расписание рассылки отчёта
+// @Description  report: calls-summary (сводка звонков по дням, направлениям и агентам), agents (показатели агентов), calls (список звонков, только csv). cron — 5 полей или @daily / @weekly / @monthly в поясе timezone. В письме — отчёт за предыдущий полный period (day / week / month).
+// @Tags         Reports
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  ReportScheduleRequest  true  "Расписание"
+// @Success      201  {object}  ReportSchedule
+// @Router       /api/reports/schedules [post]
+func (h *ReportScheduleHandler) CreateReportSchedule(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var req ReportScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Timezone == "" {
+		req.Timezone = tenantLocation(r.Context(), h.DB, user.TenantID).String()
+	}
+	next, err := normalizeReportSchedule(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var s ReportSchedule
+	err = scanReportSchedule(h.DB.QueryRow(r.Context(), `
+		INSERT INTO report_schedules
+			(tenant_id, name, report, format, cron, timezone, period, recipients, active, next_run_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+reportScheduleColumns,
+		user.TenantID, req.Name, req.Report, req.Format, req.Cron, req.Timezone, req.Period,
+		req.Recipients, *req.Active, next, user.UserID), &s)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "schedule with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("📝 Report schedule created: id=%d %q (%s %s, %s) tenant=%d", s.ID, s.Name, s.Report, s.Format, s.Cron, user.TenantID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// UpdateReportSchedule godoc
+// @Summary      Изменить расписание рассылки отчёта
+// @Description  Полная замена полей; следующий запуск пересчитывается от текущего момента
+// @Tags         Reports
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                    true  "ID расписания"
+// @Param        body  body  ReportScheduleRequest  true  "Расписание"
+// @Success      200  {object}  ReportSchedule
+// @Router       /api/reports/schedules/{id} [put]
+func (h *ReportScheduleHandler) UpdateReportSchedule(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req ReportScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Timezone == "" {
+		req.Timezone = tenantLocation(r.Context(), h.DB, user.TenantID).String()
+	}
+	next, err := normalizeReportSchedule(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var s ReportSchedule
+	err = scanReportSchedule(h.DB.QueryRow(r.Context(), `
+		UPDATE report_schedules SET
+			name=$3, report=$4, format=$5, cron=$6, timezone=$7, period=$8, recipients=$9,
+			active=$10, next_run_at=$11, updated_at=NOW()
+		WHERE id=$1 AND tenant_id=$2
+		RETURNING `+reportScheduleColumns,
+		id, user.TenantID, req.Name, req.Report, req.Format, req.Cron, req.Timezone, req.Period,
+		req.Recipients, *req.Active, next), &s)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "schedule with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	jsonResp(w, s)
+}
+
+// DeleteReportSchedule godoc
+// @Summary      Удалить расписание рассылки отчёта
+// @Description  История отправок сохраняется
+// @Tags         Reports
+// @Security     BearerAuth
+// @Param        id  path  int  true  "ID расписания"
+// @Success      204
+// @Router       /api/reports/schedules/{id} [delete]
+func (h *ReportScheduleHandler) DeleteReportSchedule(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM report_schedules WHERE id=$1 AND tenant_id=$2`, id, user.TenantID)
+	if err != nil || tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendReportNow godoc
+// @Summary      Отправить отчёт по расписанию сейчас
+// @Description  Строит отчёт за предыдущий полный период относительно текущего момента и отправляет получателям расписания. Синхронно; результат — запись истории отправок (при ошибке SMTP — 502 с той же записью).
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "ID расписания"
+// @Success      200  {object}  ReportDelivery
+// @Failure      502  {object}  ReportDelivery
+// @Failure      503  {string}  string  "smtp is not configured"
+// @Router       /api/reports/schedules/{id}/send [post]
+func (h *ReportScheduleHandler) SendReportNow(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if h.Mailer == nil {
+		http.Error(w, "smtp is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var s ReportSchedule
+	err = scanReportSchedule(h.DB.QueryRow(r.Context(),
+		`SELECT `+reportScheduleColumns+` FROM report_schedules WHERE id=$1 AND tenant_id=$2`,
+		id, user.TenantID), &s)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	d := h.deliver(r.Context(), &s, time.Now(), "manual", &user.UserID)
+	w.Header().Set("Content-Type", "application/json")
+	if d.Status != "sent" {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(d)
+}
+
+// GetReportDeliveries godoc
+// @Summary      История отправок отчётов
+// @Tags         Reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        scheduleId  query  int  false  "Только это расписание"
+// @Success      200  {array}  ReportDelivery
+// @Router       /api/reports/deliveries [get]
+func (h *ReportScheduleHandler) GetReportDeliveries(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	where := `WHERE tenant_id=$1`
+	args := []any{user.TenantID}
+	if v, err := strconv.Atoi(r.URL.Query().Get("scheduleId")); err == nil {
+		where += ` AND schedule_id=$2`
+		args = append(args, v)
+	}
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+reportDeliveryColumns+` FROM report_deliveries `+where+` ORDER BY id DESC LIMIT 100`,
+		args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]ReportDelivery, 0)
+	for rows.Next() {
+		var d ReportDelivery
+		if err := scanReportDelivery(rows, &d); err != nil {
+			log.Printf("❌ Report deliveries scan: %v", err)
+			continue
+		}
+		result = append(result, d)
+	}
+	jsonResp(w, result)
+}
+
+// normalizeReportSchedule проверяет запрос, проставляет значения по умолчанию
+// и возвращает следующий запуск (nil — расписание выключено)
+func normalizeReportSchedule(req *ReportScheduleRequest) (*time.Time, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	switch req.Report {
+	case "calls-summary", "agents":
+		if req.Format == "" {
+			req.Format = "pdf"
+		}
+		if req.Format != "pdf" && req.Format != "csv" {
+			return nil, errors.New("format must be csv or pdf")
+		}
+	case "calls":
+		if req.Format == "" {
+			req.Format = "csv"
+		}
+		if req.Format != "csv" {
+			return nil, errors.New("calls report is csv only")
+		}
+	default:
+		return nil, errors.New("report must be calls-summary, agents or calls")
+	}
+	switch req.Period {
+	case "":
+		req.Period = "day"
+	case "day", "week", "month":
+	default:
+		return nil, errors.New("period must be day, week or month")
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(req.Timezone)
+	if err != nil {
+		return nil, errors.New("invalid timezone")
+	}
+	sched, err := cron.Parse(req.Cron)
+	if err != nil {
+		return nil, err
+	}
+	req.Cron = strings.TrimSpace(req.Cron)
+
+	if len(req.Recipients) == 0 || len(req.Recipients) > maxReportRecipients {
+		return nil, fmt.Errorf("recipients: 1 to %d addresses", maxReportRecipients)
+	}
+	seen := make(map[string]bool)
+	recipients := make([]string, 0, len(req.Recipients))
+	for _, v := range req.Recipients {
+		addr, err := mail.ParseAddress(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient: %s", v)
+		}
+		if key := strings.ToLower(addr.Address); !seen[key] {
+			seen[key] = true
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	req.Recipients = recipients
+
+	if req.Active == nil {
+		active := true
+		req.Active = &active
+	}
+	if !*req.Active {
+		return nil, nil
+	}
+	next := sched.Next(time.Now().In(loc))
+	if next.IsZero() {
+		return nil, errors.New("cron expression never fires")
+	}
+	return &next, nil
+}
+
+// ============================================================
+// SCHEDULER
+// ============================================================
+
+// Run отправляет отчёты по наступившим расписаниям. Только на лидере.
+// Следующий запуск сдвигается до отправки: при падении посреди отправки
+// отчёт не уйдёт повторно (в истории его просто не будет). Пропущенные
+// за время простоя запуски не догоняются — отправляется один, за последний период.
+func (h *ReportScheduleHandler) Run(ctx context.Context) {
+	t := time.NewTicker(30 * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			for ctx.Err() == nil && h.runDue(ctx) {
+			}
+		}
+	}
+}
+
+// runDue забирает одно наступившее расписание; false — таких нет
+func (h *ReportScheduleHandler) runDue(ctx context.Context) bool {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return false
+	}
+	defer tx.Rollback(ctx)
+
+	var s ReportSchedule
+	err = scanReportSchedule(tx.QueryRow(ctx, `
+		SELECT `+reportScheduleColumns+` FROM report_schedules
+		WHERE active AND next_run_at <= NOW()
+		ORDER BY next_run_at LIMIT 1 FOR UPDATE SKIP LOCKED`), &s)
+	if err != nil {
+		return false
+	}
+	at := *s.NextRunAt
+
+	var next *time.Time
+	if sched, err := cron.Parse(s.Cron); err == nil {
+		if n := sched.Next(time.Now().In(scheduleLocation(&s))); !n.IsZero() {
+			next = &n
+		}
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE report_schedules SET next_run_at=$2, last_run_at=NOW() WHERE id=$1`, s.ID, next); err != nil {
+		log.Printf("❌ Report schedule %d: %v", s.ID, err)
+		return false
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false
+	}
+
+	h.deliver(ctx, &s, at, "schedule", nil)
+	return true
+}
+
+// deliver строит отчёт за период, предшествующий at, отправляет его и пишет историю
+func (h *ReportScheduleHandler) deliver(ctx context.Context, s *ReportSchedule, at time.Time, trigger string, by *int) ReportDelivery {
+	loc := scheduleLocation(s)
+	from, to := reportPeriod(s.Period, at.In(loc))
+	start := time.Now()
+
+	d := ReportDelivery{Status: "sent"}
+	att, err := h.render(ctx, s, from, to)
+	if err == nil {
+		d.FileName, d.Size = &att.Name, new(int)
+		*d.Size = len(att.Data)
+		err = h.send(ctx, s, att, from, to)
+	}
+	if err != nil {
+		d.Status = "failed"
+		msg := err.Error()
+		d.Error = &msg
+		log.Printf("❌ Report %q (schedule=%d tenant=%d): %v", s.Name, s.ID, s.TenantID, err)
+	} else {
+		log.Printf("📤 Report %q sent to %d recipients: %s, %d bytes (%s)",
+			s.Name, len(s.Recipients), att.Name, len(att.Data), time.Since(start).Round(time.Millisecond))
+	}
+
+	// История пишется и когда запрос уже отменён (отправка могла пройти)
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	err = scanReportDelivery(h.DB.QueryRow(saveCtx, `
+		INSERT INTO report_deliveries
+			(tenant_id, schedule_id, trigger, status, recipients, period_from, period_to, file_name, size_bytes, error, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+reportDeliveryColumns,
+		s.TenantID, s.ID, trigger, d.Status, s.Recipients, from, to, d.FileName, d.Size, d.Error, by), &d)
+	if err != nil {
+		log.Printf("❌ Report delivery save (schedule=%d): %v", s.ID, err)
+	}
+	return d
+}
+
+// send отправляет готовый отчёт получателям расписания
+func (h *ReportScheduleHandler) send(ctx context.Context, s *ReportSchedule, att mailer.Attachment, from, to time.Time) error {
+	return h.Mailer.Send(ctx, mailer.Message{
+		To:      s.Recipients,
+		Subject: "CallCentrix: " + s.Name + " — " + periodLabel(from, to),
+		Body: fmt.Sprintf("Отчёт «%s» за %s (%s).\r\n\r\nПисьмо отправлено автоматически по расписанию %q.\r\n",
+			s.Name, periodLabel(from, to), from.Location(), s.Cron),
+		Attachments: []mailer.Attachment{att},
+	})
+}
+
+func scheduleLocation(s *ReportSchedule) *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// reportPeriod — предыдущий полный день / неделя (с понедельника) / месяц до at в его поясе
+func reportPeriod(period string, at time.Time) (time.Time, time.Time) {
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	switch period {
+	case "week":
+		to := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return to.AddDate(0, 0, -7), to
+	case "month":
+		to := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, at.Location())
+		return to.AddDate(0, -1, 0), to
+	default:
+		return day.AddDate(0, 0, -1), day
+	}
+}
+
+// periodLabel — «18.10.2026» или «12.10.2026 – 18.10.2026» (to не входит в период)
+func periodLabel(from, to time.Time) string {
+	last := to.AddDate(0, 0, -1)
+	if !last.After(from) {
+		return from.Format("02.01.2006")
+	}
+	return from.Format("02.01.2006") + " – " + last.Format("02.01.2006")
+}
+
+// ============================================================
+// RENDER
+// ============================================================
+
+// render вызывает хендлер отчёта внутренним запросом и собирает файл вложения
+func (h *ReportScheduleHandler) render(ctx context.Context, s *ReportSchedule, from, to time.Time) (mailer.Attachment, error) {
+	// Отчёты видят весь тенант — строим от имени автора с правами admin
+	ctx = auth.WithUser(ctx, auth.AuthContext{UserID: s.CreatedBy, TenantID: s.TenantID, UserType: 1})
+	q := url.Values{}
+	q.Set("dateFrom", from.Format(time.RFC3339))
+	q.Set("dateTo", to.Add(-time.Second).Format(time.RFC3339)) // dateTo включительно
+	name := s.Report + "_" + from.Format("2006-01-02")
+	if last := to.AddDate(0, 0, -1); last.After(from) {
+		name += "_" + last.Format("2006-01-02")
+	}
+	name += "." + s.Format
+
+	// Отчёт — в поясе расписания, а не в текущем поясе компании
+	q.Set("tz", from.Location().String())
+	if s.Report == "calls" {
+		q.Set("format", "csv")
+		data, err := callReport(ctx, h.CDR.ExportCDR, q)
+		return mailer.Attachment{Name: name, ContentType: "text/csv; charset=utf-8", Data: data}, err
+	}
+
+	var sections []pdf.Section
+	switch s.Report {
+	case "calls-summary":
+		q.Set("groupBy", "day")
+		data, err := callReport(ctx, h.CDR.GetCDRSeries, q)
+		if err != nil {
+			return mailer.Attachment{}, err
+		}
+		var resp CDRSeriesResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return mailer.Attachment{}, err
+		}
+		sections = summarySections(resp.Rows)
+	case "agents":
+		data, err := callReport(ctx, h.CDR.GetAgentReport, q)
+		if err != nil {
+			return mailer.Attachment{}, err
+		}
+		var resp AgentReportResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return mailer.Attachment{}, err
+		}
+		sections = agentSections(resp.Agents)
+	default:
+		return mailer.Attachment{}, errors.New("unknown report: " + s.Report)
+	}
+
+	var buf bytes.Buffer
+	if s.Format == "pdf" {
+		doc := &pdf.Document{
+			Title:    s.Name,
+			Subtitle: periodLabel(from, to) + " (" + from.Location().String() + ")",
+			Sections: sections,
+		}
+		if err := doc.Write(&buf, h.PDFFont); err != nil {
+			return mailer.Attachment{}, err
+		}
+		return mailer.Attachment{Name: name, ContentType: "application/pdf", Data: buf.Bytes()}, nil
+	}
+
+	// CSV: таблицы подряд, у каждой строка-заголовок, между ними пустая строка
+	out := newCSVRows(&buf)
+	for i, sec := range sections {
+		if i > 0 {
+			out.WriteRow()
+		}
+		if len(sections) > 1 {
+			out.WriteRow(sec.Title)
+		}
+		out.WriteRow(stringCells(sec.Header)...)
+		for _, row := range sec.Rows {
+			out.WriteRow(stringCells(row)...)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return mailer.Attachment{}, err
+	}
+	return mailer.Attachment{Name: name, ContentType: "text/csv; charset=utf-8", Data: buf.Bytes()}, nil
+}
+
+// callReport выполняет хендлер отчёта без HTTP: ответ собирается в память
+func callReport(ctx context.Context, fn http.HandlerFunc, q url.Values) ([]byte, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	w := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+	fn(w, r)
+	if w.status != http.StatusOK {
+		return nil, fmt.Errorf("report: %d %s", w.status, strings.TrimSpace(w.body.String()))
+	}
+	return w.body.Bytes(), nil
+}
+
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
+
+// summarySections — сводка звонков: по дням с итогом, по направлениям и по агентам за весь период
+func summarySections(rows []CDRSeriesRow) []pdf.Section {
+	header := []string{"Всего", "Отвечено", "Пропущено", "% ответа", "Ср. разговор", "Разговор"}
+	days := pdf.Section{Title: "По дням", Header: append([]string{"Дата"}, header...)}
+	byDirection := map[string]*CDRSeriesRow{}
+	byAgent := map[int]*CDRSeriesRow{}
+	var total CDRSeriesRow
+
+	add := func(m *CDRSeriesRow, r CDRSeriesRow) {
+		m.Total += r.Total
+		m.Answered += r.Answered
+		m.Missed += r.Missed
+		m.TotalBillsec += r.TotalBillsec
+	}
+	for _, r := range rows {
+		switch {
+		case r.Breakdown == "total" && r.Period != nil:
+			days.Rows = append(days.Rows, append([]string{r.Period.Format("02.01.2006")}, summaryCells(r)...))
+			add(&total, r)
+		case r.Breakdown == "direction" && r.Direction != nil:
+			if byDirection[*r.Direction] == nil {
+				byDirection[*r.Direction] = &CDRSeriesRow{}
+			}
+			add(byDirection[*r.Direction], r)
+		case r.Breakdown == "agent" && r.AgentID != nil:
+			if byAgent[*r.AgentID] == nil {
+				byAgent[*r.AgentID] = &CDRSeriesRow{AgentName: r.AgentName}
+			}
+			add(byAgent[*r.AgentID], r)
+		}
+	}
+	days.Rows = append(days.Rows, append([]string{"Итого"}, summaryCells(total)...))
+
+	directions := pdf.Section{Title: "По направлениям", Header: append([]string{"Направление"}, header...)}
+	for _, d := range []struct{ key, name string }{
+		{"inbound", "Входящие"}, {"outbound", "Исходящие"}, {"internal", "Внутренние"},
+	} {
+		if r := byDirection[d.key]; r != nil {
+			directions.Rows = append(directions.Rows, append([]string{d.name}, summaryCells(*r)...))
+		}
+	}
+
+	agents := make([]*CDRSeriesRow, 0, len(byAgent))
+	for _, r := range byAgent {
+		agents = append(agents, r)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Total > agents[j].Total })
+	byAgents := pdf.Section{Title: "По агентам", Header: append([]string{"Агент"}, header...)}
+	for _, r := range agents {
+		name := ""
+		if r.AgentName != nil {
+			name = *r.AgentName
+		}
+		byAgents.Rows = append(byAgents.Rows, append([]string{name}, summaryCells(*r)...))
+	}
+	return []pdf.Section{days, directions, byAgents}
+}
+
+func summaryCells(r CDRSeriesRow) []string {
+	rate, avg := 0.0, 0
+	if r.Total > 0 {
+		rate = float64(r.Answered) * 100 / float64(r.Total)
+	}
+	if r.Answered > 0 {
+		avg = r.TotalBillsec / r.Answered
+	}
+	return []string{
+		strconv.Itoa(r.Total), strconv.Itoa(r.Answered), strconv.Itoa(r.Missed),
+		strconv.FormatFloat(rate, 'f', 1, 64) + "%", clockDuration(avg), clockDuration(r.TotalBillsec),
+	}
+}
+
+func agentSections(agents []AgentReportRow) []pdf.Section {
+	s := pdf.Section{
+		Title: "Агенты",
+		Header: []string{"Агент", "Номер", "Входящие", "Отвечено", "Пропущено", "Исходящие", "Исх. отвечено",
+			"AHT", "Разговор", "Пауза", "Wrap-up", "Тикетов создано", "Тикетов закрыто"},
+	}
+	for _, a := range agents {
+		s.Rows = append(s.Rows, []string{
+			a.Name, a.Extension,
+			strconv.Itoa(a.Offered), strconv.Itoa(a.Answered), strconv.Itoa(a.Missed),
+			strconv.Itoa(a.Outbound), strconv.Itoa(a.OutboundAnswered),
+			clockDuration(int(a.AHT)), clockDuration(a.TalkSeconds),
+			clockDuration(a.PauseSeconds), clockDuration(a.WrapupSeconds),
+			strconv.Itoa(a.TicketsCreated), strconv.Itoa(a.TicketsClosed),
+		})
+	}
+	return []pdf.Section{s}
+}
+
+// clockDuration — секунды как ч:мм:сс
+func clockDuration(sec int) string {
+	return fmt.Sprintf("%d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+}
+
+func stringCells(s []string) []any {
+	cells := make([]any, len(s))
+	for i, v := range s {
+		cells[i] = v
+	}
+	return cells
+}
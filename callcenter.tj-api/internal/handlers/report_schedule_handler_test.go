@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"callcentrix/internal/mailer"
+	"callcentrix/internal/pdf"
+)
+
+// fakeSender запоминает письма вместо отправки по SMTP
+type fakeSender struct {
+	sent []mailer.Message
+	err  error
+}
+
+func (f *fakeSender) Send(ctx context.Context, msg mailer.Message) error {
+	f.sent = append(f.sent, msg)
+	return f.err
+}
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestReportPeriod(t *testing.T) {
+	loc := mustLocation(t, "Asia/Dushanbe")
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, loc) }
+
+	// 2026-10-19 — понедельник
+	tests := []struct {
+		period   string
+		at       time.Time
+		from, to time.Time
+	}{
+		{"day", time.Date(2026, 10, 19, 8, 0, 0, 0, loc), day(2026, 10, 18), day(2026, 10, 19)},
+		{"", time.Date(2026, 10, 19, 0, 0, 0, 0, loc), day(2026, 10, 18), day(2026, 10, 19)},
+		{"day", time.Date(2026, 1, 1, 9, 30, 0, 0, loc), day(2025, 12, 31), day(2026, 1, 1)},
+		{"week", time.Date(2026, 10, 19, 8, 0, 0, 0, loc), day(2026, 10, 12), day(2026, 10, 19)},
+		{"week", time.Date(2026, 10, 25, 23, 59, 0, 0, loc), day(2026, 10, 12), day(2026, 10, 19)}, // воскресенье
+		{"week", time.Date(2026, 10, 21, 8, 0, 0, 0, loc), day(2026, 10, 12), day(2026, 10, 19)},
+		{"month", time.Date(2026, 10, 19, 8, 0, 0, 0, loc), day(2026, 9, 1), day(2026, 10, 1)},
+		{"month", time.Date(2026, 1, 1, 0, 0, 0, 0, loc), day(2025, 12, 1), day(2026, 1, 1)},
+		{"month", time.Date(2026, 3, 31, 12, 0, 0, 0, loc), day(2026, 2, 1), day(2026, 3, 1)},
+	}
+	for _, tt := range tests {
+		from, to := reportPeriod(tt.period, tt.at)
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("reportPeriod(%q, %s) = %s – %s, want %s – %s", tt.period, tt.at,
+				from.Format(time.DateOnly), to.Format(time.DateOnly), tt.from.Format(time.DateOnly), tt.to.Format(time.DateOnly))
+		}
+		if from.Location() != loc {
+			t.Errorf("reportPeriod(%q) location = %s", tt.period, from.Location())
+		}
+	}
+}
+
+func TestPeriodLabel(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		from, to time.Time
+		want     string
+	}{
+		{day(10, 18), day(10, 19), "18.10.2026"},
+		{day(10, 12), day(10, 19), "12.10.2026 – 18.10.2026"},
+		{day(9, 1), day(10, 1), "01.09.2026 – 30.09.2026"},
+	}
+	for _, tt := range tests {
+		if got := periodLabel(tt.from, tt.to); got != tt.want {
+			t.Errorf("periodLabel(%s, %s) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeReportSchedule(t *testing.T) {
+	valid := func() ReportScheduleRequest {
+		return ReportScheduleRequest{
+			Name: " Сводка ", Report: "calls-summary", Cron: " 0 8 * * 1-5 ",
+			Timezone: "Asia/Dushanbe", Recipients: []string{"A@example.com", "a@example.com", "Boss <b@example.com>"},
+		}
+	}
+
+	req := valid()
+	next, err := normalizeReportSchedule(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "Сводка" || req.Format != "pdf" || req.Period != "day" || req.Cron != "0 8 * * 1-5" {
+		t.Errorf("defaults: %+v", req)
+	}
+	if strings.Join(req.Recipients, ",") != "A@example.com,b@example.com" {
+		t.Errorf("recipients = %v", req.Recipients)
+	}
+	loc := mustLocation(t, "Asia/Dushanbe")
+	if next == nil || !next.After(time.Now()) || next.In(loc).Hour() != 8 || next.In(loc).Minute() != 0 {
+		t.Errorf("next = %v", next)
+	}
+	if wd := next.In(loc).Weekday(); wd == time.Saturday || wd == time.Sunday {
+		t.Errorf("next on %s", wd)
+	}
+
+	inactive := false
+	tests := []struct {
+		name   string
+		modify func(*ReportScheduleRequest)
+		err    string // "" — без ошибки и без следующего запуска
+	}{
+		{"empty name", func(r *ReportScheduleRequest) { r.Name = " " }, "name is required"},
+		{"unknown report", func(r *ReportScheduleRequest) { r.Report = "tickets" }, "report must be"},
+		{"calls as pdf", func(r *ReportScheduleRequest) { r.Report, r.Format = "calls", "pdf" }, "calls report is csv only"},
+		{"bad format", func(r *ReportScheduleRequest) { r.Format = "xlsx" }, "format must be"},
+		{"bad period", func(r *ReportScheduleRequest) { r.Period = "year" }, "period must be"},
+		{"bad timezone", func(r *ReportScheduleRequest) { r.Timezone = "Mars/Olympus" }, "invalid timezone"},
+		{"bad cron", func(r *ReportScheduleRequest) { r.Cron = "0 8 * *" }, "cron"},
+		{"never fires", func(r *ReportScheduleRequest) { r.Cron = "0 0 31 2 *" }, "never fires"},
+		{"no recipients", func(r *ReportScheduleRequest) { r.Recipients = nil }, "recipients"},
+		{"bad recipient", func(r *ReportScheduleRequest) { r.Recipients = []string{"nope"} }, "invalid recipient"},
+		{"inactive", func(r *ReportScheduleRequest) { r.Active = &inactive }, ""},
+	}
+	for _, tt := range tests {
+		req := valid()
+		tt.modify(&req)
+		next, err := normalizeReportSchedule(&req)
+		if tt.err == "" {
+			if err != nil || next != nil {
+				t.Errorf("%s: next = %v, err = %v", tt.name, next, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestReportSend(t *testing.T) {
+	loc := mustLocation(t, "Asia/Dushanbe")
+	s := &ReportSchedule{
+		ID: 7, TenantID: 1, Name: "Agents", Report: "agents", Format: "pdf",
+		Cron: "0 8 * * 1", Timezone: "Asia/Dushanbe", Period: "week",
+		Recipients: []string{"a@example.com", "b@example.com"},
+	}
+	from, to := reportPeriod(s.Period, time.Date(2026, 10, 19, 8, 0, 0, 0, loc))
+
+	var buf bytes.Buffer
+	doc := &pdf.Document{
+		Title:    s.Name,
+		Subtitle: periodLabel(from, to),
+		Sections: agentSections([]AgentReportRow{{Name: "Operator", Extension: "101", Offered: 12, Answered: 10, Missed: 2, TalkSeconds: 3725}}),
+	}
+	if err := doc.Write(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) || !bytes.Contains(buf.Bytes(), []byte("%%EOF")) {
+		t.Fatalf("not a PDF: %q…", buf.Bytes()[:min(buf.Len(), 16)])
+	}
+	att := mailer.Attachment{Name: "agents_2026-10-12_2026-10-18.pdf", ContentType: "application/pdf", Data: buf.Bytes()}
+
+	fake := &fakeSender{}
+	h := &ReportScheduleHandler{Mailer: fake}
+	if err := h.send(context.Background(), s, att, from, to); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(fake.sent))
+	}
+	msg := fake.sent[0]
+	if strings.Join(msg.To, ",") != "a@example.com,b@example.com" {
+		t.Errorf("To = %v", msg.To)
+	}
+	if want := "CallCentrix: Agents — 12.10.2026 – 18.10.2026"; msg.Subject != want {
+		t.Errorf("Subject = %q, want %q", msg.Subject, want)
+	}
+	if !strings.Contains(msg.Body, "Asia/Dushanbe") || !strings.Contains(msg.Body, `"0 8 * * 1"`) {
+		t.Errorf("Body = %q", msg.Body)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Name != att.Name || !bytes.Equal(msg.Attachments[0].Data, att.Data) {
+		t.Errorf("Attachments = %+v", msg.Attachments)
+	}
+
+	// Ошибка SMTP возвращается как есть — deliver запишет её в историю
+	fake.err = errors.New("mailer: RCPT TO a@example.com: 550 no such user")
+	if err := h.send(context.Background(), s, att, from, to); err != fake.err {
+		t.Errorf("err = %v, want %v", err, fake.err)
+	}
+}
+
+func TestClockDuration(t *testing.T) {
+	tests := map[int]string{0: "0:00:00", 59: "0:00:59", 3725: "1:02:05", 90061: "25:01:01"}
+	for sec, want := range tests {
+		if got := clockDuration(sec); got != want {
+			t.Errorf("clockDuration(%d) = %q, want %q", sec, got, want)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"callcentrix/internal/auth"
+	"callcentrix/internal/recordings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RetentionHandler — сроки хранения записей, legal hold и журнал удаления.
+// Удаляет записи recordings.Purger на лидере; здесь — настройка и отчёты (только admin тенанта).
+type RetentionHandler struct {
+	DB     *pgxpool.Pool
+	Purger *recordings.Purger
+}
+
+// =========================
+// MODELS
+// =========================
+
+type RetentionPolicyRequest struct {
+	Queue         *string `json:"queue"`         // nil — все очереди
+	DispositionID *int    `json:"dispositionId"` // nil — любой результат
+	RetainDays    int     `json:"retainDays"`
+	Active        *bool   `json:"active"`
+}
+
+type RetentionPolicyResponse struct {
+	ID            int       `json:"id"`
+	TenantID      int       `json:"tenantId"`
+	Queue         *string   `json:"queue"`
+	DispositionID *int      `json:"dispositionId"`
+	RetainDays    int       `json:"retainDays"`
+	Active        bool      `json:"active"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type LegalHoldRequest struct {
+	Reason string `json:"reason"`
+}
+
+type LegalHoldResponse struct {
+	UniqueID  string    `json:"uniqueid"`
+	Reason    *string   `json:"reason"`
+	CreatedBy *int      `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type PurgeLogEntry struct {
+	ID         int64     `json:"id"`
+	UniqueID   string    `json:"uniqueid"`
+	PolicyID   *int      `json:"policyId"`
+	RetainDays int       `json:"retainDays"`
+	CallDate   time.Time `json:"callDate"`
+	Backend    *string   `json:"backend"`
+	Location   *string   `json:"location"`
+	Size       *int64    `json:"size"`
+	Status     string    `json:"status"` // deleted / missing / failed
+	Error      *string   `json:"error"`
+	PurgedAt   time.Time `json:"purgedAt"`
+}
+
+const retentionPolicyColumns = `id, tenant_id, queue, disposition_id, retain_days, active, created_at`
+
+func scanRetentionPolicy(row interface{ Scan(...any) error }, p *RetentionPolicyResponse) error {
+	return row.Scan(&p.ID, &p.TenantID, &p.Queue, &p.DispositionID, &p.RetainDays, &p.Active, &p.CreatedAt)
+}
+
+// ============================================================
+// POLICIES
+// ============================================================
+
+// GetRetentionPolicies godoc
+// @Summary      Политики хранения записей
+// @Tags         Retention
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  RetentionPolicyResponse
+// @Router       /api/recordings/retention/policies [get]
+func (h *RetentionHandler) GetRetentionPolicies(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+retentionPolicyColumns+` FROM recording_retention_policies
+		 WHERE tenant_id=$1 ORDER BY disposition_id NULLS FIRST, queue NULLS FIRST`,
+		user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]RetentionPolicyResponse, 0)
+	for rows.Next() {
+		var p RetentionPolicyResponse
+		scanRetentionPolicy(rows, &p)
+		result = append(result, p)
+	}
+	jsonResp(w, result)
+}
+
+// CreateRetentionPolicy godoc
+// @Summary      Создать политику хранения записей
+// @Description  Без queue и dispositionId — срок по умолчанию для тенанта. Для звонка действует самая узкая политика: disposition > queue > тенант.
+// @Tags         Retention
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  RetentionPolicyRequest  true  "Политика"
+// @Success      201  {object}  RetentionPolicyResponse
+// @Failure      409  {string}  string  "policy for this scope already exists"
+// @Router       /api/recordings/retention/policies [post]
+func (h *RetentionHandler) CreateRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	req, ok := h.decodePolicy(w, r, user.TenantID)
+	if !ok {
+		return
+	}
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+	var p RetentionPolicyResponse
+	err := scanRetentionPolicy(h.DB.QueryRow(r.Context(),
+		`INSERT INTO recording_retention_policies (tenant_id, queue, disposition_id, retain_days, active)
+		 VALUES ($1,$2,$3,$4,$5)
+		 RETURNING `+retentionPolicyColumns,
+		user.TenantID, req.Queue, req.DispositionID, req.RetainDays, active), &p)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "policy for this scope already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("✅ Retention policy created: id=%d tenant=%d days=%d", p.ID, p.TenantID, p.RetainDays)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// UpdateRetentionPolicy godoc
+// @Summary      Обновить политику хранения записей
+// @Tags         Retention
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                     true  "ID"
+// @Param        body  body  RetentionPolicyRequest  true  "Политика"
+// @Success      200  {object}  RetentionPolicyResponse
+// @Router       /api/recordings/retention/policies/{id} [put]
+func (h *RetentionHandler) UpdateRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	req, ok := h.decodePolicy(w, r, user.TenantID)
+	if !ok {
+		return
+	}
+	var p RetentionPolicyResponse
+	err = scanRetentionPolicy(h.DB.QueryRow(r.Context(),
+		`UPDATE recording_retention_policies
+		 SET queue=$1, disposition_id=$2, retain_days=$3, active=COALESCE($4, active)
+		 WHERE id=$5 AND tenant_id=$6
+		 RETURNING `+retentionPolicyColumns,
+		req.Queue, req.DispositionID, req.RetainDays, req.Active, id, user.TenantID), &p)
+	if err != nil {
+		if isDuplicate(err) {
+			http.Error(w, "policy for this scope already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("✏️ Retention policy updated: id=%d tenant=%d days=%d", p.ID, p.TenantID, p.RetainDays)
+	jsonResp(w, p)
+}
+
+// DeleteRetentionPolicy godoc
+// @Summary      Удалить политику хранения записей
+// @Tags         Retention
+// @Security     BearerAuth
+// @Param        id  path  int  true  "ID"
+// @Success      204  "No Content"
+// @Router       /api/recordings/retention/policies/{id} [delete]
+func (h *RetentionHandler) DeleteRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, err := chiID(r, "id")
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM recording_retention_policies WHERE id=$1 AND tenant_id=$2`, id, user.TenantID)
+	if err != nil || tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodePolicy читает и проверяет тело запроса; disposition должен быть из каталога тенанта
+func (h *RetentionHandler) decodePolicy(w http.ResponseWriter, r *http.Request, tenantID int) (RetentionPolicyRequest, bool) {
+	var req RetentionPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RetainDays <= 0 {
+		http.Error(w, "retainDays must be positive", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Queue != nil && *req.Queue == "" {
+		req.Queue = nil
+	}
+	if req.DispositionID != nil {
+		var exists bool
+		h.DB.QueryRow(r.Context(),
+			`SELECT EXISTS (SELECT 1 FROM crm_dispositions WHERE id=$1 AND tenant_id=$2)`,
+			*req.DispositionID, tenantID).Scan(&exists)
+		if !exists {
+			http.Error(w, "unknown dispositionId", http.StatusBadRequest)
+			return req, false
+		}
+	}
+	return req, true
+}
+
+// ============================================================
+// DRY RUN / PURGE LOG
+// ============================================================
+
+// GetRetentionDryRun godoc
+// @Summary      Какие записи удалит следующий запуск очистки
+// @Description  Ничего не удаляет. knownBytes — только по уже проиндексированным записям.
+// @Tags         Retention
+// @Security     BearerAuth
+// @Produce      json
+// @Param        limit  query  int  false  "Сколько записей вернуть в items (по умолчанию 100, максимум 1000)"
+// @Success      200  {object}  recordings.PurgeReport
+// @Router       /api/recordings/retention/dry-run [get]
+func (h *RetentionHandler) GetRetentionDryRun(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+	report, err := h.Purger.DryRun(r.Context(), user.TenantID, limit)
+	if err != nil {
+		log.Printf("❌ Retention dry-run: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, report)
+}
+
+// GetPurgeLog godoc
+// @Summary      Журнал удаления записей по срокам хранения
+// @Tags         Retention
+// @Security     BearerAuth
+// @Produce      json
+// @Param        dateFrom  query  string  false  "RFC3339 или дата в поясе компании"
+// @Param        dateTo    query  string  false  "RFC3339 или дата в поясе компании (включительно)"
+// @Param        status    query  string  false  "deleted / missing / failed"
+// @Param        uniqueid  query  string  false  "uniqueid звонка"
+// @Param        limit     query  int     false  "по умолчанию 200, максимум 1000"
+// @Success      200  {array}  PurgeLogEntry
+// @Router       /api/recordings/retention/log [get]
+func (h *RetentionHandler) GetPurgeLog(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+
+	where := `WHERE tenant_id = $1`
+	args := []any{user.TenantID}
+	idx := 2
+
+	loc := tenantLocation(r.Context(), h.DB, user.TenantID)
+	if t, ok := parseReportTime(q.Get("dateFrom"), loc, false); ok {
+		where += " AND purged_at >= $" + strconv.Itoa(idx)
+		args = append(args, t)
+		idx++
+	}
+	if t, ok := parseReportTime(q.Get("dateTo"), loc, true); ok {
+		where += " AND purged_at <= $" + strconv.Itoa(idx)
+		args = append(args, t)
+		idx++
+	}
+	if v := q.Get("status"); v != "" {
+		where += " AND status = $" + strconv.Itoa(idx)
+		args = append(args, v)
+		idx++
+	}
+	if v := q.Get("uniqueid"); v != "" {
+		where += " AND uniqueid = $" + strconv.Itoa(idx)
+		args = append(args, v)
+		idx++
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 1000 {
+		limit = 200
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT id, uniqueid, policy_id, retain_days, call_date, backend, location,
+		       size_bytes, status, error, purged_at
+		FROM recording_purge_log `+where+`
+		ORDER BY purged_at DESC, id DESC
+		LIMIT $`+strconv.Itoa(idx),
+		append(args, limit)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]PurgeLogEntry, 0)
+	for rows.Next() {
+		var e PurgeLogEntry
+		if err := rows.Scan(&e.ID, &e.UniqueID, &e.PolicyID, &e.RetainDays, &e.CallDate, &e.Backend,
+			&e.Location, &e.Size, &e.Status, &e.Error, &e.PurgedAt); err != nil {
+			log.Printf("❌ Purge log scan: %v", err)
+			continue
+		}
+		result = append(result, e)
+	}
+	jsonResp(w, result)
+}
+
+// ============================================================
+// LEGAL HOLDS
+// ============================================================
+
+// GetLegalHolds godoc
+// @Summary      Записи под legal hold (не удаляются по срокам хранения)
+// @Tags         Retention
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}  LegalHoldResponse
+// @Router       /api/recordings/holds [get]
+func (h *RetentionHandler) GetLegalHolds(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT uniqueid, reason, created_by, created_at FROM recording_legal_holds
+		 WHERE tenant_id=$1 ORDER BY created_at DESC`, user.TenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]LegalHoldResponse, 0)
+	for rows.Next() {
+		var hold LegalHoldResponse
+		rows.Scan(&hold.UniqueID, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt)
+		result = append(result, hold)
+	}
+	jsonResp(w, result)
+}
+
+// SetLegalHold godoc
+// @Summary      Поставить запись на legal hold
+// @Tags         Retention
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        uniqueid  path  string            true   "uniqueid звонка"
+// @Param        body      body  LegalHoldRequest  false  "Основание"
+// @Success      200  {object}  LegalHoldResponse
+// @Router       /api/recordings/{uniqueid}/hold [put]
+func (h *RetentionHandler) SetLegalHold(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	uniqueid := chi.URLParam(r, "uniqueid")
+	if !recordingAccess(r.Context(), h.DB, uniqueid, user.TenantID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var req LegalHoldRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	var hold LegalHoldResponse
+	err := h.DB.QueryRow(r.Context(), `
+		INSERT INTO recording_legal_holds (uniqueid, tenant_id, reason, created_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (uniqueid) DO UPDATE SET reason = EXCLUDED.reason
+		RETURNING uniqueid, reason, created_by, created_at`,
+		uniqueid, user.TenantID, nullStr(req.Reason), user.UserID,
+	).Scan(&hold.UniqueID, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🔒 Legal hold set: %s tenant=%d by user=%d", uniqueid, user.TenantID, user.UserID)
+	jsonResp(w, hold)
+}
+
+// DeleteLegalHold godoc
+// @Summary      Снять legal hold с записи
+// @Tags         Retention
+// @Security     BearerAuth
+// @Param        uniqueid  path  string  true  "uniqueid звонка"
+// @Success      204  "No Content"
+// @Router       /api/recordings/{uniqueid}/hold [delete]
+func (h *RetentionHandler) DeleteLegalHold(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	uniqueid := chi.URLParam(r, "uniqueid")
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM recording_legal_holds WHERE uniqueid=$1 AND tenant_id=$2`, uniqueid, user.TenantID)
+	if err != nil || tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("🔓 Legal hold released: %s tenant=%d by user=%d", uniqueid, user.TenantID, user.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"callcentrix/internal/auth"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TimeZoneHandler — часовой пояс тенанта (crm_tenants.timezone). В нём
+// группируются отчёты, читаются даты фильтров без смещения и форматируются
+// даты в выгрузках. ast_cdr и остальные таблицы по-прежнему хранят UTC.
+type TimeZoneHandler struct {
+	DB *pgxpool.Pool
+}
+
+// =========================
+// MODELS
+// =========================
+
+// ReportZone — пояс, в котором построен ответ; встраивается в ответы отчётов
+type ReportZone struct {
+	TimeZone  string `json:"timeZone"`  // IANA, например Asia/Dushanbe
+	UTCOffset string `json:"utcOffset"` // смещение на момент ответа, например +05:00
+}
+
+type SetTimeZoneRequest struct {
+	TimeZone string `json:"timeZone"`
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// GetTimeZone godoc
+// @Summary      Часовой пояс компании
+// @Tags         Settings
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  ReportZone
+// @Router       /api/settings/timezone [get]
+func (h *TimeZoneHandler) GetTimeZone(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	jsonResp(w, reportZone(tenantLocation(r.Context(), h.DB, user.TenantID)))
+}
+
+// SetTimeZone godoc
+// @Summary      Изменить часовой пояс компании
+// @Description  IANA-имя пояса (Asia/Dushanbe, Europe/Moscow, UTC). Только админ компании. Другие инстансы подхватят пояс в течение минуты.
+// @Tags         Settings
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body  SetTimeZoneRequest  true  "Пояс"
+// @Success      200  {object}  ReportZone
+// @Failure      400  {string}  string  "invalid timeZone"
+// @Router       /api/settings/timezone [put]
+func (h *TimeZoneHandler) SetTimeZone(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	if user.UserType != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req SetTimeZoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	loc, err := loadTimeZone(req.TimeZone)
+	if err != nil {
+		http.Error(w, "invalid timeZone", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(),
+		`UPDATE crm_tenants SET timezone = $1 WHERE tenant_id = $2`, loc.String(), user.TenantID)
+	if err != nil {
+		log.Printf("❌ SetTimeZone: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return
+	}
+	tenantZones.set(user.TenantID, loc)
+
+	log.Printf("🕒 Tenant %d time zone: %s (user %d)", user.TenantID, loc, user.UserID)
+	jsonResp(w, reportZone(loc))
+}
+
+// =========================
+// HELPERS
+// =========================
+
+// tenantZones — пояса тенантов в памяти инстанса: пояс нужен почти каждому
+// отчёту, а меняется редко
+var tenantZones = &zoneCache{m: make(map[int]cachedZone)}
+
+const tenantZoneTTL = time.Minute
+
+type cachedZone struct {
+	loc *time.Location
+	at  time.Time
+}
+
+type zoneCache struct {
+	mu sync.Mutex
+	m  map[int]cachedZone
+}
+
+func (c *zoneCache) get(tenantID int) (*time.Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	z, ok := c.m[tenantID]
+	if !ok || time.Since(z.at) > tenantZoneTTL {
+		return nil, false
+	}
+	return z.loc, true
+}
+
+func (c *zoneCache) set(tenantID int, loc *time.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[tenantID] = cachedZone{loc: loc, at: time.Now()}
+}
+
+// tenantLocation — пояс тенанта; не задан или не читается — UTC
+func tenantLocation(ctx context.Context, db *pgxpool.Pool, tenantID int) *time.Location {
+	if loc, ok := tenantZones.get(tenantID); ok {
+		return loc
+	}
+	// Тенанта нет в crm_tenants — UTC; ошибку БД не кэшируем
+	var tz string
+	err := db.QueryRow(ctx,
+		`SELECT timezone FROM crm_tenants WHERE tenant_id = $1`, tenantID,
+	).Scan(&tz)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("❌ Tenant %d time zone: %v", tenantID, err)
+		return time.UTC
+	}
+	loc, err := loadTimeZone(tz)
+	if err != nil {
+		log.Printf("⚠️ Tenant %d time zone %q: %v — using UTC", tenantID, tz, err)
+		loc = time.UTC
+	}
+	tenantZones.set(tenantID, loc)
+	return loc
+}
+
+// reportLocation — пояс отчёта: ?tz (IANA), иначе пояс тенанта
+func reportLocation(ctx context.Context, db *pgxpool.Pool, tenantID int, q url.Values) (*time.Location, error) {
+	if tz := q.Get("tz"); tz != "" {
+		return loadTimeZone(tz)
+	}
+	return tenantLocation(ctx, db, tenantID), nil
+}
+
+// loadTimeZone — IANA-пояс; пусто — UTC. «Local» не принимается: это пояс сервера.
+func loadTimeZone(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+	if tz == "Local" {
+		return nil, errors.New("server-local time zone is not allowed")
+	}
+	return time.LoadLocation(tz)
+}
+
+func reportZone(loc *time.Location) ReportZone {
+	return ReportZone{TimeZone: loc.String(), UTCOffset: utcOffset(time.Now().In(loc))}
+}
+
+// utcOffset — смещение момента t от UTC: +05:00
+func utcOffset(t time.Time) string {
+	return t.Format("-07:00")
+}
+
+// Даты фильтров без смещения — в поясе отчёта
+var reportTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// parseReportTime читает дату фильтра: RFC3339 со смещением — как есть, дата-время
+// без смещения — в поясе loc, дата (2006-01-02) — начало дня в loc, а для
+// включительной верхней границы (end) — последняя микросекунда дня
+func parseReportTime(v string, loc *time.Location, end bool) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range reportTimeLayouts {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, true
+		}
+	}
+	if d, err := time.ParseInLocation("2006-01-02", v, loc); err == nil {
+		if end {
+			return d.AddDate(0, 0, 1).Add(-time.Microsecond), true
+		}
+		return d, true
+	}
+	return time.Time{}, false
+}
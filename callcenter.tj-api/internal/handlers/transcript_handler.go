@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"callcentrix/internal/auth"
+	"callcentrix/internal/transcription"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TranscriptHandler — расшифровки записей. Распознаёт transcription.Worker на лидере,
+// здесь — чтение, постановка в очередь и поиск.
+type TranscriptHandler struct {
+	DB *pgxpool.Pool
+}
+
+// =========================
+// MODELS
+// =========================
+
+type TranscriptResponse struct {
+	UniqueID  string                  `json:"uniqueid"`
+	Status    string                  `json:"status"` // queued / running / done / failed / skipped
+	Error     *string                 `json:"error"`
+	Engine    *string                 `json:"engine"`
+	Language  *string                 `json:"language"`
+	Text      *string                 `json:"text"`
+	Segments  []transcription.Segment `json:"segments"`
+	CreatedAt *time.Time              `json:"createdAt"`
+}
+
+type TranscriptSearchResult struct {
+	UniqueID string    `json:"uniqueid"`
+	CallDate time.Time `json:"callDate"`
+	Src      string    `json:"src"`
+	Dst      string    `json:"dst"`
+	Billsec  int       `json:"billsec"`
+	Snippet  string    `json:"snippet"` // совпадения в <b>…</b>
+	Rank     float64   `json:"rank"`
+}
+
+// ============================================================
+// API
+// ============================================================
+
+// GetTranscript godoc
+// @Summary      Расшифровка записи звонка
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Produce      json
+// @Param        uniqueid  path  string  true  "uniqueid звонка"
+// @Success      200  {object}  TranscriptResponse
+// @Failure      404  {string}  string  "not found"
+// @Router       /api/recordings/{uniqueid}/transcript [get]
+func (h *TranscriptHandler) GetTranscript(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	uniqueid := chi.URLParam(r, "uniqueid")
+	if !recordingAccess(r.Context(), h.DB, uniqueid, user.TenantID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	t := TranscriptResponse{UniqueID: uniqueid, Segments: make([]transcription.Segment, 0)}
+	err := h.DB.QueryRow(r.Context(), `
+		SELECT COALESCE(j.status, 'done'), j.error, tr.engine, tr.language, tr.text, tr.created_at
+		FROM (SELECT $1::text AS uniqueid) x
+		LEFT JOIN transcription_jobs j ON j.uniqueid = x.uniqueid AND j.tenant_id = $2
+		LEFT JOIN transcripts tr       ON tr.uniqueid = x.uniqueid AND tr.tenant_id = $2
+		WHERE j.uniqueid IS NOT NULL OR tr.uniqueid IS NOT NULL`,
+		uniqueid, user.TenantID,
+	).Scan(&t.Status, &t.Error, &t.Engine, &t.Language, &t.Text, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "transcript not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT COALESCE(speaker, ''), start_sec, end_sec, text
+		FROM transcript_segments WHERE uniqueid = $1 ORDER BY seq`, uniqueid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s transcription.Segment
+		var start, end float32
+		if err := rows.Scan(&s.Speaker, &start, &end, &s.Text); err != nil {
+			log.Printf("❌ Transcript segments scan: %v", err)
+			continue
+		}
+		s.Start, s.End = float64(start), float64(end)
+		t.Segments = append(t.Segments, s)
+	}
+	jsonResp(w, t)
+}
+
+// RequestTranscript godoc
+// @Summary      Поставить запись в очередь распознавания (или повторить)
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Param        uniqueid  path  string  true  "uniqueid звонка"
+// @Success      202  "Accepted"
+// @Router       /api/recordings/{uniqueid}/transcript [post]
+func (h *TranscriptHandler) RequestTranscript(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	uniqueid := chi.URLParam(r, "uniqueid")
+	if !recordingAccess(r.Context(), h.DB, uniqueid, user.TenantID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err := transcription.Enqueue(r.Context(), h.DB, uniqueid, user.TenantID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("📝 Transcription requested: %s by user=%d", uniqueid, user.UserID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// SearchTranscripts godoc
+// @Summary      Полнотекстовый поиск по расшифровкам
+// @Description  q — синтаксис websearch: слова, "точная фраза", -исключить, or
+// @Tags         Recordings
+// @Security     BearerAuth
+// @Produce      json
+// @Param        q         query  string  true   "Запрос"
+// @Param        dateFrom  query  string  false  "RFC3339 или дата в поясе компании"
+// @Param        dateTo    query  string  false  "RFC3339 или дата в поясе компании (включительно)"
+// @Param        limit     query  int     false  "по умолчанию 50, максимум 200"
+// @Success      200  {array}  TranscriptSearchResult
+// @Router       /api/transcripts/search [get]
+func (h *TranscriptHandler) SearchTranscripts(w http.ResponseWriter, r *http.Request) {
+	user := auth.FromContext(r.Context())
+	q := r.URL.Query()
+	if q.Get("q") == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	where := `WHERE tr.tenant_id = $1 AND tr.tsv @@ websearch_to_tsquery('simple', $2)`
+	args := []any{user.TenantID, q.Get("q")}
+	idx := 3
+
+	loc := tenantLocation(r.Context(), h.DB, user.TenantID)
+	if t, ok := parseReportTime(q.Get("dateFrom"), loc, false); ok {
+		where += " AND c.calldate AT TIME ZONE 'UTC' >= $" + strconv.Itoa(idx)
+		args = append(args, t.UTC())
+		idx++
+	}
+	if t, ok := parseReportTime(q.Get("dateTo"), loc, true); ok {
+		where += " AND c.calldate AT TIME ZONE 'UTC' <= $" + strconv.Itoa(idx)
+		args = append(args, t.UTC())
+		idx++
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT tr.uniqueid, c.calldate, COALESCE(c.src, ''), COALESCE(c.dst, ''), c.billsec,
+		       ts_headline('simple', tr.text, websearch_to_tsquery('simple', $2),
+		                   'StartSel=<b>, StopSel=</b>, MaxFragments=3, MaxWords=20, MinWords=5'),
+		       ts_rank(tr.tsv, websearch_to_tsquery('simple', $2))
+		FROM transcripts tr
+		CROSS JOIN LATERAL (
+			SELECT calldate, src, dst, billsec FROM ast_cdr
+			WHERE uniqueid = tr.uniqueid ORDER BY billsec DESC LIMIT 1
+		) c
+		`+where+`
+		ORDER BY 7 DESC, c.calldate DESC
+		LIMIT $`+strconv.Itoa(idx),
+		append(args, limit)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	result := make([]TranscriptSearchResult, 0)
+	for rows.Next() {
+		var s TranscriptSearchResult
+		var rank float32
+		if err := rows.Scan(&s.UniqueID, &s.CallDate, &s.Src, &s.Dst, &s.Billsec, &s.Snippet, &rank); err != nil {
+			log.Printf("❌ Transcript search scan: %v", err)
+			continue
+		}
+		s.Rank = float64(rank)
+		s.CallDate = s.CallDate.In(loc)
+		result = append(result, s)
+	}
+	jsonResp(w, result)
+}
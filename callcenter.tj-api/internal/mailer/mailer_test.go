@@ -0,0 +1,203 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession — что фейковый SMTP-сервер получил за одну сессию
+type smtpSession struct {
+	from string
+	rcpt []string
+	data []byte
+}
+
+// fakeSMTP — минимальный SMTP-сервер без TLS и AUTH: принимает одну сессию
+func fakeSMTP(t *testing.T) (host string, port int, got <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+		var s smtpSession
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimRight(line, "\r\n")
+			switch verb := strings.ToUpper(strings.Fields(cmd + " ")[0]); verb {
+			case "EHLO", "HELO":
+				reply("250 fake")
+			case "MAIL":
+				s.from = strings.Trim(strings.TrimPrefix(cmd[len("MAIL FROM:"):], " "), "<>")
+				reply("250 ok")
+			case "RCPT":
+				s.rcpt = append(s.rcpt, strings.Trim(cmd[len("RCPT TO:"):], "<>"))
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data bytes.Buffer
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(l, "."))
+				}
+				s.data = data.Bytes()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				ch <- s
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, ch
+}
+
+func TestSend(t *testing.T) {
+	host, port, got := fakeSMTP(t)
+	m := &Mailer{Host: host, Port: port, From: "CallCentrix <reports@example.com>", TLS: "none", Timeout: 5 * time.Second}
+
+	pdfData := bytes.Repeat([]byte("%PDF-1.4 report "), 20) // > 76 символов base64
+	err := m.Send(context.Background(), Message{
+		To:      []string{"a@example.com", "b@example.com"},
+		Subject: "CallCentrix: Сводка — 18.10.2026",
+		Body:    "Отчёт во вложении.\r\n",
+		Attachments: []Attachment{
+			{Name: "calls-summary_2026-10-18.pdf", ContentType: "application/pdf", Data: pdfData},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s smtpSession
+	select {
+	case s = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no SMTP session")
+	}
+	if s.from != "reports@example.com" {
+		t.Errorf("MAIL FROM = %q", s.from)
+	}
+	if strings.Join(s.rcpt, ",") != "a@example.com,b@example.com" {
+		t.Errorf("RCPT TO = %v", s.rcpt)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(s.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "CallCentrix: Сводка — 18.10.2026" {
+		t.Errorf("Subject = %q (%v)", subject, err)
+	}
+	if to := msg.Header.Get("To"); to != "a@example.com, b@example.com" {
+		t.Errorf("To = %q", to)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []*multipart.Part
+	var bodies [][]byte
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(p)
+		data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts, bodies = append(parts, p), append(bodies, data)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("parts = %d, want 2", len(parts))
+	}
+	if string(bodies[0]) != "Отчёт во вложении.\r\n" {
+		t.Errorf("body = %q", bodies[0])
+	}
+	if ct := parts[1].Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/pdf") {
+		t.Errorf("attachment Content-Type = %q", ct)
+	}
+	if name := parts[1].FileName(); name != "calls-summary_2026-10-18.pdf" {
+		t.Errorf("attachment name = %q", name)
+	}
+	if !bytes.Equal(bodies[1], pdfData) {
+		t.Errorf("attachment data mismatch: %d bytes, want %d", len(bodies[1]), len(pdfData))
+	}
+}
+
+func TestSendValidation(t *testing.T) {
+	m := &Mailer{Host: "127.0.0.1", Port: 1, From: "reports@example.com", TLS: "none"}
+	tests := []struct {
+		name string
+		m    *Mailer
+		msg  Message
+	}{
+		{"no recipients", m, Message{}},
+		{"bad recipient", m, Message{To: []string{"not an address"}}},
+		{"bad from", &Mailer{From: "nope"}, Message{To: []string{"a@example.com"}}},
+	}
+	for _, tt := range tests {
+		if err := tt.m.Send(context.Background(), tt.msg); err == nil || !strings.HasPrefix(err.Error(), "mailer: ") {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestSendConnectError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close() // порт свободен — соединение отклоняется
+
+	m := &Mailer{Host: "127.0.0.1", Port: port, From: "reports@example.com", TLS: "none", Timeout: 2 * time.Second}
+	err = m.Send(context.Background(), Message{To: []string{"a@example.com"}})
+	if err == nil || !strings.Contains(err.Error(), "connect 127.0.0.1:"+strconv.Itoa(port)) {
+		t.Errorf("err = %v", err)
+	}
+}
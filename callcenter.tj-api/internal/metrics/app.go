@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =========================
+// APP METRICS
+// =========================
+
+var (
+	AMIConnected = NewGaugeVec("callcentrix_ami_connected",
+		"AMI connection state (1 - connected)")
+	AMIEvents = NewCounterVec("callcentrix_ami_events_total",
+		"AMI events received, by event type", "event")
+
+	// DroppedNotifications — уведомление подписчику не влезло в канал (default: ветки сторов)
+	DroppedNotifications = NewCounterVec("callcentrix_store_dropped_notifications_total",
+		"Subscriber notifications dropped because the channel was full", "store")
+
+	WSClients = NewGaugeVec("callcentrix_ws_clients",
+		"Connected monitor WebSocket clients", "tenant")
+
+	RecordingsPurged = NewCounterVec("callcentrix_recordings_purged_total",
+		"Recordings processed by the retention purge job, by result", "status")
+
+	HTTPDuration = NewHistogramVec("callcentrix_http_request_duration_seconds",
+		"HTTP request latency by route", DefBuckets, "method", "route", "status")
+)
+
+// =========================
+// HTTP MIDDLEWARE
+// =========================
+
+// HTTPMiddleware замеряет латентность по шаблону маршрута chi (/api/crm/tickets/{id}),
+// а не по фактическому пути — чтобы не плодить серии
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		HTTPDuration.Observe(time.Since(start).Seconds(), r.Method, route, strconv.Itoa(rec.status))
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack нужен WebSocket-апгрейду (/ws/monitor)
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijack not supported")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// =========================
+// PGX POOL
+// =========================
+
+// RegisterPool экспортирует pool.Stat() при каждом скрейпе
+func RegisterPool(pool *pgxpool.Pool) {
+	gauge := func(name, help string, fn func(s *pgxpool.Stat) float64) {
+		NewGaugeFunc(name, help, nil, func() []Sample {
+			return []Sample{{Value: fn(pool.Stat())}}
+		})
+	}
+	counter := func(name, help string, fn func(s *pgxpool.Stat) float64) {
+		NewCounterFunc(name, help, nil, func() []Sample {
+			return []Sample{{Value: fn(pool.Stat())}}
+		})
+	}
+
+	gauge("callcentrix_pgx_conns_total", "Total connections in the pool",
+		func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) })
+	gauge("callcentrix_pgx_conns_acquired", "Connections currently in use",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) })
+	gauge("callcentrix_pgx_conns_idle", "Idle connections",
+		func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) })
+	gauge("callcentrix_pgx_conns_constructing", "Connections being established",
+		func(s *pgxpool.Stat) float64 { return float64(s.ConstructingConns()) })
+	gauge("callcentrix_pgx_conns_max", "Maximum pool size",
+		func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) })
+	counter("callcentrix_pgx_acquire_total", "Successful connection acquires",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("callcentrix_pgx_acquire_empty_total", "Acquires that had to wait for a connection",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("callcentrix_pgx_acquire_canceled_total", "Acquires canceled by context",
+		func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) })
+	counter("callcentrix_pgx_acquire_duration_seconds_total", "Total time spent acquiring connections",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+}
@@ -0,0 +1,329 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Минимальная реализация метрик в текстовом формате Prometheus (exposition 0.0.4):
+// счётчики, gauge, гистограммы с метками и gauge, вычисляемые при скрейпе.
+
+// =========================
+// REGISTRY
+// =========================
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// Handler отдаёт все зарегистрированные метрики.
+// token != "" — требуется заголовок "Authorization: Bearer <token>";
+// пустой token — только для внутреннего listener (METRICS_ADDR).
+func Handler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		registryMu.Lock()
+		collectors := append([]collector(nil), registry...)
+		registryMu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, c := range collectors {
+			c.write(w)
+		}
+	}
+}
+
+// =========================
+// VECTORS
+// =========================
+
+// series — одна временная серия (значения меток + значение)
+type series struct {
+	labelValues []string
+	mu          sync.Mutex
+	value       float64
+	// только для гистограмм
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+}
+
+func (v *vec) get(values []string, init func(s *series)) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok = v.series[key]; ok {
+		return s
+	}
+	s = &series{labelValues: append([]string(nil), values...)}
+	if init != nil {
+		init(s)
+	}
+	v.series[key] = s
+	return s
+}
+
+// sorted — серии в стабильном порядке
+func (v *vec) sorted() []*series {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*series, len(keys))
+	for i, k := range keys {
+		out[i] = v.series[k]
+	}
+	return out
+}
+
+func (v *vec) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+}
+
+// =========================
+// COUNTER / GAUGE
+// =========================
+
+type CounterVec struct{ v *vec }
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{v: newVec(name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+	return &Counter{s: c.v.get(values, nil)}
+}
+
+func (c *CounterVec) write(w io.Writer) { writeValues(w, c.v) }
+
+type Counter struct{ s *series }
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) Add(delta float64) {
+	c.s.mu.Lock()
+	c.s.value += delta
+	c.s.mu.Unlock()
+}
+
+type GaugeVec struct{ v *vec }
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{v: newVec(name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+func (g *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return &Gauge{s: g.v.get(values, nil)}
+}
+
+func (g *GaugeVec) write(w io.Writer) { writeValues(w, g.v) }
+
+type Gauge struct{ s *series }
+
+func (g *Gauge) Set(value float64) {
+	g.s.mu.Lock()
+	g.s.value = value
+	g.s.mu.Unlock()
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) Add(delta float64) {
+	g.s.mu.Lock()
+	g.s.value += delta
+	g.s.mu.Unlock()
+}
+
+func writeValues(w io.Writer, v *vec) {
+	v.header(w)
+	for _, s := range v.sorted() {
+		s.mu.Lock()
+		value := s.value
+		s.mu.Unlock()
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.labelValues, "", ""), formatFloat(value))
+	}
+}
+
+// =========================
+// HISTOGRAM
+// =========================
+
+// DefBuckets — границы по умолчанию (секунды), как в клиенте Prometheus
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type HistogramVec struct {
+	v       *vec
+	buckets []float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{v: newVec(name, help, "histogram", labels), buckets: buckets}
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	s := h.v.get(values, func(s *series) { s.buckets = make([]uint64, len(h.buckets)) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, le := range h.buckets {
+		if value <= le {
+			s.buckets[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.v.header(w)
+	for _, s := range h.v.sorted() {
+		s.mu.Lock()
+		buckets := append([]uint64(nil), s.buckets...)
+		sum, count := s.sum, s.count
+		s.mu.Unlock()
+
+		for i, le := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.v.name,
+				formatLabels(h.v.labels, s.labelValues, "le", formatFloat(le)), buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.v.name, formatLabels(h.v.labels, s.labelValues, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.v.name, formatLabels(h.v.labels, s.labelValues, "", ""), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.v.name, formatLabels(h.v.labels, s.labelValues, "", ""), count)
+	}
+}
+
+// =========================
+// GAUGE FUNC
+// =========================
+
+// Sample — значение, вычисленное при скрейпе
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type gaugeFunc struct {
+	name, help, typ string
+	labels          []string
+	fn              func() []Sample
+}
+
+// NewGaugeFunc регистрирует gauge, значения которого считает fn при каждом скрейпе
+func NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	register(&gaugeFunc{name: name, help: help, typ: "gauge", labels: labels, fn: fn})
+}
+
+// NewCounterFunc — то же для монотонных значений, которые считает кто-то другой (например, pgxpool)
+func NewCounterFunc(name, help string, labels []string, fn func() []Sample) {
+	register(&gaugeFunc{name: name, help: help, typ: "counter", labels: labels, fn: fn})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", g.name, g.help, g.name, g.typ)
+	for _, s := range g.fn() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, s.LabelValues, "", ""), formatFloat(s.Value))
+	}
+}
+
+// =========================
+// FORMAT
+// =========================
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
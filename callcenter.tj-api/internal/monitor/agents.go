@@ -1,6 +1,11 @@
 package monitor
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"callcentrix/internal/metrics"
+)
 
 // =========================
 // TYPES
@@ -8,9 +13,29 @@ import "sync"
 
 type AgentState struct {
 	Name      string `json:"name"`
-	Status    string `json:"status"`
+	Status    string `json:"status"` // итоговый статус (см. effectiveStatus)
 	CallID    string `json:"callId,omitempty"`
 	IPAddress string `json:"ipAddress,omitempty"` // IP адрес агента
+
+	// Wrap-up: звонок, по которому агент заполняет результат, и до какого времени
+	WrapupCallID string     `json:"wrapupCallId,omitempty"`
+	WrapupQueue  string     `json:"wrapupQueue,omitempty"`
+	WrapupUntil  *time.Time `json:"wrapupUntil,omitempty"`
+
+	// Presence — статус по событиям телефонии (offline/idle/ringing/in-call/wrapup),
+	// Manual — статус, выставленный агентом вручную. Status вычисляется из обоих.
+	Presence string        `json:"presence,omitempty"`
+	Manual   *ManualStatus `json:"manual,omitempty"`
+}
+
+// ManualStatus — ручной статус агента: пауза или статус из каталога тенанта
+// ("Совещание", "Обучение"...). Paused — снят ли агент с очередей.
+type ManualStatus struct {
+	ID     int    `json:"id,omitempty"` // 0 — пауза не из каталога (с телефона, из очереди)
+	Code   string `json:"code"`
+	Name   string `json:"name,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Paused bool   `json:"paused"`
 }
 
 type AgentEvent struct {
@@ -26,6 +51,11 @@ type Store struct {
 	mu      sync.RWMutex
 	tenants map[int]map[string]AgentState
 	subs    map[int][]chan AgentEvent
+
+	// observer — вызывается на каждое изменение (репликация на другие инстансы)
+	observer func(tenantID int, agent AgentState)
+	// onChange — то же, но отдельно от репликации (история состояний на лидере)
+	onChange func(tenantID int, agent AgentState)
 }
 
 func NewStore() *Store {
@@ -50,10 +80,122 @@ func (s *Store) UpdateAgent(tenantID int, agent AgentState) {
 	old, ok := s.tenants[tenantID][agent.Name]
 
 	// Проверяем можно ли перезаписать статус
-	if ok && !canOverride(old.Status, agent.Status) {
+	if ok && !canOverride(old.PresenceStatus(), agent.Status) {
+		return
+	}
+
+	// Повторное событие в том же wrap-up (например, обновился IP) не должно терять его контекст
+	if ok && old.PresenceStatus() == "wrapup" && agent.Status == "wrapup" && agent.WrapupUntil == nil {
+		agent.WrapupCallID = old.WrapupCallID
+		agent.WrapupQueue = old.WrapupQueue
+		agent.WrapupUntil = old.WrapupUntil
+	}
+
+	// Ручной статус переживает звонки: после разговора агент вернётся в него
+	agent.Manual = old.Manual
+	s.store(tenantID, agent)
+}
+
+// SetManual выставляет (nil — снимает) ручной статус агента.
+// Звонковые состояния его перекрывают, но не сбрасывают.
+func (s *Store) SetManual(tenantID int, name string, manual *ManualStatus) AgentState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		s.tenants[tenantID] = make(map[string]AgentState)
+	}
+
+	agent, ok := s.tenants[tenantID][name]
+	if !ok {
+		agent = AgentState{Name: name, Status: "idle"}
+	}
+	agent.Status = agent.PresenceStatus()
+	agent.Manual = manual
+	s.store(tenantID, agent)
+	return s.tenants[tenantID][name]
+}
+
+// ClearCall сбрасывает агента в idle, если он всё ещё привязан к callID.
+// В обход canOverride — звонка больше нет, держать агента "в разговоре" нельзя.
+func (s *Store) ClearCall(tenantID int, name, callID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agent, ok := s.tenants[tenantID][name]
+	if !ok || agent.CallID != callID {
 		return
 	}
 
+	agent.Status = "idle"
+	agent.CallID = ""
+	s.store(tenantID, agent)
+}
+
+// SetAgent записывает состояние в обход canOverride — для явных переходов,
+// которые инициирует сам сервер (например, выход из wrap-up)
+func (s *Store) SetAgent(tenantID int, agent AgentState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		s.tenants[tenantID] = make(map[string]AgentState)
+	}
+	agent.Manual = s.tenants[tenantID][agent.Name].Manual
+	s.store(tenantID, agent)
+}
+
+// Apply записывает состояние агента как есть — без canOverride и без observer.
+// Используется репликой: источник истины — лидер.
+func (s *Store) Apply(tenantID int, agent AgentState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		s.tenants[tenantID] = make(map[string]AgentState)
+	}
+	s.set(tenantID, agent)
+}
+
+// Observe подписывает fn на все изменения стора. fn вызывается под локом — не блокировать.
+func (s *Store) Observe(fn func(tenantID int, agent AgentState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = fn
+}
+
+// OnChange подписывает fn на изменения состояния агентов (кроме Apply/Restore).
+// fn вызывается под локом — не блокировать.
+func (s *Store) OnChange(fn func(tenantID int, agent AgentState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = fn
+}
+
+// Reset очищает состояние (подписчики остаются)
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants = make(map[int]map[string]AgentState)
+}
+
+// store принимает agent.Status как presence, вычисляет итоговый статус,
+// сохраняет и отдаёт изменение observer-у. Вызывать под s.mu.
+func (s *Store) store(tenantID int, agent AgentState) {
+	agent.Presence = agent.Status
+	agent.Status = effectiveStatus(agent.Presence, agent.Manual)
+
+	s.set(tenantID, agent)
+	if s.observer != nil {
+		s.observer(tenantID, agent)
+	}
+	if s.onChange != nil {
+		s.onChange(tenantID, agent)
+	}
+}
+
+// set сохраняет агента и уведомляет подписчиков. Вызывать под s.mu.
+func (s *Store) set(tenantID int, agent AgentState) {
 	s.tenants[tenantID][agent.Name] = agent
 
 	// Отправляем событие подписчикам (WebSocket)
@@ -61,6 +203,7 @@ func (s *Store) UpdateAgent(tenantID int, agent AgentState) {
 		select {
 		case ch <- AgentEvent{TenantID: tenantID, Agent: agent}:
 		default:
+			metrics.DroppedNotifications.WithLabelValues("agents").Inc()
 		}
 	}
 }
@@ -76,6 +219,36 @@ func (s *Store) GetAgents(tenantID int) map[string]AgentState {
 	return out
 }
 
+// Export возвращает копию состояния всех тенантов (для снапшота)
+func (s *Store) Export() map[int]map[string]AgentState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[int]map[string]AgentState, len(s.tenants))
+	for tenantID, agents := range s.tenants {
+		out[tenantID] = make(map[string]AgentState, len(agents))
+		for k, v := range agents {
+			out[tenantID][k] = v
+		}
+	}
+	return out
+}
+
+// Restore загружает состояние из снапшота (только при старте, до AMI)
+func (s *Store) Restore(data map[int]map[string]AgentState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tenantID, agents := range data {
+		if s.tenants[tenantID] == nil {
+			s.tenants[tenantID] = make(map[string]AgentState)
+		}
+		for k, v := range agents {
+			s.tenants[tenantID][k] = v
+		}
+	}
+}
+
 // =========================
 // SUBSCRIPTIONS
 // =========================
@@ -99,14 +272,52 @@ func (s *Store) UnsubscribeAgents(tenantID int, ch chan AgentEvent) {
 	}
 }
 
-func canOverride(old, next string) bool {
-	prio := map[string]int{
-		"offline": 5,
-		"paused":  4,
-		"in-call": 3,
-		"ringing": 2,
-		"idle":    1,
+// =========================
+// STATUS PRIORITY
+// =========================
+
+// statusPriority — приоритеты presence. Ручной статус стоит между звонковыми
+// состояниями и idle: звонок перекрывает "Совещание", а после звонка агент
+// сам возвращается в него.
+var statusPriority = map[string]int{
+	"offline": 5,
+	"in-call": 3,
+	"wrapup":  3,
+	"ringing": 2,
+	"idle":    1,
+}
+
+// effectiveStatus — итоговый статус агента для мониторинга.
+// Кастомные статусы отображаются как paused/idle по своей семантике, детали — в Manual.
+func effectiveStatus(presence string, manual *ManualStatus) string {
+	if manual == nil || statusPriority[presence] > statusPriority["idle"] {
+		return presence
+	}
+	if manual.Paused {
+		return "paused"
 	}
+	return "idle"
+}
 
-	return prio[next] >= prio[old]
-}
\ No newline at end of file
+// PresenceStatus — presence агента; для состояний из старых снапшотов (без Presence)
+// берём Status, ручную паузу считаем idle
+func (a AgentState) PresenceStatus() string {
+	if a.Presence != "" {
+		return a.Presence
+	}
+	if a.Status == "paused" {
+		return "idle"
+	}
+	return a.Status
+}
+
+// canOverride — можно ли перезаписать presence: запоздавшее событие с меньшим
+// приоритетом не понижает состояние. Выход из звонка и из offline — явные
+// переходы (ClearCall, SetAgent). Wrap-up завершает только WrapupManager,
+// раньше его может прервать лишь уход в offline или новый звонок.
+func canOverride(old, next string) bool {
+	if old == "wrapup" {
+		return next != "idle"
+	}
+	return statusPriority[next] >= statusPriority[old]
+}
@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"callcentrix/internal/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =========================
+// CALLBACK BADGE MODEL
+// =========================
+
+// CallbackCounts — счётчик списка перезвонов для бейджа (WebSocket)
+type CallbackCounts struct {
+	Open     int `json:"open"`     // никто не взял
+	Claimed  int `json:"claimed"`  // взяты в работу
+	Warning  int `json:"warning"`  // скоро нарушат SLA
+	Breached int `json:"breached"` // SLA нарушен
+}
+
+// =========================
+// CALLBACK BADGE
+// =========================
+
+// CallbackBadge держит счётчики перезвонов по тенантам. Работает на каждом
+// инстансе (свои WS-клиенты): опрашивает callbacks раз в Interval, а после
+// изменений через API обновляется сразу (Refresh).
+type CallbackBadge struct {
+	DB       *pgxpool.Pool
+	SLA      time.Duration
+	Warn     time.Duration
+	Interval time.Duration
+
+	mu     sync.RWMutex
+	counts map[int]CallbackCounts
+
+	subMu sync.RWMutex
+	subs  map[int][]chan struct{}
+}
+
+func NewCallbackBadge(db *pgxpool.Pool, sla, warn time.Duration) *CallbackBadge {
+	return &CallbackBadge{
+		DB:       db,
+		SLA:      sla,
+		Warn:     warn,
+		Interval: 10 * time.Second,
+		counts:   make(map[int]CallbackCounts),
+		subs:     make(map[int][]chan struct{}),
+	}
+}
+
+// Get — счётчики тенанта
+func (b *CallbackBadge) Get(tenantID int) CallbackCounts {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.counts[tenantID]
+}
+
+// Run опрашивает БД до отмены ctx. SLA и предупреждение меняются со временем,
+// поэтому счётчики пересчитываются, даже если список не менялся.
+func (b *CallbackBadge) Run(ctx context.Context) {
+	t := time.NewTicker(b.Interval)
+	defer t.Stop()
+	for {
+		b.Refresh(ctx, 0)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Refresh пересчитывает счётчики тенанта (0 — всех тенантов) и уведомляет
+// подписчиков тех, у кого они изменились
+func (b *CallbackBadge) Refresh(ctx context.Context, tenantID int) {
+	rows, err := b.DB.Query(ctx, `
+		SELECT tenant_id,
+		       COUNT(*) FILTER (WHERE status = 'open'),
+		       COUNT(*) FILTER (WHERE status = 'claimed'),
+		       COUNT(*) FILTER (WHERE first_missed_at <= NOW() - make_interval(secs => $2)
+		                          AND first_missed_at >  NOW() - make_interval(secs => $3)),
+		       COUNT(*) FILTER (WHERE first_missed_at <= NOW() - make_interval(secs => $3))
+		FROM callbacks
+		WHERE status IN ('open', 'claimed') AND ($1 = 0 OR tenant_id = $1)
+		GROUP BY tenant_id`,
+		tenantID, b.Warn.Seconds(), b.SLA.Seconds())
+	if err != nil {
+		log.Printf("❌ Callback badge: %v", err)
+		return
+	}
+	fresh := make(map[int]CallbackCounts)
+	for rows.Next() {
+		var id int
+		var c CallbackCounts
+		if err := rows.Scan(&id, &c.Open, &c.Claimed, &c.Warning, &c.Breached); err != nil {
+			rows.Close()
+			log.Printf("❌ Callback badge scan: %v", err)
+			return
+		}
+		fresh[id] = c
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return
+	}
+
+	var changed []int
+	b.mu.Lock()
+	for id, old := range b.counts {
+		if tenantID != 0 && id != tenantID {
+			continue
+		}
+		// Список тенанта опустел — в выборке его нет
+		if _, ok := fresh[id]; !ok && old != (CallbackCounts{}) {
+			delete(b.counts, id)
+			changed = append(changed, id)
+		}
+	}
+	for id, c := range fresh {
+		if b.counts[id] != c {
+			b.counts[id] = c
+			changed = append(changed, id)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, id := range changed {
+		b.notify(id)
+	}
+}
+
+// =========================
+// SUBSCRIPTIONS
+// =========================
+
+func (b *CallbackBadge) Subscribe(tenantID int, ch chan struct{}) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	b.subs[tenantID] = append(b.subs[tenantID], ch)
+}
+
+func (b *CallbackBadge) Unsubscribe(tenantID int, ch chan struct{}) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	subs := b.subs[tenantID]
+	for i, c := range subs {
+		if c == ch {
+			b.subs[tenantID] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+}
+
+func (b *CallbackBadge) notify(tenantID int) {
+	b.subMu.RLock()
+	defer b.subMu.RUnlock()
+
+	for _, ch := range b.subs[tenantID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			metrics.DroppedNotifications.WithLabelValues("callbacks").Inc()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CallRecord — итоговая запись завершённого звонка (таблица calls)
+type CallRecord struct {
+	TenantID    int
+	Call        Call
+	EndedAt     time.Time
+	WaitSeconds int
+	TalkSeconds int
+	HoldSeconds int
+}
+
+// NewCallRecord считает итоговые длительности звонка на момент endedAt
+func NewCallRecord(tenantID int, call Call, endedAt time.Time) CallRecord {
+	rec := CallRecord{
+		TenantID:    tenantID,
+		Call:        call,
+		EndedAt:     endedAt,
+		WaitSeconds: call.WaitSeconds,
+		HoldSeconds: call.HoldSeconds,
+	}
+	if call.AnsweredAt != nil {
+		rec.TalkSeconds = int(endedAt.Sub(*call.AnsweredAt).Seconds())
+	} else {
+		// Неотвеченный звонок: всё время — ожидание
+		rec.WaitSeconds = int(endedAt.Sub(call.StartedAt).Seconds())
+	}
+	if call.OnHold && call.HeldAt != nil {
+		rec.HoldSeconds += int(endedAt.Sub(*call.HeldAt).Seconds())
+	}
+	return rec
+}
+
+// CallLog пишет завершённые звонки в таблицу calls.
+// Работает на лидере: завершение звонка приходит из CallStore.RemoveCall под локом,
+// поэтому запись идёт через очередь отдельной горутиной.
+type CallLog struct {
+	DB    *pgxpool.Pool
+	queue chan CallRecord
+}
+
+func NewCallLog(db *pgxpool.Pool) *CallLog {
+	return &CallLog{
+		DB:    db,
+		queue: make(chan CallRecord, 1024),
+	}
+}
+
+// Attach подписывает журнал на завершение звонков стора
+func (l *CallLog) Attach(calls *CallStore) {
+	calls.OnEnd(func(tenantID int, call Call, endedAt time.Time) {
+		select {
+		case l.queue <- NewCallRecord(tenantID, call, endedAt):
+		default:
+			log.Printf("⚠️ Call log: queue full, dropped call %s (tenant=%d)", call.ID, tenantID)
+		}
+	})
+}
+
+// Run пишет записи до отмены ctx, затем дописывает то, что осталось в очереди
+func (l *CallLog) Run(ctx context.Context) {
+	for {
+		select {
+		case rec := <-l.queue:
+			l.save(ctx, rec)
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case rec := <-l.queue:
+					l.save(flushCtx, rec)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *CallLog) save(ctx context.Context, rec CallRecord) {
+	c := rec.Call
+	_, err := l.DB.Exec(ctx, `
+		INSERT INTO calls (tenant_id, uniqueid, direction, src, dst, queue, agent, bridge_id,
+		                   started_at, answered_at, ended_at, wait_seconds, talk_seconds, hold_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (tenant_id, uniqueid) DO UPDATE SET
+			agent        = COALESCE(EXCLUDED.agent, calls.agent),
+			answered_at  = COALESCE(EXCLUDED.answered_at, calls.answered_at),
+			ended_at     = EXCLUDED.ended_at,
+			wait_seconds = EXCLUDED.wait_seconds,
+			talk_seconds = EXCLUDED.talk_seconds,
+			hold_seconds = EXCLUDED.hold_seconds`,
+		rec.TenantID, c.ID, nullIfEmpty(c.Direction), c.From, c.To, nullIfEmpty(c.Queue),
+		nullIfEmpty(c.Agent), nullIfEmpty(c.BridgeID), c.StartedAt, c.AnsweredAt, rec.EndedAt,
+		rec.WaitSeconds, rec.TalkSeconds, rec.HoldSeconds,
+	)
+	if err != nil {
+		log.Printf("❌ Call log save %s (tenant=%d): %v", c.ID, rec.TenantID, err)
+	}
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -3,6 +3,8 @@ package monitor
 import (
 	"sync"
 	"time"
+
+	"callcentrix/internal/metrics"
 )
 
 // =========================
@@ -16,8 +18,25 @@ type Call struct {
 	Channel   string    `json:"channel"`   // Primary channel (для обратной совместимости)
 	Channels  []string  `json:"channels"`  // Все каналы участников звонка
 	StartedAt time.Time `json:"startedAt"`
+
+	Direction   string     `json:"direction,omitempty"` // inbound / outbound / internal
+	Queue       string     `json:"queue,omitempty"`
+	Agent       string     `json:"agent,omitempty"` // SIP номер ответившего агента
+	AnsweredAt  *time.Time `json:"answeredAt,omitempty"`
+	WaitSeconds int        `json:"waitSeconds"` // ожидание до ответа
+	BridgeID    string     `json:"bridgeId,omitempty"`
+	OnHold      bool       `json:"onHold"`
+	HeldAt      *time.Time `json:"heldAt,omitempty"` // начало текущего удержания
+	HoldSeconds int        `json:"holdSeconds"`      // суммарное завершённое удержание
 }
 
+// Call directions
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+	DirectionInternal = "internal"
+)
+
 // =========================
 // CALL STORE
 // =========================
@@ -27,6 +46,11 @@ type CallStore struct {
 	calls       map[int]map[string]Call // tenantID → callID → Call
 	subscribers map[int][]chan struct{} // tenantID → channels
 	subMu       sync.RWMutex
+
+	// observer — вызывается на каждое изменение; call == nil означает удаление
+	observer func(tenantID int, callID string, call *Call)
+	// onEnd — вызывается при завершении звонка (RemoveCall), но не при Apply/Reset
+	onEnd func(tenantID int, call Call, endedAt time.Time)
 }
 
 func NewCallStore() *CallStore {
@@ -48,9 +72,11 @@ func (s *CallStore) UpdateCall(tenantID int, call Call) {
 		s.calls[tenantID] = make(map[string]Call)
 	}
 
-	// если звонок новый — фиксируем старт и создаём массив каналов
+	// если звонок новый — фиксируем старт (если не передан) и создаём массив каналов
 	if existing, ok := s.calls[tenantID][call.ID]; !ok {
-		call.StartedAt = time.Now()
+		if call.StartedAt.IsZero() {
+			call.StartedAt = time.Now()
+		}
 		// Инициализируем массив каналов
 		if call.Channel != "" {
 			call.Channels = []string{call.Channel}
@@ -58,6 +84,28 @@ func (s *CallStore) UpdateCall(tenantID int, call Call) {
 	} else {
 		// Звонок уже существует - сохраняем StartedAt
 		call.StartedAt = existing.StartedAt
+
+		// Атрибуты, накопленные по ходу звонка, событие могло не передать
+		if call.Direction == "" {
+			call.Direction = existing.Direction
+		}
+		if call.Queue == "" {
+			call.Queue = existing.Queue
+		}
+		if call.Agent == "" {
+			call.Agent = existing.Agent
+		}
+		if call.AnsweredAt == nil {
+			call.AnsweredAt = existing.AnsweredAt
+			call.WaitSeconds = existing.WaitSeconds
+		}
+		if call.BridgeID == "" {
+			call.BridgeID = existing.BridgeID
+		}
+		// Удержание меняет только Update (Hold/Unhold)
+		call.OnHold = existing.OnHold
+		call.HeldAt = existing.HeldAt
+		call.HoldSeconds = existing.HoldSeconds
 		
 		// Объединяем каналы (добавляем новый если его нет)
 		call.Channels = existing.Channels
@@ -76,6 +124,9 @@ func (s *CallStore) UpdateCall(tenantID int, call Call) {
 	}
 
 	s.calls[tenantID][call.ID] = call
+	if s.observer != nil {
+		s.observer(tenantID, call.ID, &call)
+	}
 	
 	// ✅ УВЕДОМЛЯЕМ подписчиков!
 	s.notifySubscribers(tenantID)
@@ -85,16 +136,96 @@ func (s *CallStore) RemoveCall(tenantID int, callID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.calls[tenantID]; !ok {
+	call, ok := s.calls[tenantID][callID]
+	if !ok {
 		return
 	}
 
 	delete(s.calls[tenantID], callID)
+	if s.onEnd != nil {
+		s.onEnd(tenantID, call, time.Now())
+	}
+	if s.observer != nil {
+		s.observer(tenantID, callID, nil)
+	}
 	
 	// ✅ УВЕДОМЛЯЕМ подписчиков!
 	s.notifySubscribers(tenantID)
 }
 
+// DropCall удаляет звонок без записи в журнал (onEnd): для зависших звонков,
+// конец которых не наблюдали — их длительности недостоверны.
+func (s *CallStore) DropCall(tenantID int, callID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.calls[tenantID][callID]; !ok {
+		return
+	}
+
+	delete(s.calls[tenantID], callID)
+	if s.observer != nil {
+		s.observer(tenantID, callID, nil)
+	}
+	s.notifySubscribers(tenantID)
+}
+
+// Update изменяет существующий звонок через fn. false — звонка нет.
+func (s *CallStore) Update(tenantID int, callID string, fn func(c *Call)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	call, ok := s.calls[tenantID][callID]
+	if !ok {
+		return false
+	}
+	fn(&call)
+	s.calls[tenantID][callID] = call
+	if s.observer != nil {
+		s.observer(tenantID, callID, &call)
+	}
+	s.notifySubscribers(tenantID)
+	return true
+}
+
+// Apply записывает (call != nil) или удаляет (call == nil) звонок как есть,
+// без слияния каналов и без observer. Используется репликой.
+func (s *CallStore) Apply(tenantID int, callID string, call *Call) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if call == nil {
+		delete(s.calls[tenantID], callID)
+	} else {
+		if s.calls[tenantID] == nil {
+			s.calls[tenantID] = make(map[string]Call)
+		}
+		s.calls[tenantID][callID] = *call
+	}
+	s.notifySubscribers(tenantID)
+}
+
+// Observe подписывает fn на все изменения стора. fn вызывается под локом — не блокировать.
+func (s *CallStore) Observe(fn func(tenantID int, callID string, call *Call)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = fn
+}
+
+// OnEnd подписывает fn на завершение звонков. fn вызывается под локом — не блокировать.
+func (s *CallStore) OnEnd(fn func(tenantID int, call Call, endedAt time.Time)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onEnd = fn
+}
+
+// Reset очищает все звонки (подписчики остаются)
+func (s *CallStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = make(map[int]map[string]Call)
+}
+
 func (s *CallStore) GetCalls(tenantID int) map[string]Call {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -106,6 +237,37 @@ func (s *CallStore) GetCalls(tenantID int) map[string]Call {
 	return out
 }
 
+// Export возвращает копию всех звонков по тенантам (для снапшота)
+func (s *CallStore) Export() map[int]map[string]Call {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[int]map[string]Call, len(s.calls))
+	for tenantID, calls := range s.calls {
+		out[tenantID] = make(map[string]Call, len(calls))
+		for k, v := range calls {
+			out[tenantID][k] = v
+		}
+	}
+	return out
+}
+
+// Restore загружает звонки из снапшота как есть — с оригинальным StartedAt.
+// Дальнейшие UpdateCall по этим звонкам StartedAt уже не трогают.
+func (s *CallStore) Restore(data map[int]map[string]Call) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tenantID, calls := range data {
+		if s.calls[tenantID] == nil {
+			s.calls[tenantID] = make(map[string]Call)
+		}
+		for k, v := range calls {
+			s.calls[tenantID][k] = v
+		}
+	}
+}
+
 // =========================
 // SUBSCRIPTIONS
 // =========================
@@ -138,6 +300,7 @@ func (s *CallStore) notifySubscribers(tenantID int) {
 		case ch <- struct{}{}:
 		default:
 			// Канал заполнен, пропускаем
+			metrics.DroppedNotifications.WithLabelValues("calls").Inc()
 		}
 	}
 }
\ No newline at end of file
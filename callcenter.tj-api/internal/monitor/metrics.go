@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"strconv"
+
+	"callcentrix/internal/metrics"
+)
+
+// RegisterMetrics экспортирует размеры живых сторов по тенантам (считаются при скрейпе)
+func RegisterMetrics(agents *Store, calls *CallStore) {
+	metrics.NewGaugeFunc("callcentrix_live_calls", "Live calls per tenant",
+		[]string{"tenant"}, func() []metrics.Sample {
+			var out []metrics.Sample
+			for tenantID, c := range calls.Export() {
+				out = append(out, metrics.Sample{
+					LabelValues: []string{strconv.Itoa(tenantID)},
+					Value:       float64(len(c)),
+				})
+			}
+			return out
+		})
+
+	metrics.NewGaugeFunc("callcentrix_live_agents", "Tracked agents per tenant and status",
+		[]string{"tenant", "status"}, func() []metrics.Sample {
+			var out []metrics.Sample
+			for tenantID, list := range agents.Export() {
+				byStatus := make(map[string]int)
+				for _, a := range list {
+					byStatus[a.Status]++
+				}
+				for status, n := range byStatus {
+					out = append(out, metrics.Sample{
+						LabelValues: []string{strconv.Itoa(tenantID), status},
+						Value:       float64(n),
+					})
+				}
+			}
+			return out
+		})
+}
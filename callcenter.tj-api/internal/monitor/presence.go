@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"callcentrix/internal/metrics"
+)
+
+// =========================
+// PRESENCE MODEL
+// =========================
+
+// Presence — состояние extension для BLF/справочника (все номера тенанта, не только агенты очередей)
+type Presence struct {
+	Extension   string    `json:"extension"`
+	Status      string    `json:"status"`                // available / busy / ringing / offline / dnd
+	DeviceState string    `json:"deviceState,omitempty"` // как прислал Asterisk: NOT_INUSE, INUSE, RINGING...
+	DND         bool      `json:"dnd"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type PresenceEvent struct {
+	TenantID int
+	Presence Presence
+}
+
+// presenceStatus сводит device state Asterisk и DND в статус справочника.
+// Недоступное устройство — offline даже при DND; DND перекрывает остальное.
+func presenceStatus(deviceState string, dnd bool) string {
+	switch deviceState {
+	case "UNAVAILABLE", "INVALID", "UNKNOWN", "":
+		return "offline"
+	}
+	if dnd {
+		return "dnd"
+	}
+	switch deviceState {
+	case "RINGING", "RINGINUSE":
+		return "ringing"
+	case "INUSE", "BUSY", "ONHOLD":
+		return "busy"
+	default:
+		return "available"
+	}
+}
+
+// =========================
+// PRESENCE STORE
+// =========================
+
+type PresenceStore struct {
+	mu      sync.RWMutex
+	tenants map[int]map[string]Presence
+	subs    map[int][]chan PresenceEvent
+
+	// observer — вызывается на каждое изменение (репликация на другие инстансы)
+	observer func(tenantID int, p Presence)
+}
+
+func NewPresenceStore() *PresenceStore {
+	return &PresenceStore{
+		tenants: make(map[int]map[string]Presence),
+		subs:    make(map[int][]chan PresenceEvent),
+	}
+}
+
+// SetDeviceState обновляет device state extension (DeviceStateChange)
+func (s *PresenceStore) SetDeviceState(tenantID int, ext, state string) {
+	s.update(tenantID, ext, func(p *Presence) { p.DeviceState = state })
+}
+
+// SetDND обновляет флаг "не беспокоить" (PresenceStateChange)
+func (s *PresenceStore) SetDND(tenantID int, ext string, dnd bool) {
+	s.update(tenantID, ext, func(p *Presence) { p.DND = dnd })
+}
+
+func (s *PresenceStore) update(tenantID int, ext string, fn func(p *Presence)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		s.tenants[tenantID] = make(map[string]Presence)
+	}
+
+	old, ok := s.tenants[tenantID][ext]
+	p := old
+	p.Extension = ext
+	fn(&p)
+	p.Status = presenceStatus(p.DeviceState, p.DND)
+
+	// DeviceStateChange приходит часто и с теми же значениями — шумим только при изменении
+	if ok && p.Status == old.Status && p.DeviceState == old.DeviceState && p.DND == old.DND {
+		return
+	}
+	p.UpdatedAt = time.Now()
+
+	s.set(tenantID, p)
+	if s.observer != nil {
+		s.observer(tenantID, p)
+	}
+}
+
+// Apply записывает состояние как есть — без observer. Используется репликой.
+func (s *PresenceStore) Apply(tenantID int, p Presence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		s.tenants[tenantID] = make(map[string]Presence)
+	}
+	s.set(tenantID, p)
+}
+
+// Observe подписывает fn на все изменения стора. fn вызывается под локом — не блокировать.
+func (s *PresenceStore) Observe(fn func(tenantID int, p Presence)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = fn
+}
+
+// Reset очищает состояние (подписчики остаются)
+func (s *PresenceStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants = make(map[int]map[string]Presence)
+}
+
+// set сохраняет состояние и уведомляет подписчиков. Вызывать под s.mu.
+func (s *PresenceStore) set(tenantID int, p Presence) {
+	s.tenants[tenantID][p.Extension] = p
+
+	for _, ch := range s.subs[tenantID] {
+		select {
+		case ch <- PresenceEvent{TenantID: tenantID, Presence: p}:
+		default:
+			metrics.DroppedNotifications.WithLabelValues("presence").Inc()
+		}
+	}
+}
+
+func (s *PresenceStore) Get(tenantID int) map[string]Presence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[string]Presence, len(s.tenants[tenantID]))
+	for k, v := range s.tenants[tenantID] {
+		out[k] = v
+	}
+	return out
+}
+
+// Export возвращает копию состояния всех тенантов (для снапшота)
+func (s *PresenceStore) Export() map[int]map[string]Presence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[int]map[string]Presence, len(s.tenants))
+	for tenantID, entries := range s.tenants {
+		out[tenantID] = make(map[string]Presence, len(entries))
+		for k, v := range entries {
+			out[tenantID][k] = v
+		}
+	}
+	return out
+}
+
+// Restore загружает состояние из снапшота (только при старте, до AMI).
+// Актуальные значения придут в ответ на DeviceStateList.
+func (s *PresenceStore) Restore(data map[int]map[string]Presence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tenantID, entries := range data {
+		if s.tenants[tenantID] == nil {
+			s.tenants[tenantID] = make(map[string]Presence)
+		}
+		for k, v := range entries {
+			s.tenants[tenantID][k] = v
+		}
+	}
+}
+
+// =========================
+// SUBSCRIPTIONS
+// =========================
+
+func (s *PresenceStore) Subscribe(tenantID int, ch chan PresenceEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[tenantID] = append(s.subs[tenantID], ch)
+}
+
+func (s *PresenceStore) Unsubscribe(tenantID int, ch chan PresenceEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := s.subs[tenantID]
+	for i, c := range subs {
+		if c == ch {
+			s.subs[tenantID] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+}
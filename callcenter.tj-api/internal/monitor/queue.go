@@ -1,6 +1,10 @@
 package monitor
 
-import "sync"
+import (
+	"sync"
+
+	"callcentrix/internal/metrics"
+)
 
 type QueueStats struct {
 	Name string `json:"name"`
@@ -19,6 +23,9 @@ type QueueStore struct {
 	mu     sync.RWMutex
 	queues map[int]map[string]*QueueStats
 	subs   map[int][]chan struct{} // 🔔 subscribers per tenant
+
+	// observer — вызывается на каждое изменение (репликация на другие инстансы)
+	observer func(tenantID int, q QueueStats)
 }
 
 func NewQueueStore() *QueueStore {
@@ -60,11 +67,44 @@ func (s *QueueStore) Update(
 		q.Agents = 0
 	}
 
-	// 🔔 уведомляем подписчиков
+	if s.observer != nil {
+		s.observer(tenantID, *q)
+	}
+
+	s.notify(tenantID)
+}
+
+// Apply записывает статистику очереди как есть, без observer. Используется репликой.
+func (s *QueueStore) Apply(tenantID int, stats QueueStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.ensure(tenantID, stats.Name)
+	*q = stats
+	s.notify(tenantID)
+}
+
+// Observe подписывает fn на все изменения стора. fn вызывается под локом — не блокировать.
+func (s *QueueStore) Observe(fn func(tenantID int, q QueueStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = fn
+}
+
+// Reset очищает статистику очередей (подписчики остаются)
+func (s *QueueStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queues = make(map[int]map[string]*QueueStats)
+}
+
+// 🔔 уведомляем подписчиков. Вызывать под s.mu.
+func (s *QueueStore) notify(tenantID int) {
 	for _, ch := range s.subs[tenantID] {
 		select {
 		case ch <- struct{}{}:
 		default:
+			metrics.DroppedNotifications.WithLabelValues("queues").Inc()
 		}
 	}
 }
@@ -80,6 +120,39 @@ func (s *QueueStore) Snapshot(tenantID int) map[string]QueueStats {
 	return out
 }
 
+// Export возвращает копию статистики всех очередей (для снапшота)
+func (s *QueueStore) Export() map[int]map[string]QueueStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[int]map[string]QueueStats, len(s.queues))
+	for tenantID, queues := range s.queues {
+		out[tenantID] = make(map[string]QueueStats, len(queues))
+		for k, v := range queues {
+			out[tenantID][k] = *v
+		}
+	}
+	return out
+}
+
+// Restore загружает очереди из снапшота.
+// Agents/InCall/Waiting обнуляются — их заново пересчитает ответ на QueueStatus
+// (QueueMember / QueueEntry), иначе счётчики удвоятся.
+func (s *QueueStore) Restore(data map[int]map[string]QueueStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tenantID, queues := range data {
+		for name, v := range queues {
+			q := s.ensure(tenantID, name)
+			*q = v
+			q.Agents = 0
+			q.InCall = 0
+			q.Waiting = 0
+		}
+	}
+}
+
 // =========================
 // SUBSCRIPTIONS
 // =========================
@@ -0,0 +1,223 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =========================
+// SNAPSHOT MODEL
+// =========================
+
+// Snapshot — состояние живого мониторинга на момент сохранения
+type Snapshot struct {
+	TakenAt time.Time                     `json:"takenAt"`
+	Seq     uint64                        `json:"seq"` // номер последнего опубликованного изменения (кластер)
+	Agents  map[int]map[string]AgentState `json:"agents"`
+	Calls   map[int]map[string]Call       `json:"calls"`
+	Queues  map[int]map[string]QueueStats `json:"queues"`
+
+	Presence map[int]map[string]Presence `json:"presence,omitempty"`
+}
+
+// SnapshotBackend — куда сохраняется снапшот (Postgres или локальный файл)
+type SnapshotBackend interface {
+	Save(ctx context.Context, snap *Snapshot) error
+	// Load возвращает nil, nil если снапшота нет
+	Load(ctx context.Context) (*Snapshot, error)
+}
+
+// =========================
+// POSTGRES BACKEND
+// =========================
+
+type PGSnapshotBackend struct {
+	DB  *pgxpool.Pool
+	Key string // id строки в monitor_snapshots
+}
+
+func (b *PGSnapshotBackend) Save(ctx context.Context, snap *Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	_, err = b.DB.Exec(ctx, `
+		INSERT INTO monitor_snapshots (id, data, taken_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET
+			data     = EXCLUDED.data,
+			taken_at = EXCLUDED.taken_at`,
+		b.Key, data, snap.TakenAt,
+	)
+	return err
+}
+
+func (b *PGSnapshotBackend) Load(ctx context.Context) (*Snapshot, error) {
+	var data []byte
+	err := b.DB.QueryRow(ctx,
+		`SELECT data FROM monitor_snapshots WHERE id = $1`, b.Key,
+	).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// =========================
+// FILE BACKEND
+// =========================
+
+type FileSnapshotBackend struct {
+	Path string
+}
+
+func (b *FileSnapshotBackend) Save(_ context.Context, snap *Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0755); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл и переименовываем — чтобы не оставить битый JSON
+	tmp := b.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.Path)
+}
+
+func (b *FileSnapshotBackend) Load(_ context.Context) (*Snapshot, error) {
+	data, err := os.ReadFile(b.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// =========================
+// PERSISTER
+// =========================
+
+// Persister периодически сохраняет сторы и восстанавливает их при старте.
+// Сверка с Asterisk после восстановления идёт штатно: CoreShowChannelsComplete
+// убирает звонки без живых каналов, QueueStatus пересчитывает очереди.
+type Persister struct {
+	Agents   *Store
+	Calls    *CallStore
+	Queues   *QueueStore
+	Presence *PresenceStore // nil — presence не сохраняется
+	Backend  SnapshotBackend
+	Interval time.Duration
+	MaxAge   time.Duration // снапшот старше — не восстанавливаем
+
+	// Кластер: номер изменения на момент снапшота и уведомление о сохранении
+	SeqFunc func() uint64
+	OnSaved func(snap *Snapshot)
+}
+
+func (p *Persister) Take() *Snapshot {
+	snap := &Snapshot{TakenAt: time.Now()}
+	// Seq берём ДО экспорта: всё, что опубликовано до него, уже в сторах
+	if p.SeqFunc != nil {
+		snap.Seq = p.SeqFunc()
+	}
+	snap.Agents = p.Agents.Export()
+	snap.Calls = p.Calls.Export()
+	snap.Queues = p.Queues.Export()
+	if p.Presence != nil {
+		snap.Presence = p.Presence.Export()
+	}
+	return snap
+}
+
+func (p *Persister) Save(ctx context.Context) error {
+	snap := p.Take()
+	if err := p.Backend.Save(ctx, snap); err != nil {
+		return err
+	}
+	if p.OnSaved != nil {
+		p.OnSaved(snap)
+	}
+	return nil
+}
+
+// Restore загружает последний снапшот в сторы. Вызывать до старта AMI.
+func (p *Persister) Restore(ctx context.Context) error {
+	snap, err := p.Backend.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if snap == nil {
+		log.Println("💾 Monitor snapshot: nothing to restore")
+		return nil
+	}
+
+	age := time.Since(snap.TakenAt)
+	if p.MaxAge > 0 && age > p.MaxAge {
+		log.Printf("💾 Monitor snapshot is too old (%s), skipping restore", age.Round(time.Second))
+		return nil
+	}
+
+	p.Agents.Restore(snap.Agents)
+	p.Calls.Restore(snap.Calls)
+	p.Queues.Restore(snap.Queues)
+	if p.Presence != nil {
+		p.Presence.Restore(snap.Presence)
+	}
+
+	log.Printf("💾 Monitor snapshot restored: age=%s tenants(agents)=%d tenants(calls)=%d",
+		age.Round(time.Second), len(snap.Agents), len(snap.Calls))
+	return nil
+}
+
+// Run сохраняет снапшот каждые Interval и ещё раз при отмене ctx (shutdown)
+func (p *Persister) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Save(ctx); err != nil {
+				log.Printf("❌ Monitor snapshot save: %v", err)
+			}
+
+		case <-ctx.Done():
+			// ctx уже отменён — финальное сохранение с собственным таймаутом
+			saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := p.Save(saveCtx); err != nil {
+				log.Printf("❌ Monitor snapshot final save: %v", err)
+			} else {
+				log.Println("💾 Monitor snapshot saved on shutdown")
+			}
+			cancel()
+			return
+		}
+	}
+}
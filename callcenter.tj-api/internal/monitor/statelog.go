@@ -0,0 +1,103 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StateChange — смена состояния агента (таблица agent_state_history)
+type StateChange struct {
+	TenantID  int
+	Agent     string
+	Status    string // итоговый статус: offline / idle / ringing / in-call / wrapup / paused
+	Presence  string
+	Manual    string // код ручного статуса, "" — нет
+	ChangedAt time.Time
+}
+
+// StateLog пишет историю состояний агентов для отчётов (пауза, wrap-up).
+// Строка — момент перехода; интервал длится до следующей строки агента.
+// Работает на лидере, как CallLog: изменения приходят из Store под локом.
+type StateLog struct {
+	DB    *pgxpool.Pool
+	queue chan StateChange
+	last  map[stateKey]StateChange // только в горутине Run
+}
+
+type stateKey struct {
+	tenantID int
+	agent    string
+}
+
+func NewStateLog(db *pgxpool.Pool) *StateLog {
+	return &StateLog{
+		DB:    db,
+		queue: make(chan StateChange, 1024),
+	}
+}
+
+// Attach подписывает журнал на изменения агентов стора
+func (l *StateLog) Attach(agents *Store) {
+	agents.OnChange(func(tenantID int, agent AgentState) {
+		ch := StateChange{
+			TenantID:  tenantID,
+			Agent:     agent.Name,
+			Status:    agent.Status,
+			Presence:  agent.PresenceStatus(),
+			ChangedAt: time.Now(),
+		}
+		if agent.Manual != nil {
+			ch.Manual = agent.Manual.Code
+		}
+		select {
+		case l.queue <- ch:
+		default:
+			log.Printf("⚠️ State log: queue full, dropped %s → %s (tenant=%d)", agent.Name, agent.Status, tenantID)
+		}
+	})
+}
+
+// Run пишет переходы до отмены ctx, затем дописывает то, что осталось в очереди.
+// Пока инстанс не был лидером, переходы писал другой — начинаем с чистого листа.
+func (l *StateLog) Run(ctx context.Context) {
+	l.last = make(map[stateKey]StateChange)
+	for {
+		select {
+		case ch := <-l.queue:
+			l.save(ctx, ch)
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case ch := <-l.queue:
+					l.save(flushCtx, ch)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// save пишет только реальные переходы: повторные события (обновился IP,
+// продлился wrap-up) статус не меняют
+func (l *StateLog) save(ctx context.Context, ch StateChange) {
+	key := stateKey{ch.TenantID, ch.Agent}
+	if prev, ok := l.last[key]; ok && prev.Status == ch.Status && prev.Manual == ch.Manual {
+		return
+	}
+	_, err := l.DB.Exec(ctx, `
+		INSERT INTO agent_state_history (tenant_id, agent, status, presence, manual_code, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		ch.TenantID, ch.Agent, ch.Status, nullIfEmpty(ch.Presence), nullIfEmpty(ch.Manual), ch.ChangedAt,
+	)
+	if err != nil {
+		log.Printf("❌ State log save %s (tenant=%d): %v", ch.Agent, ch.TenantID, err)
+		return
+	}
+	l.last[key] = ch
+}
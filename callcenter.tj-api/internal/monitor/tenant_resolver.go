@@ -2,21 +2,41 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Кэш номеров: без него каждое событие — запрос в БД на пути AMI.
+// Переназначенный номер распознаётся заново не позже чем через hitTTL,
+// новый extension — через missTTL.
+const (
+	hitTTL        = 10 * time.Minute // сколько помнить тенант номера
+	missTTL       = 5 * time.Minute  // сколько помнить, что номер внешний
+	maxEntries    = 50000            // предел записей кэша
+	lookupTimeout = 2 * time.Second  // запрос в БД на пути AMI-событий
+)
+
+type tenantEntry struct {
+	tenantID int // 0 — номер внешний
+	until    time.Time
+}
+
 type TenantResolver struct {
 	db    *pgxpool.Pool
-	cache map[string]int
+	mu    sync.RWMutex
+	cache map[string]tenantEntry
 }
 
 func NewTenantResolver(db *pgxpool.Pool) *TenantResolver {
 	return &TenantResolver{
 		db:    db,
-		cache: make(map[string]int),
+		cache: make(map[string]tenantEntry),
 	}
 }
 
@@ -34,22 +54,7 @@ func (r *TenantResolver) Resolve(event map[string]string) int {
 		if ext == "" {
 			continue
 		}
-
-		// 1️⃣ cache
-		if t, ok := r.cache[ext]; ok {
-			return t
-		}
-
-		// 2️⃣ db lookup
-		var tenantID int
-		err := r.db.QueryRow(
-			context.Background(),
-			`SELECT tenant_id FROM ast_ps_endpoints WHERE id = $1`,
-			ext,
-		).Scan(&tenantID)
-
-		if err == nil {
-			r.cache[ext] = tenantID
+		if tenantID := r.lookup(ext); tenantID != 0 {
 			return tenantID
 		}
 	}
@@ -64,27 +69,60 @@ func (r *TenantResolver) ResolveByExtension(ext string) int {
 		return 0
 	}
 
+	return r.lookup(ext)
+}
+
+// lookup — tenant extension из кэша или ast_ps_endpoints; 0 — не extension.
+// Запрос в БД идёт без блокировки: медленная БД не держит остальные lookup.
+func (r *TenantResolver) lookup(ext string) int {
 	// 1️⃣ cache
-	if t, ok := r.cache[ext]; ok {
-		return t
+	r.mu.RLock()
+	e, ok := r.cache[ext]
+	r.mu.RUnlock()
+	if ok && time.Now().Before(e.until) {
+		return e.tenantID
 	}
 
 	// 2️⃣ db lookup
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
 	var tenantID int
-	err := r.db.QueryRow(
-		context.Background(),
+	err := r.db.QueryRow(ctx,
 		`SELECT tenant_id FROM ast_ps_endpoints WHERE id = $1`,
 		ext,
 	).Scan(&tenantID)
 
-	if err != nil {
-		return 0
+	ttl := hitTTL
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		tenantID, ttl = 0, missTTL
+	case err != nil:
+		// БД недоступна — до следующей попытки живём старым значением
+		return e.tenantID
 	}
 
-	r.cache[ext] = tenantID
+	r.mu.Lock()
+	r.store(ext, tenantEntry{tenantID: tenantID, until: time.Now().Add(ttl)})
+	r.mu.Unlock()
 	return tenantID
 }
 
+// store запоминает номер; просроченные записи вычищаются по мере роста
+func (r *TenantResolver) store(ext string, e tenantEntry) {
+	if _, ok := r.cache[ext]; !ok && len(r.cache) >= maxEntries {
+		now := time.Now()
+		for k, old := range r.cache {
+			if now.After(old.until) {
+				delete(r.cache, k)
+			}
+		}
+		if len(r.cache) >= maxEntries {
+			return
+		}
+	}
+	r.cache[ext] = e
+}
+
 func extractExt(v string) string {
 	if v == "" {
 		return ""
@@ -0,0 +1,192 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Font — TrueType-шрифт для встраивания (CIDFontType2, Identity-H).
+// Встраивается целиком, без subsetting: отчёты небольшие, а шрифт сжимается.
+type Font struct {
+	data       []byte
+	unitsPerEm int
+	glyphs     map[rune]uint16 // cmap: символ → glyph id
+	advances   []uint16        // hmtx: ширина глифа в единицах шрифта
+	ascent     int
+	descent    int
+	bbox       [4]int
+}
+
+// LoadFont читает TTF (glyf-outlines; OTF с CFF не поддерживается)
+func LoadFont(path string) (*Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFont(data)
+}
+
+func parseFont(data []byte) (*Font, error) {
+	if len(data) < 12 {
+		return nil, errors.New("pdf: font too short")
+	}
+	if v := binary.BigEndian.Uint32(data); v != 0x00010000 && v != 0x74727565 { // 1.0 / 'true'
+		return nil, errors.New("pdf: not a TrueType font")
+	}
+	tables := map[string][]byte{}
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < n; i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, errors.New("pdf: truncated table directory")
+		}
+		tag := string(data[rec : rec+4])
+		off := int(binary.BigEndian.Uint32(data[rec+8:]))
+		length := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if off+length > len(data) {
+			return nil, fmt.Errorf("pdf: table %s out of bounds", tag)
+		}
+		tables[tag] = data[off : off+length]
+	}
+	for _, t := range []string{"head", "hhea", "hmtx", "cmap", "maxp", "glyf"} {
+		if tables[t] == nil {
+			return nil, fmt.Errorf("pdf: font has no %s table", t)
+		}
+	}
+
+	f := &Font{data: data, glyphs: map[rune]uint16{}}
+	head, hhea := tables["head"], tables["hhea"]
+	if len(head) < 54 || len(hhea) < 36 {
+		return nil, errors.New("pdf: bad head/hhea")
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	if f.unitsPerEm == 0 {
+		return nil, errors.New("pdf: unitsPerEm is 0")
+	}
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	f.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+
+	numGlyphs := int(binary.BigEndian.Uint16(tables["maxp"][4:]))
+	numMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	hmtx := tables["hmtx"]
+	if numMetrics == 0 || len(hmtx) < 4*numMetrics {
+		return nil, errors.New("pdf: bad hmtx")
+	}
+	f.advances = make([]uint16, numGlyphs)
+	for g := 0; g < numGlyphs; g++ {
+		m := g
+		if m >= numMetrics {
+			m = numMetrics - 1 // моноширинный хвост: ширина последней метрики
+		}
+		f.advances[g] = binary.BigEndian.Uint16(hmtx[4*m:])
+	}
+
+	if err := f.parseCmap(tables["cmap"]); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseCmap — Unicode-подтаблица формата 12 (полный Unicode) или 4 (BMP)
+func (f *Font) parseCmap(cmap []byte) error {
+	if len(cmap) < 4 {
+		return errors.New("pdf: bad cmap")
+	}
+	var fmt4, fmt12 []byte
+	n := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < n; i++ {
+		rec := 4 + 8*i
+		if rec+8 > len(cmap) {
+			break
+		}
+		platform := binary.BigEndian.Uint16(cmap[rec:])
+		encoding := binary.BigEndian.Uint16(cmap[rec+2:])
+		off := int(binary.BigEndian.Uint32(cmap[rec+4:]))
+		if off+2 > len(cmap) {
+			continue
+		}
+		sub := cmap[off:]
+		unicode := platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))
+		if !unicode {
+			continue
+		}
+		switch binary.BigEndian.Uint16(sub) {
+		case 4:
+			fmt4 = sub
+		case 12:
+			fmt12 = sub
+		}
+	}
+
+	switch {
+	case fmt12 != nil && len(fmt12) >= 16:
+		groups := int(binary.BigEndian.Uint32(fmt12[12:]))
+		for i := 0; i < groups && 16+12*i+12 <= len(fmt12); i++ {
+			g := fmt12[16+12*i:]
+			start := binary.BigEndian.Uint32(g)
+			end := binary.BigEndian.Uint32(g[4:])
+			gid := binary.BigEndian.Uint32(g[8:])
+			for c := start; c <= end && c <= 0x10FFFF; c++ {
+				f.glyphs[rune(c)] = uint16(gid + c - start)
+			}
+		}
+	case fmt4 != nil && len(fmt4) >= 14:
+		segX2 := int(binary.BigEndian.Uint16(fmt4[6:]))
+		ends := 14
+		starts := ends + segX2 + 2
+		deltas := starts + segX2
+		ranges := deltas + segX2
+		if ranges+segX2 > len(fmt4) {
+			return errors.New("pdf: bad cmap format 4")
+		}
+		for s := 0; s < segX2; s += 2 {
+			end := int(binary.BigEndian.Uint16(fmt4[ends+s:]))
+			start := int(binary.BigEndian.Uint16(fmt4[starts+s:]))
+			delta := int(binary.BigEndian.Uint16(fmt4[deltas+s:]))
+			rangeOff := int(binary.BigEndian.Uint16(fmt4[ranges+s:]))
+			for c := start; c <= end && c != 0xFFFF; c++ {
+				var gid int
+				if rangeOff == 0 {
+					gid = (c + delta) & 0xFFFF
+				} else {
+					p := ranges + s + rangeOff + 2*(c-start)
+					if p+2 > len(fmt4) {
+						continue
+					}
+					gid = int(binary.BigEndian.Uint16(fmt4[p:]))
+					if gid != 0 {
+						gid = (gid + delta) & 0xFFFF
+					}
+				}
+				if gid != 0 {
+					f.glyphs[rune(c)] = uint16(gid)
+				}
+			}
+		}
+	default:
+		return errors.New("pdf: font has no Unicode cmap")
+	}
+	return nil
+}
+
+// glyph — glyph id символа (0 — .notdef, символа нет в шрифте)
+func (f *Font) glyph(r rune) uint16 {
+	return f.glyphs[r]
+}
+
+// width — ширина глифа в тысячных долях кегля (единицы PDF)
+func (f *Font) width(gid uint16) int {
+	if int(gid) >= len(f.advances) {
+		return 0
+	}
+	return int(f.advances[gid]) * 1000 / f.unitsPerEm
+}
+
+func (f *Font) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
@@ -0,0 +1,401 @@
+// Package pdf — минимальный генератор PDF с таблицами для отчётов:
+// A4 альбомная, заголовок таблицы повторяется на каждой странице.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Section — таблица отчёта с необязательным заголовком
+type Section struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// Document — отчёт: заголовок, подзаголовок (период, пояс) и таблицы
+type Document struct {
+	Title    string
+	Subtitle string
+	Sections []Section
+}
+
+const (
+	pageW, pageH = 842.0, 595.0 // A4 landscape, pt
+	margin       = 36.0
+	titleSize    = 14.0
+	textSize     = 10.0
+	cellSize     = 8.0
+	rowH         = 14.0
+	cellPad      = 3.0
+	maxColW      = 220.0
+)
+
+// Write рендерит документ. font == nil — встроенный Helvetica (только Latin-1:
+// остальные символы заменяются на '?'), для кириллицы нужен TTF.
+func (d *Document) Write(w io.Writer, font *Font) error {
+	l := &layout{enc: newEncoder(font)}
+	l.newPage()
+	l.text(margin, l.y-titleSize, titleSize, d.Title)
+	l.y -= titleSize + 6
+	if d.Subtitle != "" {
+		l.text(margin, l.y-textSize, textSize, d.Subtitle)
+		l.y -= textSize + 6
+	}
+	for _, s := range d.Sections {
+		l.table(s)
+	}
+	return l.write(w)
+}
+
+// =========================
+// LAYOUT
+// =========================
+
+type layout struct {
+	enc   *encoder
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func (l *layout) newPage() {
+	l.page = &bytes.Buffer{}
+	l.pages = append(l.pages, l.page)
+	l.y = pageH - margin
+}
+
+func (l *layout) text(x, y, size float64, s string) {
+	fmt.Fprintf(l.page, "BT /F1 %s Tf %s %s Td %s Tj ET\n", num(size), num(x), num(y), l.enc.encode(s))
+}
+
+func (l *layout) table(s Section) {
+	widths := l.columnWidths(s)
+	right := numericColumns(s)
+
+	header := func() {
+		l.page.WriteString("0.9 g\n")
+		x := margin
+		for _, w := range widths {
+			fmt.Fprintf(l.page, "%s %s %s %s re f\n", num(x), num(l.y-rowH), num(w), num(rowH))
+			x += w
+		}
+		l.page.WriteString("0 g\n")
+		l.row(s.Header, widths, nil)
+	}
+
+	// Заголовок секции не отрываем от таблицы
+	if l.y-textSize-6-2*rowH < margin {
+		l.newPage()
+	}
+	if s.Title != "" {
+		l.y -= 6
+		l.text(margin, l.y-textSize, textSize, s.Title)
+		l.y -= textSize + 6
+	}
+	header()
+	for _, r := range s.Rows {
+		if l.y-rowH < margin+rowH { // место под номер страницы
+			l.newPage()
+			header()
+		}
+		l.row(r, widths, right)
+	}
+	l.y -= rowH / 2
+}
+
+func (l *layout) row(cells []string, widths []float64, right []bool) {
+	x := margin
+	baseline := l.y - rowH + (rowH-cellSize)/2 + 1
+	for i, w := range widths {
+		if i < len(cells) {
+			s := l.fit(cells[i], w-2*cellPad)
+			tx := x + cellPad
+			if right != nil && right[i] {
+				tx = x + w - cellPad - l.enc.measure(s, cellSize)
+			}
+			l.text(tx, baseline, cellSize, s)
+		}
+		x += w
+	}
+	fmt.Fprintf(l.page, "0.8 G 0.5 w %s %s m %s %s l S 0 G\n", num(margin), num(l.y-rowH), num(x), num(l.y-rowH))
+	l.y -= rowH
+}
+
+// fit обрезает текст по ширине колонки с многоточием
+func (l *layout) fit(s string, w float64) string {
+	if l.enc.measure(s, cellSize) <= w {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 {
+		r = r[:len(r)-1]
+		if t := string(r) + "…"; l.enc.measure(t, cellSize) <= w {
+			return t
+		}
+	}
+	return ""
+}
+
+// columnWidths — по самому широкому значению (не шире maxColW), затем
+// пропорционально ужимаются до ширины страницы
+func (l *layout) columnWidths(s Section) []float64 {
+	widths := make([]float64, len(s.Header))
+	for i, h := range s.Header {
+		widths[i] = l.enc.measure(h, cellSize) + 2*cellPad
+	}
+	for _, r := range s.Rows {
+		for i := 0; i < len(r) && i < len(widths); i++ {
+			if w := l.enc.measure(r[i], cellSize) + 2*cellPad; w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	total := 0.0
+	for i := range widths {
+		if widths[i] > maxColW {
+			widths[i] = maxColW
+		}
+		total += widths[i]
+	}
+	if avail := pageW - 2*margin; total > avail {
+		for i := range widths {
+			widths[i] *= avail / total
+		}
+	}
+	return widths
+}
+
+// numericColumns — колонки, где все непустые значения числа, проценты или
+// длительности ч:мм:сс: выравниваем вправо
+func numericColumns(s Section) []bool {
+	plain := strings.NewReplacer("%", "", ":", "")
+	right := make([]bool, len(s.Header))
+	for i := range right {
+		right[i] = len(s.Rows) > 0
+		for _, r := range s.Rows {
+			if i < len(r) && r[i] != "" {
+				if _, err := strconv.ParseFloat(plain.Replace(r[i]), 64); err != nil {
+					right[i] = false
+					break
+				}
+			}
+		}
+	}
+	return right
+}
+
+// =========================
+// OUTPUT
+// =========================
+
+func (l *layout) write(w io.Writer) error {
+	o := &objWriter{}
+	o.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Номера страниц — когда известно их количество
+	for i, p := range l.pages {
+		s := fmt.Sprintf("%d / %d", i+1, len(l.pages))
+		fmt.Fprintf(p, "0.4 g BT /F1 %s Tf %s %s Td %s Tj ET 0 g\n",
+			num(cellSize), num(pageW-margin-l.enc.measure(s, cellSize)), num(margin/2), l.enc.encode(s))
+	}
+
+	// 1 — каталог, 2 — дерево страниц, 3 — шрифт; дальше страницы и шрифтовые объекты
+	const catalog, pages, font = 1, 2, 3
+	o.next = 4
+	kids := make([]string, len(l.pages))
+	pageObjs := make([]int, len(l.pages))
+	for i := range l.pages {
+		pageObjs[i] = o.alloc()
+		kids[i] = fmt.Sprintf("%d 0 R", pageObjs[i])
+	}
+
+	o.obj(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	o.obj(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	for i, p := range l.pages {
+		content := o.alloc()
+		o.obj(pageObjs[i], fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+			pages, num(pageW), num(pageH), font, content))
+		o.stream(content, "", p.Bytes())
+	}
+	l.enc.writeFont(o, font)
+
+	xref := o.buf.Len()
+	fmt.Fprintf(&o.buf, "xref\n0 %d\n0000000000 65535 f \n", len(o.offsets)+1)
+	for i := 1; i <= len(o.offsets); i++ {
+		fmt.Fprintf(&o.buf, "%010d 00000 n \n", o.offsets[i])
+	}
+	fmt.Fprintf(&o.buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(o.offsets)+1, catalog, xref)
+	_, err := w.Write(o.buf.Bytes())
+	return err
+}
+
+type objWriter struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+	next    int
+}
+
+func (o *objWriter) alloc() int {
+	o.next++
+	return o.next - 1
+}
+
+func (o *objWriter) obj(id int, body string) {
+	if o.offsets == nil {
+		o.offsets = make(map[int]int)
+	}
+	o.offsets[id] = o.buf.Len()
+	fmt.Fprintf(&o.buf, "%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// stream пишет FlateDecode-поток; extra — дополнительные ключи словаря
+func (o *objWriter) stream(id int, extra string, data []byte) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+	if o.offsets == nil {
+		o.offsets = make(map[int]int)
+	}
+	o.offsets[id] = o.buf.Len()
+	fmt.Fprintf(&o.buf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode%s >>\nstream\n", id, z.Len(), extra)
+	o.buf.Write(z.Bytes())
+	o.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// =========================
+// FONT ENCODING
+// =========================
+
+// encoder кодирует строки для /F1 и запоминает использованные глифы
+// (для таблицы ширин и ToUnicode)
+type encoder struct {
+	font *Font
+	used map[uint16]rune
+}
+
+func newEncoder(f *Font) *encoder {
+	return &encoder{font: f, used: make(map[uint16]rune)}
+}
+
+func (e *encoder) encode(s string) string {
+	var b strings.Builder
+	if e.font == nil {
+		b.WriteByte('(')
+		for _, r := range s {
+			c := winAnsi(r)
+			if c == '(' || c == ')' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte(')')
+		return b.String()
+	}
+	b.WriteByte('<')
+	for _, r := range s {
+		g := e.font.glyph(r)
+		e.used[g] = r
+		fmt.Fprintf(&b, "%04X", g)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+func (e *encoder) measure(s string, size float64) float64 {
+	w := 0
+	if e.font == nil {
+		w = helveticaWidth * utf8.RuneCountInString(s)
+	} else {
+		for _, r := range s {
+			w += e.font.width(e.font.glyph(r))
+		}
+	}
+	return float64(w) * size / 1000
+}
+
+func (e *encoder) writeFont(o *objWriter, id int) {
+	if e.font == nil {
+		o.obj(id, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+		return
+	}
+	f := e.font
+	cid, desc, file, toUni := o.alloc(), o.alloc(), o.alloc(), o.alloc()
+
+	gids := make([]int, 0, len(e.used))
+	for g := range e.used {
+		gids = append(gids, int(g))
+	}
+	sort.Ints(gids)
+
+	var w strings.Builder
+	for _, g := range gids {
+		fmt.Fprintf(&w, "%d [%d] ", g, f.width(uint16(g)))
+	}
+
+	o.obj(id, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /ReportFont /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", cid, toUni))
+	o.obj(cid, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /ReportFont /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW 1000 /W [%s] >>", desc, w.String()))
+	o.obj(desc, fmt.Sprintf("<< /Type /FontDescriptor /FontName /ReportFont /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+		f.scale(f.ascent), f.scale(f.descent), f.scale(f.ascent), file))
+	o.stream(file, fmt.Sprintf(" /Length1 %d", len(f.data)), f.data)
+	o.stream(toUni, "", toUnicode(gids, e.used))
+}
+
+// toUnicode — CMap glyph id → Unicode, чтобы текст в PDF копировался и искался
+func toUnicode(gids []int, used map[uint16]rune) []byte {
+	var b bytes.Buffer
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i := 0; i < len(gids); i += 100 {
+		chunk := gids[i:min(i+100, len(gids))]
+		fmt.Fprintf(&b, "%d beginbfchar\n", len(chunk))
+		for _, g := range chunk {
+			fmt.Fprintf(&b, "<%04X> <", g)
+			for _, u := range utf16Units(used[uint16(g)]) {
+				fmt.Fprintf(&b, "%04X", u)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.Bytes()
+}
+
+func utf16Units(r rune) []uint16 {
+	if r < 0x10000 {
+		return []uint16{uint16(r)}
+	}
+	r -= 0x10000
+	return []uint16{uint16(0xD800 + (r >> 10)), uint16(0xDC00 + (r & 0x3FF))}
+}
+
+// helveticaWidth — средняя ширина глифа Helvetica: без AFM-метрик
+// выравнивание запасного шрифта приблизительное
+const helveticaWidth = 556
+
+func winAnsi(r rune) byte {
+	switch {
+	case r == '…':
+		return 0x85
+	case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+		return byte(r)
+	}
+	return '?'
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
@@ -0,0 +1,71 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FSStore — локальный каталог или смонтированный NFS
+type FSStore struct {
+	Root string
+}
+
+func (s *FSStore) Name() string { return "fs" }
+
+func (s *FSStore) Open(_ context.Context, key string) (*Object, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Object{Body: f, Size: info.Size(), ContentType: ContentType(path.Ext(key))}, nil
+}
+
+func (s *FSStore) OpenAt(_ context.Context, key string, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *FSStore) Stat(_ context.Context, key string) (int64, error) {
+	info, err := os.Stat(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *FSStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *FSStore) path(key string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(cleanKey(key)))
+}
@@ -0,0 +1,101 @@
+package recordings
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// HTTPStore — файлы, отдаваемые веб-сервером рядом с Asterisk (nginx /recordings)
+type HTTPStore struct {
+	BaseURL string // http://172.20.40.3:8090/recordings
+	Client  *http.Client
+}
+
+func (s *HTTPStore) Name() string { return "http" }
+
+func (s *HTTPStore) Open(ctx context.Context, key string) (*Object, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" || ct == "application/octet-stream" {
+		ct = ContentType(path.Ext(key))
+	}
+	return &Object{Body: resp.Body, Size: resp.ContentLength, ContentType: ct}, nil
+}
+
+func (s *HTTPStore) Stat(ctx context.Context, key string) (int64, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength, nil
+	}
+	// HEAD без Content-Length (chunked, gzip на лету) — размер из Range-ответа
+	return statByRange(ctx, key, s.do)
+}
+
+func (s *HTTPStore) OpenAt(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, rangeHeader(offset))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		return resp.Body, nil
+	}
+	return discardTo(resp.Body, offset)
+}
+
+// Delete — HTTP DELETE; веб-сервер должен его разрешать (nginx dav_methods DELETE)
+func (s *HTTPStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *HTTPStore) do(ctx context.Context, method, key string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.BaseURL, "/")+"/"+cleanKey(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode/100 != 2:
+		resp.Body.Close()
+		return nil, fmt.Errorf("recording store: %s %s: %s", method, key, resp.Status)
+	}
+	return resp, nil
+}
+
+// rangeHeader — "Range: bytes=<offset>-" (nil для offset 0)
+func rangeHeader(offset int64) http.Header {
+	if offset <= 0 {
+		return nil
+	}
+	return http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}}
+}
+
+func (s *HTTPStore) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
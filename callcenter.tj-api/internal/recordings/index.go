@@ -0,0 +1,214 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Recording — строка индекса: где лежит запись звонка
+type Recording struct {
+	UniqueID  string    `json:"uniqueid"`
+	TenantID  *int      `json:"tenantId"`
+	Backend   string    `json:"backend"`  // fs / http / s3
+	Location  string    `json:"location"` // ключ внутри хранилища
+	Format    string    `json:"format"`   // wav / mp3 / gsm / ogg
+	Size      int64     `json:"size"`
+	Duration  int       `json:"duration"` // секунды
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (r *Recording) ContentType() string { return ContentType(r.Format) }
+
+// FileName — имя файла для Content-Disposition
+func (r *Recording) FileName() string { return r.UniqueID + "." + r.Format }
+
+// Index — таблица recordings поверх хранилищ. Записи, которых ещё нет в индексе,
+// ищутся в Default перебором форматов один раз и индексируются.
+type Index struct {
+	DB      *pgxpool.Pool
+	Default Store
+	stores  map[string]Store
+}
+
+// NewIndex — def используется для поиска новых записей; others — хранилища,
+// на которые могут ссылаться старые строки индекса (например, после переезда в S3)
+func NewIndex(db *pgxpool.Pool, def Store, others ...Store) *Index {
+	x := &Index{DB: db, Default: def, stores: map[string]Store{def.Name(): def}}
+	for _, s := range others {
+		if _, ok := x.stores[s.Name()]; !ok {
+			x.stores[s.Name()] = s
+		}
+	}
+	return x
+}
+
+// Store — хранилище по имени бэкенда из индекса
+func (x *Index) Store(name string) (Store, bool) {
+	s, ok := x.stores[name]
+	return s, ok
+}
+
+// Lookup находит запись в индексе, а если её там нет — в Default.
+// tenantID записывается в индекс для новой строки (доступ проверяет вызывающий).
+func (x *Index) Lookup(ctx context.Context, uniqueid string, tenantID int) (*Recording, error) {
+	rec, err := x.get(ctx, uniqueid)
+	if err == nil {
+		return rec, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return x.probe(ctx, uniqueid, tenantID)
+}
+
+// Open открывает файл записи целиком
+func (x *Index) Open(ctx context.Context, uniqueid string, tenantID int) (*Recording, *Object, error) {
+	var obj *Object
+	rec, err := x.resolve(ctx, uniqueid, tenantID, func(rec *Recording, store Store) (err error) {
+		obj, err = store.Open(ctx, rec.Location)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return rec, obj, nil
+}
+
+// Reader — запись для воспроизведения с поддержкой Range. Размер сверяется
+// с хранилищем, заодно проверяя, что файл на месте.
+func (x *Index) Reader(ctx context.Context, uniqueid string, tenantID int) (*Recording, *ReadSeeker, error) {
+	var rs *ReadSeeker
+	rec, err := x.resolve(ctx, uniqueid, tenantID, func(rec *Recording, store Store) error {
+		size, err := store.Stat(ctx, rec.Location)
+		if err != nil {
+			return err
+		}
+		rec.Size = size
+		rs = NewReadSeeker(ctx, store, rec.Location, size)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return rec, rs, nil
+}
+
+// resolve находит запись и вызывает fn с её хранилищем. Если файла по строке индекса
+// больше нет (ErrNotFound от fn) — строка удаляется, запись ищется заново и fn повторяется.
+func (x *Index) resolve(ctx context.Context, uniqueid string, tenantID int, fn func(rec *Recording, store Store) error) (*Recording, error) {
+	rec, err := x.Lookup(ctx, uniqueid, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	store, ok := x.stores[rec.Backend]
+	if !ok {
+		return nil, fmt.Errorf("recording %s: backend %q is not configured", rec.UniqueID, rec.Backend)
+	}
+
+	err = fn(rec, store)
+	if errors.Is(err, ErrNotFound) {
+		log.Printf("⚠️ Recording %s missing in %s:%s, re-indexing", uniqueid, rec.Backend, rec.Location)
+		x.DB.Exec(ctx, `DELETE FROM recordings WHERE uniqueid = $1`, uniqueid)
+		if rec, err = x.probe(ctx, uniqueid, tenantID); err != nil {
+			return nil, err
+		}
+		err = fn(rec, x.Default)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Put добавляет или обновляет строку индекса (например, при загрузке записи в хранилище)
+func (x *Index) Put(ctx context.Context, rec *Recording) error {
+	_, err := x.DB.Exec(ctx, `
+		INSERT INTO recordings (uniqueid, tenant_id, backend, location, format, size_bytes, duration_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (uniqueid) DO UPDATE SET
+			tenant_id        = COALESCE(EXCLUDED.tenant_id, recordings.tenant_id),
+			backend          = EXCLUDED.backend,
+			location         = EXCLUDED.location,
+			format           = EXCLUDED.format,
+			size_bytes       = EXCLUDED.size_bytes,
+			duration_seconds = EXCLUDED.duration_seconds`,
+		rec.UniqueID, rec.TenantID, rec.Backend, rec.Location, rec.Format, rec.Size, rec.Duration,
+	)
+	return err
+}
+
+// Delete удаляет файл записи из её хранилища и строку индекса.
+// Файла уже нет (ErrNotFound) — строка всё равно удаляется, ошибка возвращается вызывающему.
+func (x *Index) Delete(ctx context.Context, rec *Recording) error {
+	store, ok := x.stores[rec.Backend]
+	if !ok {
+		return fmt.Errorf("recording %s: backend %q is not configured", rec.UniqueID, rec.Backend)
+	}
+	err := store.Delete(ctx, rec.Location)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if _, dbErr := x.DB.Exec(ctx, `DELETE FROM recordings WHERE uniqueid = $1`, rec.UniqueID); dbErr != nil {
+		return dbErr
+	}
+	return err
+}
+
+func (x *Index) get(ctx context.Context, uniqueid string) (*Recording, error) {
+	var rec Recording
+	err := x.DB.QueryRow(ctx, `
+		SELECT uniqueid, tenant_id, backend, location, format,
+		       COALESCE(size_bytes, 0), COALESCE(duration_seconds, 0), created_at
+		FROM recordings WHERE uniqueid = $1`, uniqueid,
+	).Scan(&rec.UniqueID, &rec.TenantID, &rec.Backend, &rec.Location, &rec.Format,
+		&rec.Size, &rec.Duration, &rec.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// probe ищет "<uniqueid>.<format>" в Default и индексирует найденное.
+// Длительность — billsec из CDR (запись идёт с момента ответа).
+func (x *Index) probe(ctx context.Context, uniqueid string, tenantID int) (*Recording, error) {
+	for _, format := range Formats {
+		key := uniqueid + "." + format
+		size, err := x.Default.Stat(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rec := &Recording{
+			UniqueID:  uniqueid,
+			Backend:   x.Default.Name(),
+			Location:  key,
+			Format:    format,
+			Size:      size,
+			CreatedAt: time.Now(),
+		}
+		if tenantID > 0 {
+			rec.TenantID = &tenantID
+		}
+		x.DB.QueryRow(ctx,
+			`SELECT COALESCE(MAX(billsec), 0) FROM ast_cdr WHERE uniqueid = $1`, uniqueid,
+		).Scan(&rec.Duration)
+
+		if err := x.Put(ctx, rec); err != nil {
+			log.Printf("❌ Recording index put %s: %v", uniqueid, err)
+		}
+		return rec, nil
+	}
+	return nil, ErrNotFound
+}
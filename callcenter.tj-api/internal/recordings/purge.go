@@ -0,0 +1,245 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"callcentrix/internal/metrics"
+)
+
+// Статусы в recording_purge_log
+const (
+	PurgeDeleted = "deleted"
+	PurgeMissing = "missing" // файла уже не было в хранилище
+	PurgeFailed  = "failed"  // повторится при следующем запуске
+)
+
+// PurgeCandidate — запись, срок хранения которой истёк по политике тенанта
+type PurgeCandidate struct {
+	UniqueID   string    `json:"uniqueid"`
+	TenantID   int       `json:"tenantId"`
+	CallDate   time.Time `json:"callDate"`
+	ExpiredAt  time.Time `json:"expiredAt"`
+	PolicyID   int       `json:"policyId"`
+	RetainDays int       `json:"retainDays"`
+	Queue      *string   `json:"queue"`
+	Backend    *string   `json:"backend"` // nil — запись ещё не в индексе
+	Size       *int64    `json:"size"`
+}
+
+// PurgeReport — результат dry-run: что удалит следующий запуск
+type PurgeReport struct {
+	Total      int              `json:"total"`
+	KnownBytes int64            `json:"knownBytes"` // только по проиндексированным записям
+	ByPolicy   map[int]int      `json:"byPolicy"`
+	Items      []PurgeCandidate `json:"items"` // первые limit записей
+}
+
+// Purger удаляет записи с истёкшим сроком хранения через хранилища индекса
+// и пишет recording_purge_log. Работает только на лидере.
+type Purger struct {
+	Index      *Index
+	Transcoder *Transcoder // nil — транскодирование выключено, чистить кэш не нужно
+	Interval   time.Duration
+	BatchSize  int
+}
+
+// purgeCursor — keyset-пагинация по (calldate, uniqueid)
+type purgeCursor struct {
+	CallDate time.Time
+	UniqueID string
+}
+
+// candidatesSQL — записи с истёкшим сроком. Тенант звонка — ast_cdr.tenant_id (как в CDR),
+// политика — самая узкая подходящая: disposition > queue > тенант.
+// Кандидат — проиндексированная запись или CDR с именем файла в userfield.
+// calldate хранится в UTC без зоны (как в CDRHandler).
+// Legal hold и уже удалённые (deleted/missing в журнале) исключаются.
+const candidatesSQL = `
+	SELECT c.uniqueid, c.calldate, c.tenant_id, p.id, p.retain_days,
+	       COALESCE(cl.queue, cd.queue), r.backend, r.size_bytes
+	FROM ast_cdr c
+	LEFT JOIN recordings r         ON r.uniqueid = c.uniqueid
+	LEFT JOIN calls cl             ON cl.tenant_id = c.tenant_id AND cl.uniqueid = c.uniqueid
+	LEFT JOIN call_dispositions cd ON cd.tenant_id = c.tenant_id AND cd.uniqueid = c.uniqueid
+	CROSS JOIN LATERAL (
+		SELECT p.id, p.retain_days FROM recording_retention_policies p
+		WHERE p.tenant_id = c.tenant_id AND p.active
+		AND (p.queue IS NULL OR p.queue = COALESCE(cl.queue, cd.queue))
+		AND (p.disposition_id IS NULL OR p.disposition_id = cd.disposition_id)
+		ORDER BY (p.disposition_id IS NOT NULL) DESC, (p.queue IS NOT NULL) DESC
+		LIMIT 1
+	) p
+	WHERE c.calldate AT TIME ZONE 'UTC' < NOW() - make_interval(days => (
+		SELECT MIN(retain_days) FROM recording_retention_policies WHERE active))
+	AND c.calldate AT TIME ZONE 'UTC' < NOW() - make_interval(days => p.retain_days)
+	AND (r.uniqueid IS NOT NULL OR NULLIF(TRIM(c.userfield), '') IS NOT NULL)
+	AND NOT EXISTS (SELECT 1 FROM recording_legal_holds h WHERE h.uniqueid = c.uniqueid)
+	AND NOT EXISTS (SELECT 1 FROM recording_purge_log l WHERE l.uniqueid = c.uniqueid AND l.status <> 'failed')
+	AND c.tenant_id IS NOT NULL
+	AND ($1 = 0 OR c.tenant_id = $1)
+	AND (c.calldate, c.uniqueid) > ($2, $3)
+	ORDER BY c.calldate, c.uniqueid
+	LIMIT $4`
+
+// candidates — следующая пачка после cursor; tenantID 0 — все тенанты
+func (p *Purger) candidates(ctx context.Context, tenantID int, cursor purgeCursor) ([]PurgeCandidate, error) {
+	rows, err := p.Index.DB.Query(ctx, candidatesSQL, tenantID, cursor.CallDate, cursor.UniqueID, p.batchSize())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PurgeCandidate
+	for rows.Next() {
+		var c PurgeCandidate
+		if err := rows.Scan(&c.UniqueID, &c.CallDate, &c.TenantID, &c.PolicyID, &c.RetainDays,
+			&c.Queue, &c.Backend, &c.Size); err != nil {
+			return nil, err
+		}
+		c.ExpiredAt = c.CallDate.AddDate(0, 0, c.RetainDays)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// each обходит всех кандидатов пачками. CDR-ноги с одним uniqueid отдаются один раз.
+func (p *Purger) each(ctx context.Context, tenantID int, fn func(c PurgeCandidate) error) error {
+	var cursor purgeCursor
+	seen := make(map[string]bool)
+	for {
+		batch, err := p.candidates(ctx, tenantID, cursor)
+		if err != nil {
+			return err
+		}
+		for _, c := range batch {
+			if seen[c.UniqueID] {
+				continue
+			}
+			seen[c.UniqueID] = true
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		if len(batch) < p.batchSize() {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		cursor = purgeCursor{CallDate: last.CallDate, UniqueID: last.UniqueID}
+	}
+}
+
+// DryRun считает, что удалит следующий запуск для тенанта, ничего не трогая
+func (p *Purger) DryRun(ctx context.Context, tenantID, limit int) (*PurgeReport, error) {
+	report := &PurgeReport{ByPolicy: make(map[int]int), Items: make([]PurgeCandidate, 0)}
+	err := p.each(ctx, tenantID, func(c PurgeCandidate) error {
+		report.Total++
+		report.ByPolicy[c.PolicyID]++
+		if c.Size != nil {
+			report.KnownBytes += *c.Size
+		}
+		if len(report.Items) < limit {
+			report.Items = append(report.Items, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Purge удаляет все записи с истёкшим сроком. Ошибка отдельной записи
+// не останавливает прогон — она попадает в журнал как failed.
+func (p *Purger) Purge(ctx context.Context) (map[string]int, error) {
+	stats := map[string]int{PurgeDeleted: 0, PurgeMissing: 0, PurgeFailed: 0}
+	err := p.each(ctx, 0, func(c PurgeCandidate) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		status := p.purgeOne(ctx, c)
+		stats[status]++
+		metrics.RecordingsPurged.WithLabelValues(status).Inc()
+		return nil
+	})
+	return stats, err
+}
+
+func (p *Purger) purgeOne(ctx context.Context, c PurgeCandidate) string {
+	var backend, location *string
+	var size *int64
+	var purgeErr error
+
+	status := PurgeDeleted
+	rec, err := p.Index.Lookup(ctx, c.UniqueID, c.TenantID)
+	if err == nil {
+		backend, location, size = &rec.Backend, &rec.Location, &rec.Size
+		err = p.Index.Delete(ctx, rec)
+	}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = PurgeMissing
+	case err != nil:
+		status, purgeErr = PurgeFailed, err
+		log.Printf("❌ Recording purge %s: %v", c.UniqueID, err)
+	}
+	if status != PurgeFailed {
+		if p.Transcoder != nil {
+			p.Transcoder.Evict(c.UniqueID)
+		}
+		// Расшифровка — тоже содержимое разговора и удаляется вместе с записью
+		if _, err := p.Index.DB.Exec(ctx, `DELETE FROM transcripts WHERE uniqueid = $1`, c.UniqueID); err != nil {
+			log.Printf("❌ Recording purge transcript %s: %v", c.UniqueID, err)
+		}
+	}
+
+	var errText *string
+	if purgeErr != nil {
+		s := purgeErr.Error()
+		errText = &s
+	}
+	if _, err := p.Index.DB.Exec(ctx, `
+		INSERT INTO recording_purge_log
+			(tenant_id, uniqueid, policy_id, retain_days, call_date, backend, location, size_bytes, status, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		c.TenantID, c.UniqueID, c.PolicyID, c.RetainDays, c.CallDate, backend, location, size, status, errText,
+	); err != nil {
+		log.Printf("❌ Recording purge log %s: %v", c.UniqueID, err)
+	}
+	return status
+}
+
+// Run запускает Purge через минуту после старта (лидерство могло смениться
+// посреди прогона) и далее раз в Interval
+func (p *Purger) Run(ctx context.Context) {
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		stats, err := p.Purge(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("❌ Recording retention: %v", err)
+		}
+		if n := stats[PurgeDeleted] + stats[PurgeMissing] + stats[PurgeFailed]; n > 0 {
+			log.Printf("🗑️ Recording retention: deleted=%d missing=%d failed=%d (%s)",
+				stats[PurgeDeleted], stats[PurgeMissing], stats[PurgeFailed], time.Since(start).Round(time.Second))
+		}
+		timer.Reset(p.Interval)
+	}
+}
+
+func (p *Purger) batchSize() int {
+	if p.BatchSize > 0 {
+		return p.BatchSize
+	}
+	return 500
+}
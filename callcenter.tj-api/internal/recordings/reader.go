@@ -0,0 +1,75 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ReadSeeker — ленивый io.ReadSeekCloser поверх Store для http.ServeContent.
+// Seek только двигает позицию; тело открывается с неё при первом Read,
+// так что ответ на Range — один ranged-запрос к хранилищу, а не скачивание файла целиком.
+// size -1 (неизвестен) — читаем до конца тела, SeekEnd недоступен.
+type ReadSeeker struct {
+	ctx   context.Context
+	store Store
+	key   string
+	size  int64
+	pos   int64
+	body  io.ReadCloser
+}
+
+func NewReadSeeker(ctx context.Context, store Store, key string, size int64) *ReadSeeker {
+	return &ReadSeeker{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (r *ReadSeeker) Read(p []byte) (int, error) {
+	if r.size >= 0 && r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.store.OpenAt(r.ctx, r.key, r.pos)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.pos + offset
+	case io.SeekEnd:
+		if r.size < 0 {
+			return 0, errors.New("recordings: size unknown")
+		}
+		abs = r.size + offset
+	default:
+		return 0, errors.New("recordings: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("recordings: negative position")
+	}
+	if abs != r.pos && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.pos = abs
+	return abs, nil
+}
+
+func (r *ReadSeeker) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
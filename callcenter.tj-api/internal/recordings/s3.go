@@ -0,0 +1,186 @@
+package recordings
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// S3Store — S3-совместимое объектное хранилище (AWS S3, MinIO, Ceph RGW).
+// Запросы подписываются AWS Signature V4.
+type S3Store struct {
+	Endpoint  string // https://s3.eu-central-1.amazonaws.com или http://minio:9000
+	Region    string
+	Bucket    string
+	Prefix    string // необязательный префикс ключей ("recordings/")
+	AccessKey string
+	SecretKey string
+	PathStyle bool // true — endpoint/bucket/key (MinIO), false — bucket.endpoint/key
+	Client    *http.Client
+}
+
+// emptyPayloadHash — sha256 пустого тела (GET/HEAD/DELETE)
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *S3Store) Name() string { return "s3" }
+
+func (s *S3Store) Open(ctx context.Context, key string) (*Object, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" || ct == "application/octet-stream" || ct == "binary/octet-stream" {
+		ct = ContentType(path.Ext(key))
+	}
+	return &Object{Body: resp.Body, Size: resp.ContentLength, ContentType: ct}, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (int64, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength, nil
+	}
+	return statByRange(ctx, key, s.do)
+}
+
+// OpenAt — ranged GET; Range не входит в подписанные заголовки
+func (s *S3Store) OpenAt(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, rangeHeader(offset))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		return resp.Body, nil
+	}
+	return discardTo(resp.Body, offset)
+}
+
+// Delete — DeleteObject. S3 отвечает 204 и на отсутствующий ключ, поэтому ErrNotFound тут не бывает.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Store) do(ctx context.Context, method, key string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode/100 != 2:
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3: %s %s: %s", method, key, resp.Status)
+	}
+	return resp, nil
+}
+
+// objectURL строит адрес объекта; каждый сегмент ключа экранируется один раз
+// по RFC 3986 (s3Escape) — этот же путь идёт в каноничный запрос SigV4
+func (s *S3Store) objectURL(key string) string {
+	u, _ := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	// Ключ чистится отдельно от префикса: "../" не выводит за пределы Prefix
+	segments := strings.Split(cleanKey(path.Join(s.Prefix, cleanKey(key))), "/")
+	for i, seg := range segments {
+		segments[i] = s3Escape(seg)
+	}
+	objectPath := strings.Join(segments, "/")
+
+	if s.PathStyle {
+		return u.Scheme + "://" + u.Host + "/" + s3Escape(s.Bucket) + "/" + objectPath
+	}
+	return u.Scheme + "://" + s.Bucket + "." + u.Host + "/" + objectPath
+}
+
+// sign добавляет заголовки AWS Signature V4 (тело всегда пустое)
+func (s *S3Store) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + emptyPayloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3Escape — сегмент пути для SigV4: всё, кроме A-Z a-z 0-9 - _ . ~, в %XX.
+// url.PathEscape оставляет + = $ & : @ , — с ними подпись не сходится.
+func s3Escape(seg string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(seg); i++ {
+		c := seg[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&15])
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,93 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound — записи нет в хранилище
+var ErrNotFound = errors.New("recording not found")
+
+// Object — открытый файл записи
+type Object struct {
+	Body        io.ReadCloser
+	Size        int64 // -1 — неизвестен
+	ContentType string
+}
+
+// Store — хранилище файлов записей. key — путь внутри хранилища ("<uniqueid>.wav").
+type Store interface {
+	// Name — имя бэкенда для индекса: fs / http / s3
+	Name() string
+	Open(ctx context.Context, key string) (*Object, error)
+	// OpenAt открывает файл с байта offset до конца (для HTTP Range)
+	OpenAt(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
+	// Stat возвращает размер файла или ErrNotFound
+	Stat(ctx context.Context, key string) (int64, error)
+	// Delete удаляет файл (ErrNotFound — его уже нет)
+	Delete(ctx context.Context, key string) error
+}
+
+// Formats — расширения, которые пишет Asterisk, в порядке проверки
+var Formats = []string{"wav", "mp3", "gsm", "ogg"}
+
+// ContentType по формату записи
+func ContentType(format string) string {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "mp3":
+		return "audio/mpeg"
+	case "ogg":
+		return "audio/ogg"
+	case "gsm":
+		return "audio/x-gsm"
+	default:
+		return "audio/wav"
+	}
+}
+
+// discardTo доводит поток до offset, если сервер проигнорировал Range и отдал файл целиком
+func discardTo(body io.ReadCloser, offset int64) (io.ReadCloser, error) {
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, body, offset); err != nil {
+			body.Close()
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// statByRange узнаёт размер, когда HEAD его не сообщил: GET первого байта
+// и полный размер из Content-Range. Сервер без Range — тело считается целиком.
+func statByRange(ctx context.Context, key string, do func(ctx context.Context, method, key string, header http.Header) (*http.Response, error)) (int64, error) {
+	resp, err := do(ctx, http.MethodGet, key, http.Header{"Range": {"bytes=0-0"}})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes 0-0/12345
+		cr := resp.Header.Get("Content-Range")
+		if i := strings.LastIndex(cr, "/"); i >= 0 {
+			if size, err := strconv.ParseInt(cr[i+1:], 10, 64); err == nil {
+				return size, nil
+			}
+		}
+		return 0, fmt.Errorf("recording store: %s: unknown size (Content-Range %q)", key, cr)
+	}
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength, nil
+	}
+	return io.Copy(io.Discard, resp.Body)
+}
+
+// cleanKey не даёт выйти за пределы корня хранилища ("../../etc/passwd")
+func cleanKey(key string) string {
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
@@ -0,0 +1,342 @@
+package recordings
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAudio = "RIFF....WAVEfmt data: 0123456789abcdef"
+
+// fileServer — веб-сервер записей: GET/HEAD с Range, DELETE.
+// chunked — не отдавать Content-Length (как nginx с gzip или прокси со stream).
+type fileServer struct {
+	mu       sync.Mutex
+	files    map[string]string
+	chunked  bool
+	requests []*http.Request
+}
+
+func newFileServer() *fileServer {
+	return &fileServer{files: map[string]string{"/recordings/1700000000.1.wav": testAudio}}
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	body, ok := s.files[r.URL.Path]
+	if ok && r.Method == http.MethodDelete {
+		delete(s.files, r.URL.Path)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	case s.chunked && r.Header.Get("Range") == "":
+		// Без Content-Length: Flush до конца тела переводит ответ в chunked
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if r.Method == http.MethodGet {
+			io.WriteString(w, body)
+		}
+	default:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	}
+}
+
+func (s *fileServer) lastRequest() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+// testStore — общий прогон Stat/Open/OpenAt/Delete для бэкенда
+func testStore(t *testing.T, store Store, key string) {
+	t.Helper()
+	ctx := context.Background()
+
+	size, err := store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if size != int64(len(testAudio)) {
+		t.Fatalf("Stat = %d, want %d", size, len(testAudio))
+	}
+
+	obj, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if string(data) != testAudio {
+		t.Fatalf("Open body = %q", data)
+	}
+	if obj.ContentType != "audio/wav" {
+		t.Errorf("Open content type = %q, want audio/wav", obj.ContentType)
+	}
+
+	body, err := store.OpenAt(ctx, key, 12)
+	if err != nil {
+		t.Fatalf("OpenAt: %v", err)
+	}
+	data, _ = io.ReadAll(body)
+	body.Close()
+	if string(data) != testAudio[12:] {
+		t.Fatalf("OpenAt(12) = %q, want %q", data, testAudio[12:])
+	}
+
+	if _, err := store.Stat(ctx, "missing.wav"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat(missing) err = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Open(ctx, "missing.wav"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open(missing) err = %v, want ErrNotFound", err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "1700000000.1.wav"), []byte(testAudio), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store := &FSStore{Root: root}
+	testStore(t, store, "1700000000.1.wav")
+
+	if err := store.Delete(context.Background(), "1700000000.1.wav"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFSStoreKeyStaysInRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "monitor")
+	os.Mkdir(root, 0o755)
+	os.WriteFile(filepath.Join(dir, "secret.wav"), []byte("secret"), 0o644)
+
+	store := &FSStore{Root: root}
+	if _, err := store.Stat(context.Background(), "../secret.wav"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat(../secret.wav) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestHTTPStore(t *testing.T) {
+	srv := newFileServer()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	store := &HTTPStore{BaseURL: ts.URL + "/recordings/", Client: ts.Client()}
+	testStore(t, store, "1700000000.1.wav")
+}
+
+func TestHTTPStoreError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	store := &HTTPStore{BaseURL: ts.URL, Client: ts.Client()}
+	_, err := store.Stat(context.Background(), "1.wav")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat on 500 err = %v, want store error", err)
+	}
+}
+
+func TestHTTPStoreUnknownLength(t *testing.T) {
+	srv := newFileServer()
+	srv.chunked = true
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	store := &HTTPStore{BaseURL: ts.URL + "/recordings", Client: ts.Client()}
+	ctx := context.Background()
+
+	size, err := store.Stat(ctx, "1700000000.1.wav")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if size != int64(len(testAudio)) {
+		t.Fatalf("Stat = %d, want %d (from Content-Range)", size, len(testAudio))
+	}
+	if rng := srv.lastRequest().Header.Get("Range"); rng != "bytes=0-0" {
+		t.Fatalf("Stat fallback request Range = %q, want bytes=0-0", rng)
+	}
+
+	// Размер известен — ReadSeeker отдаёт запись и Range через ServeContent
+	rs := NewReadSeeker(ctx, store, "1700000000.1.wav", size)
+	defer rs.Close()
+	req := httptest.NewRequest(http.MethodGet, "/play", nil)
+	req.Header.Set("Range", "bytes=4-11")
+	rec := httptest.NewRecorder()
+	http.ServeContent(rec, req, "1700000000.1.wav", time.Time{}, rs)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("ServeContent status = %d, want 206", rec.Code)
+	}
+	if got := rec.Body.String(); got != testAudio[4:12] {
+		t.Fatalf("ServeContent body = %q, want %q", got, testAudio[4:12])
+	}
+}
+
+func TestReadSeekerUnknownSize(t *testing.T) {
+	srv := newFileServer()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	store := &HTTPStore{BaseURL: ts.URL + "/recordings", Client: ts.Client()}
+	rs := NewReadSeeker(context.Background(), store, "1700000000.1.wav", -1)
+	defer rs.Close()
+
+	data, err := io.ReadAll(rs)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(data) != testAudio {
+		t.Fatalf("ReadAll = %q, want whole file", data)
+	}
+	if _, err := rs.Seek(0, io.SeekEnd); err == nil {
+		t.Fatal("Seek(SeekEnd) with unknown size should fail")
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	srv := newFileServer()
+	srv.files = map[string]string{"/bucket/calls/2026/1700000000.1.wav": testAudio}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	store := &S3Store{
+		Endpoint:  ts.URL,
+		Region:    "us-east-1",
+		Bucket:    "bucket",
+		Prefix:    "calls/",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "secret",
+		PathStyle: true,
+		Client:    ts.Client(),
+	}
+	testStore(t, store, "2026/1700000000.1.wav")
+
+	last := srv.lastRequest()
+	auth := last.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+		t.Errorf("Authorization = %q, want SigV4", auth)
+	}
+	if !strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date") {
+		t.Errorf("Authorization = %q: Range must not be signed", auth)
+	}
+	if last.Header.Get("x-amz-date") == "" || last.Header.Get("x-amz-content-sha256") != emptyPayloadHash {
+		t.Errorf("missing x-amz-* headers: %v", last.Header)
+	}
+}
+
+func TestS3StoreSignature(t *testing.T) {
+	// Подпись детерминирована для запроса и времени и зависит от пути объекта
+	store := &S3Store{Region: "us-east-1", AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	req, _ := http.NewRequest(http.MethodGet, "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	store.sign(req, time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC))
+
+	again, _ := http.NewRequest(http.MethodGet, "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	store.sign(again, time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC))
+	if req.Header.Get("Authorization") != again.Header.Get("Authorization") {
+		t.Fatal("signature is not deterministic")
+	}
+
+	other, _ := http.NewRequest(http.MethodGet, "https://examplebucket.s3.amazonaws.com/other.txt", nil)
+	store.sign(other, time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC))
+	if req.Header.Get("Authorization") == other.Header.Get("Authorization") {
+		t.Fatal("signature does not depend on the path")
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "Credential=AKIDEXAMPLE/20130524/us-east-1/s3/aws4_request") {
+		t.Errorf("Authorization = %q", req.Header.Get("Authorization"))
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	tests := []struct {
+		pathStyle bool
+		key       string
+		want      string
+	}{
+		{true, "1700000000.1.wav", "http://minio:9000/rec/p/1700000000.1.wav"},
+		{true, "../../etc/passwd", "http://minio:9000/rec/p/etc/passwd"},
+		{true, "a b+c.wav", "http://minio:9000/rec/p/a%20b%2Bc.wav"},
+		{true, "2026/x+y=z$&:@,~_-.wav", "http://minio:9000/rec/p/2026/x%2By%3Dz%24%26%3A%40%2C~_-.wav"},
+		{false, "тест.wav", "http://rec.minio:9000/p/%D1%82%D0%B5%D1%81%D1%82.wav"},
+		{false, "1700000000.1.wav", "http://rec.minio:9000/p/1700000000.1.wav"},
+	}
+	for _, tt := range tests {
+		s := &S3Store{Endpoint: "http://minio:9000/", Bucket: "rec", Prefix: "p/", PathStyle: tt.pathStyle}
+		if got := s.objectURL(tt.key); got != tt.want {
+			t.Errorf("objectURL(%q, pathStyle=%v) = %q, want %q", tt.key, tt.pathStyle, got, tt.want)
+		}
+	}
+}
+
+func TestS3StoreReservedKey(t *testing.T) {
+	// + = $ & : @ , в ключе: SigV4 требует их в каноничном пути как %XX,
+	// и на провод уходит тот же путь, что подписан
+	const key = "2026/a+b=c$&:@,.wav"
+	srv := newFileServer()
+	srv.files = map[string]string{"/bucket/calls/" + key: testAudio}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	store := &S3Store{
+		Endpoint: ts.URL, Region: "us-east-1", Bucket: "bucket", Prefix: "calls/",
+		AccessKey: "AKIDEXAMPLE", SecretKey: "secret", PathStyle: true, Client: ts.Client(),
+	}
+	if _, err := store.Stat(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	const want = "/bucket/calls/2026/a%2Bb%3Dc%24%26%3A%40%2C.wav"
+	if got := srv.lastRequest().RequestURI; got != want {
+		t.Errorf("request path = %q, want %q", got, want)
+	}
+	req, _ := http.NewRequest(http.MethodHead, store.objectURL(key), nil)
+	if got := req.URL.EscapedPath(); got != want {
+		t.Errorf("canonical URI = %q, want %q", got, want)
+	}
+}
+
+func TestDiscardToIgnoredRange(t *testing.T) {
+	// Сервер без поддержки Range отдаёт файл целиком — OpenAt сам пропускает начало
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testAudio)
+	}))
+	defer ts.Close()
+
+	store := &HTTPStore{BaseURL: ts.URL, Client: ts.Client()}
+	body, err := store.OpenAt(context.Background(), "1.wav", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(body)
+	if !bytes.Equal(data, []byte(testAudio[20:])) {
+		t.Fatalf("OpenAt(20) = %q, want %q", data, testAudio[20:])
+	}
+}
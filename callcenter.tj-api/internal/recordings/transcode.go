@@ -0,0 +1,279 @@
+package recordings
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupportedFormat — запрошен формат, в который не транскодируем
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// targetFormat — параметры ffmpeg для формата воспроизведения в браузере
+type targetFormat struct {
+	ext         string
+	contentType string
+	args        []string
+}
+
+var targetFormats = map[string]targetFormat{
+	"mp3":  {ext: "mp3", contentType: "audio/mpeg", args: []string{"-codec:a", "libmp3lame", "-b:a", "64k", "-f", "mp3"}},
+	"opus": {ext: "opus", contentType: "audio/ogg; codecs=opus", args: []string{"-codec:a", "libopus", "-b:a", "24k", "-f", "ogg"}},
+}
+
+// peaksSampleRate — частота, до которой декодируем запись для waveform
+const peaksSampleRate = 8000
+
+// Transcoder перекодирует записи через ffmpeg и кэширует результат на диске:
+// <CacheDir>/<uniqueid>.<mp3|opus> и <uniqueid>.peaks.<count>.json
+type Transcoder struct {
+	Index    *Index
+	FFmpeg   string // путь к ffmpeg
+	CacheDir string
+	TTL      time.Duration // файлы кэша старше TTL удаляет Run
+
+	locks [64]sync.Mutex
+}
+
+// Peaks — данные waveform для плеера: максимум |амплитуды| по корзинам, 0..1
+type Peaks struct {
+	Duration float64   `json:"duration"` // секунды
+	Peaks    []float64 `json:"peaks"`
+}
+
+// Transcode возвращает путь к файлу в кэше и его Content-Type, перекодируя при промахе
+func (t *Transcoder) Transcode(ctx context.Context, rec *Recording, format string) (string, string, error) {
+	target, ok := targetFormats[format]
+	if !ok {
+		return "", "", ErrUnsupportedFormat
+	}
+
+	path := t.cachePath(rec.UniqueID + "." + target.ext)
+	unlock := t.lock(path)
+	defer unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		return path, target.contentType, nil
+	}
+
+	// Перекодируем до конца, даже если клиент ушёл — результат пригодится следующему
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Minute)
+	defer cancel()
+
+	err := t.writeAtomic(path, func(out io.Writer) error {
+		args := append(t.inputArgs(rec), target.args...)
+		return t.run(ctx, rec, append(args, "pipe:1"), out)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	log.Printf("🎛️ Recording transcoded: %s → %s", rec.FileName(), filepath.Base(path))
+	return path, target.contentType, nil
+}
+
+// Peaks строит (или берёт из кэша) waveform из count корзин
+func (t *Transcoder) Peaks(ctx context.Context, rec *Recording, count int) (*Peaks, error) {
+	path := t.cachePath(fmt.Sprintf("%s.peaks.%d.json", rec.UniqueID, count))
+	unlock := t.lock(path)
+	defer unlock()
+
+	if data, err := os.ReadFile(path); err == nil {
+		var p Peaks
+		if json.Unmarshal(data, &p) == nil {
+			return &p, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Minute)
+	defer cancel()
+
+	// Декодируем в моно 16-bit PCM с низкой частотой — для формы волны достаточно
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		args := append(t.inputArgs(rec), "-ac", "1", "-ar", fmt.Sprint(peaksSampleRate), "-f", "s16le", "pipe:1")
+		err := t.run(ctx, rec, args, pw)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+
+	var samples []int16
+	r := bufio.NewReader(pr)
+	for {
+		var s int16
+		if err := binary.Read(r, binary.LittleEndian, &s); err != nil {
+			break
+		}
+		samples = append(samples, s)
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	p := &Peaks{
+		Duration: float64(len(samples)) / peaksSampleRate,
+		Peaks:    bucketPeaks(samples, count),
+	}
+	if data, err := json.Marshal(p); err == nil {
+		t.writeAtomic(path, func(out io.Writer) error {
+			_, err := out.Write(data)
+			return err
+		})
+	}
+	return p, nil
+}
+
+// Run раз в час удаляет файлы кэша старше TTL
+func (t *Transcoder) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.prune()
+		}
+	}
+}
+
+func (t *Transcoder) prune() {
+	entries, err := os.ReadDir(t.CacheDir)
+	if err != nil {
+		return
+	}
+	removed := 0
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || time.Since(info.ModTime()) < t.TTL {
+			continue
+		}
+		if os.Remove(filepath.Join(t.CacheDir, e.Name())) == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Printf("🧹 Recording cache: removed %d expired files", removed)
+	}
+}
+
+// Decode декодирует запись в WAV PCM 16 бит моно с частотой rate — вход для распознавания речи.
+// path — файл результата (не кэшируется: нужен один раз).
+func (t *Transcoder) Decode(ctx context.Context, rec *Recording, rate int, path string) error {
+	args := append(t.inputArgs(rec), "-ac", "1", "-ar", strconv.Itoa(rate), "-c:a", "pcm_s16le", "-y", path)
+	return t.run(ctx, rec, args, io.Discard)
+}
+
+// Evict удаляет из кэша транскоды и waveform записи (после удаления самой записи)
+func (t *Transcoder) Evict(uniqueid string) {
+	matches, _ := filepath.Glob(t.cachePath(uniqueid) + ".*")
+	for _, m := range matches {
+		os.Remove(m)
+	}
+}
+
+// inputArgs — вход ffmpeg из stdin; у GSM нет заголовка, формат указываем явно
+func (t *Transcoder) inputArgs(rec *Recording) []string {
+	args := []string{"-v", "error", "-nostdin"}
+	if rec.Format == "gsm" {
+		args = append(args, "-f", "gsm")
+	}
+	// -nostdin запрещает интерактивный ввод, но не чтение входа из pipe:0
+	return append(args, "-i", "pipe:0")
+}
+
+// run запускает ffmpeg, подавая на вход исходный файл записи
+func (t *Transcoder) run(ctx context.Context, rec *Recording, args []string, out io.Writer) error {
+	store, ok := t.Index.Store(rec.Backend)
+	if !ok {
+		return fmt.Errorf("recording %s: backend %q is not configured", rec.UniqueID, rec.Backend)
+	}
+	src, err := store.Open(ctx, rec.Location)
+	if err != nil {
+		return err
+	}
+	defer src.Body.Close()
+
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, t.FFmpeg, args...)
+	cmd.Stdin = src.Body
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg %s: %v: %s", rec.FileName(), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// writeAtomic пишет во временный файл и переименовывает — в кэше не бывает недописанных файлов
+func (t *Transcoder) writeAtomic(path string, write func(out io.Writer) error) error {
+	if err := os.MkdirAll(t.CacheDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(t.CacheDir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (t *Transcoder) cachePath(name string) string {
+	return filepath.Join(t.CacheDir, filepath.Base(cleanKey(name)))
+}
+
+// lock — полосатые мьютексы по имени файла кэша: параллельные запросы одной записи
+// ждут одну перекодировку, а карта блокировок не растёт с числом записей
+func (t *Transcoder) lock(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	l := &t.locks[h.Sum32()%uint32(len(t.locks))]
+	l.Lock()
+	return l.Unlock
+}
+
+// bucketPeaks делит сэмплы на count корзин и берёт максимум |амплитуды| в каждой
+func bucketPeaks(samples []int16, count int) []float64 {
+	peaks := make([]float64, count)
+	if len(samples) == 0 {
+		return peaks
+	}
+	for i := 0; i < count; i++ {
+		from := i * len(samples) / count
+		to := (i + 1) * len(samples) / count
+		var max int32
+		for _, s := range samples[from:to] {
+			v := int32(s)
+			if v < 0 {
+				v = -v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		peaks[i] = float64(max) / 32768
+	}
+	return peaks
+}
@@ -0,0 +1,27 @@
+package transcription
+
+import "context"
+
+// SampleRate — частота WAV, который получает Transcriber (стандарт для whisper)
+const SampleRate = 16000
+
+// Segment — фраза расшифровки с таймкодами от начала записи
+type Segment struct {
+	Speaker string  `json:"speaker,omitempty"` // "" — не определён
+	Start   float64 `json:"start"`             // секунды
+	End     float64 `json:"end"`
+	Text    string  `json:"text"`
+}
+
+// Result — расшифровка одной записи
+type Result struct {
+	Language string
+	Segments []Segment
+}
+
+// Transcriber — движок распознавания речи. wavPath — WAV PCM 16 бит моно SampleRate Гц.
+type Transcriber interface {
+	// Name — имя движка для transcripts.engine
+	Name() string
+	Transcribe(ctx context.Context, wavPath string) (*Result, error)
+}
@@ -0,0 +1,101 @@
+package transcription
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WhisperCLI — локальный whisper.cpp (whisper-cli) на CPU.
+// Модель скачивается отдельно: models/download-ggml-model.sh small
+type WhisperCLI struct {
+	Binary   string // путь к whisper-cli
+	Model    string // ggml-модель, например /opt/whisper/ggml-small.bin
+	Language string // ru / en / auto
+	Threads  int
+	// Diarize — смена говорящего через tinydiarize (-tdrz, нужна модель *.tdrz).
+	// Говорящие помечаются "A"/"B" по очереди: моно-запись не говорит, кто из них агент.
+	Diarize bool
+}
+
+func (w *WhisperCLI) Name() string { return "whisper.cpp" }
+
+// whisperOutput — формат -oj (output-json) whisper.cpp
+type whisperOutput struct {
+	Result struct {
+		Language string `json:"language"`
+	} `json:"result"`
+	Transcription []struct {
+		Offsets struct {
+			From int64 `json:"from"` // мс
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text            string `json:"text"`
+		SpeakerTurnNext bool   `json:"speaker_turn_next"`
+	} `json:"transcription"`
+}
+
+func (w *WhisperCLI) Transcribe(ctx context.Context, wavPath string) (*Result, error) {
+	outBase := strings.TrimSuffix(wavPath, filepath.Ext(wavPath))
+	defer os.Remove(outBase + ".json")
+
+	lang := w.Language
+	if lang == "" {
+		lang = "auto"
+	}
+	args := []string{"-m", w.Model, "-f", wavPath, "-l", lang, "-oj", "-of", outBase, "-np"}
+	if w.Threads > 0 {
+		args = append(args, "-t", strconv.Itoa(w.Threads))
+	}
+	if w.Diarize {
+		args = append(args, "-tdrz")
+	}
+
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, w.Binary, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("whisper: %v: %s", err, lastLine(stderr.String()))
+	}
+
+	data, err := os.ReadFile(outBase + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("whisper: %w", err)
+	}
+	var out whisperOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("whisper: invalid json: %w", err)
+	}
+
+	res := &Result{Language: out.Result.Language}
+	speaker := ""
+	if w.Diarize {
+		speaker = "A"
+	}
+	for _, t := range out.Transcription {
+		text := strings.TrimSpace(t.Text)
+		if text != "" {
+			res.Segments = append(res.Segments, Segment{
+				Speaker: speaker,
+				Start:   float64(t.Offsets.From) / 1000,
+				End:     float64(t.Offsets.To) / 1000,
+				Text:    text,
+			})
+		}
+		if w.Diarize && t.SpeakerTurnNext {
+			speaker = map[string]string{"A": "B", "B": "A"}[speaker]
+		}
+	}
+	return res, nil
+}
+
+// lastLine — последняя непустая строка stderr (whisper.cpp пишет туда много служебного)
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
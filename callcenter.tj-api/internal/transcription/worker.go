@@ -0,0 +1,203 @@
+package transcription
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"callcentrix/internal/recordings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Worker ставит в очередь новые разговоры и по одному распознаёт их записи.
+// Работает только на лидере: распознавание тяжёлое, второй инстанс его не ускорит.
+type Worker struct {
+	DB          *pgxpool.Pool
+	Recordings  *recordings.Index
+	Decoder     *recordings.Transcoder // ffmpeg: запись → WAV для Transcriber
+	Transcriber Transcriber
+	TempDir     string
+	MinSeconds  int // разговоры короче не распознаём
+	MaxAttempts int
+}
+
+// Enqueue ставит звонок в очередь (или повторно — после ошибки или смены модели)
+func Enqueue(ctx context.Context, db *pgxpool.Pool, uniqueid string, tenantID int) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO transcription_jobs (uniqueid, tenant_id) VALUES ($1, $2)
+		ON CONFLICT (uniqueid) DO UPDATE SET
+			status = 'queued', attempts = 0, error = NULL, created_at = NOW()
+		WHERE transcription_jobs.status <> 'running'`,
+		uniqueid, tenantID)
+	return err
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	// Задания, прерванные сменой лидера или рестартом
+	if _, err := w.DB.Exec(ctx, `UPDATE transcription_jobs SET status='queued' WHERE status='running'`); err != nil {
+		log.Printf("❌ Transcription requeue: %v", err)
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := w.enqueueNew(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("❌ Transcription enqueue: %v", err)
+		}
+		for ctx.Err() == nil && w.runNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enqueueNew — разговоры за последние сутки, завершившиеся больше минуты назад
+// (MixMonitor успел дописать файл). Тенант — ast_cdr.tenant_id, как в CDR.
+func (w *Worker) enqueueNew(ctx context.Context) error {
+	tag, err := w.DB.Exec(ctx, `
+		INSERT INTO transcription_jobs (uniqueid, tenant_id)
+		SELECT DISTINCT ON (c.uniqueid) c.uniqueid, c.tenant_id
+		FROM ast_cdr c
+		WHERE c.tenant_id IS NOT NULL AND c.billsec >= $1
+		AND c.calldate AT TIME ZONE 'UTC' > NOW() - INTERVAL '1 day'
+		AND c.calldate AT TIME ZONE 'UTC' + make_interval(secs => c.duration) < NOW() - INTERVAL '1 minute'
+		ORDER BY c.uniqueid
+		ON CONFLICT (uniqueid) DO NOTHING`,
+		w.MinSeconds)
+	if err == nil && tag.RowsAffected() > 0 {
+		log.Printf("📝 Transcription: %d calls queued", tag.RowsAffected())
+	}
+	return err
+}
+
+// runNext распознаёт следующее задание; false — очередь пуста
+func (w *Worker) runNext(ctx context.Context) bool {
+	var uniqueid string
+	var tenantID int
+	err := w.DB.QueryRow(ctx, `
+		UPDATE transcription_jobs SET status='running', attempts=attempts+1, started_at=NOW()
+		WHERE uniqueid = (
+			SELECT uniqueid FROM transcription_jobs WHERE status='queued'
+			ORDER BY attempts, created_at LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING uniqueid, tenant_id`,
+	).Scan(&uniqueid, &tenantID)
+	if err != nil {
+		return false
+	}
+
+	start := time.Now()
+	err = w.transcribe(ctx, uniqueid, tenantID)
+	switch {
+	case ctx.Err() != nil:
+		// лидерство потеряно — задание вернётся в очередь
+	case errors.Is(err, recordings.ErrNotFound):
+		w.finish(ctx, uniqueid, "skipped", "recording not found")
+	case err != nil:
+		log.Printf("❌ Transcription %s: %v", uniqueid, err)
+		w.DB.Exec(ctx, `
+			UPDATE transcription_jobs
+			SET status = CASE WHEN attempts >= $2 THEN 'failed' ELSE 'queued' END, error = $3, finished_at = NOW()
+			WHERE uniqueid = $1`, uniqueid, w.maxAttempts(), err.Error())
+	default:
+		w.finish(ctx, uniqueid, "done", "")
+		log.Printf("📝 Transcribed %s (%s)", uniqueid, time.Since(start).Round(time.Second))
+	}
+	return true
+}
+
+func (w *Worker) transcribe(ctx context.Context, uniqueid string, tenantID int) error {
+	rec, err := w.Recordings.Lookup(ctx, uniqueid, tenantID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+	defer cancel()
+
+	if err := os.MkdirAll(w.TempDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(w.TempDir, "stt-*.wav")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := w.Decoder.Decode(ctx, rec, SampleRate, tmp.Name()); err != nil {
+		return err
+	}
+	res, err := w.Transcriber.Transcribe(ctx, tmp.Name())
+	if err != nil {
+		return err
+	}
+	return w.save(ctx, uniqueid, tenantID, res)
+}
+
+// save заменяет расшифровку звонка целиком
+func (w *Worker) save(ctx context.Context, uniqueid string, tenantID int, res *Result) error {
+	texts := make([]string, 0, len(res.Segments))
+	for _, s := range res.Segments {
+		texts = append(texts, s.Text)
+	}
+
+	tx, err := w.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO transcripts (uniqueid, tenant_id, engine, language, text)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (uniqueid) DO UPDATE SET
+			engine = EXCLUDED.engine, language = EXCLUDED.language,
+			text = EXCLUDED.text, created_at = NOW()`,
+		uniqueid, tenantID, w.Transcriber.Name(), res.Language, strings.Join(texts, " "))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM transcript_segments WHERE uniqueid = $1`, uniqueid); err != nil {
+		return err
+	}
+
+	rows := make([][]any, len(res.Segments))
+	for i, s := range res.Segments {
+		var speaker *string
+		if s.Speaker != "" {
+			speaker = &s.Speaker
+		}
+		rows[i] = []any{uniqueid, i, speaker, s.Start, s.End, s.Text}
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"transcript_segments"},
+		[]string{"uniqueid", "seq", "speaker", "start_sec", "end_sec", "text"},
+		pgx.CopyFromRows(rows))
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (w *Worker) finish(ctx context.Context, uniqueid, status, errText string) {
+	w.DB.Exec(ctx, `
+		UPDATE transcription_jobs SET status = $2, error = NULLIF($3, ''), finished_at = NOW()
+		WHERE uniqueid = $1`, uniqueid, status, errText)
+}
+
+func (w *Worker) maxAttempts() int {
+	if w.MaxAttempts > 0 {
+		return w.MaxAttempts
+	}
+	return 3
+}
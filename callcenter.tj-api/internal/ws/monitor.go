@@ -3,10 +3,12 @@ package ws
 import (
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"callcentrix/internal/auth"
 	"callcentrix/internal/config"
+	"callcentrix/internal/metrics"
 	"callcentrix/internal/monitor"
 
 	"github.com/gorilla/websocket"
@@ -23,10 +25,24 @@ type snapshot struct {
 	Queues map[string]monitor.QueueStats `json:"queues"`
 }
 
+// presenceMessage — состояния extension для BLF: при подключении все, дальше только изменения
+type presenceMessage struct {
+	Type    string             `json:"type"` // "presence"
+	Entries []monitor.Presence `json:"entries"`
+}
+
+// callbacksMessage — бейдж списка перезвонов: при подключении и при изменении счётчиков
+type callbacksMessage struct {
+	Type string `json:"type"` // "callbacks"
+	monitor.CallbackCounts
+}
+
 func Monitor(
 	agentStore *monitor.Store,
 	callStore *monitor.CallStore,
 	queueStore *monitor.QueueStore,
+	presenceStore *monitor.PresenceStore,
+	callbackBadge *monitor.CallbackBadge,
 	cfg *config.Config,
 ) http.HandlerFunc {
 
@@ -54,12 +70,16 @@ func Monitor(
 
 		log.Printf("🟢 WS connected | tenant=%d", tenantID)
 
+		clients := metrics.WSClients.WithLabelValues(strconv.Itoa(tenantID))
+		clients.Inc()
+		defer clients.Dec()
+
 		writeSnapshot := func() error {
 			agents := agentStore.GetAgents(tenantID)
 			calls := callStore.GetCalls(tenantID)
 			queues := queueStore.Snapshot(tenantID)
 			
-			// 🧹 ОЧИСТКА: Удаляем агентов с несуществующими звонками
+			// 🧹 ОЧИСТКА: в снапшоте агенты с несуществующими звонками — idle
 			cleanedAgents := make(map[string]monitor.AgentState)
 			for name, agent := range agents {
 				// Если у агента есть callId, проверяем существует ли звонок
@@ -75,8 +95,8 @@ func Monitor(
 						cleanedAgent.CallID = ""
 						cleanedAgents[name] = cleanedAgent
 						
-						// Обновляем в Store
-						agentStore.UpdateAgent(tenantID, cleanedAgent)
+						// Store не трогаем: снапшот только читает (на follower store
+						// реплицируется), сброс агента — на лидере по Hangup
 						continue
 					}
 				}
@@ -108,6 +128,23 @@ func Monitor(
 		if err := writeSnapshot(); err != nil {
 			return
 		}
+
+		// 💡 presence всех extension тенанта (BLF)
+		entries := make([]monitor.Presence, 0)
+		for _, p := range presenceStore.Get(tenantID) {
+			entries = append(entries, p)
+		}
+		if err := conn.WriteJSON(presenceMessage{Type: "presence", Entries: entries}); err != nil {
+			return
+		}
+
+		// 📞 бейдж перезвонов
+		writeCallbacks := func() error {
+			return conn.WriteJSON(callbacksMessage{Type: "callbacks", CallbackCounts: callbackBadge.Get(tenantID)})
+		}
+		if err := writeCallbacks(); err != nil {
+			return
+		}
 		
 		// 🔔 subscriptions
 		agentCh := make(chan monitor.AgentEvent, 16)
@@ -123,6 +160,14 @@ func Monitor(
 		callStore.Subscribe(tenantID, callCh)
 		defer callStore.Unsubscribe(tenantID, callCh)
 
+		presenceCh := make(chan monitor.PresenceEvent, 64)
+		presenceStore.Subscribe(tenantID, presenceCh)
+		defer presenceStore.Unsubscribe(tenantID, presenceCh)
+
+		callbackCh := make(chan struct{}, 4)
+		callbackBadge.Subscribe(tenantID, callbackCh)
+		defer callbackBadge.Unsubscribe(tenantID, callbackCh)
+
 		heartbeat := time.NewTicker(25 * time.Second)
 		defer heartbeat.Stop()
 
@@ -145,6 +190,17 @@ func Monitor(
 					return
 				}
 
+			case ev := <-presenceCh:
+				msg := presenceMessage{Type: "presence", Entries: []monitor.Presence{ev.Presence}}
+				if err := conn.WriteJSON(msg); err != nil {
+					return
+				}
+
+			case <-callbackCh:
+				if err := writeCallbacks(); err != nil {
+					return
+				}
+
 			case <-heartbeat.C:
 				if err := conn.WriteControl(
 					websocket.PingMessage,
@@ -0,0 +1,216 @@
+// Package xlsx — потоковая запись одного листа XLSX без внешних зависимостей.
+// Строки пишутся сразу в zip (inline-строки, без sharedStrings), поэтому
+// размер выгрузки не ограничен памятью.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxRows — предел строк листа в Excel
+const MaxRows = 1048576
+
+// ErrTooManyRows — лист заполнен, дальнейшие строки Excel не откроет
+var ErrTooManyRows = errors.New("xlsx: too many rows")
+
+// Writer пишет книгу с одним листом. Ячейки: string, int, int64, float64,
+// bool, time.Time (дата-время в поясе значения) и указатели на них; nil — пустая ячейка.
+type Writer struct {
+	zw   *zip.Writer
+	buf  *bufio.Writer
+	rows int
+}
+
+// NewWriter начинает книгу в w; sheet — имя листа (до 31 символа)
+func NewWriter(w io.Writer, sheet string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, escape(sheetName(sheet)))},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/styles.xml", styles},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(f, 64*1024)
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return &Writer{zw: zw, buf: buf}, nil
+}
+
+// WriteRow добавляет строку листа
+func (w *Writer) WriteRow(cells ...any) error {
+	if w.rows >= MaxRows {
+		return ErrTooManyRows
+	}
+	w.rows++
+	row := strconv.Itoa(w.rows)
+	w.buf.WriteString(`<row r="` + row + `">`)
+	for i, v := range cells {
+		ref := column(i) + row
+		switch v := deref(v).(type) {
+		case nil:
+		case string:
+			if v == "" {
+				continue
+			}
+			w.buf.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			w.buf.WriteString(escape(v))
+			w.buf.WriteString(`</t></is></c>`)
+		case int:
+			w.number(ref, "", strconv.Itoa(v))
+		case int64:
+			w.number(ref, "", strconv.FormatInt(v, 10))
+		case float64:
+			w.number(ref, "", strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			b := "0"
+			if v {
+				b = "1"
+			}
+			w.buf.WriteString(`<c r="` + ref + `" t="b"><v>` + b + `</v></c>`)
+		case time.Time:
+			w.number(ref, ` s="1"`, strconv.FormatFloat(serial(v), 'f', -1, 64))
+		default:
+			return fmt.Errorf("xlsx: unsupported cell type %T", v)
+		}
+	}
+	_, err := w.buf.WriteString(`</row>`)
+	return err
+}
+
+// Close завершает лист и архив; закрывать нужно и после ошибки записи
+func (w *Writer) Close() error {
+	w.buf.WriteString(`</sheetData></worksheet>`)
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+func (w *Writer) number(ref, style, v string) {
+	w.buf.WriteString(`<c r="` + ref + `"` + style + `><v>` + v + `</v></c>`)
+}
+
+func deref(v any) any {
+	switch p := v.(type) {
+	case *string:
+		if p == nil {
+			return nil
+		}
+		return *p
+	case *int:
+		if p == nil {
+			return nil
+		}
+		return *p
+	case *int64:
+		if p == nil {
+			return nil
+		}
+		return *p
+	case *float64:
+		if p == nil {
+			return nil
+		}
+		return *p
+	case *time.Time:
+		if p == nil {
+			return nil
+		}
+		return *p
+	}
+	return v
+}
+
+// column — буквенное имя колонки: 0 → A, 26 → AA
+func column(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+// serial — дата Excel: дни от 1899-12-30, дробная часть — время суток.
+// Пояса в Excel нет — пишется локальное время t.
+func serial(t time.Time) float64 {
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return float64(t.Sub(epoch)/time.Second) / 86400
+}
+
+// sheetName — Excel запрещает в имени листа []:*?/\ и длину больше 31
+func sheetName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		s = "Sheet1"
+	}
+	if r := []rune(s); len(r) > 31 {
+		s = string(r[:31])
+	}
+	return s
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// styles: xf 0 — обычная ячейка, xf 1 — дата-время yyyy-mm-dd hh:mm:ss
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`